@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"compiler/token"
 	"fmt"
+	"sort"
 )
 
 type Node interface {
@@ -23,6 +24,9 @@ type Expression interface {
 
 type Program struct {
 	Statements []Statement
+
+	// Comments holds every comment of the source in order of appearance.
+	Comments []*Comment
 }
 
 func (p *Program) TokenLiteral() string {
@@ -41,9 +45,24 @@ func (p *Program) String() string {
 	return out.String()
 }
 
+type Comment struct {
+	Token token.Token
+	// Trailing is set when the comment follows other code on the same line.
+	Trailing bool
+}
+
+func (comment *Comment) TokenLiteral() string {
+	return comment.Token.Literal
+}
+func (comment *Comment) String() string {
+	return comment.Token.Literal
+}
+
 type LetStatement struct {
 	Token token.Token
 	Name  *Identifier
+	// Type is the annotated type of the binding or nil.
+	Type  Type
 	Value Expression
 }
 
@@ -55,7 +74,10 @@ func (lst *LetStatement) String() string {
 	var out bytes.Buffer
 
 	out.WriteString("let ")
-	out.WriteString(lst.TokenLiteral())
+	out.WriteString(lst.Name.String())
+	if lst.Type != nil {
+		out.WriteString(": " + lst.Type.String())
+	}
 	out.WriteString(" = ")
 	out.WriteString(lst.Value.String())
 
@@ -64,6 +86,73 @@ func (lst *LetStatement) String() string {
 	return out.String()
 }
 
+// ConstStatement binds a name that cannot be assigned to again in the
+// same scope, e.g. const limit = 10;
+type ConstStatement struct {
+	Token token.Token
+	Name  *Identifier
+	Type  Type
+	Value Expression
+}
+
+func (cst *ConstStatement) TokenLiteral() string {
+	return cst.Token.Literal
+}
+func (cst *ConstStatement) statementNode() {}
+func (cst *ConstStatement) String() string {
+	if cst.Type != nil {
+		return "const " + cst.Name.String() + ": " + cst.Type.String() + " = " + cst.Value.String() + ";"
+	}
+	return "const " + cst.Name.String() + " = " + cst.Value.String() + ";"
+}
+
+// InfixDeclaration declares an infix operator and binds the function it
+// calls, e.g. infixl 6 <+> = fn(a, b) { a + b };
+type InfixDeclaration struct {
+	Token      token.Token // the infixl or infixr token
+	Precedence int
+	Operator   token.Token
+	Value      Expression
+}
+
+func (decl *InfixDeclaration) TokenLiteral() string {
+	return decl.Token.Literal
+}
+func (decl *InfixDeclaration) statementNode() {}
+func (decl *InfixDeclaration) String() string {
+	return fmt.Sprintf("%s %d %s = %s;", decl.Token.Literal, decl.Precedence, decl.Operator.Literal, decl.Value.String())
+}
+
+// RightAssociative reports whether the operator was declared by infixr.
+func (decl *InfixDeclaration) RightAssociative() bool {
+	return decl.Token.Type == token.INFIXR
+}
+
+// DestructuringLetStatement binds the names of an array or map pattern,
+// e.g. let [a, ...rest] = xs; or let {name, age} = person;
+type DestructuringLetStatement struct {
+	Token   token.Token
+	Pattern Pattern
+	Value   Expression
+}
+
+func (dst *DestructuringLetStatement) TokenLiteral() string {
+	return dst.Token.Literal
+}
+func (dst *DestructuringLetStatement) statementNode() {}
+func (dst *DestructuringLetStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("let ")
+	out.WriteString(dst.Pattern.String())
+	out.WriteString(" = ")
+	out.WriteString(dst.Value.String())
+
+	out.WriteString(";")
+
+	return out.String()
+}
+
 type Identifier struct {
 	Token token.Token
 	Value string
@@ -89,8 +178,10 @@ func (returnStmt *ReturnStatement) statementNode() {}
 func (returnStmt *ReturnStatement) String() string {
 	var out bytes.Buffer
 
-	out.WriteString(returnStmt.TokenLiteral() + " ")
-	out.WriteString(returnStmt.ReturnValue.String())
+	out.WriteString(returnStmt.TokenLiteral())
+	if returnStmt.ReturnValue != nil {
+		out.WriteString(" " + returnStmt.ReturnValue.String())
+	}
 
 	out.WriteString(";")
 
@@ -152,6 +243,36 @@ func (str *StringLiteral) String() string {
 	return str.TokenLiteral()
 }
 
+// InterpolatedString is a string like "a${b}c" with embedded expressions.
+// The text before, between and after the expressions is kept in Texts,
+// which has one more element than Expressions.
+type InterpolatedString struct {
+	Token       token.Token
+	Texts       []*StringLiteral
+	Expressions []Expression
+}
+
+func (is *InterpolatedString) TokenLiteral() string {
+	return is.Token.Literal
+}
+func (is *InterpolatedString) expressionNode() {}
+func (is *InterpolatedString) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(`"`)
+	for i, text := range is.Texts {
+		out.WriteString(text.Value)
+		if i < len(is.Expressions) {
+			out.WriteString("${")
+			out.WriteString(is.Expressions[i].String())
+			out.WriteString("}")
+		}
+	}
+	out.WriteString(`"`)
+
+	return out.String()
+}
+
 type PrefixExpression struct {
 	Token    token.Token
 	Operator token.TokenType
@@ -200,6 +321,13 @@ func (infixExpr *InfixExpression) String() string {
 	return out.String()
 }
 
+// Call returns the call a declared operator stands for: a <+> b calls the
+// function bound to <+> with a and b.
+func (infixExpr *InfixExpression) Call() *CallExpression {
+	operator := &Identifier{Token: infixExpr.Token, Value: string(infixExpr.Operator)}
+	return &CallExpression{Token: infixExpr.Token, Left: operator, Arguments: []Expression{infixExpr.Left, infixExpr.Right}}
+}
+
 type IfExpression struct {
 	Token       token.Token
 	Condition   Expression
@@ -231,6 +359,7 @@ func (ifExpression *IfExpression) String() string {
 type BlockStatement struct {
 	Token      token.Token
 	Statements []Statement
+	Rbrace     token.Token
 }
 
 func (bstmt *BlockStatement) TokenLiteral() string {
@@ -250,13 +379,41 @@ func (bstmt *BlockStatement) String() string {
 
 }
 
+// FunctionLiteral describes fn(a, b = 1, ...rest) { ... }. Defaults is
+// either empty or holds the default value of every parameter, nil for
+// parameters without one. Rest collects the remaining arguments. Types
+// works like Defaults for the annotated parameter types, e.g. in
+// fn(a: int, b): bool { ... }. RestType annotates the array Rest is bound
+// to, as in fn(...rest: [int]), and like ReturnType is nil unless
+// annotated.
 type FunctionLiteral struct {
 	Token      token.Token
 	Parameters []*Identifier
+	Defaults   []Expression
+	Types      []Type
+	Rest       *Identifier
+	RestType   Type
+	ReturnType Type
 	Body       *BlockStatement
 	Name       string
 }
 
+// Default returns the default value of the i-th parameter or nil.
+func (fn *FunctionLiteral) Default(i int) Expression {
+	if i >= len(fn.Defaults) {
+		return nil
+	}
+	return fn.Defaults[i]
+}
+
+// ParameterType returns the annotated type of the i-th parameter or nil.
+func (fn *FunctionLiteral) ParameterType(i int) Type {
+	if i >= len(fn.Types) {
+		return nil
+	}
+	return fn.Types[i]
+}
+
 func (fn *FunctionLiteral) TokenLiteral() string {
 	return fn.Token.Literal
 }
@@ -269,20 +426,127 @@ func (fn *FunctionLiteral) String() string {
 	}
 
 	out.WriteString("fn(")
-	for _, s := range fn.Parameters {
+	for i, s := range fn.Parameters {
+		if i != 0 {
+			out.WriteString(", ")
+		}
 		out.WriteString(s.String())
+		if typ := fn.ParameterType(i); typ != nil {
+			out.WriteString(": " + typ.String())
+		}
+		if def := fn.Default(i); def != nil {
+			out.WriteString(" = ")
+			out.WriteString(def.String())
+		}
+	}
+	if fn.Rest != nil {
+		if len(fn.Parameters) != 0 {
+			out.WriteString(", ")
+		}
+		out.WriteString("..." + fn.Rest.String())
+		if fn.RestType != nil {
+			out.WriteString(": " + fn.RestType.String())
+		}
 	}
 	out.WriteString(")")
+	if fn.ReturnType != nil {
+		out.WriteString(": " + fn.ReturnType.String())
+	}
 
 	out.WriteString(fn.Body.String())
 
 	return out.String()
 }
 
+// MacroLiteral defines a macro, e.g. macro(a, b) { quote(unquote(b) - unquote(a)) }.
+// Macros receive their arguments unevaluated and return the quoted
+// expression that replaces their call.
+type MacroLiteral struct {
+	Token      token.Token
+	Parameters []*Identifier
+	Body       *BlockStatement
+}
+
+func (macro *MacroLiteral) TokenLiteral() string {
+	return macro.Token.Literal
+}
+func (macro *MacroLiteral) expressionNode() {}
+func (macro *MacroLiteral) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("macro(")
+	for i, s := range macro.Parameters {
+		if i != 0 {
+			out.WriteString(", ")
+		}
+		out.WriteString(s.String())
+	}
+	out.WriteString(")")
+
+	out.WriteString(macro.Body.String())
+
+	return out.String()
+}
+
+// LambdaLiteral is the short form x => body of fn(x) { body }. Like for
+// function literals, Name is the name of the let or const it is bound to.
+type LambdaLiteral struct {
+	Token     token.Token
+	Parameter *Identifier
+	Body      Expression
+	Name      string
+}
+
+func (lambda *LambdaLiteral) TokenLiteral() string {
+	return lambda.Token.Literal
+}
+func (lambda *LambdaLiteral) expressionNode() {}
+func (lambda *LambdaLiteral) String() string {
+	return lambda.Parameter.String() + " => " + lambda.Body.String()
+}
+
+// Function returns the function literal the lambda stands for.
+func (lambda *LambdaLiteral) Function() *FunctionLiteral {
+	body := &BlockStatement{
+		Token:      lambda.Token,
+		Statements: []Statement{&ExpressionStatement{Token: lambda.Token, Expression: lambda.Body}},
+	}
+	return &FunctionLiteral{Token: lambda.Token, Parameters: []*Identifier{lambda.Parameter}, Body: body, Name: lambda.Name}
+}
+
+// PipeExpression passes its left value as the first argument of the call
+// on its right, e.g. xs |> map(f) is map(xs, f).
+type PipeExpression struct {
+	Token token.Token
+	Left  Expression
+	Right Expression
+}
+
+func (pipe *PipeExpression) TokenLiteral() string {
+	return pipe.Token.Literal
+}
+func (pipe *PipeExpression) expressionNode() {}
+func (pipe *PipeExpression) String() string {
+	return "(" + pipe.Left.String() + " |> " + pipe.Right.String() + ")"
+}
+
+// Call returns the call the pipe stands for. If the right side is not a
+// call, like in x |> f, it is called with the left value only.
+func (pipe *PipeExpression) Call() *CallExpression {
+	call, ok := pipe.Right.(*CallExpression)
+	if !ok {
+		return &CallExpression{Token: pipe.Token, Left: pipe.Right, Arguments: []Expression{pipe.Left}}
+	}
+
+	args := append([]Expression{pipe.Left}, call.Arguments...)
+	return &CallExpression{Token: call.Token, Left: call.Left, Arguments: args, Rparen: call.Rparen}
+}
+
 type CallExpression struct {
 	Token     token.Token
 	Left      Expression
 	Arguments []Expression
+	Rparen    token.Token
 }
 
 func (call *CallExpression) TokenLiteral() string {
@@ -305,9 +569,24 @@ func (call *CallExpression) String() string {
 	return out.String()
 }
 
+// SpreadExpression passes the elements of an array as separate arguments.
+type SpreadExpression struct {
+	Token token.Token
+	Value Expression
+}
+
+func (spread *SpreadExpression) TokenLiteral() string {
+	return spread.Token.Literal
+}
+func (spread *SpreadExpression) expressionNode() {}
+func (spread *SpreadExpression) String() string {
+	return "..." + spread.Value.String()
+}
+
 type ArrayLiteral struct {
 	Token    token.Token
 	Elements []Expression
+	Rbracket token.Token
 }
 
 func (arr *ArrayLiteral) TokenLiteral() string {
@@ -326,13 +605,18 @@ func (arr *ArrayLiteral) String() string {
 		out.WriteString(e.String())
 	}
 
+	out.WriteString("]")
+
 	return out.String()
 }
 
+// IndexExpression describes left[index] or, if Optional, left?.[index]
+// which is null if left is null.
 type IndexExpression struct {
-	Token token.Token
-	Left  Expression
-	Index Expression
+	Token    token.Token
+	Left     Expression
+	Index    Expression
+	Optional bool
 }
 
 func (ind *IndexExpression) TokenLiteral() string {
@@ -343,6 +627,9 @@ func (ind *IndexExpression) String() string {
 	var out bytes.Buffer
 
 	out.WriteString(ind.Left.String())
+	if ind.Optional {
+		out.WriteString("?.")
+	}
 	out.WriteString("[")
 	out.WriteString(ind.Index.String())
 	out.WriteString("]")
@@ -350,9 +637,51 @@ func (ind *IndexExpression) String() string {
 	return out.String()
 }
 
+// PropertyExpression reads the entry of a map whose key is the name of the
+// property, e.g. person.name. The optional form person?.name is null if
+// person is null or has no such key.
+type PropertyExpression struct {
+	Token    token.Token
+	Left     Expression
+	Property *Identifier
+	Optional bool
+}
+
+func (prop *PropertyExpression) TokenLiteral() string {
+	return prop.Token.Literal
+}
+func (prop *PropertyExpression) expressionNode() {}
+func (prop *PropertyExpression) String() string {
+	if prop.Optional {
+		return prop.Left.String() + "?." + prop.Property.String()
+	}
+	return prop.Left.String() + "." + prop.Property.String()
+}
+
 type MapLiteral struct {
 	Token   token.Token
 	Entries map[Expression]Expression
+	// Keys lists the keys of Entries in source order.
+	Keys   []Expression
+	Rbrace token.Token
+}
+
+// OrderedKeys returns a copy of the keys in source order. Maps built without
+// Keys fall back to the keys sorted by their String, so the order is the
+// same every time.
+func (mapExpr *MapLiteral) OrderedKeys() []Expression {
+	if len(mapExpr.Keys) == len(mapExpr.Entries) {
+		return append([]Expression{}, mapExpr.Keys...)
+	}
+
+	keys := make([]Expression, 0, len(mapExpr.Entries))
+	for key := range mapExpr.Entries {
+		keys = append(keys, key)
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		return keys[i].String() < keys[j].String()
+	})
+	return keys
 }
 
 func (mapExpr *MapLiteral) TokenLiteral() string {
@@ -362,15 +691,270 @@ func (mapExpr *MapLiteral) expressionNode() {}
 func (mapExpr *MapLiteral) String() string {
 	var out bytes.Buffer
 
-	out.WriteString(mapExpr.TokenLiteral())
 	out.WriteString("{ ")
-	for key, value := range mapExpr.Entries {
+	for _, key := range mapExpr.OrderedKeys() {
 		out.WriteString(key.String())
 		out.WriteString(": ")
-		out.WriteString(value.String())
+		out.WriteString(mapExpr.Entries[key].String())
 		out.WriteString(" ")
 	}
 	out.WriteString("}")
 
 	return out.String()
 }
+
+type Pattern interface {
+	Node
+	patternNode()
+}
+
+type MatchExpression struct {
+	Token   token.Token
+	Subject Expression
+	Arms    []*MatchArm
+	Rbrace  token.Token
+}
+
+func (match *MatchExpression) TokenLiteral() string {
+	return match.Token.Literal
+}
+func (match *MatchExpression) expressionNode() {}
+func (match *MatchExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("match (")
+	out.WriteString(match.Subject.String())
+	out.WriteString(") { ")
+	for i, arm := range match.Arms {
+		if i != 0 {
+			out.WriteString(", ")
+		}
+		out.WriteString(arm.String())
+	}
+	out.WriteString(" }")
+
+	return out.String()
+}
+
+type MatchArm struct {
+	Token   token.Token
+	Pattern Pattern
+	Guard   Expression
+	Body    Expression
+}
+
+func (arm *MatchArm) TokenLiteral() string {
+	return arm.Token.Literal
+}
+func (arm *MatchArm) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(arm.Pattern.String())
+	if arm.Guard != nil {
+		out.WriteString(" if ")
+		out.WriteString(arm.Guard.String())
+	}
+	out.WriteString(" => ")
+	out.WriteString(arm.Body.String())
+
+	return out.String()
+}
+
+type NullLiteral struct {
+	Token token.Token
+}
+
+func (null *NullLiteral) TokenLiteral() string {
+	return null.Token.Literal
+}
+func (null *NullLiteral) expressionNode() {}
+func (null *NullLiteral) String() string {
+	return "null"
+}
+
+type WildcardPattern struct {
+	Token token.Token
+}
+
+func (wildcard *WildcardPattern) TokenLiteral() string {
+	return wildcard.Token.Literal
+}
+func (wildcard *WildcardPattern) patternNode() {}
+func (wildcard *WildcardPattern) String() string {
+	return "_"
+}
+
+// LiteralPattern matches values equal to an integer, string or boolean
+// literal. Negative integers are represented as prefix expressions.
+type LiteralPattern struct {
+	Token token.Token
+	Value Expression
+}
+
+func (literal *LiteralPattern) TokenLiteral() string {
+	return literal.Token.Literal
+}
+func (literal *LiteralPattern) patternNode() {}
+func (literal *LiteralPattern) String() string {
+	return literal.Value.String()
+}
+
+type BindingPattern struct {
+	Token token.Token
+	Name  *Identifier
+}
+
+func (binding *BindingPattern) TokenLiteral() string {
+	return binding.Token.Literal
+}
+func (binding *BindingPattern) patternNode() {}
+func (binding *BindingPattern) String() string {
+	return binding.Name.String()
+}
+
+// ArrayPattern matches arrays element by element. Without Rest the array
+// must have exactly as many elements as the pattern, otherwise Rest is bound
+// to the remaining elements.
+type ArrayPattern struct {
+	Token    token.Token
+	Elements []Pattern
+	Rest     *Identifier
+	Rbracket token.Token
+}
+
+func (arr *ArrayPattern) TokenLiteral() string {
+	return arr.Token.Literal
+}
+func (arr *ArrayPattern) patternNode() {}
+func (arr *ArrayPattern) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("[")
+	for i, e := range arr.Elements {
+		if i != 0 {
+			out.WriteString(", ")
+		}
+		out.WriteString(e.String())
+	}
+	if arr.Rest != nil {
+		if len(arr.Elements) != 0 {
+			out.WriteString(", ")
+		}
+		out.WriteString("..." + arr.Rest.String())
+	}
+	out.WriteString("]")
+
+	return out.String()
+}
+
+type MapPatternEntry struct {
+	Key   Expression
+	Value Pattern
+}
+
+// MapPattern matches maps containing all of its keys with values matching
+// the corresponding patterns. Other keys are ignored.
+type MapPattern struct {
+	Token   token.Token
+	Entries []*MapPatternEntry
+	Rbrace  token.Token
+}
+
+func (mapPattern *MapPattern) TokenLiteral() string {
+	return mapPattern.Token.Literal
+}
+func (mapPattern *MapPattern) patternNode() {}
+func (mapPattern *MapPattern) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("{")
+	for i, entry := range mapPattern.Entries {
+		if i != 0 {
+			out.WriteString(", ")
+		}
+		out.WriteString(entry.Key.String())
+		out.WriteString(": ")
+		out.WriteString(entry.Value.String())
+	}
+	out.WriteString("}")
+
+	return out.String()
+}
+
+// Type is a type annotation like int, [string], {string: int} or
+// fn(int, bool): string.
+type Type interface {
+	Node
+	typeNode()
+}
+
+// NamedType refers to a type by its name, e.g. int or null.
+type NamedType struct {
+	Token token.Token
+	Name  string
+}
+
+func (named *NamedType) TokenLiteral() string {
+	return named.Token.Literal
+}
+func (named *NamedType) typeNode() {}
+func (named *NamedType) String() string {
+	return named.Name
+}
+
+type ArrayType struct {
+	Token   token.Token
+	Element Type
+}
+
+func (arr *ArrayType) TokenLiteral() string {
+	return arr.Token.Literal
+}
+func (arr *ArrayType) typeNode() {}
+func (arr *ArrayType) String() string {
+	return "[" + arr.Element.String() + "]"
+}
+
+type MapType struct {
+	Token token.Token
+	Key   Type
+	Value Type
+}
+
+func (mapType *MapType) TokenLiteral() string {
+	return mapType.Token.Literal
+}
+func (mapType *MapType) typeNode() {}
+func (mapType *MapType) String() string {
+	return "{" + mapType.Key.String() + ": " + mapType.Value.String() + "}"
+}
+
+// FunctionType describes functions by their parameter types and the type
+// they return. Return is nil if the return type is not annotated.
+type FunctionType struct {
+	Token      token.Token
+	Parameters []Type
+	Return     Type
+}
+
+func (fn *FunctionType) TokenLiteral() string {
+	return fn.Token.Literal
+}
+func (fn *FunctionType) typeNode() {}
+func (fn *FunctionType) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("fn(")
+	for i, param := range fn.Parameters {
+		if i != 0 {
+			out.WriteString(", ")
+		}
+		out.WriteString(param.String())
+	}
+	out.WriteString(")")
+	if fn.Return != nil {
+		out.WriteString(": " + fn.Return.String())
+	}
+
+	return out.String()
+}
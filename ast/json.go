@@ -0,0 +1,843 @@
+package ast
+
+import (
+	"compiler/token"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// The JSON encoding represents every node as an object with a "kind" naming
+// the node type (e.g. "LetStatement"), its "token" and the node specific
+// fields. Tokens are objects with "type", "literal", "offset", "line" and
+// "column". Missing optional children are encoded as null.
+
+type jsonObject map[string]interface{}
+
+type jsonToken struct {
+	Type    token.TokenType `json:"type"`
+	Literal string          `json:"literal"`
+	Offset  int             `json:"offset"`
+	Line    int             `json:"line"`
+	Column  int             `json:"column"`
+}
+
+// EncodeJSON returns the JSON encoding of a node and all of its children.
+func EncodeJSON(node Node) ([]byte, error) {
+	return json.Marshal(encodeNode(node))
+}
+
+// EncodeJSONIndent is like EncodeJSON but indents the output.
+func EncodeJSONIndent(node Node) ([]byte, error) {
+	return json.MarshalIndent(encodeNode(node), "", "  ")
+}
+
+func encodeToken(tok token.Token) jsonToken {
+	return jsonToken{
+		Type:    tok.Type,
+		Literal: tok.Literal,
+		Offset:  tok.Position.Offset,
+		Line:    tok.Position.Line,
+		Column:  tok.Position.Column,
+	}
+}
+
+func encodeNode(node Node) interface{} {
+	if isNil(node) {
+		return nil
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		return jsonObject{
+			"kind":       "Program",
+			"statements": encodeStatements(n.Statements),
+			"comments":   encodeComments(n.Comments),
+		}
+	case *Comment:
+		return jsonObject{"kind": "Comment", "token": encodeToken(n.Token), "trailing": n.Trailing}
+	case *LetStatement:
+		return jsonObject{
+			"kind":  "LetStatement",
+			"token": encodeToken(n.Token),
+			"name":  encodeNode(n.Name),
+			"type":  encodeNode(n.Type),
+			"value": encodeNode(n.Value),
+		}
+	case *ConstStatement:
+		return jsonObject{
+			"kind":  "ConstStatement",
+			"token": encodeToken(n.Token),
+			"name":  encodeNode(n.Name),
+			"type":  encodeNode(n.Type),
+			"value": encodeNode(n.Value),
+		}
+	case *InfixDeclaration:
+		return jsonObject{
+			"kind":       "InfixDeclaration",
+			"token":      encodeToken(n.Token),
+			"precedence": n.Precedence,
+			"operator":   encodeToken(n.Operator),
+			"value":      encodeNode(n.Value),
+		}
+	case *DestructuringLetStatement:
+		return jsonObject{
+			"kind":    "DestructuringLetStatement",
+			"token":   encodeToken(n.Token),
+			"pattern": encodeNode(n.Pattern),
+			"value":   encodeNode(n.Value),
+		}
+	case *ReturnStatement:
+		return jsonObject{
+			"kind":        "ReturnStatement",
+			"token":       encodeToken(n.Token),
+			"returnValue": encodeNode(n.ReturnValue),
+		}
+	case *ExpressionStatement:
+		return jsonObject{
+			"kind":       "ExpressionStatement",
+			"token":      encodeToken(n.Token),
+			"expression": encodeNode(n.Expression),
+		}
+	case *BlockStatement:
+		return jsonObject{
+			"kind":       "BlockStatement",
+			"token":      encodeToken(n.Token),
+			"statements": encodeStatements(n.Statements),
+			"rbrace":     encodeToken(n.Rbrace),
+		}
+	case *Identifier:
+		return jsonObject{"kind": "Identifier", "token": encodeToken(n.Token), "value": n.Value}
+	case *IntegerLiteral:
+		return jsonObject{"kind": "IntegerLiteral", "token": encodeToken(n.Token), "value": n.Value}
+	case *BooleanLiteral:
+		return jsonObject{"kind": "BooleanLiteral", "token": encodeToken(n.Token), "value": n.Value}
+	case *StringLiteral:
+		return jsonObject{"kind": "StringLiteral", "token": encodeToken(n.Token), "value": n.Value}
+	case *NullLiteral:
+		return jsonObject{"kind": "NullLiteral", "token": encodeToken(n.Token)}
+	case *InterpolatedString:
+		texts := make([]interface{}, len(n.Texts))
+		for i, text := range n.Texts {
+			texts[i] = encodeNode(text)
+		}
+		return jsonObject{
+			"kind":        "InterpolatedString",
+			"token":       encodeToken(n.Token),
+			"texts":       texts,
+			"expressions": encodeExpressions(n.Expressions),
+		}
+	case *PrefixExpression:
+		return jsonObject{
+			"kind":     "PrefixExpression",
+			"token":    encodeToken(n.Token),
+			"operator": n.Operator,
+			"right":    encodeNode(n.Right),
+		}
+	case *InfixExpression:
+		return jsonObject{
+			"kind":     "InfixExpression",
+			"token":    encodeToken(n.Token),
+			"operator": n.Operator,
+			"left":     encodeNode(n.Left),
+			"right":    encodeNode(n.Right),
+		}
+	case *IfExpression:
+		return jsonObject{
+			"kind":        "IfExpression",
+			"token":       encodeToken(n.Token),
+			"condition":   encodeNode(n.Condition),
+			"consequence": encodeNode(n.Consequence),
+			"alternative": encodeNode(n.Alternative),
+		}
+	case *FunctionLiteral:
+		params := make([]interface{}, len(n.Parameters))
+		for i, param := range n.Parameters {
+			params[i] = encodeNode(param)
+		}
+		return jsonObject{
+			"kind":       "FunctionLiteral",
+			"token":      encodeToken(n.Token),
+			"name":       n.Name,
+			"parameters": params,
+			"defaults":   encodeExpressions(n.Defaults),
+			"types":      encodeTypes(n.Types),
+			"rest":       encodeNode(n.Rest),
+			"restType":   encodeNode(n.RestType),
+			"returnType": encodeNode(n.ReturnType),
+			"body":       encodeNode(n.Body),
+		}
+	case *MacroLiteral:
+		params := make([]interface{}, len(n.Parameters))
+		for i, param := range n.Parameters {
+			params[i] = encodeNode(param)
+		}
+		return jsonObject{
+			"kind":       "MacroLiteral",
+			"token":      encodeToken(n.Token),
+			"parameters": params,
+			"body":       encodeNode(n.Body),
+		}
+	case *LambdaLiteral:
+		return jsonObject{
+			"kind":      "LambdaLiteral",
+			"token":     encodeToken(n.Token),
+			"name":      n.Name,
+			"parameter": encodeNode(n.Parameter),
+			"body":      encodeNode(n.Body),
+		}
+	case *PipeExpression:
+		return jsonObject{
+			"kind":  "PipeExpression",
+			"token": encodeToken(n.Token),
+			"left":  encodeNode(n.Left),
+			"right": encodeNode(n.Right),
+		}
+	case *PropertyExpression:
+		return jsonObject{
+			"kind":     "PropertyExpression",
+			"token":    encodeToken(n.Token),
+			"left":     encodeNode(n.Left),
+			"property": encodeNode(n.Property),
+			"optional": n.Optional,
+		}
+	case *SpreadExpression:
+		return jsonObject{"kind": "SpreadExpression", "token": encodeToken(n.Token), "value": encodeNode(n.Value)}
+	case *CallExpression:
+		return jsonObject{
+			"kind":      "CallExpression",
+			"token":     encodeToken(n.Token),
+			"left":      encodeNode(n.Left),
+			"arguments": encodeExpressions(n.Arguments),
+			"rparen":    encodeToken(n.Rparen),
+		}
+	case *ArrayLiteral:
+		return jsonObject{
+			"kind":     "ArrayLiteral",
+			"token":    encodeToken(n.Token),
+			"elements": encodeExpressions(n.Elements),
+			"rbracket": encodeToken(n.Rbracket),
+		}
+	case *IndexExpression:
+		return jsonObject{
+			"kind":     "IndexExpression",
+			"token":    encodeToken(n.Token),
+			"left":     encodeNode(n.Left),
+			"index":    encodeNode(n.Index),
+			"optional": n.Optional,
+		}
+	case *MapLiteral:
+		entries := make([]interface{}, 0, len(n.Entries))
+		for _, key := range n.OrderedKeys() {
+			entries = append(entries, jsonObject{"key": encodeNode(key), "value": encodeNode(n.Entries[key])})
+		}
+		return jsonObject{
+			"kind":    "MapLiteral",
+			"token":   encodeToken(n.Token),
+			"entries": entries,
+			"rbrace":  encodeToken(n.Rbrace),
+		}
+	case *MatchExpression:
+		arms := make([]interface{}, len(n.Arms))
+		for i, arm := range n.Arms {
+			arms[i] = encodeNode(arm)
+		}
+		return jsonObject{
+			"kind":    "MatchExpression",
+			"token":   encodeToken(n.Token),
+			"subject": encodeNode(n.Subject),
+			"arms":    arms,
+			"rbrace":  encodeToken(n.Rbrace),
+		}
+	case *MatchArm:
+		return jsonObject{
+			"kind":    "MatchArm",
+			"token":   encodeToken(n.Token),
+			"pattern": encodeNode(n.Pattern),
+			"guard":   encodeNode(n.Guard),
+			"body":    encodeNode(n.Body),
+		}
+	case *WildcardPattern:
+		return jsonObject{"kind": "WildcardPattern", "token": encodeToken(n.Token)}
+	case *LiteralPattern:
+		return jsonObject{"kind": "LiteralPattern", "token": encodeToken(n.Token), "value": encodeNode(n.Value)}
+	case *BindingPattern:
+		return jsonObject{"kind": "BindingPattern", "token": encodeToken(n.Token), "name": encodeNode(n.Name)}
+	case *ArrayPattern:
+		elements := make([]interface{}, len(n.Elements))
+		for i, e := range n.Elements {
+			elements[i] = encodeNode(e)
+		}
+		return jsonObject{
+			"kind":     "ArrayPattern",
+			"token":    encodeToken(n.Token),
+			"elements": elements,
+			"rest":     encodeNode(n.Rest),
+			"rbracket": encodeToken(n.Rbracket),
+		}
+	case *MapPattern:
+		entries := make([]interface{}, len(n.Entries))
+		for i, entry := range n.Entries {
+			entries[i] = jsonObject{"key": encodeNode(entry.Key), "value": encodeNode(entry.Value)}
+		}
+		return jsonObject{
+			"kind":    "MapPattern",
+			"token":   encodeToken(n.Token),
+			"entries": entries,
+			"rbrace":  encodeToken(n.Rbrace),
+		}
+	case *NamedType:
+		return jsonObject{"kind": "NamedType", "token": encodeToken(n.Token), "name": n.Name}
+	case *ArrayType:
+		return jsonObject{"kind": "ArrayType", "token": encodeToken(n.Token), "element": encodeNode(n.Element)}
+	case *MapType:
+		return jsonObject{
+			"kind":  "MapType",
+			"token": encodeToken(n.Token),
+			"key":   encodeNode(n.Key),
+			"value": encodeNode(n.Value),
+		}
+	case *FunctionType:
+		return jsonObject{
+			"kind":       "FunctionType",
+			"token":      encodeToken(n.Token),
+			"parameters": encodeTypes(n.Parameters),
+			"return":     encodeNode(n.Return),
+		}
+	default:
+		panic(fmt.Sprintf("ast.EncodeJSON: unexpected node type %T", n))
+	}
+}
+
+func encodeStatements(statements []Statement) []interface{} {
+	out := make([]interface{}, len(statements))
+	for i, s := range statements {
+		out[i] = encodeNode(s)
+	}
+	return out
+}
+
+func encodeExpressions(expressions []Expression) []interface{} {
+	out := make([]interface{}, len(expressions))
+	for i, e := range expressions {
+		out[i] = encodeNode(e)
+	}
+	return out
+}
+
+func encodeTypes(types []Type) []interface{} {
+	out := make([]interface{}, len(types))
+	for i, t := range types {
+		out[i] = encodeNode(t)
+	}
+	return out
+}
+
+func encodeComments(comments []*Comment) []interface{} {
+	out := make([]interface{}, len(comments))
+	for i, c := range comments {
+		out[i] = encodeNode(c)
+	}
+	return out
+}
+
+// isNil reports whether node is nil or a typed nil pointer, as left behind
+// by optional children like a missing else block.
+func isNil(node Node) bool {
+	if node == nil {
+		return true
+	}
+
+	value := reflect.ValueOf(node)
+	return value.Kind() == reflect.Pointer && value.IsNil()
+}
+
+// DecodeJSON reconstructs a node from its JSON encoding.
+func DecodeJSON(data []byte) (Node, error) {
+	var raw json.RawMessage = data
+	return decodeNode(raw)
+}
+
+// DecodeProgram reconstructs a program from its JSON encoding.
+func DecodeProgram(data []byte) (*Program, error) {
+	node, err := DecodeJSON(data)
+	if err != nil {
+		return nil, err
+	}
+
+	program, ok := node.(*Program)
+	if !ok {
+		return nil, fmt.Errorf("expected Program, got %T", node)
+	}
+	return program, nil
+}
+
+// Clone returns a deep copy of node by decoding its JSON encoding.
+func Clone(node Node) Node {
+	data, err := EncodeJSON(node)
+	if err != nil {
+		panic(fmt.Sprintf("ast.Clone: %s", err))
+	}
+
+	clone, err := DecodeJSON(data)
+	if err != nil {
+		panic(fmt.Sprintf("ast.Clone: %s", err))
+	}
+	return clone
+}
+
+type jsonFields map[string]json.RawMessage
+
+func (f jsonFields) value(name string, target interface{}) error {
+	raw, ok := f[name]
+	if !ok {
+		return fmt.Errorf("missing field %q", name)
+	}
+
+	err := json.Unmarshal(raw, target)
+	if err != nil {
+		return fmt.Errorf("field %q: %s", name, err)
+	}
+	return nil
+}
+
+func (f jsonFields) token(name string) (token.Token, error) {
+	var tok jsonToken
+	if err := f.value(name, &tok); err != nil {
+		return token.Token{}, err
+	}
+
+	return token.Token{
+		Type:     tok.Type,
+		Literal:  tok.Literal,
+		Position: token.Position{Offset: tok.Offset, Line: tok.Line, Column: tok.Column},
+	}, nil
+}
+
+func (f jsonFields) node(name string) (Node, error) {
+	raw, ok := f[name]
+	if !ok {
+		return nil, fmt.Errorf("missing field %q", name)
+	}
+	return decodeNode(raw)
+}
+
+func (f jsonFields) nodes(name string) ([]Node, error) {
+	var raws []json.RawMessage
+	if err := f.value(name, &raws); err != nil {
+		return nil, err
+	}
+
+	nodes := make([]Node, len(raws))
+	for i, raw := range raws {
+		node, err := decodeNode(raw)
+		if err != nil {
+			return nil, err
+		}
+		nodes[i] = node
+	}
+	return nodes, nil
+}
+
+// decoder collects the first error of a sequence of field reads, so the
+// node cases below can read all fields before checking for failure.
+type decoder struct {
+	fields jsonFields
+	err    error
+}
+
+func (d *decoder) check(err error) {
+	if d.err == nil && err != nil {
+		d.err = err
+	}
+}
+
+func (d *decoder) value(name string, target interface{}) {
+	d.check(d.fields.value(name, target))
+}
+
+func (d *decoder) token(name string) token.Token {
+	tok, err := d.fields.token(name)
+	d.check(err)
+	return tok
+}
+
+func (d *decoder) expression(name string) Expression {
+	node, err := d.fields.node(name)
+	d.check(err)
+	return d.asExpression(name, node)
+}
+
+func (d *decoder) expressions(name string) []Expression {
+	nodes, err := d.fields.nodes(name)
+	d.check(err)
+
+	expressions := make([]Expression, len(nodes))
+	for i, node := range nodes {
+		expressions[i] = d.asExpression(name, node)
+	}
+	return expressions
+}
+
+func (d *decoder) asExpression(name string, node Node) Expression {
+	if node == nil {
+		return nil
+	}
+
+	expr, ok := node.(Expression)
+	if !ok {
+		d.check(fmt.Errorf("field %q: expected expression, got %T", name, node))
+	}
+	return expr
+}
+
+func (d *decoder) statements(name string) []Statement {
+	nodes, err := d.fields.nodes(name)
+	d.check(err)
+
+	statements := make([]Statement, len(nodes))
+	for i, node := range nodes {
+		stmt, ok := node.(Statement)
+		if !ok {
+			d.check(fmt.Errorf("field %q: expected statement, got %T", name, node))
+		}
+		statements[i] = stmt
+	}
+	return statements
+}
+
+func (d *decoder) identifier(name string) *Identifier {
+	node, err := d.fields.node(name)
+	d.check(err)
+	if node == nil {
+		return nil
+	}
+
+	ident, ok := node.(*Identifier)
+	if !ok {
+		d.check(fmt.Errorf("field %q: expected Identifier, got %T", name, node))
+	}
+	return ident
+}
+
+func (d *decoder) identifiers(name string) []*Identifier {
+	nodes, err := d.fields.nodes(name)
+	d.check(err)
+
+	identifiers := make([]*Identifier, len(nodes))
+	for i, node := range nodes {
+		ident, ok := node.(*Identifier)
+		if !ok {
+			d.check(fmt.Errorf("field %q: expected Identifier, got %T", name, node))
+		}
+		identifiers[i] = ident
+	}
+	return identifiers
+}
+
+func (d *decoder) block(name string) *BlockStatement {
+	node, err := d.fields.node(name)
+	d.check(err)
+	if node == nil {
+		return nil
+	}
+
+	block, ok := node.(*BlockStatement)
+	if !ok {
+		d.check(fmt.Errorf("field %q: expected BlockStatement, got %T", name, node))
+	}
+	return block
+}
+
+func (d *decoder) pattern(name string) Pattern {
+	node, err := d.fields.node(name)
+	d.check(err)
+	return d.asPattern(name, node)
+}
+
+func (d *decoder) patterns(name string) []Pattern {
+	nodes, err := d.fields.nodes(name)
+	d.check(err)
+
+	patterns := make([]Pattern, len(nodes))
+	for i, node := range nodes {
+		patterns[i] = d.asPattern(name, node)
+	}
+	return patterns
+}
+
+func (d *decoder) asPattern(name string, node Node) Pattern {
+	if node == nil {
+		return nil
+	}
+
+	pattern, ok := node.(Pattern)
+	if !ok {
+		d.check(fmt.Errorf("field %q: expected pattern, got %T", name, node))
+	}
+	return pattern
+}
+
+func (d *decoder) annotation(name string) Type {
+	node, err := d.fields.node(name)
+	d.check(err)
+	return d.asType(name, node)
+}
+
+func (d *decoder) annotations(name string) []Type {
+	nodes, err := d.fields.nodes(name)
+	d.check(err)
+
+	types := make([]Type, len(nodes))
+	for i, node := range nodes {
+		types[i] = d.asType(name, node)
+	}
+	return types
+}
+
+func (d *decoder) asType(name string, node Node) Type {
+	if node == nil {
+		return nil
+	}
+
+	typ, ok := node.(Type)
+	if !ok {
+		d.check(fmt.Errorf("field %q: expected type, got %T", name, node))
+	}
+	return typ
+}
+
+func (d *decoder) comments(name string) []*Comment {
+	nodes, err := d.fields.nodes(name)
+	d.check(err)
+
+	comments := make([]*Comment, len(nodes))
+	for i, node := range nodes {
+		comment, ok := node.(*Comment)
+		if !ok {
+			d.check(fmt.Errorf("field %q: expected Comment, got %T", name, node))
+		}
+		comments[i] = comment
+	}
+	return comments
+}
+
+func decodeNode(raw json.RawMessage) (Node, error) {
+	if string(raw) == "null" {
+		return nil, nil
+	}
+
+	var fields jsonFields
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+
+	var kind string
+	if err := fields.value("kind", &kind); err != nil {
+		return nil, err
+	}
+
+	d := &decoder{fields: fields}
+
+	var node Node
+	switch kind {
+	case "Program":
+		node = &Program{Statements: d.statements("statements"), Comments: d.comments("comments")}
+	case "Comment":
+		comment := &Comment{Token: d.token("token")}
+		d.value("trailing", &comment.Trailing)
+		node = comment
+	case "LetStatement":
+		node = &LetStatement{
+			Token: d.token("token"),
+			Name:  d.identifier("name"),
+			Type:  d.annotation("type"),
+			Value: d.expression("value"),
+		}
+	case "ConstStatement":
+		node = &ConstStatement{
+			Token: d.token("token"),
+			Name:  d.identifier("name"),
+			Type:  d.annotation("type"),
+			Value: d.expression("value"),
+		}
+	case "InfixDeclaration":
+		decl := &InfixDeclaration{Token: d.token("token"), Operator: d.token("operator"), Value: d.expression("value")}
+		d.value("precedence", &decl.Precedence)
+		node = decl
+	case "DestructuringLetStatement":
+		node = &DestructuringLetStatement{Token: d.token("token"), Pattern: d.pattern("pattern"), Value: d.expression("value")}
+	case "ReturnStatement":
+		node = &ReturnStatement{Token: d.token("token"), ReturnValue: d.expression("returnValue")}
+	case "ExpressionStatement":
+		node = &ExpressionStatement{Token: d.token("token"), Expression: d.expression("expression")}
+	case "BlockStatement":
+		node = &BlockStatement{Token: d.token("token"), Statements: d.statements("statements"), Rbrace: d.token("rbrace")}
+	case "Identifier":
+		ident := &Identifier{Token: d.token("token")}
+		d.value("value", &ident.Value)
+		node = ident
+	case "IntegerLiteral":
+		integer := &IntegerLiteral{Token: d.token("token")}
+		d.value("value", &integer.Value)
+		node = integer
+	case "BooleanLiteral":
+		boolean := &BooleanLiteral{Token: d.token("token")}
+		d.value("value", &boolean.Value)
+		node = boolean
+	case "StringLiteral":
+		str := &StringLiteral{Token: d.token("token")}
+		d.value("value", &str.Value)
+		node = str
+	case "NullLiteral":
+		node = &NullLiteral{Token: d.token("token")}
+	case "InterpolatedString":
+		interpolated := &InterpolatedString{Token: d.token("token"), Expressions: d.expressions("expressions")}
+		for _, text := range d.expressions("texts") {
+			str, ok := text.(*StringLiteral)
+			if !ok {
+				d.check(fmt.Errorf("field \"texts\": expected StringLiteral, got %T", text))
+				break
+			}
+			interpolated.Texts = append(interpolated.Texts, str)
+		}
+		node = interpolated
+	case "PrefixExpression":
+		prefix := &PrefixExpression{Token: d.token("token"), Right: d.expression("right")}
+		d.value("operator", &prefix.Operator)
+		node = prefix
+	case "InfixExpression":
+		infix := &InfixExpression{Token: d.token("token"), Left: d.expression("left"), Right: d.expression("right")}
+		d.value("operator", &infix.Operator)
+		node = infix
+	case "IfExpression":
+		node = &IfExpression{
+			Token:       d.token("token"),
+			Condition:   d.expression("condition"),
+			Consequence: d.block("consequence"),
+			Alternative: d.block("alternative"),
+		}
+	case "FunctionLiteral":
+		function := &FunctionLiteral{
+			Token:      d.token("token"),
+			Parameters: d.identifiers("parameters"),
+			Defaults:   d.expressions("defaults"),
+			Types:      d.annotations("types"),
+			Rest:       d.identifier("rest"),
+			RestType:   d.annotation("restType"),
+			ReturnType: d.annotation("returnType"),
+			Body:       d.block("body"),
+		}
+		d.value("name", &function.Name)
+		node = function
+	case "MacroLiteral":
+		node = &MacroLiteral{Token: d.token("token"), Parameters: d.identifiers("parameters"), Body: d.block("body")}
+	case "LambdaLiteral":
+		lambda := &LambdaLiteral{Token: d.token("token"), Parameter: d.identifier("parameter"), Body: d.expression("body")}
+		d.value("name", &lambda.Name)
+		node = lambda
+	case "PipeExpression":
+		node = &PipeExpression{Token: d.token("token"), Left: d.expression("left"), Right: d.expression("right")}
+	case "PropertyExpression":
+		prop := &PropertyExpression{Token: d.token("token"), Left: d.expression("left"), Property: d.identifier("property")}
+		d.value("optional", &prop.Optional)
+		node = prop
+	case "SpreadExpression":
+		node = &SpreadExpression{Token: d.token("token"), Value: d.expression("value")}
+	case "CallExpression":
+		node = &CallExpression{
+			Token:     d.token("token"),
+			Left:      d.expression("left"),
+			Arguments: d.expressions("arguments"),
+			Rparen:    d.token("rparen"),
+		}
+	case "ArrayLiteral":
+		node = &ArrayLiteral{Token: d.token("token"), Elements: d.expressions("elements"), Rbracket: d.token("rbracket")}
+	case "IndexExpression":
+		index := &IndexExpression{Token: d.token("token"), Left: d.expression("left"), Index: d.expression("index")}
+		d.value("optional", &index.Optional)
+		node = index
+	case "MapLiteral":
+		mapExpr := &MapLiteral{Token: d.token("token"), Rbrace: d.token("rbrace")}
+		var entries []jsonFields
+		d.value("entries", &entries)
+
+		mapExpr.Entries = make(map[Expression]Expression, len(entries))
+		mapExpr.Keys = make([]Expression, 0, len(entries))
+		for _, entry := range entries {
+			entryDecoder := &decoder{fields: entry}
+			key := entryDecoder.expression("key")
+			value := entryDecoder.expression("value")
+			d.check(entryDecoder.err)
+
+			mapExpr.Entries[key] = value
+			mapExpr.Keys = append(mapExpr.Keys, key)
+		}
+		node = mapExpr
+	case "MatchExpression":
+		match := &MatchExpression{Token: d.token("token"), Subject: d.expression("subject"), Rbrace: d.token("rbrace")}
+
+		nodes, err := d.fields.nodes("arms")
+		d.check(err)
+		for _, node := range nodes {
+			arm, ok := node.(*MatchArm)
+			if !ok {
+				d.check(fmt.Errorf("field \"arms\": expected MatchArm, got %T", node))
+				break
+			}
+			match.Arms = append(match.Arms, arm)
+		}
+		node = match
+	case "MatchArm":
+		node = &MatchArm{
+			Token:   d.token("token"),
+			Pattern: d.pattern("pattern"),
+			Guard:   d.expression("guard"),
+			Body:    d.expression("body"),
+		}
+	case "WildcardPattern":
+		node = &WildcardPattern{Token: d.token("token")}
+	case "LiteralPattern":
+		node = &LiteralPattern{Token: d.token("token"), Value: d.expression("value")}
+	case "BindingPattern":
+		node = &BindingPattern{Token: d.token("token"), Name: d.identifier("name")}
+	case "ArrayPattern":
+		node = &ArrayPattern{
+			Token:    d.token("token"),
+			Elements: d.patterns("elements"),
+			Rest:     d.identifier("rest"),
+			Rbracket: d.token("rbracket"),
+		}
+	case "MapPattern":
+		mapPattern := &MapPattern{Token: d.token("token"), Rbrace: d.token("rbrace")}
+
+		var entries []jsonFields
+		d.value("entries", &entries)
+		for _, entry := range entries {
+			entryDecoder := &decoder{fields: entry}
+			key := entryDecoder.expression("key")
+			value := entryDecoder.pattern("value")
+			d.check(entryDecoder.err)
+
+			mapPattern.Entries = append(mapPattern.Entries, &MapPatternEntry{Key: key, Value: value})
+		}
+		node = mapPattern
+	case "NamedType":
+		named := &NamedType{Token: d.token("token")}
+		d.value("name", &named.Name)
+		node = named
+	case "ArrayType":
+		node = &ArrayType{Token: d.token("token"), Element: d.annotation("element")}
+	case "MapType":
+		node = &MapType{Token: d.token("token"), Key: d.annotation("key"), Value: d.annotation("value")}
+	case "FunctionType":
+		node = &FunctionType{Token: d.token("token"), Parameters: d.annotations("parameters"), Return: d.annotation("return")}
+	default:
+		return nil, fmt.Errorf("unknown node kind %q", kind)
+	}
+
+	if d.err != nil {
+		return nil, fmt.Errorf("%s: %s", kind, d.err)
+	}
+	return node, nil
+}
@@ -0,0 +1,142 @@
+package ast_test
+
+import (
+	"compiler/ast"
+	"compiler/compiler"
+	"compiler/object"
+	"compiler/vm"
+	"strings"
+	"testing"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+	inputs := []string{
+		`let x = 5; // five`,
+		`let add = fn(a, b) { return a + b }; add(1, -2)`,
+		`if (1 < 2 && true) { "yes" } else { "no" }`,
+		`if (false) { 1 }`,
+		`let m = {"a": [1, 2][0], "b": !false}; m["a"]`,
+		`return;`,
+		`person.greet(x).name`,
+		`const limit = 10;`,
+		`"Hello ${name}, ${"nested ${1 + 2}"}"`,
+		`let unless = macro(c, a) { quote(if (!(unquote(c))) { unquote(a) }) };`,
+		`a?.b?.[0] ?? null`,
+		`xs |> map(x => x * 2) |> len`,
+		`infixr 5 <+> = fn(a, b) { a + b }; 1 <+> 2 <+> 3`,
+		`let f = fn(a, b = 1, ...rest) { g(a, ...rest) };`,
+		`let [a, ...rest] = xs; let {name} = person;`,
+		`match (x) { 0 => 1, [a, [_], ...rest] if a > 0 => rest, {name, 1: true} => name, _ => -1 }`,
+		`let f: fn(int, [string]): {string: bool} = fn(a: int, b, c: null = null): any { a };`,
+		`fn(a: int, ...rest: [{string: int}]) { rest }`,
+	}
+
+	for _, input := range inputs {
+		program := parse(t, input)
+
+		encoded, err := ast.EncodeJSON(program)
+		if err != nil {
+			t.Fatalf("encoding failed for %q: %s", input, err)
+		}
+
+		decoded, err := ast.DecodeProgram(encoded)
+		if err != nil {
+			t.Fatalf("decoding failed for %q: %s", input, err)
+		}
+
+		if decoded.String() != program.String() {
+			t.Errorf("decoded program differs.\nwant=%s\ngot= %s", program.String(), decoded.String())
+		}
+
+		reencoded, err := ast.EncodeJSON(decoded)
+		if err != nil {
+			t.Fatalf("encoding decoded program failed for %q: %s", input, err)
+		}
+
+		if string(reencoded) != string(encoded) {
+			t.Errorf("encoding is not stable.\nfirst= %s\nsecond=%s", encoded, reencoded)
+		}
+	}
+}
+
+func TestJSONEncoding(t *testing.T) {
+	program := parse(t, `x`)
+
+	encoded, err := ast.EncodeJSON(program)
+	if err != nil {
+		t.Fatalf("encoding failed: %s", err)
+	}
+
+	expected := `{"comments":[],"kind":"Program","statements":[{"expression":{"kind":"Identifier","token":{"type":"IDENT","literal":"x","offset":0,"line":1,"column":1},"value":"x"},"kind":"ExpressionStatement","token":{"type":"IDENT","literal":"x","offset":0,"line":1,"column":1}}]}`
+	if string(encoded) != expected {
+		t.Errorf("wrong encoding.\nwant=%s\ngot= %s", expected, encoded)
+	}
+}
+
+func TestClone(t *testing.T) {
+	program := parse(t, `let f = fn(x) { x + 1 };`)
+
+	clone := ast.Clone(program).(*ast.Program)
+	name := clone.Statements[0].(*ast.LetStatement).Name
+	name.Token.Literal = "g"
+	name.Value = "g"
+
+	if program.String() != "let f = <f>fn(x){(x + 1)};" {
+		t.Errorf("original changed by modifying the clone: %s", program.String())
+	}
+	if clone.String() != "let g = <f>fn(x){(x + 1)};" {
+		t.Errorf("wrong clone: %s", clone.String())
+	}
+}
+
+func TestDecodedProgramCompiles(t *testing.T) {
+	program := parse(t, `let fib = fn(n) { if (n < 2) { return n } fib(n - 1) + fib(n - 2) }; fib(10)`)
+
+	encoded, err := ast.EncodeJSON(program)
+	if err != nil {
+		t.Fatalf("encoding failed: %s", err)
+	}
+
+	decoded, err := ast.DecodeProgram(encoded)
+	if err != nil {
+		t.Fatalf("decoding failed: %s", err)
+	}
+
+	comp := compiler.New()
+	if err := comp.Compile(decoded); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	machine := vm.New(comp.Bytecode())
+	if err := machine.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	result, ok := machine.LastPopped().(*object.Integer)
+	if !ok || result.Value != 55 {
+		t.Errorf("wrong result. want=55, got=%v", machine.LastPopped())
+	}
+}
+
+func TestJSONDecodeErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"kind": "Unknown"}`, `unknown node kind "Unknown"`},
+		{`{"statements": []}`, `missing field "kind"`},
+		{`{"kind": "Program", "statements": [{"kind": "Identifier", "token": {}, "value": "x"}], "comments": []}`, `expected statement`},
+		{`{"kind": "ExpressionStatement", "token": {}}`, `missing field "expression"`},
+	}
+
+	for _, tt := range tests {
+		_, err := ast.DecodeJSON([]byte(tt.input))
+		if err == nil {
+			t.Fatalf("expected error for %s", tt.input)
+		}
+
+		if !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("wrong error. want it to contain %q, got %q", tt.expected, err)
+		}
+	}
+}
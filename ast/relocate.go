@@ -0,0 +1,51 @@
+package ast
+
+import (
+	"compiler/token"
+	"reflect"
+)
+
+var positionType = reflect.TypeOf(token.Position{})
+
+// Relocate replaces the position of every token of the tree by the result
+// of f, e.g. to move a subtree that is reused after an edit of the source.
+// Tokens without a valid position are left alone.
+func Relocate(node Node, f func(token.Position) token.Position) {
+	relocate(reflect.ValueOf(node), f, make(map[uintptr]bool))
+}
+
+func relocate(v reflect.Value, f func(token.Position) token.Position, seen map[uintptr]bool) {
+	switch v.Kind() {
+	case reflect.Pointer:
+		// map literals reference their keys twice
+		if v.IsNil() || seen[v.Pointer()] {
+			return
+		}
+		seen[v.Pointer()] = true
+		relocate(v.Elem(), f, seen)
+	case reflect.Interface:
+		if !v.IsNil() {
+			relocate(v.Elem(), f, seen)
+		}
+	case reflect.Struct:
+		if v.Type() == positionType {
+			position := v.Interface().(token.Position)
+			if position.IsValid() && v.CanSet() {
+				v.Set(reflect.ValueOf(f(position)))
+			}
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			relocate(v.Field(i), f, seen)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			relocate(v.Index(i), f, seen)
+		}
+	case reflect.Map:
+		for _, key := range v.MapKeys() {
+			relocate(key, f, seen)
+			relocate(v.MapIndex(key), f, seen)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package ast_test
+
+import (
+	"compiler/ast"
+	"compiler/token"
+	"testing"
+)
+
+func TestRelocate(t *testing.T) {
+	program := parse(t, `let m = {"a": fn(x) { x }}; m.a(1)`)
+
+	ast.Relocate(program, func(pos token.Position) token.Position {
+		pos.Offset += 10
+		pos.Line += 1
+		return pos
+	})
+
+	var offsets []int
+	ast.Inspect(program, func(node ast.Node) bool {
+		if ident, ok := node.(*ast.Identifier); ok {
+			offsets = append(offsets, ident.Token.Position.Offset)
+			if ident.Token.Position.Line != 2 {
+				t.Errorf("Expected %s on line 2. Got %d", ident.Value, ident.Token.Position.Line)
+			}
+		}
+		return true
+	})
+
+	// the key of the map literal is referenced twice but only moved once
+	expected := []int{14, 27, 32, 38, 40}
+	if len(offsets) != len(expected) {
+		t.Fatalf("Expected %d identifiers. Got %d", len(expected), len(offsets))
+	}
+	for i := range expected {
+		if offsets[i] != expected[i] {
+			t.Errorf("Expected offset %d. Got %d", expected[i], offsets[i])
+		}
+	}
+
+	key := program.Statements[0].(*ast.LetStatement).Value.(*ast.MapLiteral).Keys[0].(*ast.StringLiteral)
+	if key.Token.Position.Offset != 19 {
+		t.Errorf("Expected key at offset 19. Got %d", key.Token.Position.Offset)
+	}
+}
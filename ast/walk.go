@@ -0,0 +1,415 @@
+package ast
+
+import "fmt"
+
+// A Visitor's Visit method is invoked for each node encountered by Walk.
+// If the result visitor w is not nil, Walk visits each of the children of
+// node with w, followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses an AST in depth-first order, children in source order.
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		for _, s := range n.Statements {
+			Walk(v, s)
+		}
+	case *LetStatement:
+		Walk(v, n.Name)
+		if n.Type != nil {
+			Walk(v, n.Type)
+		}
+		Walk(v, n.Value)
+	case *ConstStatement:
+		Walk(v, n.Name)
+		if n.Type != nil {
+			Walk(v, n.Type)
+		}
+		Walk(v, n.Value)
+	case *InfixDeclaration:
+		Walk(v, n.Value)
+	case *DestructuringLetStatement:
+		Walk(v, n.Pattern)
+		Walk(v, n.Value)
+	case *ReturnStatement:
+		if n.ReturnValue != nil {
+			Walk(v, n.ReturnValue)
+		}
+	case *ExpressionStatement:
+		if n.Expression != nil {
+			Walk(v, n.Expression)
+		}
+	case *BlockStatement:
+		for _, s := range n.Statements {
+			Walk(v, s)
+		}
+	case *InterpolatedString:
+		for i, text := range n.Texts {
+			Walk(v, text)
+			if i < len(n.Expressions) {
+				Walk(v, n.Expressions[i])
+			}
+		}
+	case *PrefixExpression:
+		Walk(v, n.Right)
+	case *InfixExpression:
+		Walk(v, n.Left)
+		Walk(v, n.Right)
+	case *IfExpression:
+		Walk(v, n.Condition)
+		Walk(v, n.Consequence)
+		if n.Alternative != nil {
+			Walk(v, n.Alternative)
+		}
+	case *FunctionLiteral:
+		for i, param := range n.Parameters {
+			Walk(v, param)
+			if typ := n.ParameterType(i); typ != nil {
+				Walk(v, typ)
+			}
+			if def := n.Default(i); def != nil {
+				Walk(v, def)
+			}
+		}
+		if n.Rest != nil {
+			Walk(v, n.Rest)
+		}
+		if n.RestType != nil {
+			Walk(v, n.RestType)
+		}
+		if n.ReturnType != nil {
+			Walk(v, n.ReturnType)
+		}
+		Walk(v, n.Body)
+	case *MacroLiteral:
+		for _, param := range n.Parameters {
+			Walk(v, param)
+		}
+		Walk(v, n.Body)
+	case *LambdaLiteral:
+		Walk(v, n.Parameter)
+		Walk(v, n.Body)
+	case *PipeExpression:
+		Walk(v, n.Left)
+		Walk(v, n.Right)
+	case *CallExpression:
+		Walk(v, n.Left)
+		for _, arg := range n.Arguments {
+			Walk(v, arg)
+		}
+	case *SpreadExpression:
+		Walk(v, n.Value)
+	case *ArrayLiteral:
+		for _, e := range n.Elements {
+			Walk(v, e)
+		}
+	case *IndexExpression:
+		Walk(v, n.Left)
+		Walk(v, n.Index)
+	case *PropertyExpression:
+		Walk(v, n.Left)
+		Walk(v, n.Property)
+	case *MapLiteral:
+		for _, key := range n.OrderedKeys() {
+			Walk(v, key)
+			Walk(v, n.Entries[key])
+		}
+	case *MatchExpression:
+		Walk(v, n.Subject)
+		for _, arm := range n.Arms {
+			Walk(v, arm)
+		}
+	case *MatchArm:
+		Walk(v, n.Pattern)
+		if n.Guard != nil {
+			Walk(v, n.Guard)
+		}
+		Walk(v, n.Body)
+	case *LiteralPattern:
+		Walk(v, n.Value)
+	case *BindingPattern:
+		Walk(v, n.Name)
+	case *ArrayPattern:
+		for _, e := range n.Elements {
+			Walk(v, e)
+		}
+		if n.Rest != nil {
+			Walk(v, n.Rest)
+		}
+	case *MapPattern:
+		for _, entry := range n.Entries {
+			Walk(v, entry.Key)
+			Walk(v, entry.Value)
+		}
+	case *ArrayType:
+		Walk(v, n.Element)
+	case *MapType:
+		Walk(v, n.Key)
+		Walk(v, n.Value)
+	case *FunctionType:
+		for _, param := range n.Parameters {
+			Walk(v, param)
+		}
+		if n.Return != nil {
+			Walk(v, n.Return)
+		}
+	case *Identifier, *IntegerLiteral, *BooleanLiteral, *StringLiteral, *NullLiteral, *Comment, *WildcardPattern, *NamedType:
+		// leaves
+	default:
+		panic(fmt.Sprintf("ast.Walk: unexpected node type %T", n))
+	}
+
+	v.Visit(nil)
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses an AST in depth-first order. It calls f(node) for each
+// node and only descends into the children of node if f returns true. After
+// all children are visited, f is called with nil.
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
+
+// RewriteFunc returns the node that replaces the given one. Returning the
+// node unchanged keeps it.
+type RewriteFunc func(Node) Node
+
+// Rewrite traverses an AST in depth-first order and replaces every node by
+// the result of f. Children are rewritten before their parent, so f always
+// sees a node whose subtrees are already rewritten. Replacements must fit
+// the slot they are put into: an expression may only be replaced by an
+// expression, a block by a block and so on.
+func Rewrite(node Node, f RewriteFunc) Node {
+	switch n := node.(type) {
+	case *Program:
+		for i, s := range n.Statements {
+			n.Statements[i] = rewriteStatement(s, f)
+		}
+	case *LetStatement:
+		n.Name = rewriteIdentifier(n.Name, f)
+		n.Type = rewriteType(n.Type, f)
+		n.Value = rewriteExpression(n.Value, f)
+	case *ConstStatement:
+		n.Name = rewriteIdentifier(n.Name, f)
+		n.Type = rewriteType(n.Type, f)
+		n.Value = rewriteExpression(n.Value, f)
+	case *InfixDeclaration:
+		n.Value = rewriteExpression(n.Value, f)
+	case *DestructuringLetStatement:
+		n.Pattern = rewritePattern(n.Pattern, f)
+		n.Value = rewriteExpression(n.Value, f)
+	case *ReturnStatement:
+		n.ReturnValue = rewriteExpression(n.ReturnValue, f)
+	case *ExpressionStatement:
+		n.Expression = rewriteExpression(n.Expression, f)
+	case *BlockStatement:
+		for i, s := range n.Statements {
+			n.Statements[i] = rewriteStatement(s, f)
+		}
+	case *InterpolatedString:
+		for i, text := range n.Texts {
+			n.Texts[i] = rewriteStringLiteral(text, f)
+		}
+		for i, expr := range n.Expressions {
+			n.Expressions[i] = rewriteExpression(expr, f)
+		}
+	case *PrefixExpression:
+		n.Right = rewriteExpression(n.Right, f)
+	case *InfixExpression:
+		n.Left = rewriteExpression(n.Left, f)
+		n.Right = rewriteExpression(n.Right, f)
+	case *IfExpression:
+		n.Condition = rewriteExpression(n.Condition, f)
+		n.Consequence = rewriteBlock(n.Consequence, f)
+		n.Alternative = rewriteBlock(n.Alternative, f)
+	case *FunctionLiteral:
+		for i, param := range n.Parameters {
+			n.Parameters[i] = rewriteIdentifier(param, f)
+			if i < len(n.Types) {
+				n.Types[i] = rewriteType(n.Types[i], f)
+			}
+			if i < len(n.Defaults) {
+				n.Defaults[i] = rewriteExpression(n.Defaults[i], f)
+			}
+		}
+		n.Rest = rewriteIdentifier(n.Rest, f)
+		n.RestType = rewriteType(n.RestType, f)
+		n.ReturnType = rewriteType(n.ReturnType, f)
+		n.Body = rewriteBlock(n.Body, f)
+	case *MacroLiteral:
+		for i, param := range n.Parameters {
+			n.Parameters[i] = rewriteIdentifier(param, f)
+		}
+		n.Body = rewriteBlock(n.Body, f)
+	case *LambdaLiteral:
+		n.Parameter = rewriteIdentifier(n.Parameter, f)
+		n.Body = rewriteExpression(n.Body, f)
+	case *PipeExpression:
+		n.Left = rewriteExpression(n.Left, f)
+		n.Right = rewriteExpression(n.Right, f)
+	case *CallExpression:
+		n.Left = rewriteExpression(n.Left, f)
+		for i, arg := range n.Arguments {
+			n.Arguments[i] = rewriteExpression(arg, f)
+		}
+	case *SpreadExpression:
+		n.Value = rewriteExpression(n.Value, f)
+	case *ArrayLiteral:
+		for i, e := range n.Elements {
+			n.Elements[i] = rewriteExpression(e, f)
+		}
+	case *IndexExpression:
+		n.Left = rewriteExpression(n.Left, f)
+		n.Index = rewriteExpression(n.Index, f)
+	case *PropertyExpression:
+		n.Left = rewriteExpression(n.Left, f)
+		n.Property = rewriteIdentifier(n.Property, f)
+	case *MapLiteral:
+		keys := n.OrderedKeys()
+		entries := make(map[Expression]Expression, len(keys))
+		for i, key := range keys {
+			value := n.Entries[key]
+			keys[i] = rewriteExpression(key, f)
+			entries[keys[i]] = rewriteExpression(value, f)
+		}
+		n.Keys = keys
+		n.Entries = entries
+	case *MatchExpression:
+		n.Subject = rewriteExpression(n.Subject, f)
+		for i, arm := range n.Arms {
+			rewritten, ok := Rewrite(arm, f).(*MatchArm)
+			if !ok {
+				panic(fmt.Sprintf("ast.Rewrite: cannot replace match arm by %T", rewritten))
+			}
+			n.Arms[i] = rewritten
+		}
+	case *MatchArm:
+		n.Pattern = rewritePattern(n.Pattern, f)
+		n.Guard = rewriteExpression(n.Guard, f)
+		n.Body = rewriteExpression(n.Body, f)
+	case *LiteralPattern:
+		n.Value = rewriteExpression(n.Value, f)
+	case *BindingPattern:
+		n.Name = rewriteIdentifier(n.Name, f)
+	case *ArrayPattern:
+		for i, e := range n.Elements {
+			n.Elements[i] = rewritePattern(e, f)
+		}
+		n.Rest = rewriteIdentifier(n.Rest, f)
+	case *MapPattern:
+		for _, entry := range n.Entries {
+			entry.Key = rewriteExpression(entry.Key, f)
+			entry.Value = rewritePattern(entry.Value, f)
+		}
+	case *ArrayType:
+		n.Element = rewriteType(n.Element, f)
+	case *MapType:
+		n.Key = rewriteType(n.Key, f)
+		n.Value = rewriteType(n.Value, f)
+	case *FunctionType:
+		for i, param := range n.Parameters {
+			n.Parameters[i] = rewriteType(param, f)
+		}
+		n.Return = rewriteType(n.Return, f)
+	case *Identifier, *IntegerLiteral, *BooleanLiteral, *StringLiteral, *NullLiteral, *Comment, *WildcardPattern, *NamedType:
+		// leaves
+	default:
+		panic(fmt.Sprintf("ast.Rewrite: unexpected node type %T", n))
+	}
+
+	return f(node)
+}
+
+func rewriteStatement(s Statement, f RewriteFunc) Statement {
+	if s == nil {
+		return nil
+	}
+
+	rewritten, ok := Rewrite(s, f).(Statement)
+	if !ok {
+		panic(fmt.Sprintf("ast.Rewrite: cannot replace statement %T by %T", s, rewritten))
+	}
+	return rewritten
+}
+
+func rewriteExpression(e Expression, f RewriteFunc) Expression {
+	if e == nil {
+		return nil
+	}
+
+	rewritten, ok := Rewrite(e, f).(Expression)
+	if !ok {
+		panic(fmt.Sprintf("ast.Rewrite: cannot replace expression %T by %T", e, rewritten))
+	}
+	return rewritten
+}
+
+func rewritePattern(pattern Pattern, f RewriteFunc) Pattern {
+	if pattern == nil {
+		return nil
+	}
+
+	rewritten, ok := Rewrite(pattern, f).(Pattern)
+	if !ok {
+		panic(fmt.Sprintf("ast.Rewrite: cannot replace pattern %T by %T", pattern, rewritten))
+	}
+	return rewritten
+}
+
+func rewriteType(typ Type, f RewriteFunc) Type {
+	if typ == nil {
+		return nil
+	}
+
+	rewritten, ok := Rewrite(typ, f).(Type)
+	if !ok {
+		panic(fmt.Sprintf("ast.Rewrite: cannot replace type %T by %T", typ, rewritten))
+	}
+	return rewritten
+}
+
+func rewriteIdentifier(ident *Identifier, f RewriteFunc) *Identifier {
+	if ident == nil {
+		return nil
+	}
+
+	rewritten, ok := Rewrite(ident, f).(*Identifier)
+	if !ok {
+		panic(fmt.Sprintf("ast.Rewrite: cannot replace identifier by %T", rewritten))
+	}
+	return rewritten
+}
+
+func rewriteStringLiteral(str *StringLiteral, f RewriteFunc) *StringLiteral {
+	rewritten, ok := Rewrite(str, f).(*StringLiteral)
+	if !ok {
+		panic(fmt.Sprintf("ast.Rewrite: cannot replace string literal by %T", rewritten))
+	}
+	return rewritten
+}
+
+func rewriteBlock(block *BlockStatement, f RewriteFunc) *BlockStatement {
+	if block == nil {
+		return nil
+	}
+
+	rewritten, ok := Rewrite(block, f).(*BlockStatement)
+	if !ok {
+		panic(fmt.Sprintf("ast.Rewrite: cannot replace block by %T", rewritten))
+	}
+	return rewritten
+}
@@ -0,0 +1,177 @@
+package ast_test
+
+import (
+	"compiler/ast"
+	"compiler/parser"
+	"compiler/scanner"
+	"fmt"
+	"testing"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	p := parser.New(scanner.NewHandcodedScanner(input))
+	program := p.ParseProgram()
+	if len(p.Errors) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors)
+	}
+
+	return program
+}
+
+type kindCounter struct {
+	kinds []string
+}
+
+func (c *kindCounter) Visit(node ast.Node) ast.Visitor {
+	if node == nil {
+		return nil
+	}
+
+	c.kinds = append(c.kinds, fmt.Sprintf("%T", node))
+
+	if _, ok := node.(*ast.FunctionLiteral); ok {
+		return nil
+	}
+	return c
+}
+
+func TestWalk(t *testing.T) {
+	program := parse(t, `let x = -1 + 2; if (x) { [x] } else { {"a": x}[x] }; fn(y) { y }(3); return x;`)
+
+	counter := &kindCounter{}
+	ast.Walk(counter, program)
+
+	expected := []string{
+		"*ast.Program",
+		"*ast.LetStatement", "*ast.Identifier", "*ast.InfixExpression",
+		"*ast.PrefixExpression", "*ast.IntegerLiteral", "*ast.IntegerLiteral",
+		"*ast.ExpressionStatement", "*ast.IfExpression", "*ast.Identifier",
+		"*ast.BlockStatement", "*ast.ExpressionStatement", "*ast.ArrayLiteral", "*ast.Identifier",
+		"*ast.BlockStatement", "*ast.ExpressionStatement", "*ast.IndexExpression",
+		"*ast.MapLiteral", "*ast.StringLiteral", "*ast.Identifier", "*ast.Identifier",
+		"*ast.ExpressionStatement", "*ast.CallExpression", "*ast.FunctionLiteral", "*ast.IntegerLiteral",
+		"*ast.ReturnStatement", "*ast.Identifier",
+	}
+
+	if len(counter.kinds) != len(expected) {
+		t.Fatalf("wrong number of visited nodes. want=%d, got=%d (%v)", len(expected), len(counter.kinds), counter.kinds)
+	}
+
+	for i, kind := range expected {
+		if counter.kinds[i] != kind {
+			t.Errorf("wrong node at %d. want=%s, got=%s", i, kind, counter.kinds[i])
+		}
+	}
+}
+
+func TestWalkMatchExpression(t *testing.T) {
+	program := parse(t, `match (x) { 1 => a, [b, ...c] if b => b, {d} => d, _ => 0 }`)
+
+	counter := &kindCounter{}
+	ast.Walk(counter, program.Statements[0].(*ast.ExpressionStatement).Expression)
+
+	expected := []string{
+		"*ast.MatchExpression", "*ast.Identifier",
+		"*ast.MatchArm", "*ast.LiteralPattern", "*ast.IntegerLiteral", "*ast.Identifier",
+		"*ast.MatchArm", "*ast.ArrayPattern", "*ast.BindingPattern", "*ast.Identifier", "*ast.Identifier",
+		"*ast.Identifier", "*ast.Identifier",
+		"*ast.MatchArm", "*ast.MapPattern", "*ast.StringLiteral", "*ast.BindingPattern", "*ast.Identifier",
+		"*ast.Identifier",
+		"*ast.MatchArm", "*ast.WildcardPattern", "*ast.IntegerLiteral",
+	}
+
+	if len(counter.kinds) != len(expected) {
+		t.Fatalf("wrong number of visited nodes. want=%d, got=%d (%v)", len(expected), len(counter.kinds), counter.kinds)
+	}
+
+	for i, kind := range expected {
+		if counter.kinds[i] != kind {
+			t.Errorf("wrong node at %d. want=%s, got=%s", i, kind, counter.kinds[i])
+		}
+	}
+}
+
+func TestInspect(t *testing.T) {
+	program := parse(t, `let add = fn(a, b) { a + b }; add(a, "b")`)
+
+	identifiers := 0
+	nils := 0
+	ast.Inspect(program, func(node ast.Node) bool {
+		if node == nil {
+			nils++
+			return false
+		}
+
+		if ident, ok := node.(*ast.Identifier); ok && ident.Value == "a" {
+			identifiers++
+		}
+		return true
+	})
+
+	if identifiers != 3 {
+		t.Errorf("wrong number of identifiers named a. want=3, got=%d", identifiers)
+	}
+
+	if nils == 0 {
+		t.Errorf("expected Inspect to call f with nil after visiting children")
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`1`, `2`},
+		{`-1`, `(-2)`},
+		{`1 + 1`, `(2 + 2)`},
+		{`let x = 1;`, `let x = 2;`},
+		{`return 1;`, `return 2;`},
+		{`if (1) { 1 } else { 1 }`, `if (2) {2} {2}`},
+		{`fn(x) { 1 }`, `fn(x){2}`},
+		{`fn(x = 1, ...y) { f(...[1]) }`, `fn(x = 2, ...y){f(...[2])}`},
+		{`f(1, 1)`, `f(2, 2)`},
+		{`[1][1]`, `[2][2]`},
+		{`{1: 1}`, `{ 2: 2 }`},
+		{`match (1) { 1 if 1 => 1 }`, `match (2) { 2 if 2 => 2 }`},
+	}
+
+	turnOneIntoTwo := func(node ast.Node) ast.Node {
+		integer, ok := node.(*ast.IntegerLiteral)
+		if !ok || integer.Value != 1 {
+			return node
+		}
+
+		tok := integer.Token
+		tok.Literal = "2"
+		return &ast.IntegerLiteral{Token: tok, Value: 2}
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		rewritten := ast.Rewrite(program, turnOneIntoTwo)
+
+		if rewritten.String() != tt.expected {
+			t.Errorf("wrong rewrite of %q. want=%q, got=%q", tt.input, tt.expected, rewritten.String())
+		}
+	}
+}
+
+func TestRewriteRejectsMismatchingReplacements(t *testing.T) {
+	program := parse(t, `let x = 1;`)
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected panic when replacing an expression by a statement")
+		}
+	}()
+
+	ast.Rewrite(program, func(node ast.Node) ast.Node {
+		if _, ok := node.(*ast.IntegerLiteral); ok {
+			return &ast.ReturnStatement{}
+		}
+		return node
+	})
+}
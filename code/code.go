@@ -13,17 +13,17 @@ func (ins Instructions) String() string {
 
 	i := 0
 	for i < len(ins) {
-		def, err := Lookup(ins[i])
+		def, header, err := LookupInstruction(ins[i:])
 		if err != nil {
 			fmt.Fprintf(&out, "ERROR: %s\n", err)
 			continue
 		}
 
-		operands, read := ReadOperands(def, ins[i+1:])
+		operands, read := ReadOperands(def, ins[i+header:])
 
 		fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
 
-		i += 1 + read
+		i += header + read
 	}
 
 	return out.String()
@@ -83,45 +83,96 @@ const (
 	OpClosure
 	OpGetFree
 	OpCurrentClosure
+	OpMatchLiteral
+	OpMatchArray
+	OpMatchMap
+	OpHasKey
+	OpSlice
+	OpMatchFail
+	OpDestructureFail
+	OpJumpIfArgument
+	OpCallSpread
+	OpGetProperty
+	OpGetOptionalProperty
+	OpJumpIfNull
+	OpJumpIfNotNull
+	OpBuildString
+	OpDup
+	// OpWide prefixes an instruction whose operands are all four bytes
+	// wide. Make adds it when an operand does not fit its usual width.
+	OpWide
 )
 
+// wideWidth is the width of every operand of a wide instruction.
+const wideWidth = 4
+
 type Definition struct {
 	Name          string
 	OperandWidths []int
 }
 
 var definitions = map[Opcode]*Definition{
-	OpConstant:       {"OpConstant", []int{2}},
-	OpPop:            {"OpPop", []int{}},
-	OpAdd:            {"OpAdd", []int{}},
-	OpSub:            {"OpSub", []int{}},
-	OpMul:            {"OpMul", []int{}},
-	OpDiv:            {"OpDiv", []int{}},
-	OpTrue:           {"OpTrue", []int{}},
-	OpFalse:          {"OpFalse", []int{}},
-	OpNull:           {"OpNull", []int{}},
-	OpEqual:          {"OpEqual", []int{}},
-	OpNotEqual:       {"OpNotEqual", []int{}},
-	OpGreater:        {"OpGreater", []int{}},
-	OpGreaterEqual:   {"OpGreaterEqual", []int{}},
-	OpBang:           {"OpBang", []int{}},
-	OpMinus:          {"OpMinus", []int{}},
-	OpJumpNotTrue:    {"OpJumpNotTrue", []int{2}},
-	OpJump:           {"OpJump", []int{2}},
-	OpSetGlobal:      {"OpSetGlobal", []int{2}},
-	OpGetGlobal:      {"OpGetGlobal", []int{2}},
-	OpArray:          {"OpArray", []int{2}},
-	OpMap:            {"OpMap", []int{2}},
-	OpIndex:          {"OpIndex", []int{}},
-	OpReturn:         {"OpReturn", []int{}},
-	OpReturnValue:    {"OpReturnValue", []int{}},
-	OpCall:           {"OpCall", []int{1}},
-	OpSetLocal:       {"OpSetLocal", []int{1}},
-	OpGetLocal:       {"OpGetLocal", []int{1}},
-	OpGetBuiltin:     {"OpGetBuiltin", []int{1}},
-	OpClosure:        {"OpClosure", []int{2, 1}},
-	OpGetFree:        {"OpGetFree", []int{1}},
-	OpCurrentClosure: {"OpCurrentClosure", []int{}},
+	OpConstant:            {"OpConstant", []int{2}},
+	OpPop:                 {"OpPop", []int{}},
+	OpAdd:                 {"OpAdd", []int{}},
+	OpSub:                 {"OpSub", []int{}},
+	OpMul:                 {"OpMul", []int{}},
+	OpDiv:                 {"OpDiv", []int{}},
+	OpTrue:                {"OpTrue", []int{}},
+	OpFalse:               {"OpFalse", []int{}},
+	OpNull:                {"OpNull", []int{}},
+	OpEqual:               {"OpEqual", []int{}},
+	OpNotEqual:            {"OpNotEqual", []int{}},
+	OpGreater:             {"OpGreater", []int{}},
+	OpGreaterEqual:        {"OpGreaterEqual", []int{}},
+	OpBang:                {"OpBang", []int{}},
+	OpMinus:               {"OpMinus", []int{}},
+	OpJumpNotTrue:         {"OpJumpNotTrue", []int{2}},
+	OpJump:                {"OpJump", []int{2}},
+	OpSetGlobal:           {"OpSetGlobal", []int{2}},
+	OpGetGlobal:           {"OpGetGlobal", []int{2}},
+	OpArray:               {"OpArray", []int{2}},
+	OpMap:                 {"OpMap", []int{2}},
+	OpIndex:               {"OpIndex", []int{}},
+	OpReturn:              {"OpReturn", []int{}},
+	OpReturnValue:         {"OpReturnValue", []int{}},
+	OpCall:                {"OpCall", []int{1}},
+	OpSetLocal:            {"OpSetLocal", []int{1}},
+	OpGetLocal:            {"OpGetLocal", []int{1}},
+	OpGetBuiltin:          {"OpGetBuiltin", []int{1}},
+	OpClosure:             {"OpClosure", []int{2, 1}},
+	OpGetFree:             {"OpGetFree", []int{1}},
+	OpCurrentClosure:      {"OpCurrentClosure", []int{}},
+	OpMatchLiteral:        {"OpMatchLiteral", []int{}},
+	OpMatchArray:          {"OpMatchArray", []int{2, 1}},
+	OpMatchMap:            {"OpMatchMap", []int{}},
+	OpHasKey:              {"OpHasKey", []int{}},
+	OpSlice:               {"OpSlice", []int{2}},
+	OpMatchFail:           {"OpMatchFail", []int{}},
+	OpDestructureFail:     {"OpDestructureFail", []int{}},
+	OpJumpIfArgument:      {"OpJumpIfArgument", []int{1, 2}},
+	OpCallSpread:          {"OpCallSpread", []int{1}},
+	OpGetProperty:         {"OpGetProperty", []int{2}},
+	OpGetOptionalProperty: {"OpGetOptionalProperty", []int{2}},
+	OpJumpIfNull:          {"OpJumpIfNull", []int{2}},
+	OpJumpIfNotNull:       {"OpJumpIfNotNull", []int{2}},
+	OpBuildString:         {"OpBuildString", []int{2}},
+	OpDup:                 {"OpDup", []int{}},
+	OpWide:                {"OpWide", []int{}},
+}
+
+// wideDefinitions holds the definitions of the instructions following
+// OpWide.
+var wideDefinitions = make(map[Opcode]*Definition)
+
+func init() {
+	for op, def := range definitions {
+		widths := make([]int, len(def.OperandWidths))
+		for i := range widths {
+			widths[i] = wideWidth
+		}
+		wideDefinitions[op] = &Definition{"OpWide " + def.Name, widths}
+	}
 }
 
 func Lookup(op byte) (*Definition, error) {
@@ -133,24 +184,80 @@ func Lookup(op byte) (*Definition, error) {
 	return def, nil
 }
 
+// LookupInstruction returns the definition of the instruction at the start
+// of ins and the number of bytes in front of its operands. The definition
+// of a wide instruction has the widths of its wide operands.
+func LookupInstruction(ins Instructions) (*Definition, int, error) {
+	if Opcode(ins[0]) != OpWide {
+		def, err := Lookup(ins[0])
+		return def, 1, err
+	}
+
+	if len(ins) < 2 {
+		return nil, 0, fmt.Errorf("OpWide is missing its instruction")
+	}
+	if _, err := Lookup(ins[1]); err != nil || Opcode(ins[1]) == OpWide {
+		return nil, 0, fmt.Errorf("opcode %d cannot be wide", ins[1])
+	}
+	return wideDefinitions[Opcode(ins[1])], 2, nil
+}
+
+// Validate checks that ins consists of defined opcodes followed by all of
+// their operands, e.g. after reading instructions from a file.
+func (ins Instructions) Validate() error {
+	i := 0
+	for i < len(ins) {
+		def, header, err := LookupInstruction(ins[i:])
+		if err != nil {
+			return fmt.Errorf("offset %d: %w", i, err)
+		}
+
+		width := 0
+		for _, w := range def.OperandWidths {
+			width += w
+		}
+		if i+header+width > len(ins) {
+			return fmt.Errorf("offset %d: %s is missing operands", i, def.Name)
+		}
+
+		i += header + width
+	}
+
+	return nil
+}
+
+// Make encodes an instruction. It is made wide if an operand does not fit
+// its usual width.
 func Make(op Opcode, operands ...int) []byte {
 	def, ok := definitions[op]
 	if !ok {
 		return []byte{}
 	}
 
-	instructionLen := 1
+	var header []byte
+	for i, o := range operands {
+		if o >= 1<<(8*def.OperandWidths[i]) {
+			def = wideDefinitions[op]
+			header = []byte{byte(OpWide)}
+			break
+		}
+	}
+	header = append(header, byte(op))
+
+	instructionLen := len(header)
 	for _, w := range def.OperandWidths {
 		instructionLen += w
 	}
 
 	instruction := make([]byte, instructionLen)
-	instruction[0] = byte(op)
+	copy(instruction, header)
 
-	offset := 1
+	offset := len(header)
 	for i, o := range operands {
 		width := def.OperandWidths[i]
 		switch width {
+		case 4:
+			binary.BigEndian.PutUint32(instruction[offset:], uint32(o))
 		case 2:
 			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
 		case 1:
@@ -168,6 +275,8 @@ func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
 
 	for i, width := range def.OperandWidths {
 		switch width {
+		case 4:
+			operands[i] = int(ReadUint32(ins[offset:]))
 		case 2:
 			operands[i] = int(ReadUint16(ins[offset:]))
 		case 1:
@@ -180,6 +289,27 @@ func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
 	return operands, offset
 }
 
+// ReadOperand reads an operand of width bytes from the start of ins, or a
+// wide operand if wide is set, and returns it with the bytes read.
+func ReadOperand(ins Instructions, width int, wide bool) (int, int) {
+	if wide {
+		width = wideWidth
+	}
+
+	switch width {
+	case 4:
+		return int(ReadUint32(ins)), width
+	case 2:
+		return int(ReadUint16(ins)), width
+	default:
+		return int(ReadUint8(ins)), width
+	}
+}
+
+func ReadUint32(ins Instructions) uint32 {
+	return binary.BigEndian.Uint32(ins)
+}
+
 func ReadUint16(ins Instructions) uint16 {
 	return binary.BigEndian.Uint16(ins)
 }
@@ -1,6 +1,9 @@
 package code
 
-import "testing"
+import (
+	"compiler/token"
+	"testing"
+)
 
 func TestMake(t *testing.T) {
 	tests := []struct {
@@ -10,6 +13,9 @@ func TestMake(t *testing.T) {
 	}{
 		{OpConstant, []int{65534}, []byte{byte(OpConstant), 255, 254}},
 		{OpClosure, []int{65534, 255}, []byte{byte(OpClosure), 255, 254, 255}},
+		{OpConstant, []int{65536}, []byte{byte(OpWide), byte(OpConstant), 0, 1, 0, 0}},
+		{OpGetLocal, []int{256}, []byte{byte(OpWide), byte(OpGetLocal), 0, 0, 1, 0}},
+		{OpClosure, []int{1, 256}, []byte{byte(OpWide), byte(OpClosure), 0, 0, 0, 1, 0, 0, 1, 0}},
 	}
 
 	for _, tt := range tests {
@@ -44,6 +50,8 @@ func TestInstructionsString(t *testing.T) {
 		Make(OpSetLocal, 1),
 		Make(OpGetLocal, 1),
 		Make(OpClosure, 65535, 255),
+		Make(OpClosure, 65535, 256),
+		Make(OpPop),
 	}
 
 	expected := `0000 OpConstant 1
@@ -59,6 +67,8 @@ func TestInstructionsString(t *testing.T) {
 0016 OpSetLocal 1
 0018 OpGetLocal 1
 0020 OpClosure 65535 255
+0024 OpWide OpClosure 65535 256
+0034 OpPop
 `
 
 	concatted := Instructions{}
@@ -80,17 +90,19 @@ func TestReadOperands(t *testing.T) {
 	}{
 		{OpConstant, []int{65535}, 2},
 		{OpClosure, []int{65535, 255}, 3},
+		{OpConstant, []int{65536}, 4},
+		{OpClosure, []int{65535, 256}, 8},
 	}
 
 	for _, tt := range tests {
 		instruction := Make(tt.op, tt.operands...)
 
-		def, err := Lookup(byte(tt.op))
+		def, header, err := LookupInstruction(instruction)
 		if err != nil {
 			t.Fatalf("definition not found: %q\n", err)
 		}
 
-		operandsRead, n := ReadOperands(def, instruction[1:])
+		operandsRead, n := ReadOperands(def, instruction[header:])
 		if n != tt.bytesRead {
 			t.Fatalf("n wrong. want=%d, got=%d", tt.bytesRead, n)
 		}
@@ -102,3 +114,52 @@ func TestReadOperands(t *testing.T) {
 		}
 	}
 }
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		ins      Instructions
+		expected string
+	}{
+		{append(Make(OpConstant, 1), Make(OpPop)...), ""},
+		{Instructions{255}, "offset 0: opcode 255 undefined"},
+		{append(Make(OpPop), Make(OpClosure, 1, 2)[:3]...), "offset 1: OpClosure is missing operands"},
+		{append(Make(OpConstant, 1<<16), Make(OpPop)...), ""},
+		{Make(OpConstant, 1<<16)[:5], "offset 0: OpWide OpConstant is missing operands"},
+		{Instructions{byte(OpWide)}, "offset 0: OpWide is missing its instruction"},
+		{Instructions{byte(OpWide), byte(OpWide), byte(OpPop)}, "offset 0: opcode 46 cannot be wide"},
+	}
+
+	for _, tt := range tests {
+		err := tt.ins.Validate()
+		actual := ""
+		if err != nil {
+			actual = err.Error()
+		}
+		if actual != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expected, actual)
+		}
+	}
+}
+
+func TestLineTableLookup(t *testing.T) {
+	first := token.Position{Offset: 0, Line: 1, Column: 1}
+	second := token.Position{Offset: 4, Line: 2, Column: 1}
+	table := LineTable{{Offset: 2, Position: first}, {Offset: 5, Position: second}}
+
+	tests := []struct {
+		offset   int
+		expected token.Position
+	}{
+		{0, token.Position{}},
+		{2, first},
+		{4, first},
+		{5, second},
+		{100, second},
+	}
+
+	for _, tt := range tests {
+		if pos := table.Lookup(tt.offset); pos != tt.expected {
+			t.Errorf("wrong position for offset %d. want=%s, got=%s", tt.offset, tt.expected, pos)
+		}
+	}
+}
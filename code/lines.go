@@ -0,0 +1,29 @@
+package code
+
+import (
+	"compiler/token"
+	"sort"
+)
+
+// LineEntry maps the instructions starting at Offset to the source
+// position they were compiled from.
+type LineEntry struct {
+	Offset   int
+	Position token.Position
+}
+
+// LineTable maps instructions to source positions. Entries are sorted by
+// Offset, each one applies up to the Offset of the next.
+type LineTable []LineEntry
+
+// Lookup returns the source position of the instruction at offset, or the
+// zero Position if it is unknown.
+func (table LineTable) Lookup(offset int) token.Position {
+	i := sort.Search(len(table), func(i int) bool {
+		return table[i].Offset > offset
+	})
+	if i == 0 {
+		return token.Position{}
+	}
+	return table[i-1].Position
+}
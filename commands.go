@@ -0,0 +1,311 @@
+package main
+
+import (
+	"compiler/ast"
+	"compiler/compiler"
+	"compiler/evaluator"
+	"compiler/format"
+	"compiler/lint"
+	"compiler/parser"
+	"compiler/scanner"
+	"compiler/types"
+	"compiler/vm"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func parseFile(path string) (*ast.Program, error) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	p := parser.New(scanner.NewHandcodedScanner(string(source)))
+	program := p.ParseProgram()
+	if len(p.Errors) != 0 {
+		return nil, fmt.Errorf("%s: %w", path, errors.New(strings.Join(p.Errors, "\n")))
+	}
+
+	return program, nil
+}
+
+// formatCommand prints the canonical formatting of every given file, or
+// rewrites the files in place when -w is set.
+func formatCommand(args []string) error {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	write := flags.Bool("w", false, "write result to the source file instead of stdout")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() == 0 {
+		return fmt.Errorf("usage: fmt [-w] file...")
+	}
+
+	for _, path := range flags.Args() {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		formatted, err := format.Source(string(source))
+		if err != nil {
+			return fmt.Errorf("%s: %s", path, err)
+		}
+
+		if !*write {
+			fmt.Print(formatted)
+			continue
+		}
+
+		if formatted != string(source) {
+			err = os.WriteFile(path, []byte(formatted), 0644)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// astCommand prints the JSON encoding of the syntax tree of a file.
+func astCommand(args []string) error {
+	flags := flag.NewFlagSet("ast", flag.ContinueOnError)
+	compact := flags.Bool("compact", false, "print the JSON without indentation")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: ast [-compact] file")
+	}
+
+	program, err := parseFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	encode := ast.EncodeJSONIndent
+	if *compact {
+		encode = ast.EncodeJSON
+	}
+
+	encoded, err := encode(program)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(string(encoded))
+	return nil
+}
+
+// checkCommand reports the unresolved names and type errors of every given
+// file. With -strict the types of unannotated code are inferred as well and
+// the signatures of the top-level declarations are printed.
+func checkCommand(args []string) error {
+	flags := flag.NewFlagSet("check", flag.ContinueOnError)
+	strict := flags.Bool("strict", false, "infer the types of unannotated code")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() == 0 {
+		return fmt.Errorf("usage: check [-strict] file...")
+	}
+
+	failed := false
+	for _, path := range flags.Args() {
+		program, err := parseFile(path)
+		if err != nil {
+			return err
+		}
+
+		for _, err := range compiler.Resolve(program) {
+			fmt.Fprintf(os.Stderr, "%s:%s\n", path, err)
+			failed = true
+		}
+
+		var typeErrors []*types.Error
+		if *strict {
+			var info *types.Info
+			info, typeErrors = types.Infer(program)
+			if len(typeErrors) == 0 {
+				for _, binding := range info.Bindings {
+					fmt.Printf("%s:%s: %s\n", path, binding.Position, binding)
+				}
+			}
+		} else {
+			typeErrors = types.Check(program)
+		}
+
+		for _, err := range typeErrors {
+			fmt.Fprintf(os.Stderr, "%s:%s\n", path, err)
+			failed = true
+		}
+	}
+
+	if failed {
+		return errors.New("type check failed")
+	}
+	return nil
+}
+
+// lintCommand prints the warnings of the lint rules for every given file.
+// The rules can be configured by a file passed with -config.
+func lintCommand(args []string) error {
+	flags := flag.NewFlagSet("lint", flag.ContinueOnError)
+	configPath := flags.String("config", "", "read the rule configuration from `file`")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() == 0 {
+		return fmt.Errorf("usage: lint [-config file] file...")
+	}
+
+	var config *lint.Config
+	if *configPath != "" {
+		var err error
+		config, err = lint.LoadConfig(*configPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	failed := false
+	for _, path := range flags.Args() {
+		program, err := parseFile(path)
+		if err != nil {
+			return err
+		}
+
+		for _, d := range lint.Lint(program, config) {
+			fmt.Fprintf(os.Stderr, "%s:%s\n", path, d)
+			failed = true
+		}
+	}
+
+	if failed {
+		return errors.New("lint found problems")
+	}
+	return nil
+}
+
+// compileFile expands the macros of a source file, checks it and compiles
+// it. Unresolved names and type errors are printed to stderr.
+func compileFile(path string, options compiler.Options) (*compiler.Bytecode, error) {
+	program, err := parseFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	env := evaluator.NewEnvironment()
+	evaluator.DefineMacros(program, env)
+	expanded, err := evaluator.ExpandMacros(program, env)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	failed := false
+	for _, err := range compiler.Resolve(expanded) {
+		fmt.Fprintf(os.Stderr, "%s:%s\n", path, err)
+		failed = true
+	}
+	for _, err := range types.Check(expanded) {
+		fmt.Fprintf(os.Stderr, "%s:%s\n", path, err)
+		failed = true
+	}
+	if failed {
+		return nil, errors.New("compilation failed")
+	}
+
+	comp := compiler.NewWithOptions(options)
+	if err := comp.Compile(expanded); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return comp.Bytecode(), nil
+}
+
+// compileCommand writes the bytecode file of a source file, next to it
+// unless -o is given.
+func compileCommand(args []string) error {
+	flags := flag.NewFlagSet("compile", flag.ContinueOnError)
+	output := flags.String("o", "", "write the bytecode to `file`")
+	noopt := flags.Bool("noopt", false, "disable optimizations")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: compile [-o file] [-noopt] file")
+	}
+
+	path := flags.Arg(0)
+	options := compiler.DefaultOptions
+	if *noopt {
+		options = compiler.Options{}
+	}
+
+	bytecode, err := compileFile(path, options)
+	if err != nil {
+		return err
+	}
+
+	encoded, err := compiler.EncodeBytecode(bytecode)
+	if err != nil {
+		return err
+	}
+
+	if *output == "" {
+		*output = strings.TrimSuffix(path, filepath.Ext(path)) + ".bc"
+	}
+	return os.WriteFile(*output, encoded, 0644)
+}
+
+// runCommand runs a bytecode file or compiles and runs a source file and
+// prints the value of its last expression statement.
+func runCommand(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: run file")
+	}
+
+	path := args[0]
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var bytecode *compiler.Bytecode
+	if compiler.IsBytecode(data) {
+		bytecode, err = compiler.DecodeBytecode(data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	} else {
+		bytecode, err = compileFile(path, compiler.DefaultOptions)
+		if err != nil {
+			return err
+		}
+	}
+
+	machine := vm.New(bytecode)
+	if err := machine.Run(); err != nil {
+		var runtimeErr *vm.RuntimeError
+		if !errors.As(err, &runtimeErr) || len(runtimeErr.Trace) == 0 {
+			return err
+		}
+
+		fmt.Fprintf(os.Stderr, "%s:%s: %s\n%s", path, runtimeErr.Trace[0].Position, err, runtimeErr.StackTrace())
+		return errors.New("runtime error")
+	}
+
+	if result := machine.LastPopped(); result != nil {
+		fmt.Println(result.String())
+	}
+	return nil
+}
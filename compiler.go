@@ -2,9 +2,36 @@ package main
 
 import (
 	"compiler/repl"
+	"fmt"
 	"os"
 )
 
 func main() {
-	repl.Start(os.Stdin, os.Stdout)
+	if len(os.Args) < 2 {
+		repl.Start(os.Stdin, os.Stdout)
+		return
+	}
+
+	var err error
+	switch command, args := os.Args[1], os.Args[2:]; command {
+	case "fmt":
+		err = formatCommand(args)
+	case "ast":
+		err = astCommand(args)
+	case "check":
+		err = checkCommand(args)
+	case "lint":
+		err = lintCommand(args)
+	case "compile":
+		err = compileCommand(args)
+	case "run":
+		err = runCommand(args)
+	default:
+		err = fmt.Errorf("unknown command: %s", command)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 }
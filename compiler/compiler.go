@@ -4,6 +4,7 @@ import (
 	"compiler/ast"
 	"compiler/code"
 	"compiler/object"
+	"compiler/token"
 	"fmt"
 )
 
@@ -14,10 +15,35 @@ type Compiler struct {
 	scopeIndex int
 
 	symbolTable *SymbolTable
+
+	hiddenCount int
+
+	// position is the source position of the node being compiled.
+	position token.Position
+
+	options Options
+	stats   PeepholeStats
+}
+
+// Options selects the optimizations a Compiler runs.
+type Options struct {
+	// Fold folds constant expressions and removes dead if branches before
+	// code is generated, see Fold.
+	Fold bool
+	// Peephole are the rules of the peephole pass run over the generated
+	// instructions of the program and every function, see Peephole.
+	Peephole []*PeepholeRule
 }
 
+// DefaultOptions enables every optimization.
+var DefaultOptions = Options{Fold: true, Peephole: PeepholeRules}
+
 type CompilationScope struct {
 	instructions code.Instructions
+	lines        code.LineTable
+	// longJumps holds the targets of the jumps at the given offsets that
+	// do not fit their operand. They are made wide by relocateJumps.
+	longJumps map[int]int
 
 	lastInstruction     EmittedInstruction
 	previousInstruction EmittedInstruction
@@ -29,6 +55,10 @@ type EmittedInstruction struct {
 }
 
 func New() *Compiler {
+	return NewWithOptions(DefaultOptions)
+}
+
+func NewWithOptions(options Options) *Compiler {
 	mainScope := &CompilationScope{
 		instructions: code.Instructions{},
 	}
@@ -43,18 +73,35 @@ func New() *Compiler {
 		scopeIndex: 0,
 
 		symbolTable: symbolTable,
+
+		options: options,
 	}
 }
 
 func (c *Compiler) Compile(node ast.Node) error {
+	defer c.at(node)()
+
 	switch node := node.(type) {
 	case *ast.Program:
+		// Fold rewrites in place, the program of the caller is left alone
+		if c.options.Fold {
+			node = Fold(ast.Clone(node).(*ast.Program))
+		}
+
 		for _, s := range node.Statements {
 			err := c.Compile(s)
 			if err != nil {
 				return err
 			}
 		}
+
+		c.relocateJumps()
+		if len(c.options.Peephole) != 0 {
+			scope := c.scopes[c.scopeIndex]
+			scope.instructions, scope.lines = c.peephole(scope.instructions, scope.lines)
+			scope.lastInstruction = EmittedInstruction{}
+			scope.previousInstruction = EmittedInstruction{}
+		}
 	case *ast.ExpressionStatement:
 		err := c.Compile(node.Expression)
 		if err != nil {
@@ -62,8 +109,13 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 		c.emit(code.OpPop)
 	case *ast.LetStatement:
+		err := c.checkAssignable(node.Name)
+		if err != nil {
+			return err
+		}
+
 		symbol := c.symbolTable.Define(node.Name.Value)
-		err := c.Compile(node.Value)
+		err = c.Compile(node.Value)
 		if err != nil {
 			return err
 		}
@@ -73,12 +125,28 @@ func (c *Compiler) Compile(node ast.Node) error {
 		} else {
 			c.emit(code.OpSetLocal, symbol.Index)
 		}
+	case *ast.ConstStatement:
+		return c.compileConstStatement(node)
+	case *ast.InfixDeclaration:
+		symbol := c.symbolTable.Define(node.Operator.Literal)
+		err := c.Compile(node.Value)
+		if err != nil {
+			return err
+		}
+
+		c.setSymbol(symbol)
+	case *ast.DestructuringLetStatement:
+		return c.compileDestructuringLetStatement(node)
 	case *ast.Identifier:
 		symbol, ok := c.symbolTable.RetrieveSymbol(node.Value)
 		if !ok {
 			return fmt.Errorf("undefined: %s", node.Value)
 		}
 
+		if symbol.Value != nil {
+			return c.Compile(symbol.Value)
+		}
+
 		c.loadSymbol(symbol)
 	case *ast.ArrayLiteral:
 		elements := node.Elements
@@ -91,32 +159,24 @@ func (c *Compiler) Compile(node ast.Node) error {
 
 		c.emit(code.OpArray, len(elements))
 	case *ast.MapLiteral:
-		entries := node.Entries
-		for key, value := range entries {
+		keys := node.OrderedKeys()
+		for _, key := range keys {
 			err := c.Compile(key)
 			if err != nil {
 				return err
 			}
 
-			err = c.Compile(value)
+			err = c.Compile(node.Entries[key])
 			if err != nil {
 				return err
 			}
 		}
 
-		c.emit(code.OpMap, len(entries))
+		c.emit(code.OpMap, len(keys))
 	case *ast.IndexExpression:
-		err := c.Compile(node.Left)
-		if err != nil {
-			return err
-		}
-
-		err = c.Compile(node.Index)
-		if err != nil {
-			return err
-		}
-
-		c.emit(code.OpIndex)
+		return c.compileChain(node)
+	case *ast.PropertyExpression:
+		return c.compileChain(node)
 	case *ast.IfExpression:
 		err := c.Compile(node.Condition)
 		if err != nil {
@@ -191,12 +251,25 @@ func (c *Compiler) Compile(node ast.Node) error {
 			c.symbolTable.Define(parameter.Value)
 		}
 
-		err := c.Compile(node.Body)
+		if node.Rest != nil {
+			c.symbolTable.Define(node.Rest.Value)
+		}
+
+		numDefaults, err := c.compileDefaults(node)
+		if err != nil {
+			return err
+		}
+
+		err = c.Compile(node.Body)
 		if err != nil {
 			return err
 		}
 
 		if c.lastInstructionIs(code.OpPop) {
+			// the implicit return belongs to the returned expression
+			scope := c.scopes[c.scopeIndex]
+			c.position = scope.lines.Lookup(scope.lastInstruction.position)
+
 			c.removeLastInstruction()
 			c.emit(code.OpReturnValue)
 		}
@@ -207,7 +280,7 @@ func (c *Compiler) Compile(node ast.Node) error {
 
 		freeSymbols := c.symbolTable.FreeSymbols
 		numLocals := c.symbolTable.numDefinitions
-		functionInstructions := c.leaveScope()
+		functionInstructions, lines := c.peephole(c.leaveScope())
 
 		for _, s := range freeSymbols {
 			c.loadSymbol(s)
@@ -215,28 +288,34 @@ func (c *Compiler) Compile(node ast.Node) error {
 
 		compiledFn := &object.CompiledFunction{
 			Instructions: functionInstructions,
+			Name:         node.Name,
+			Lines:        lines,
 			NumParams:    len(node.Parameters),
+			NumDefaults:  numDefaults,
+			Variadic:     node.Rest != nil,
 			NumLocals:    numLocals,
 		}
 
 		fnIndex := c.addConstant(compiledFn)
 		c.emit(code.OpClosure, fnIndex, len(freeSymbols))
 	case *ast.CallExpression:
-		err := c.Compile(node.Left)
-		if err != nil {
-			return err
-		}
-
-		for _, arg := range node.Arguments {
-			err := c.Compile(arg)
-			if err != nil {
-				return err
-			}
+		return c.compileChain(node)
+	case *ast.PipeExpression:
+		return c.compileChain(node.Call())
+	case *ast.LambdaLiteral:
+		return c.Compile(node.Function())
+	case *ast.SpreadExpression:
+		return fmt.Errorf("spread is only allowed in call arguments")
+	case *ast.MacroLiteral:
+		return fmt.Errorf("macros can only be defined by top-level let statements")
+	case *ast.InfixExpression:
+		if _, ok := c.symbolTable.RetrieveSymbol(string(node.Operator)); ok {
+			return c.Compile(node.Call())
 		}
 
-		c.emit(code.OpCall, len(node.Arguments))
-	case *ast.InfixExpression:
 		switch node.Operator {
+		case "??":
+			return c.compileCoalesce(node)
 		case "<=", "<":
 			err := c.Compile(node.Right)
 			if err != nil {
@@ -279,26 +358,540 @@ func (c *Compiler) Compile(node ast.Node) error {
 		default:
 			return fmt.Errorf("unknown operator %s", node.Operator)
 		}
+	case *ast.MatchExpression:
+		return c.compileMatchExpression(node)
 	case *ast.IntegerLiteral:
 		integer := &object.Integer{Value: node.Value}
 		c.emit(code.OpConstant, c.addConstant(integer))
 	case *ast.StringLiteral:
 		string := &object.String{Value: node.Value}
 		c.emit(code.OpConstant, c.addConstant(string))
+	case *ast.InterpolatedString:
+		return c.compileInterpolatedString(node)
 	case *ast.BooleanLiteral:
 		if node.Value {
 			c.emit(code.OpTrue)
 		} else {
 			c.emit(code.OpFalse)
 		}
+	case *ast.NullLiteral:
+		c.emit(code.OpNull)
 	}
 
 	return nil
 }
 
+// compileInterpolatedString pushes the non-empty texts and the values of
+// the expressions, which OpBuildString joins into a single string.
+func (c *Compiler) compileInterpolatedString(node *ast.InterpolatedString) error {
+	parts := 0
+	for i, text := range node.Texts {
+		if text.Value != "" {
+			c.emit(code.OpConstant, c.addConstant(&object.String{Value: text.Value}))
+			parts++
+		}
+
+		if i < len(node.Expressions) {
+			err := c.Compile(node.Expressions[i])
+			if err != nil {
+				return err
+			}
+			parts++
+		}
+	}
+
+	c.emit(code.OpBuildString, parts)
+	return nil
+}
+
+// compileChain compiles a chain of index, property and call expressions.
+// An optional link like a?.b jumps to the end of the whole chain if its
+// left side is null, so a?.b.c does not fail on the .c access.
+func (c *Compiler) compileChain(node ast.Expression) error {
+	nullJumps := []int{}
+
+	err := c.compileChainLink(node, &nullJumps)
+	if err != nil {
+		return err
+	}
+
+	afterChain := len(c.currentInstructions())
+	for _, position := range nullJumps {
+		c.replaceInstruction(position, code.Make(code.OpJumpIfNull, afterChain))
+	}
+
+	return nil
+}
+
+func (c *Compiler) compileChainLink(node ast.Expression, nullJumps *[]int) error {
+	defer c.at(node)()
+
+	switch node := node.(type) {
+	case *ast.IndexExpression:
+		err := c.compileChainLink(node.Left, nullJumps)
+		if err != nil {
+			return err
+		}
+
+		if node.Optional {
+			*nullJumps = append(*nullJumps, c.emit(code.OpJumpIfNull, 0))
+		}
+
+		err = c.Compile(node.Index)
+		if err != nil {
+			return err
+		}
+
+		c.emit(code.OpIndex)
+	case *ast.PropertyExpression:
+		err := c.compileChainLink(node.Left, nullJumps)
+		if err != nil {
+			return err
+		}
+
+		name := &object.String{Value: node.Property.Value}
+		if node.Optional {
+			*nullJumps = append(*nullJumps, c.emit(code.OpJumpIfNull, 0))
+			c.emit(code.OpGetOptionalProperty, c.addConstant(name))
+		} else {
+			c.emit(code.OpGetProperty, c.addConstant(name))
+		}
+	case *ast.CallExpression:
+		err := c.compileChainLink(node.Left, nullJumps)
+		if err != nil {
+			return err
+		}
+
+		if hasSpread(node.Arguments) {
+			return c.compileSpreadArguments(node.Arguments)
+		}
+
+		for _, arg := range node.Arguments {
+			err := c.Compile(arg)
+			if err != nil {
+				return err
+			}
+		}
+
+		c.emit(code.OpCall, len(node.Arguments))
+	default:
+		return c.Compile(node)
+	}
+
+	return nil
+}
+
+// compileCoalesce compiles left ?? right. The right side is only evaluated
+// if the left side is null.
+func (c *Compiler) compileCoalesce(node *ast.InfixExpression) error {
+	err := c.Compile(node.Left)
+	if err != nil {
+		return err
+	}
+
+	jumpPosition := c.emit(code.OpJumpIfNotNull, 0)
+
+	err = c.Compile(node.Right)
+	if err != nil {
+		return err
+	}
+
+	c.replaceInstruction(jumpPosition, code.Make(code.OpJumpIfNotNull, len(c.currentInstructions())))
+	return nil
+}
+
+// compileDefaults emits the prologue assigning default values to the
+// parameters the caller omitted. A default value may only refer to the
+// parameters before it, later ones are hidden while it is compiled.
+func (c *Compiler) compileDefaults(fn *ast.FunctionLiteral) (int, error) {
+	numDefaults := 0
+
+	for i, parameter := range fn.Parameters {
+		def := fn.Default(i)
+		if def == nil {
+			continue
+		}
+		numDefaults++
+
+		hidden := make(map[string]*Symbol)
+		for _, later := range fn.Parameters[i:] {
+			hidden[later.Value] = c.symbolTable.symbols[later.Value]
+		}
+		if fn.Rest != nil {
+			hidden[fn.Rest.Value] = c.symbolTable.symbols[fn.Rest.Value]
+		}
+		for name := range hidden {
+			c.symbolTable.restore(name, nil)
+		}
+
+		jumpPosition := c.emit(code.OpJumpIfArgument, i, 0)
+
+		err := c.Compile(def)
+		if err != nil {
+			return 0, err
+		}
+
+		for name, symbol := range hidden {
+			c.symbolTable.restore(name, symbol)
+		}
+
+		symbol, _ := c.symbolTable.RetrieveSymbol(parameter.Value)
+		c.setSymbol(symbol)
+
+		c.replaceInstruction(jumpPosition, code.Make(code.OpJumpIfArgument, i, len(c.currentInstructions())))
+	}
+
+	return numDefaults, nil
+}
+
+func hasSpread(arguments []ast.Expression) bool {
+	for _, arg := range arguments {
+		if _, ok := arg.(*ast.SpreadExpression); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// compileSpreadArguments pushes the arguments as arrays: runs of ordinary
+// arguments are collected by OpArray, spread values are pushed as they are.
+// OpCallSpread concatenates them and calls the function.
+func (c *Compiler) compileSpreadArguments(arguments []ast.Expression) error {
+	numArrays := 0
+	pending := 0
+
+	for _, arg := range arguments {
+		spread, ok := arg.(*ast.SpreadExpression)
+		if !ok {
+			err := c.Compile(arg)
+			if err != nil {
+				return err
+			}
+			pending++
+			continue
+		}
+
+		if pending > 0 {
+			c.emit(code.OpArray, pending)
+			numArrays++
+			pending = 0
+		}
+
+		err := c.Compile(spread.Value)
+		if err != nil {
+			return err
+		}
+		numArrays++
+	}
+
+	if pending > 0 {
+		c.emit(code.OpArray, pending)
+		numArrays++
+	}
+
+	c.emit(code.OpCallSpread, numArrays)
+	return nil
+}
+
+// compileMatchExpression stores the subject in a hidden variable and tests
+// the arms in order. Every failing check jumps to the next arm, every body
+// jumps to the end. If no arm matches, OpMatchFail raises a runtime error.
+func (c *Compiler) compileMatchExpression(match *ast.MatchExpression) error {
+	err := c.Compile(match.Subject)
+	if err != nil {
+		return err
+	}
+
+	subject := c.defineHidden("match")
+	c.setSymbol(subject)
+
+	loadSubject := func() error {
+		c.loadSymbol(subject)
+		return nil
+	}
+
+	endJumps := make([]int, 0)
+	for _, arm := range match.Arms {
+		shadowed := make(map[string]*Symbol)
+		failJumps := make([]int, 0)
+
+		err := c.compilePattern(arm.Pattern, loadSubject, &failJumps, shadowed)
+		if err != nil {
+			return err
+		}
+
+		if arm.Guard != nil {
+			err := c.Compile(arm.Guard)
+			if err != nil {
+				return err
+			}
+			failJumps = append(failJumps, c.emit(code.OpJumpNotTrue, 0))
+		}
+
+		err = c.Compile(arm.Body)
+		if err != nil {
+			return err
+		}
+		endJumps = append(endJumps, c.emit(code.OpJump, 0))
+
+		for _, pos := range failJumps {
+			c.replaceInstruction(pos, code.Make(code.OpJumpNotTrue, len(c.currentInstructions())))
+		}
+
+		// bindings are only visible inside their arm
+		for name, symbol := range shadowed {
+			c.symbolTable.restore(name, symbol)
+		}
+	}
+
+	c.loadSymbol(subject)
+	c.emit(code.OpMatchFail)
+
+	for _, pos := range endJumps {
+		c.replaceInstruction(pos, code.Make(code.OpJump, len(c.currentInstructions())))
+	}
+
+	return nil
+}
+
+// compileConstStatement defines an immutable symbol. Constants bound to a
+// literal are inlined where they are used, so no code is emitted for them.
+func (c *Compiler) compileConstStatement(stmt *ast.ConstStatement) error {
+	err := c.checkAssignable(stmt.Name)
+	if err != nil {
+		return err
+	}
+
+	if isLiteral(stmt.Value) {
+		c.symbolTable.DefineConstant(stmt.Name.Value, stmt.Value)
+		return nil
+	}
+
+	symbol := c.symbolTable.DefineConstant(stmt.Name.Value, nil)
+	err = c.Compile(stmt.Value)
+	if err != nil {
+		return err
+	}
+
+	c.setSymbol(symbol)
+	return nil
+}
+
+func isLiteral(expr ast.Expression) bool {
+	switch expr.(type) {
+	case *ast.IntegerLiteral, *ast.StringLiteral, *ast.BooleanLiteral, *ast.NullLiteral:
+		return true
+	default:
+		return false
+	}
+}
+
+// checkAssignable fails at the position of name if it is a constant of
+// the current scope.
+func (c *Compiler) checkAssignable(name *ast.Identifier) error {
+	symbol, ok := c.symbolTable.symbols[name.Value]
+	if ok && symbol.Immutable {
+		return fmt.Errorf("%s: cannot assign to constant %s", name.Token.Position, name.Value)
+	}
+	return nil
+}
+
+// compileDestructuringLetStatement binds the names of the pattern in the
+// current scope. If the value does not fit the pattern, OpDestructureFail
+// raises a runtime error.
+func (c *Compiler) compileDestructuringLetStatement(stmt *ast.DestructuringLetStatement) error {
+	var err error
+	ast.Inspect(stmt.Pattern, func(node ast.Node) bool {
+		if ident, ok := node.(*ast.Identifier); ok && err == nil {
+			err = c.checkAssignable(ident)
+		}
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = c.Compile(stmt.Value)
+	if err != nil {
+		return err
+	}
+
+	value := c.defineHidden("let")
+	c.setSymbol(value)
+
+	loadValue := func() error {
+		c.loadSymbol(value)
+		return nil
+	}
+
+	failJumps := make([]int, 0)
+	err = c.compilePattern(stmt.Pattern, loadValue, &failJumps, make(map[string]*Symbol))
+	if err != nil {
+		return err
+	}
+
+	if len(failJumps) == 0 {
+		return nil
+	}
+
+	jumpPosition := c.emit(code.OpJump, 0)
+	for _, pos := range failJumps {
+		c.replaceInstruction(pos, code.Make(code.OpJumpNotTrue, len(c.currentInstructions())))
+	}
+
+	c.loadSymbol(value)
+	c.emit(code.OpDestructureFail)
+
+	c.replaceInstruction(jumpPosition, code.Make(code.OpJump, len(c.currentInstructions())))
+	return nil
+}
+
+// defineHidden defines a variable that cannot clash with user defined names.
+func (c *Compiler) defineHidden(prefix string) *Symbol {
+	symbol := c.symbolTable.Define(fmt.Sprintf("$%s%d", prefix, c.hiddenCount))
+	c.hiddenCount++
+	return symbol
+}
+
+// compilePattern emits the checks of a pattern against the value pushed by
+// load. The position of every conditional jump taken on a failed check is
+// added to failJumps.
+func (c *Compiler) compilePattern(pattern ast.Pattern, load func() error, failJumps *[]int, shadowed map[string]*Symbol) error {
+	switch pattern := pattern.(type) {
+	case *ast.WildcardPattern:
+		return nil
+	case *ast.BindingPattern:
+		return c.bind(pattern.Name.Value, load, shadowed)
+	case *ast.LiteralPattern:
+		err := load()
+		if err != nil {
+			return err
+		}
+
+		err = c.Compile(pattern.Value)
+		if err != nil {
+			return err
+		}
+
+		c.emit(code.OpMatchLiteral)
+		*failJumps = append(*failJumps, c.emit(code.OpJumpNotTrue, 0))
+	case *ast.ArrayPattern:
+		err := load()
+		if err != nil {
+			return err
+		}
+
+		hasRest := 0
+		if pattern.Rest != nil {
+			hasRest = 1
+		}
+		c.emit(code.OpMatchArray, len(pattern.Elements), hasRest)
+		*failJumps = append(*failJumps, c.emit(code.OpJumpNotTrue, 0))
+
+		for i, element := range pattern.Elements {
+			index := c.addConstant(&object.Integer{Value: int64(i)})
+			loadElement := func() error {
+				err := load()
+				if err != nil {
+					return err
+				}
+
+				c.emit(code.OpConstant, index)
+				c.emit(code.OpIndex)
+				return nil
+			}
+
+			err := c.compilePattern(element, loadElement, failJumps, shadowed)
+			if err != nil {
+				return err
+			}
+		}
+
+		if pattern.Rest != nil && pattern.Rest.Value != "_" {
+			loadRest := func() error {
+				err := load()
+				if err != nil {
+					return err
+				}
+
+				c.emit(code.OpSlice, len(pattern.Elements))
+				return nil
+			}
+
+			return c.bind(pattern.Rest.Value, loadRest, shadowed)
+		}
+	case *ast.MapPattern:
+		err := load()
+		if err != nil {
+			return err
+		}
+
+		c.emit(code.OpMatchMap)
+		*failJumps = append(*failJumps, c.emit(code.OpJumpNotTrue, 0))
+
+		for _, entry := range pattern.Entries {
+			key := entry.Key
+
+			err := load()
+			if err != nil {
+				return err
+			}
+
+			err = c.Compile(key)
+			if err != nil {
+				return err
+			}
+
+			c.emit(code.OpHasKey)
+			*failJumps = append(*failJumps, c.emit(code.OpJumpNotTrue, 0))
+
+			loadValue := func() error {
+				err := load()
+				if err != nil {
+					return err
+				}
+
+				err = c.Compile(key)
+				if err != nil {
+					return err
+				}
+
+				c.emit(code.OpIndex)
+				return nil
+			}
+
+			err = c.compilePattern(entry.Value, loadValue, failJumps, shadowed)
+			if err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unknown pattern %T", pattern)
+	}
+
+	return nil
+}
+
+func (c *Compiler) bind(name string, load func() error, shadowed map[string]*Symbol) error {
+	if _, ok := shadowed[name]; !ok {
+		shadowed[name] = c.symbolTable.symbols[name]
+	}
+
+	symbol := c.symbolTable.Define(name)
+
+	err := load()
+	if err != nil {
+		return err
+	}
+
+	c.setSymbol(symbol)
+	return nil
+}
+
 func (c *Compiler) emit(op code.Opcode, operands ...int) int {
 	ins := code.Make(op, operands...)
 	pos := c.addInstruction(ins)
+	c.addLine(pos)
 
 	c.scopes[c.scopeIndex].previousInstruction = c.scopes[c.scopeIndex].lastInstruction
 	c.scopes[c.scopeIndex].lastInstruction = EmittedInstruction{code: op, position: pos}
@@ -307,6 +900,7 @@ func (c *Compiler) emit(op code.Opcode, operands ...int) int {
 
 func (c *Compiler) removeLastInstruction() {
 	c.scopes[c.scopeIndex].instructions = c.currentInstructions()[:c.scopes[c.scopeIndex].lastInstruction.position]
+	c.removeLines(c.scopes[c.scopeIndex].lastInstruction.position)
 	c.scopes[c.scopeIndex].lastInstruction = c.scopes[c.scopeIndex].previousInstruction
 }
 
@@ -315,11 +909,39 @@ func (c *Compiler) lastInstructionIs(op code.Opcode) bool {
 }
 
 func (c *Compiler) replaceInstruction(pos int, ins []byte) {
+	if code.Opcode(ins[0]) == code.OpWide && code.Opcode(c.currentInstructions()[pos]) != code.OpWide {
+		// widening the jump would move the instructions after it
+		def, header, _ := code.LookupInstruction(ins)
+		operands, _ := code.ReadOperands(def, ins[header:])
+
+		scope := c.scopes[c.scopeIndex]
+		if scope.longJumps == nil {
+			scope.longJumps = make(map[int]int)
+		}
+		scope.longJumps[pos] = operands[jumpOperand(code.Opcode(ins[1]))]
+		return
+	}
+
 	for i, instruction := range ins {
 		c.currentInstructions()[pos+i] = instruction
 	}
 }
 
+// relocateJumps makes the jumps of the current scope that do not fit their
+// operand wide and moves the instructions after them.
+func (c *Compiler) relocateJumps() {
+	scope := c.scopes[c.scopeIndex]
+	if len(scope.longJumps) == 0 {
+		return
+	}
+
+	list, end := decode(scope.instructions, scope.lines, scope.longJumps)
+	scope.instructions, scope.lines = encode(list, end)
+	scope.longJumps = nil
+	scope.lastInstruction = EmittedInstruction{}
+	scope.previousInstruction = EmittedInstruction{}
+}
+
 func (c *Compiler) addInstruction(ins []byte) int {
 	posNewInstruction := len(c.currentInstructions())
 	c.scopes[c.scopeIndex].instructions = append(c.currentInstructions(), ins...)
@@ -335,6 +957,14 @@ func (c *Compiler) currentInstructions() code.Instructions {
 	return c.scopes[c.scopeIndex].instructions
 }
 
+func (c *Compiler) setSymbol(symbol *Symbol) {
+	if symbol.Scope == GlobalScope {
+		c.emit(code.OpSetGlobal, symbol.Index)
+	} else {
+		c.emit(code.OpSetLocal, symbol.Index)
+	}
+}
+
 func (c *Compiler) loadSymbol(symbol *Symbol) {
 	switch symbol.Scope {
 	case GlobalScope:
@@ -361,25 +991,42 @@ func (c *Compiler) enterScope() {
 	c.symbolTable = FromSymbolTable(c.symbolTable)
 }
 
-func (c *Compiler) leaveScope() code.Instructions {
+func (c *Compiler) leaveScope() (code.Instructions, code.LineTable) {
+	c.relocateJumps()
 	instructionsInCurrentScope := c.scopes[c.scopeIndex].instructions
+	linesInCurrentScope := c.scopes[c.scopeIndex].lines
 
 	c.scopes = c.scopes[:c.scopeIndex]
 	c.scopeIndex--
 
 	c.symbolTable = c.symbolTable.UnwrapSymbolTable()
 
-	return instructionsInCurrentScope
+	return instructionsInCurrentScope, linesInCurrentScope
+}
+
+func (c *Compiler) peephole(instructions code.Instructions, lines code.LineTable) (code.Instructions, code.LineTable) {
+	if len(c.options.Peephole) == 0 {
+		return instructions, lines
+	}
+	return Peephole(instructions, lines, c.options.Peephole, &c.stats)
+}
+
+// PeepholeStats returns the work done by the peephole pass so far.
+func (c *Compiler) PeepholeStats() PeepholeStats {
+	return c.stats
 }
 
 func (c *Compiler) Bytecode() *Bytecode {
 	return &Bytecode{
 		Instructions: c.currentInstructions(),
+		Lines:        c.scopes[c.scopeIndex].lines,
 		Constants:    c.constants,
 	}
 }
 
 type Bytecode struct {
 	Instructions code.Instructions
-	Constants    []object.Object
+	// Lines maps Instructions to the source they were compiled from.
+	Lines     code.LineTable
+	Constants []object.Object
 }
@@ -196,6 +196,18 @@ func TestStringExpressions(t *testing.T) {
 				code.Make(code.OpPop),
 			},
 		},
+		{
+			input:             `"a${1}b${2}"`,
+			expectedConstants: []interface{}{"a", 1, "b", 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpBuildString, 4),
+				code.Make(code.OpPop),
+			},
+		},
 	}
 
 	runCompilerTests(t, tests)
@@ -290,6 +302,148 @@ func TestLetStatements(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestConstStatements(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `const x = 10; x + x`,
+			expectedConstants: []interface{}{10, 10},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `const x = true; fn() { x }`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpTrue),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `const xs = [1]; xs`,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestConstantsCannotBeAssigned(t *testing.T) {
+	tests := []struct {
+		input string
+		error string
+	}{
+		{`const x = 1; let x = 2;`, "1:18: cannot assign to constant x"},
+		{`const x = [1]; const x = 2;`, "1:22: cannot assign to constant x"},
+		{`const x = 1; let [a, x] = [1, 2];`, "1:22: cannot assign to constant x"},
+		{`const x = 1; let [a, ...x] = [1, 2];`, "1:25: cannot assign to constant x"},
+		{`fn() { const x = 1; let {x} = {"x": 2}; }`, "1:26: cannot assign to constant x"},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+
+		compiler := New()
+		err := compiler.Compile(program)
+		if err == nil || err.Error() != tt.error {
+			t.Errorf("expected error '%s' for %q. Got %v", tt.error, tt.input, err)
+		}
+	}
+
+	valid := []string{
+		`const x = 1; fn() { let x = 2; x }`,
+		`const x = 1; fn(x) { x }`,
+		`const x = 1; match (2) { x => x }`,
+	}
+
+	for _, input := range valid {
+		program := parse(t, input)
+
+		compiler := New()
+		err := compiler.Compile(program)
+		if err != nil {
+			t.Errorf("unexpected error for %q: %s", input, err)
+		}
+	}
+}
+
+func TestDestructuringLetStatements(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `let [a, ...rest] = [1]; a`,
+			expectedConstants: []interface{}{1, 0},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpMatchArray, 1, 1),
+				code.Make(code.OpJumpNotTrue, 41),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpIndex),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpSlice, 1),
+				code.Make(code.OpSetGlobal, 2),
+				code.Make(code.OpJump, 45),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpDestructureFail),
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `fn(person) { let {name} = person; name }`,
+			expectedConstants: []interface{}{
+				"name",
+				"name",
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpMatchMap),
+					code.Make(code.OpJumpNotTrue, 30),
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpHasKey),
+					code.Make(code.OpJumpNotTrue, 30),
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpIndex),
+					code.Make(code.OpSetLocal, 2),
+					code.Make(code.OpJump, 33),
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpDestructureFail),
+					code.Make(code.OpGetLocal, 2),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
 func TestArrayLiterals(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -388,6 +542,87 @@ func TestIndexExpressions(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestPropertyExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `{"a": 1}.a`,
+			expectedConstants: []interface{}{"a", 1, "a"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpMap, 1),
+				code.Make(code.OpGetProperty, 2),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestOptionalChainingAndCoalescing(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `null`,
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpNull),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `null?.a.b`,
+			expectedConstants: []interface{}{"a", "b"},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpNull),
+				// 0001
+				code.Make(code.OpJumpIfNull, 10),
+				// 0004
+				code.Make(code.OpGetOptionalProperty, 0),
+				// 0007
+				code.Make(code.OpGetProperty, 1),
+				// 0010
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `[1]?.[0]`,
+			expectedConstants: []interface{}{1, 0},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpArray, 1),
+				// 0006
+				code.Make(code.OpJumpIfNull, 13),
+				// 0009
+				code.Make(code.OpConstant, 1),
+				// 0012
+				code.Make(code.OpIndex),
+				// 0013
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `null ?? 1`,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpNull),
+				// 0001
+				code.Make(code.OpJumpIfNotNull, 7),
+				// 0004
+				code.Make(code.OpConstant, 0),
+				// 0007
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
 func TestFunctionLiterals(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -506,6 +741,133 @@ func TestCallExpressions(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestPipesAndLambdas(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `let f = fn(a, b) { a - b }; 1 |> f(2)`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpSub),
+					code.Make(code.OpReturnValue),
+				},
+				1,
+				2,
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpCall, 2),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `(x => x * 2)(3)`,
+			expectedConstants: []interface{}{
+				2,
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpMul),
+					code.Make(code.OpReturnValue),
+				},
+				3,
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestDeclaredOperators(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `infixl 6 <+> = fn(a, b) { a }; 1 <+> 2`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpReturnValue),
+				},
+				1,
+				2,
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpCall, 2),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestDefaultAndRestParameters(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `fn(a, b = a + 1, ...rest) { rest }`,
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpJumpIfArgument, 1, 12),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpGetLocal, 2),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `len(1, ...[2], 3, 4)`,
+			expectedConstants: []interface{}{1, 2, 3, 4},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpGetBuiltin, 1),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpArray, 2),
+				code.Make(code.OpCallSpread, 3),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestDefaultValuesCannotReferToLaterParameters(t *testing.T) {
+	program := parse(t, `fn(a = b, b = 1) { a }`)
+
+	compiler := New()
+	err := compiler.Compile(program)
+	if err == nil || err.Error() != "undefined: b" {
+		t.Fatalf("expected error 'undefined: b'. Got %v", err)
+	}
+}
+
 func TestBuiltins(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -671,13 +1033,223 @@ func TestRecursiveFunctions(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestMatchExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `match (1) { 1 => 10, _ => 20 }`,
+			expectedConstants: []interface{}{1, 1, 10, 20},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpMatchLiteral),
+				code.Make(code.OpJumpNotTrue, 22),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpJump, 32),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpJump, 32),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpMatchFail),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `match ([1]) { [x, ...rest] if x > 0 => x }`,
+			expectedConstants: []interface{}{1, 0, 0},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpMatchArray, 1, 1),
+				code.Make(code.OpJumpNotTrue, 54),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpIndex),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpSlice, 1),
+				code.Make(code.OpSetGlobal, 2),
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpGreater),
+				code.Make(code.OpJumpNotTrue, 54),
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpJump, 58),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpMatchFail),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `fn(m) { match (m) { {"a": a} => a } }`,
+			expectedConstants: []interface{}{
+				"a",
+				"a",
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpMatchMap),
+					code.Make(code.OpJumpNotTrue, 32),
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpHasKey),
+					code.Make(code.OpJumpNotTrue, 32),
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpIndex),
+					code.Make(code.OpSetLocal, 2),
+					code.Make(code.OpGetLocal, 2),
+					code.Make(code.OpJump, 35),
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpMatchFail),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestFolding(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "1 + 2 * 3",
+			expectedConstants: []interface{}{7},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `-(2 - 5) > 2 == !false; "a" + "b" + "c"`,
+			expectedConstants: []interface{}{"abc"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "let x = 1; x + 1 * 2; 1 / 0",
+			expectedConstants: []interface{}{1, 2, 1, 0},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpDiv),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "const n = 2 * 3; n",
+			expectedConstants: []interface{}{6},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "if (true) { 10 } else { 20 }; let x = if (1 > 2) { 30 };",
+			expectedConstants: []interface{}{10},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpNull),
+				code.Make(code.OpSetGlobal, 0),
+			},
+		},
+		{
+			input:             "if (!true) { 10 } else { let y = 1; y }",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "let x = if (true) { let y = 1; y };",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpJumpNotTrue, 16),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpJump, 17),
+				code.Make(code.OpNull),
+				code.Make(code.OpSetGlobal, 0),
+			},
+		},
+	}
+
+	runCompilerTestsWithOptions(t, Options{Fold: true}, tests)
+}
+
+func TestFoldingLeavesProgramAlone(t *testing.T) {
+	program := parse(t, `let x = 1 + 2; if (true) { x } else { -x }`)
+	expected := program.String()
+
+	compiler := NewWithOptions(Options{Fold: true})
+	err := compiler.Compile(program)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	if program.String() != expected {
+		t.Errorf("program was changed.\nwant=%s\ngot= %s", expected, program.String())
+	}
+}
+
+func TestUnexpandedMacros(t *testing.T) {
+	program := parse(t, `fn() { let m = macro(x) { x }; }`)
+
+	compiler := New()
+	err := compiler.Compile(program)
+	if err == nil || err.Error() != "macros can only be defined by top-level let statements" {
+		t.Fatalf("expected error 'macros can only be defined by top-level let statements'. Got %v", err)
+	}
+}
+
+func TestMatchBindingsAreScopedToTheirArm(t *testing.T) {
+	program := parse(t, `match (1) { x => x, _ => x }`)
+
+	compiler := New()
+	err := compiler.Compile(program)
+	if err == nil || err.Error() != "undefined: x" {
+		t.Fatalf("expected error 'undefined: x'. Got %v", err)
+	}
+}
+
+// runCompilerTests compiles without optimizations, so the instructions
+// follow the source.
 func runCompilerTests(t *testing.T, tests []compilerTestCase) {
 	t.Helper()
+	runCompilerTestsWithOptions(t, Options{}, tests)
+}
+
+func runCompilerTestsWithOptions(t *testing.T, options Options, tests []compilerTestCase) {
+	t.Helper()
 
 	for _, tt := range tests {
 		program := parse(t, tt.input)
 
-		compiler := New()
+		compiler := NewWithOptions(options)
 		err := compiler.Compile(program)
 		if err != nil {
 			t.Fatalf("compiler error: %s", err)
@@ -0,0 +1,254 @@
+package compiler
+
+import (
+	"bytes"
+	"compiler/code"
+	"compiler/object"
+	"compiler/token"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+// A bytecode file starts with Magic and the format version as a big endian
+// uint16, followed by the constant pool and the main instructions with
+// their line table. Numbers are varints, strings and instructions are
+// prefixed with their length. The file ends with the big endian CRC-32
+// (IEEE) of everything before it.
+const (
+	Magic   = "\x00mbc"
+	Version = 3
+)
+
+// tags of the constant kinds in the constant pool
+const (
+	integerConstant byte = iota + 1
+	stringConstant
+	functionConstant
+)
+
+var errTruncated = errors.New("truncated bytecode")
+
+// IsBytecode reports whether data starts like a bytecode file.
+func IsBytecode(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(Magic))
+}
+
+// EncodeBytecode returns the bytecode file of bytecode. Equal bytecode
+// always has the same encoding.
+func EncodeBytecode(bytecode *Bytecode) ([]byte, error) {
+	out := []byte(Magic)
+	out = binary.BigEndian.AppendUint16(out, Version)
+
+	out = binary.AppendUvarint(out, uint64(len(bytecode.Constants)))
+	for i, constant := range bytecode.Constants {
+		switch constant := constant.(type) {
+		case *object.Integer:
+			out = append(out, integerConstant)
+			out = binary.AppendVarint(out, constant.Value)
+		case *object.String:
+			out = append(out, stringConstant)
+			out = appendBytes(out, []byte(constant.Value))
+		case *object.CompiledFunction:
+			out = append(out, functionConstant)
+			out = appendBytes(out, []byte(constant.Name))
+			out = binary.AppendUvarint(out, uint64(constant.NumParams))
+			out = binary.AppendUvarint(out, uint64(constant.NumDefaults))
+			out = binary.AppendUvarint(out, uint64(constant.NumLocals))
+			out = appendBool(out, constant.Variadic)
+			out = appendBytes(out, constant.Instructions)
+			out = appendLines(out, constant.Lines)
+		default:
+			return nil, fmt.Errorf("constant %d: cannot encode %s", i, constant.Type())
+		}
+	}
+
+	out = appendBytes(out, bytecode.Instructions)
+	out = appendLines(out, bytecode.Lines)
+	return binary.BigEndian.AppendUint32(out, crc32.ChecksumIEEE(out)), nil
+}
+
+func appendBytes(out []byte, b []byte) []byte {
+	out = binary.AppendUvarint(out, uint64(len(b)))
+	return append(out, b...)
+}
+
+// appendLines appends the number of entries of lines followed by each
+// entry as the distance to the offset of the previous one and the source
+// offset, line and column.
+func appendLines(out []byte, lines code.LineTable) []byte {
+	out = binary.AppendUvarint(out, uint64(len(lines)))
+	previous := 0
+	for _, entry := range lines {
+		out = binary.AppendUvarint(out, uint64(entry.Offset-previous))
+		out = binary.AppendUvarint(out, uint64(entry.Position.Offset))
+		out = binary.AppendUvarint(out, uint64(entry.Position.Line))
+		out = binary.AppendUvarint(out, uint64(entry.Position.Column))
+		previous = entry.Offset
+	}
+	return out
+}
+
+func appendBool(out []byte, b bool) []byte {
+	if b {
+		return append(out, 1)
+	}
+	return append(out, 0)
+}
+
+// DecodeBytecode reads a bytecode file written by EncodeBytecode.
+func DecodeBytecode(data []byte) (*Bytecode, error) {
+	if !IsBytecode(data) {
+		return nil, errors.New("not a bytecode file")
+	}
+	if len(data) < len(Magic)+2+4 {
+		return nil, errTruncated
+	}
+
+	version := binary.BigEndian.Uint16(data[len(Magic):])
+	if version != Version {
+		return nil, fmt.Errorf("unsupported bytecode version %d, expected %d", version, Version)
+	}
+
+	body, checksum := data[:len(data)-4], binary.BigEndian.Uint32(data[len(data)-4:])
+	if crc32.ChecksumIEEE(body) != checksum {
+		return nil, errors.New("bytecode checksum mismatch")
+	}
+
+	r := &reader{data: body[len(Magic)+2:]}
+	bytecode := &Bytecode{}
+
+	numConstants := r.uvarint()
+	for i := uint64(0); i < numConstants && r.err == nil; i++ {
+		constant, err := r.constant()
+		if err != nil {
+			return nil, fmt.Errorf("constant %d: %w", i, err)
+		}
+		bytecode.Constants = append(bytecode.Constants, constant)
+	}
+
+	bytecode.Instructions = r.instructions()
+	bytecode.Lines = r.lines()
+	if r.err != nil {
+		return nil, r.err
+	}
+	if len(r.data) != 0 {
+		return nil, fmt.Errorf("%d unexpected bytes after the line table", len(r.data))
+	}
+
+	return bytecode, nil
+}
+
+// reader decodes the values of a bytecode file. After the first error it
+// only returns zero values, so callers check err once they are done.
+type reader struct {
+	data []byte
+	err  error
+}
+
+func (r *reader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+
+	value, n := binary.Uvarint(r.data)
+	if n <= 0 {
+		r.err = errTruncated
+		return 0
+	}
+	r.data = r.data[n:]
+	return value
+}
+
+func (r *reader) varint() int64 {
+	if r.err != nil {
+		return 0
+	}
+
+	value, n := binary.Varint(r.data)
+	if n <= 0 {
+		r.err = errTruncated
+		return 0
+	}
+	r.data = r.data[n:]
+	return value
+}
+
+func (r *reader) byte() byte {
+	b := r.bytes(1)
+	if len(b) == 0 {
+		return 0
+	}
+	return b[0]
+}
+
+func (r *reader) bytes(n uint64) []byte {
+	if r.err != nil {
+		return nil
+	}
+
+	if n > uint64(len(r.data)) {
+		r.err = errTruncated
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *reader) instructions() code.Instructions {
+	ins := code.Instructions(append([]byte{}, r.bytes(r.uvarint())...))
+	if r.err == nil {
+		r.err = ins.Validate()
+	}
+	return ins
+}
+
+func (r *reader) lines() code.LineTable {
+	n := r.uvarint()
+	if n > uint64(len(r.data)) {
+		// every entry takes at least four bytes, guard against huge counts
+		r.err = errTruncated
+	}
+
+	var lines code.LineTable
+	offset := 0
+	for i := uint64(0); i < n && r.err == nil; i++ {
+		offset += int(r.uvarint())
+		lines = append(lines, code.LineEntry{
+			Offset: offset,
+			Position: token.Position{
+				Offset: int(r.uvarint()),
+				Line:   int(r.uvarint()),
+				Column: int(r.uvarint()),
+			},
+		})
+	}
+	return lines
+}
+
+func (r *reader) constant() (object.Object, error) {
+	var constant object.Object
+	switch tag := r.byte(); tag {
+	case integerConstant:
+		constant = &object.Integer{Value: r.varint()}
+	case stringConstant:
+		constant = &object.String{Value: string(r.bytes(r.uvarint()))}
+	case functionConstant:
+		constant = &object.CompiledFunction{
+			Name:         string(r.bytes(r.uvarint())),
+			NumParams:    int(r.uvarint()),
+			NumDefaults:  int(r.uvarint()),
+			NumLocals:    int(r.uvarint()),
+			Variadic:     r.byte() != 0,
+			Instructions: r.instructions(),
+			Lines:        r.lines(),
+		}
+	default:
+		if r.err == nil {
+			r.err = fmt.Errorf("unknown constant tag %d", tag)
+		}
+	}
+	return constant, r.err
+}
@@ -0,0 +1,143 @@
+package compiler
+
+import (
+	"bytes"
+	"compiler/ast"
+	"compiler/code"
+	"compiler/token"
+	"encoding/binary"
+	"hash/crc32"
+	"reflect"
+	"testing"
+)
+
+func compileBytecode(t *testing.T, input string) *Bytecode {
+	t.Helper()
+
+	compiler := New()
+	err := compiler.Compile(parse(t, input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	return compiler.Bytecode()
+}
+
+func TestBytecodeRoundTrip(t *testing.T) {
+	inputs := []string{
+		`1`,
+		`let x = -42; let s = "hello, ${x}"; x`,
+		`let f = fn(a, b = 2, ...rest) { let c = a + b; push(rest, c) }; f(1)`,
+		`let add = fn(a) { fn(b) { a + b } }; let m = {"a": add(1), "b": [1, 2]}; m.a(2)`,
+		`match ([1, 2]) { [x, ...xs] => x, _ => 0 }`,
+	}
+
+	for _, input := range inputs {
+		bytecode := compileBytecode(t, input)
+
+		encoded, err := EncodeBytecode(bytecode)
+		if err != nil {
+			t.Fatalf("encode error for %q: %s", input, err)
+		}
+
+		decoded, err := DecodeBytecode(encoded)
+		if err != nil {
+			t.Fatalf("decode error for %q: %s", input, err)
+		}
+
+		if !reflect.DeepEqual(bytecode, decoded) {
+			t.Errorf("wrong bytecode for %q.\nwant=%+v\ngot= %+v", input, bytecode, decoded)
+		}
+	}
+}
+
+func TestBytecodeIsDeterministic(t *testing.T) {
+	input := `let m = {"a": 1, "b": 2, "c": 3, "d": 4, "e": 5, "f": 6, "g": 7, "h": 8}; m`
+	first, err := EncodeBytecode(compileBytecode(t, input))
+	if err != nil {
+		t.Fatalf("encode error: %s", err)
+	}
+
+	for i := 0; i < 10; i++ {
+		encoded, _ := EncodeBytecode(compileBytecode(t, input))
+		if !bytes.Equal(first, encoded) {
+			t.Fatalf("encoding differs in run %d", i)
+		}
+	}
+
+	// maps built without Keys, e.g. by macros, are compiled in a fixed order
+	entries := make(map[ast.Expression]ast.Expression)
+	for _, key := range []string{"x", "y", "z", "w", "v", "u"} {
+		k := &ast.StringLiteral{Token: token.Token{Type: token.STRING, Literal: key}, Value: key}
+		entries[k] = &ast.IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "1"}, Value: 1}
+	}
+	program := &ast.Program{Statements: []ast.Statement{
+		&ast.ExpressionStatement{Expression: &ast.MapLiteral{Entries: entries}},
+	}}
+
+	var expected []byte
+	for i := 0; i < 10; i++ {
+		compiler := New()
+		if err := compiler.Compile(program); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		encoded, _ := EncodeBytecode(compiler.Bytecode())
+		if expected == nil {
+			expected = encoded
+		} else if !bytes.Equal(expected, encoded) {
+			t.Fatalf("encoding of map without keys differs in run %d", i)
+		}
+	}
+}
+
+func TestDecodeBytecodeErrors(t *testing.T) {
+	bytecode := compileBytecode(t, `let f = fn(x) { x }; f("a")`)
+	valid, err := EncodeBytecode(bytecode)
+	if err != nil {
+		t.Fatalf("encode error: %s", err)
+	}
+
+	// withChecksum replaces the checksum of a modified file
+	withChecksum := func(data []byte) []byte {
+		body := append([]byte{}, data[:len(data)-4]...)
+		return binary.BigEndian.AppendUint32(body, crc32.ChecksumIEEE(body))
+	}
+
+	corrupted := append([]byte{}, valid...)
+	corrupted[len(corrupted)-6] ^= 0xff
+
+	newer := append([]byte{}, valid...)
+	newer[len(Magic)+1] = Version + 1
+
+	header := len(Magic) + 2
+	unknownTag := append([]byte{}, valid...)
+	unknownTag[header+1] = 9
+
+	bytecode.Instructions = append(code.Instructions{}, bytecode.Instructions...)
+	bytecode.Instructions[len(bytecode.Instructions)-1] = 255
+	invalidOpcode, err := EncodeBytecode(bytecode)
+	if err != nil {
+		t.Fatalf("encode error: %s", err)
+	}
+
+	tests := []struct {
+		data     []byte
+		expected string
+	}{
+		{[]byte("let x = 1;"), "not a bytecode file"},
+		{[]byte(Magic), "truncated bytecode"},
+		{newer, "unsupported bytecode version 4, expected 3"},
+		{corrupted, "bytecode checksum mismatch"},
+		{withChecksum(append(valid[:header+3:header+3], valid[len(valid)-4:]...)), "constant 0: truncated bytecode"},
+		{withChecksum(unknownTag), "constant 0: unknown constant tag 9"},
+		{invalidOpcode, "offset 13: opcode 255 undefined"},
+		{withChecksum(append(valid[:len(valid)-4:len(valid)-4], 0, 0, 0, 0, 0)), "1 unexpected bytes after the line table"},
+	}
+
+	for _, tt := range tests {
+		_, err := DecodeBytecode(tt.data)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%v", tt.expected, err)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package compiler
+
+import (
+	"compiler/ast"
+	"compiler/token"
+	"strconv"
+)
+
+// Fold optimizes a program before code is generated for it. Arithmetic,
+// comparisons, negation and string concatenation of literals are replaced
+// by their result, and if expressions with a literal condition by the
+// branch taken. Operations failing at runtime, like a division by zero,
+// are left alone so they still fail. The program is rewritten in place.
+func Fold(program *ast.Program) *ast.Program {
+	ast.Rewrite(program, fold)
+	program.Statements = spliceTakenBranches(program.Statements)
+	return program
+}
+
+func fold(node ast.Node) ast.Node {
+	switch node := node.(type) {
+	case *ast.PrefixExpression:
+		return foldPrefix(node)
+	case *ast.InfixExpression:
+		return foldInfix(node)
+	case *ast.IfExpression:
+		return foldIf(node)
+	case *ast.BlockStatement:
+		node.Statements = spliceTakenBranches(node.Statements)
+	}
+	return node
+}
+
+func foldPrefix(node *ast.PrefixExpression) ast.Expression {
+	switch right := node.Right.(type) {
+	case *ast.IntegerLiteral:
+		if node.Operator == "-" {
+			return integerLiteral(node.Token.Position, -right.Value)
+		}
+	case *ast.BooleanLiteral:
+		if node.Operator == "!" {
+			return booleanLiteral(node.Token.Position, !right.Value)
+		}
+	}
+	return node
+}
+
+func foldInfix(node *ast.InfixExpression) ast.Expression {
+	pos := node.Token.Position
+	switch left := node.Left.(type) {
+	case *ast.IntegerLiteral:
+		right, ok := node.Right.(*ast.IntegerLiteral)
+		if !ok {
+			break
+		}
+
+		switch node.Operator {
+		case "+":
+			return integerLiteral(pos, left.Value+right.Value)
+		case "-":
+			return integerLiteral(pos, left.Value-right.Value)
+		case "*":
+			return integerLiteral(pos, left.Value*right.Value)
+		case "/":
+			if right.Value != 0 {
+				return integerLiteral(pos, left.Value/right.Value)
+			}
+		case "==":
+			return booleanLiteral(pos, left.Value == right.Value)
+		case "!=":
+			return booleanLiteral(pos, left.Value != right.Value)
+		case "<":
+			return booleanLiteral(pos, left.Value < right.Value)
+		case ">":
+			return booleanLiteral(pos, left.Value > right.Value)
+		case "<=":
+			return booleanLiteral(pos, left.Value <= right.Value)
+		case ">=":
+			return booleanLiteral(pos, left.Value >= right.Value)
+		}
+	case *ast.StringLiteral:
+		right, ok := node.Right.(*ast.StringLiteral)
+		if !ok {
+			break
+		}
+
+		switch node.Operator {
+		case "+":
+			return &ast.StringLiteral{
+				Token: token.Token{Type: token.STRING, Literal: left.Value + right.Value, Position: pos},
+				Value: left.Value + right.Value,
+			}
+		case "==":
+			return booleanLiteral(pos, left.Value == right.Value)
+		case "!=":
+			return booleanLiteral(pos, left.Value != right.Value)
+		}
+	case *ast.BooleanLiteral:
+		right, ok := node.Right.(*ast.BooleanLiteral)
+		if !ok {
+			break
+		}
+
+		switch node.Operator {
+		case "==":
+			return booleanLiteral(pos, left.Value == right.Value)
+		case "!=":
+			return booleanLiteral(pos, left.Value != right.Value)
+		}
+	}
+
+	// null is only equal to itself
+	_, leftNull := node.Left.(*ast.NullLiteral)
+	_, rightNull := node.Right.(*ast.NullLiteral)
+	if (leftNull || rightNull) && isLiteral(node.Left) && isLiteral(node.Right) {
+		switch node.Operator {
+		case "==":
+			return booleanLiteral(pos, leftNull == rightNull)
+		case "!=":
+			return booleanLiteral(pos, leftNull != rightNull)
+		}
+	}
+
+	return node
+}
+
+// foldIf replaces an if expression with a literal condition by the branch
+// taken. Branches of a single expression become that expression, longer
+// ones are kept as an if expression with the condition true, which is
+// spliced into its block where possible.
+func foldIf(node *ast.IfExpression) ast.Expression {
+	condition, ok := node.Condition.(*ast.BooleanLiteral)
+	if !ok || (condition.Value && node.Alternative == nil) {
+		return node
+	}
+
+	taken := node.Consequence
+	if !condition.Value {
+		taken = node.Alternative
+	}
+
+	switch {
+	case taken == nil || len(taken.Statements) == 0:
+		return &ast.NullLiteral{Token: token.Token{Type: token.NULL, Literal: "null", Position: node.Token.Position}}
+	case len(taken.Statements) == 1:
+		if stmt, ok := taken.Statements[0].(*ast.ExpressionStatement); ok && stmt.Expression != nil {
+			return stmt.Expression
+		}
+	}
+
+	return &ast.IfExpression{
+		Token:       node.Token,
+		Condition:   booleanLiteral(condition.Token.Position, true),
+		Consequence: taken,
+	}
+}
+
+// spliceTakenBranches replaces statements consisting of an if expression
+// that is always taken by the statements of its branch. The last
+// statement of a block is its value, so it is only replaced if the branch
+// ends with an expression as well.
+func spliceTakenBranches(statements []ast.Statement) []ast.Statement {
+	var spliced []ast.Statement
+	for i, stmt := range statements {
+		branch := takenBranch(stmt)
+		if branch == nil || (i == len(statements)-1 && !endsWithExpression(branch)) {
+			spliced = append(spliced, stmt)
+			continue
+		}
+		spliced = append(spliced, branch.Statements...)
+	}
+	return spliced
+}
+
+func takenBranch(stmt ast.Statement) *ast.BlockStatement {
+	expressionStmt, ok := stmt.(*ast.ExpressionStatement)
+	if !ok {
+		return nil
+	}
+
+	ifExpression, ok := expressionStmt.Expression.(*ast.IfExpression)
+	if !ok || ifExpression.Alternative != nil {
+		return nil
+	}
+
+	condition, ok := ifExpression.Condition.(*ast.BooleanLiteral)
+	if !ok || !condition.Value {
+		return nil
+	}
+	return ifExpression.Consequence
+}
+
+func endsWithExpression(block *ast.BlockStatement) bool {
+	if len(block.Statements) == 0 {
+		return false
+	}
+	_, ok := block.Statements[len(block.Statements)-1].(*ast.ExpressionStatement)
+	return ok
+}
+
+func integerLiteral(pos token.Position, value int64) *ast.IntegerLiteral {
+	return &ast.IntegerLiteral{
+		Token: token.Token{Type: token.INT, Literal: strconv.FormatInt(value, 10), Position: pos},
+		Value: value,
+	}
+}
+
+func booleanLiteral(pos token.Position, value bool) *ast.BooleanLiteral {
+	tok := token.Token{Type: token.FALSE, Literal: "false", Position: pos}
+	if value {
+		tok = token.Token{Type: token.TRUE, Literal: "true", Position: pos}
+	}
+	return &ast.BooleanLiteral{Token: tok, Value: value}
+}
@@ -0,0 +1,103 @@
+package compiler
+
+import (
+	"compiler/ast"
+	"compiler/code"
+	"compiler/token"
+)
+
+// at makes the instructions emitted until the returned function is called
+// map to the position of node. Nodes without a position of their own, like
+// blocks, keep the position of the enclosing node.
+func (c *Compiler) at(node ast.Node) func() {
+	outer := c.position
+	if pos := sourcePosition(node); pos.IsValid() {
+		c.position = pos
+	}
+	return func() { c.position = outer }
+}
+
+// addLine records that the instruction at offset of the current scope was
+// compiled from the current position.
+func (c *Compiler) addLine(offset int) {
+	scope := c.scopes[c.scopeIndex]
+
+	n := len(scope.lines)
+	switch {
+	case n == 0 && !c.position.IsValid():
+		return
+	case n > 0 && scope.lines[n-1].Position == c.position:
+		return
+	case n > 0 && scope.lines[n-1].Offset == offset:
+		scope.lines[n-1].Position = c.position
+		return
+	}
+	scope.lines = append(scope.lines, code.LineEntry{Offset: offset, Position: c.position})
+}
+
+// removeLines removes the entries of instructions starting at or after
+// offset from the current scope.
+func (c *Compiler) removeLines(offset int) {
+	scope := c.scopes[c.scopeIndex]
+	for len(scope.lines) > 0 && scope.lines[len(scope.lines)-1].Offset >= offset {
+		scope.lines = scope.lines[:len(scope.lines)-1]
+	}
+}
+
+// sourcePosition returns the position runtime errors of node are reported
+// at. Operators, calls, indexes and properties are reported at their
+// operator rather than at the start of the expression.
+func sourcePosition(node ast.Node) token.Position {
+	switch node := node.(type) {
+	case *ast.LetStatement:
+		return node.Token.Position
+	case *ast.ConstStatement:
+		return node.Token.Position
+	case *ast.InfixDeclaration:
+		return node.Token.Position
+	case *ast.DestructuringLetStatement:
+		return node.Token.Position
+	case *ast.ReturnStatement:
+		return node.Token.Position
+	case *ast.ExpressionStatement:
+		return node.Token.Position
+	case *ast.Identifier:
+		return node.Token.Position
+	case *ast.IntegerLiteral:
+		return node.Token.Position
+	case *ast.BooleanLiteral:
+		return node.Token.Position
+	case *ast.StringLiteral:
+		return node.Token.Position
+	case *ast.InterpolatedString:
+		return node.Token.Position
+	case *ast.NullLiteral:
+		return node.Token.Position
+	case *ast.PrefixExpression:
+		return node.Token.Position
+	case *ast.InfixExpression:
+		return node.Token.Position
+	case *ast.IfExpression:
+		return node.Token.Position
+	case *ast.FunctionLiteral:
+		return node.Token.Position
+	case *ast.PipeExpression:
+		return node.Token.Position
+	case *ast.CallExpression:
+		return node.Token.Position
+	case *ast.SpreadExpression:
+		return node.Token.Position
+	case *ast.ArrayLiteral:
+		return node.Token.Position
+	case *ast.IndexExpression:
+		return node.Token.Position
+	case *ast.PropertyExpression:
+		return node.Token.Position
+	case *ast.MapLiteral:
+		return node.Token.Position
+	case *ast.MatchExpression:
+		return node.Token.Position
+	default:
+		return token.Position{}
+	}
+}
@@ -0,0 +1,48 @@
+package compiler
+
+import (
+	"compiler/code"
+	"compiler/object"
+	"compiler/token"
+	"reflect"
+	"testing"
+)
+
+func TestLineTable(t *testing.T) {
+	compiler := NewWithOptions(Options{})
+	err := compiler.Compile(parse(t, "1 +\n2"))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	expected := code.LineTable{
+		{Offset: 0, Position: token.Position{Offset: 0, Line: 1, Column: 1}},
+		{Offset: 3, Position: token.Position{Offset: 4, Line: 2, Column: 1}},
+		{Offset: 6, Position: token.Position{Offset: 2, Line: 1, Column: 3}},
+		{Offset: 7, Position: token.Position{Offset: 0, Line: 1, Column: 1}},
+	}
+	if lines := compiler.Bytecode().Lines; !reflect.DeepEqual(lines, expected) {
+		t.Errorf("wrong lines.\nwant=%v\ngot= %v", expected, lines)
+	}
+}
+
+func TestFunctionLineTable(t *testing.T) {
+	compiler := NewWithOptions(Options{})
+	err := compiler.Compile(parse(t, "let f = fn(a) {\n  a\n};"))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	fn := compiler.Bytecode().Constants[0].(*object.CompiledFunction)
+	if fn.Name != "f" {
+		t.Errorf("wrong name. want=%q, got=%q", "f", fn.Name)
+	}
+
+	// the implicit return belongs to the last expression
+	expected := code.LineTable{
+		{Offset: 0, Position: token.Position{Offset: 18, Line: 2, Column: 3}},
+	}
+	if !reflect.DeepEqual(fn.Lines, expected) {
+		t.Errorf("wrong lines.\nwant=%v\ngot= %v", expected, fn.Lines)
+	}
+}
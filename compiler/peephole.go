@@ -0,0 +1,365 @@
+package compiler
+
+import (
+	"compiler/code"
+	"compiler/token"
+)
+
+// Instruction is a decoded instruction seen by peephole rules.
+type Instruction struct {
+	Op       code.Opcode
+	Operands []int
+	// Position is the source position the instruction was compiled from.
+	// Replacements without one take the position of the first instruction
+	// they replace.
+	Position token.Position
+	// Target is the instruction a jump leads to. The operand holding its
+	// offset is recomputed when the instructions are encoded again.
+	Target *Instruction
+	// Targeted is set if a jump leads to the instruction. Control can
+	// enter there from elsewhere, so it must not be merged with the
+	// instructions in front of it.
+	Targeted bool
+
+	// end marks the position behind the last instruction.
+	end bool
+}
+
+// PeepholeRule rewrites the instructions at the start of window, which
+// holds the instructions from some position to the end. Rewrite returns
+// how many instructions it replaces and their replacement, or 0 if the
+// rule does not apply. Only the first replaced instruction may be Targeted;
+// jumps to it are redirected to the first instruction of the replacement,
+// or to the one following the replaced instructions.
+type PeepholeRule struct {
+	Name    string
+	Rewrite func(window []*Instruction) (int, []*Instruction)
+}
+
+// PeepholeRules are the rules run by default.
+var PeepholeRules = []*PeepholeRule{
+	{Name: "thread-jumps", Rewrite: threadJumps},
+	{Name: "constant-condition", Rewrite: constantCondition},
+	{Name: "jump-to-next", Rewrite: jumpToNext},
+	{Name: "jump-to-return", Rewrite: jumpToReturn},
+	{Name: "unreachable", Rewrite: removeUnreachable},
+	{Name: "load-pop", Rewrite: removeLoadPop},
+	{Name: "store-load", Rewrite: duplicateStore},
+}
+
+// PeepholeStats counts the work done by the peephole pass.
+type PeepholeStats struct {
+	// Rewrites counts the rewrites by rule name.
+	Rewrites            map[string]int
+	InstructionsRemoved int
+	BytesRemoved        int
+}
+
+// Peephole runs rules over instructions until none of them applies and
+// returns the rewritten instructions with their line table. Jump offsets
+// are relocated to the new positions of their targets. stats may be nil.
+func Peephole(instructions code.Instructions, lines code.LineTable, rules []*PeepholeRule, stats *PeepholeStats) (code.Instructions, code.LineTable) {
+	list, end := decode(instructions, lines, nil)
+	markTargets(list)
+
+	for changed := true; changed; {
+		changed = false
+		for i := 0; i < len(list); i++ {
+			for _, rule := range rules {
+				replaced, replacement := rule.Rewrite(list[i:])
+				if replaced == 0 || !replaceable(list[i:i+replaced]) {
+					continue
+				}
+
+				next := end
+				if i+replaced < len(list) {
+					next = list[i+replaced]
+				}
+				if len(replacement) != 0 {
+					next = replacement[0]
+				}
+				redirect(list, list[i], next)
+				redirect(replacement, list[i], next)
+				for _, ins := range replacement {
+					if !ins.Position.IsValid() {
+						ins.Position = list[i].Position
+					}
+				}
+
+				if stats != nil {
+					if stats.Rewrites == nil {
+						stats.Rewrites = make(map[string]int)
+					}
+					stats.Rewrites[rule.Name]++
+					stats.InstructionsRemoved += replaced - len(replacement)
+					stats.BytesRemoved += size(list[i:i+replaced]) - size(replacement)
+				}
+
+				list = append(list[:i:i], append(replacement, list[i+replaced:]...)...)
+				markTargets(list)
+				changed = true
+				if i >= len(list) {
+					break
+				}
+			}
+		}
+	}
+
+	return encode(list, end)
+}
+
+func replaceable(replaced []*Instruction) bool {
+	for _, ins := range replaced[1:] {
+		if ins.Targeted {
+			return false
+		}
+	}
+	return true
+}
+
+func redirect(list []*Instruction, from *Instruction, to *Instruction) {
+	for _, ins := range list {
+		if ins.Target == from {
+			ins.Target = to
+		}
+	}
+}
+
+func markTargets(list []*Instruction) {
+	for _, ins := range list {
+		ins.Targeted = false
+	}
+	for _, ins := range list {
+		if ins.Target != nil {
+			ins.Target.Targeted = true
+		}
+	}
+}
+
+// jumpOperand returns the index of the operand holding the target of a
+// jump, or -1 for other instructions.
+func jumpOperand(op code.Opcode) int {
+	switch op {
+	case code.OpJump, code.OpJumpNotTrue, code.OpJumpIfNull, code.OpJumpIfNotNull:
+		return 0
+	case code.OpJumpIfArgument:
+		return 1
+	default:
+		return -1
+	}
+}
+
+// decode decodes instructions. The jumps at the offsets in targets lead
+// to the given offsets instead of the ones in their operands.
+func decode(instructions code.Instructions, lines code.LineTable, targets map[int]int) ([]*Instruction, *Instruction) {
+	var list []*Instruction
+	at := make(map[int]*Instruction)
+	offsets := make(map[*Instruction]int)
+
+	for i := 0; i < len(instructions); {
+		def, header, err := code.LookupInstruction(instructions[i:])
+		if err != nil {
+			panic(err)
+		}
+
+		operands, read := code.ReadOperands(def, instructions[i+header:])
+		ins := &Instruction{
+			Op:       code.Opcode(instructions[i+header-1]),
+			Operands: operands,
+			Position: lines.Lookup(i),
+		}
+		list = append(list, ins)
+		at[i] = ins
+		offsets[ins] = i
+
+		i += header + read
+	}
+
+	end := &Instruction{end: true}
+	at[len(instructions)] = end
+
+	for _, ins := range list {
+		if operand := jumpOperand(ins.Op); operand != -1 {
+			target, ok := targets[offsets[ins]]
+			if !ok {
+				target = ins.Operands[operand]
+			}
+			ins.Target = at[target]
+		}
+	}
+
+	return list, end
+}
+
+func encode(list []*Instruction, end *Instruction) (code.Instructions, code.LineTable) {
+	// jumps become wide when their target moves out of the range of their
+	// operand, which moves the instructions after them in turn
+	offsets := make(map[*Instruction]int)
+	for changed := true; changed; {
+		changed = false
+		offset := 0
+		for _, ins := range list {
+			if offsets[ins] != offset {
+				offsets[ins] = offset
+				changed = true
+			}
+			offset += len(ins.encode(offsets))
+		}
+		if offsets[end] != offset {
+			offsets[end] = offset
+			changed = true
+		}
+	}
+
+	instructions := code.Instructions{}
+	var lines code.LineTable
+	position := token.Position{}
+	for _, ins := range list {
+		if ins.Position != position {
+			lines = append(lines, code.LineEntry{Offset: len(instructions), Position: ins.Position})
+			position = ins.Position
+		}
+		instructions = append(instructions, ins.encode(offsets)...)
+	}
+	return instructions, lines
+}
+
+// encode encodes ins with the offset of its target, if it is a jump.
+func (ins *Instruction) encode(offsets map[*Instruction]int) []byte {
+	operands := ins.Operands
+	if operand := jumpOperand(ins.Op); operand != -1 {
+		operands = append([]int{}, operands...)
+		operands[operand] = offsets[ins.Target]
+	}
+	return code.Make(ins.Op, operands...)
+}
+
+func size(list []*Instruction) int {
+	n := 0
+	for _, ins := range list {
+		n += len(code.Make(ins.Op, ins.Operands...))
+	}
+	return n
+}
+
+func jump(op code.Opcode, operands []int, target *Instruction) *Instruction {
+	return &Instruction{Op: op, Operands: append([]int{}, operands...), Target: target}
+}
+
+// threadJumps lets jumps to an unconditional jump lead to its target.
+func threadJumps(window []*Instruction) (int, []*Instruction) {
+	ins := window[0]
+	if jumpOperand(ins.Op) == -1 || ins.Target.end || ins.Target.Op != code.OpJump {
+		return 0, nil
+	}
+
+	target := ins.Target.Target
+	if target == ins.Target {
+		return 0, nil
+	}
+	return 1, []*Instruction{jump(ins.Op, ins.Operands, target)}
+}
+
+// constantCondition removes conditional jumps on a constant.
+func constantCondition(window []*Instruction) (int, []*Instruction) {
+	if len(window) < 2 || window[1].Op != code.OpJumpNotTrue {
+		return 0, nil
+	}
+
+	switch window[0].Op {
+	case code.OpTrue:
+		return 2, nil
+	case code.OpFalse:
+		return 2, []*Instruction{jump(code.OpJump, []int{0}, window[1].Target)}
+	default:
+		return 0, nil
+	}
+}
+
+// jumpToNext removes jumps to the instruction following them.
+func jumpToNext(window []*Instruction) (int, []*Instruction) {
+	if window[0].Op == code.OpJump && len(window) > 1 && window[0].Target == window[1] {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// jumpToReturn replaces jumps to a return by the return.
+func jumpToReturn(window []*Instruction) (int, []*Instruction) {
+	ins := window[0]
+	if ins.Op != code.OpJump || ins.Target.end {
+		return 0, nil
+	}
+
+	switch ins.Target.Op {
+	case code.OpReturn, code.OpReturnValue:
+		return 1, []*Instruction{{Op: ins.Target.Op, Operands: []int{}}}
+	default:
+		return 0, nil
+	}
+}
+
+// removeUnreachable removes the instructions following an unconditional
+// jump, return or failure up to the next jump target.
+func removeUnreachable(window []*Instruction) (int, []*Instruction) {
+	switch window[0].Op {
+	case code.OpJump, code.OpReturn, code.OpReturnValue, code.OpMatchFail, code.OpDestructureFail:
+	default:
+		return 0, nil
+	}
+
+	n := 1
+	for n < len(window) && !window[n].Targeted {
+		n++
+	}
+	if n == 1 {
+		return 0, nil
+	}
+	return n, []*Instruction{window[0]}
+}
+
+// isLoad reports whether op only pushes a value.
+func isLoad(op code.Opcode) bool {
+	switch op {
+	case code.OpConstant, code.OpTrue, code.OpFalse, code.OpNull, code.OpGetGlobal,
+		code.OpGetLocal, code.OpGetBuiltin, code.OpGetFree, code.OpCurrentClosure, code.OpDup:
+		return true
+	default:
+		return false
+	}
+}
+
+// removeLoadPop removes values that are pushed and popped right away. The
+// value popped last is the result of the program, so the last pop stays.
+func removeLoadPop(window []*Instruction) (int, []*Instruction) {
+	if len(window) > 2 && isLoad(window[0].Op) && window[1].Op == code.OpPop {
+		return 2, nil
+	}
+	return 0, nil
+}
+
+// duplicateStore replaces loading a variable that was just stored by
+// duplicating the stored value before storing it. As in removeLoadPop,
+// the last pop stays.
+func duplicateStore(window []*Instruction) (int, []*Instruction) {
+	if len(window) < 2 {
+		return 0, nil
+	}
+
+	store, load := window[0], window[1]
+	switch {
+	case store.Op == code.OpSetGlobal && load.Op == code.OpGetGlobal:
+	case store.Op == code.OpSetLocal && load.Op == code.OpGetLocal:
+	default:
+		return 0, nil
+	}
+	if store.Operands[0] != load.Operands[0] {
+		return 0, nil
+	}
+
+	// a value stored and popped only needs to be stored
+	if len(window) > 3 && window[2].Op == code.OpPop && !window[2].Targeted {
+		return 3, []*Instruction{store}
+	}
+	return 2, []*Instruction{{Op: code.OpDup, Operands: []int{}}, store}
+}
@@ -0,0 +1,146 @@
+package compiler
+
+import (
+	"compiler/code"
+	"compiler/token"
+	"reflect"
+	"testing"
+)
+
+func TestPeepholeRules(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "let x = 1; x; 5",
+			expectedConstants: []interface{}{1, 5},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "let x = 1; x",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpDup),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "if (true) { 10 } else { 20 }; 3333;",
+			expectedConstants: []interface{}{10, 20, 3333},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "let x = if (false) { 1 } else { 2 }; x",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpDup),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn(a) { if (a) { 1 } else { 2 } }",
+			expectedConstants: []interface{}{
+				1,
+				2,
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpJumpNotTrue, 9),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpReturnValue),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTestsWithOptions(t, Options{Peephole: PeepholeRules}, tests)
+}
+
+func TestPeepholeRelocatesJumps(t *testing.T) {
+	doubleBang := &PeepholeRule{
+		Name: "double-bang",
+		Rewrite: func(window []*Instruction) (int, []*Instruction) {
+			if len(window) > 1 && window[0].Op == code.OpBang && window[1].Op == code.OpBang {
+				return 2, nil
+			}
+			return 0, nil
+		},
+	}
+
+	instructions := concatInstructions([]code.Instructions{
+		code.Make(code.OpTrue),
+		code.Make(code.OpJumpIfNull, 4),
+		code.Make(code.OpBang),
+		code.Make(code.OpBang),
+		code.Make(code.OpJump, 10),
+		code.Make(code.OpPop),
+	})
+	expected := concatInstructions([]code.Instructions{
+		code.Make(code.OpTrue),
+		code.Make(code.OpJumpIfNull, 4),
+		code.Make(code.OpJump, 8),
+		code.Make(code.OpPop),
+	})
+
+	lines := code.LineTable{
+		{Offset: 0, Position: token.Position{Offset: 0, Line: 1, Column: 1}},
+		{Offset: 4, Position: token.Position{Offset: 10, Line: 2, Column: 1}},
+		{Offset: 6, Position: token.Position{Offset: 20, Line: 3, Column: 1}},
+		{Offset: 9, Position: token.Position{Offset: 30, Line: 4, Column: 1}},
+	}
+	expectedLines := code.LineTable{
+		{Offset: 0, Position: token.Position{Offset: 0, Line: 1, Column: 1}},
+		{Offset: 4, Position: token.Position{Offset: 20, Line: 3, Column: 1}},
+		{Offset: 7, Position: token.Position{Offset: 30, Line: 4, Column: 1}},
+	}
+
+	stats := &PeepholeStats{}
+	actual, actualLines := Peephole(instructions, lines, []*PeepholeRule{doubleBang}, stats)
+	if actual.String() != expected.String() {
+		t.Fatalf("wrong instructions.\nwant=%q\ngot= %q", expected, actual)
+	}
+	if !reflect.DeepEqual(actualLines, expectedLines) {
+		t.Errorf("wrong lines.\nwant=%v\ngot= %v", expectedLines, actualLines)
+	}
+
+	expectedStats := &PeepholeStats{Rewrites: map[string]int{"double-bang": 1}, InstructionsRemoved: 2, BytesRemoved: 2}
+	if !reflect.DeepEqual(stats, expectedStats) {
+		t.Errorf("wrong stats. want=%+v, got=%+v", expectedStats, stats)
+	}
+}
+
+func TestPeepholeStats(t *testing.T) {
+	compiler := New()
+	err := compiler.Compile(parse(t, `
+let f = fn(x) { if (x) { return 1; 2 } else { 3 } };
+let g = fn(x) { if (x) { 1 } else { 2 } };
+f; g; 4`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	stats := compiler.PeepholeStats()
+	expected := map[string]int{"unreachable": 1, "jump-to-return": 1, "load-pop": 1, "store-load": 1}
+	if !reflect.DeepEqual(stats.Rewrites, expected) {
+		t.Errorf("wrong rewrites. want=%v, got=%v", expected, stats.Rewrites)
+	}
+	if stats.InstructionsRemoved != 6 || stats.BytesRemoved != 16 {
+		t.Errorf("wrong removals. want=6 instructions, 16 bytes, got=%d instructions, %d bytes",
+			stats.InstructionsRemoved, stats.BytesRemoved)
+	}
+}
@@ -0,0 +1,314 @@
+package compiler
+
+import (
+	"compiler/ast"
+	"compiler/object"
+	"compiler/token"
+	"fmt"
+)
+
+// ResolveError is a name that cannot be resolved at a position of the source.
+type ResolveError struct {
+	Position token.Position
+	Message  string
+}
+
+func (err *ResolveError) Error() string {
+	return fmt.Sprintf("%s: %s", err.Position, err.Message)
+}
+
+// resolver defines and retrieves names in the same order as the compiler,
+// but keeps going after a name cannot be resolved.
+type resolver struct {
+	symbolTable *SymbolTable
+	// declarations holds the names declared anywhere in each enclosing
+	// function, outermost first, to tell early uses from undefined names.
+	declarations []map[string]token.Position
+	// uninitialized is the global being defined by definition while its
+	// value is resolved, outside of the functions in the value
+	uninitialized *Symbol
+	definition    *ast.Identifier
+
+	errors []*ResolveError
+}
+
+// Resolve reports every identifier of program that the compiler would
+// fail to resolve, every duplicate parameter, every use of a name before
+// its definition and every assignment to a constant, in the order they
+// appear.
+func Resolve(program *ast.Program) []*ResolveError {
+	symbolTable := NewSymbolTable()
+	for i, builtin := range object.Builtins {
+		symbolTable.DefineBuiltin(i, builtin.Name)
+	}
+
+	r := &resolver{symbolTable: symbolTable}
+	r.declarations = append(r.declarations, declarations(program, nil))
+	for _, s := range program.Statements {
+		r.statement(s)
+	}
+	return r.errors
+}
+
+// declarations collects the names bound by let and const statements in
+// body and parameters, but not in nested functions.
+func declarations(body ast.Node, parameters []*ast.Identifier) map[string]token.Position {
+	declared := make(map[string]token.Position)
+	for _, param := range parameters {
+		declared[param.Value] = param.Token.Position
+	}
+
+	declare := func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.LetStatement:
+			declared[node.Name.Value] = node.Name.Token.Position
+		case *ast.ConstStatement:
+			declared[node.Name.Value] = node.Name.Token.Position
+		case *ast.DestructuringLetStatement:
+			ast.Inspect(node.Pattern, func(node ast.Node) bool {
+				if ident, ok := node.(*ast.Identifier); ok {
+					declared[ident.Value] = ident.Token.Position
+				}
+				return true
+			})
+		case *ast.FunctionLiteral, *ast.LambdaLiteral, *ast.MacroLiteral:
+			return false
+		}
+		return true
+	}
+	ast.Inspect(body, declare)
+
+	return declared
+}
+
+func (r *resolver) errorf(pos token.Position, format string, a ...interface{}) {
+	r.errors = append(r.errors, &ResolveError{Position: pos, Message: fmt.Sprintf(format, a...)})
+}
+
+func (r *resolver) statement(stmt ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		r.checkAssignable(stmt.Name)
+		r.binding(stmt.Name, stmt.Value, func() *Symbol {
+			return r.symbolTable.Define(stmt.Name.Value)
+		})
+	case *ast.ConstStatement:
+		r.checkAssignable(stmt.Name)
+		if isLiteral(stmt.Value) {
+			r.symbolTable.DefineConstant(stmt.Name.Value, stmt.Value)
+			return
+		}
+		r.binding(stmt.Name, stmt.Value, func() *Symbol {
+			return r.symbolTable.DefineConstant(stmt.Name.Value, nil)
+		})
+	case *ast.InfixDeclaration:
+		r.symbolTable.Define(stmt.Operator.Literal)
+		r.expression(stmt.Value)
+	case *ast.DestructuringLetStatement:
+		ast.Inspect(stmt.Pattern, func(node ast.Node) bool {
+			if ident, ok := node.(*ast.Identifier); ok {
+				r.checkAssignable(ident)
+			}
+			return true
+		})
+		r.expression(stmt.Value)
+		r.pattern(stmt.Pattern, make(map[string]*Symbol))
+	case *ast.ReturnStatement:
+		if stmt.ReturnValue != nil {
+			r.expression(stmt.ReturnValue)
+		}
+	case *ast.ExpressionStatement:
+		if stmt.Expression != nil {
+			r.expression(stmt.Expression)
+		}
+	case *ast.BlockStatement:
+		for _, s := range stmt.Statements {
+			r.statement(s)
+		}
+	}
+}
+
+// binding resolves the value of a let or const statement defining name
+// with define. Only functions may refer to the name they are bound to, any
+// other value would read it before it is set. The functions inside a global
+// value run later, when the global is set, so they may refer to it too.
+func (r *resolver) binding(name *ast.Identifier, value ast.Expression, define func() *Symbol) {
+	switch value.(type) {
+	case *ast.FunctionLiteral, *ast.LambdaLiteral:
+		define()
+		r.expression(value)
+		return
+	}
+
+	if r.symbolTable.outer != nil {
+		r.expression(value)
+		define()
+		return
+	}
+
+	r.uninitialized, r.definition = define(), name
+	r.expression(value)
+	r.uninitialized, r.definition = nil, nil
+}
+
+func (r *resolver) expression(expr ast.Expression) {
+	switch expr := expr.(type) {
+	case *ast.Identifier:
+		r.identifier(expr)
+	case *ast.InterpolatedString:
+		for _, e := range expr.Expressions {
+			r.expression(e)
+		}
+	case *ast.PrefixExpression:
+		r.expression(expr.Right)
+	case *ast.InfixExpression:
+		r.symbolTable.RetrieveSymbol(string(expr.Operator))
+		r.expression(expr.Left)
+		r.expression(expr.Right)
+	case *ast.IfExpression:
+		r.expression(expr.Condition)
+		r.statement(expr.Consequence)
+		if expr.Alternative != nil {
+			r.statement(expr.Alternative)
+		}
+	case *ast.FunctionLiteral:
+		r.function(expr)
+	case *ast.LambdaLiteral:
+		r.function(expr.Function())
+	case *ast.PipeExpression:
+		r.expression(expr.Left)
+		r.expression(expr.Right)
+	case *ast.CallExpression:
+		r.expression(expr.Left)
+		for _, arg := range expr.Arguments {
+			r.expression(arg)
+		}
+	case *ast.SpreadExpression:
+		r.expression(expr.Value)
+	case *ast.ArrayLiteral:
+		for _, e := range expr.Elements {
+			r.expression(e)
+		}
+	case *ast.IndexExpression:
+		r.expression(expr.Left)
+		r.expression(expr.Index)
+	case *ast.PropertyExpression:
+		r.expression(expr.Left)
+	case *ast.MapLiteral:
+		for _, key := range expr.OrderedKeys() {
+			r.expression(key)
+			r.expression(expr.Entries[key])
+		}
+	case *ast.MatchExpression:
+		r.expression(expr.Subject)
+		for _, arm := range expr.Arms {
+			shadowed := make(map[string]*Symbol)
+			r.pattern(arm.Pattern, shadowed)
+			if arm.Guard != nil {
+				r.expression(arm.Guard)
+			}
+			r.expression(arm.Body)
+
+			// bindings are only visible inside their arm
+			for name, symbol := range shadowed {
+				r.symbolTable.restore(name, symbol)
+			}
+		}
+	}
+}
+
+func (r *resolver) identifier(ident *ast.Identifier) {
+	if symbol, ok := r.symbolTable.RetrieveSymbol(ident.Value); ok {
+		if symbol == r.uninitialized {
+			r.errorf(ident.Token.Position, "%s used before its definition at %s", ident.Value, r.definition.Token.Position)
+		}
+		return
+	}
+
+	for i := len(r.declarations) - 1; i >= 0; i-- {
+		if pos, ok := r.declarations[i][ident.Value]; ok {
+			r.errorf(ident.Token.Position, "%s used before its definition at %s", ident.Value, pos)
+			return
+		}
+	}
+	r.errorf(ident.Token.Position, "undefined: %s", ident.Value)
+}
+
+func (r *resolver) function(fn *ast.FunctionLiteral) {
+	// the function runs after the global it is part of is set
+	uninitialized := r.uninitialized
+	r.uninitialized = nil
+	defer func() { r.uninitialized = uninitialized }()
+
+	r.symbolTable = FromSymbolTable(r.symbolTable)
+
+	parameters := fn.Parameters
+	if fn.Rest != nil {
+		parameters = append(parameters[:len(parameters):len(parameters)], fn.Rest)
+	}
+	r.declarations = append(r.declarations, declarations(fn.Body, parameters))
+
+	if fn.Name != "" {
+		r.symbolTable.DefineFunctionName(fn.Name)
+	}
+
+	seen := make(map[string]bool)
+	for _, param := range parameters {
+		if seen[param.Value] {
+			r.errorf(param.Token.Position, "duplicate parameter %s", param.Value)
+		}
+		seen[param.Value] = true
+	}
+
+	// default values only see the parameters in front of them
+	for i, param := range fn.Parameters {
+		if def := fn.Default(i); def != nil {
+			r.expression(def)
+		}
+		r.symbolTable.Define(param.Value)
+	}
+	if fn.Rest != nil {
+		r.symbolTable.Define(fn.Rest.Value)
+	}
+
+	r.statement(fn.Body)
+
+	r.declarations = r.declarations[:len(r.declarations)-1]
+	r.symbolTable = r.symbolTable.UnwrapSymbolTable()
+}
+
+func (r *resolver) pattern(pattern ast.Pattern, shadowed map[string]*Symbol) {
+	switch pattern := pattern.(type) {
+	case *ast.BindingPattern:
+		r.bind(pattern.Name.Value, shadowed)
+	case *ast.LiteralPattern:
+		r.expression(pattern.Value)
+	case *ast.ArrayPattern:
+		for _, e := range pattern.Elements {
+			r.pattern(e, shadowed)
+		}
+		if pattern.Rest != nil {
+			r.bind(pattern.Rest.Value, shadowed)
+		}
+	case *ast.MapPattern:
+		for _, entry := range pattern.Entries {
+			r.expression(entry.Key)
+			r.pattern(entry.Value, shadowed)
+		}
+	}
+}
+
+// checkAssignable reports name if it is a constant of the current scope.
+func (r *resolver) checkAssignable(name *ast.Identifier) {
+	symbol, ok := r.symbolTable.symbols[name.Value]
+	if ok && symbol.Immutable {
+		r.errorf(name.Token.Position, "cannot assign to constant %s", name.Value)
+	}
+}
+
+func (r *resolver) bind(name string, shadowed map[string]*Symbol) {
+	if _, ok := shadowed[name]; !ok {
+		shadowed[name] = r.symbolTable.symbols[name]
+	}
+	r.symbolTable.Define(name)
+}
@@ -0,0 +1,49 @@
+package compiler
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{`let x = 1; let f = fn(a, b = a, ...c) { x + a + b + len(c) }; f(1)`, nil},
+		{`let f = fn(n) { if (n < 1) { 0 } else { f(n - 1) } };`, nil},
+		{`let a = 1; let f = fn() { fn() { a } };`, nil},
+		{`const limit = 10; match ([1]) { [x] if x < limit => x, {k} => k, _ => 0 }`, nil},
+		{`let [a, {b}] = [1, {"b": 2}]; a + b`, nil},
+		{`infixl 6 <+> = fn(a, b) { a + b }; 1 <+> 2`, nil},
+		{`let m = macro(x) { quote(unquote(x)) };`, nil},
+		{`let p = {}; p.name`, nil},
+		{`x + y`, []string{`1:1: undefined: x`, `1:5: undefined: y`}},
+		{`let f = fn() { g() }; let g = fn() { 1 };`, []string{`1:16: g used before its definition at 1:27`}},
+		{`let f = fn() { let y = x; let x = 1; y };`, []string{`1:24: x used before its definition at 1:31`}},
+		{`let a = a; a`, []string{`1:9: a used before its definition at 1:5`}},
+		{`let a = 1; let a = a + 1; const c = [c];`, []string{`1:20: a used before its definition at 1:16`, `1:38: c used before its definition at 1:33`}},
+		{`let m = {"f": fn() { m }}; m.f()`, nil},
+		{`let xs = [x => xs, fn() { len(xs) }]; let m = match (1) { m => m };`, nil},
+		{`let f = fn() { let m = {"f": fn() { m }}; m };`, []string{`1:37: m used before its definition at 1:20`}},
+		{`let f = fn() { let v = v; v }; f()`, []string{`1:24: v used before its definition at 1:20`}},
+		{`let fact = n => if (n < 2) { 1 } else { n * fact(n - 1) }; fact(3)`, nil},
+		{`fn(a = b, b = 1) { a }`, []string{`1:8: b used before its definition at 1:11`}},
+		{`fn(a, b, a, ...b) { a }`, []string{`1:10: duplicate parameter a`, `1:16: duplicate parameter b`}},
+		{`match (1) { x => x, _ => x }`, []string{`1:26: undefined: x`}},
+		{`const x = 1; let x = 2;`, []string{`1:18: cannot assign to constant x`}},
+		{`fn() { const x = 1; let [a, {x}] = [1, {"x": 2}]; }`, []string{`1:30: cannot assign to constant x`}},
+		{"let f = fn() {\n  missing(1)\n};\nf(other)", []string{`2:3: undefined: missing`, `4:3: undefined: other`}},
+	}
+
+	for _, tt := range tests {
+		var actual []string
+		for _, err := range Resolve(parse(t, tt.input)) {
+			actual = append(actual, err.Error())
+		}
+
+		if strings.Join(actual, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("wrong errors for %q.\nwant=%q\ngot= %q", tt.input, tt.expected, actual)
+		}
+	}
+}
@@ -1,5 +1,7 @@
 package compiler
 
+import "compiler/ast"
+
 type SymbolScope string
 
 const (
@@ -14,6 +16,13 @@ type Symbol struct {
 	Name  string
 	Scope SymbolScope
 	Index int
+
+	// Immutable symbols are defined by const statements and cannot be
+	// assigned to again in the same scope.
+	Immutable bool
+	// Value is the literal an immutable symbol is bound to, if any. It is
+	// inlined wherever the symbol is used.
+	Value ast.Expression
 }
 
 type SymbolTable struct {
@@ -54,6 +63,24 @@ func (s *SymbolTable) Define(name string) *Symbol {
 	return symbol
 }
 
+// DefineConstant defines an immutable symbol. value is the literal the
+// symbol is inlined as, or nil if it has to be loaded like any other.
+func (s *SymbolTable) DefineConstant(name string, value ast.Expression) *Symbol {
+	symbol := s.Define(name)
+	symbol.Immutable = true
+	symbol.Value = value
+	return symbol
+}
+
+// restore reverts name to a previous definition. A nil symbol removes it.
+func (s *SymbolTable) restore(name string, symbol *Symbol) {
+	if symbol == nil {
+		delete(s.symbols, name)
+	} else {
+		s.symbols[name] = symbol
+	}
+}
+
 func (s *SymbolTable) DefineBuiltin(index int, name string) *Symbol {
 	symbol := &Symbol{Name: name, Index: index, Scope: BuiltinScope}
 	s.symbols[name] = symbol
@@ -84,7 +111,7 @@ func (s *SymbolTable) RetrieveSymbol(name string) (*Symbol, bool) {
 			return symbol, ok
 		}
 
-		if symbol.Scope == GlobalScope || symbol.Scope == BuiltinScope {
+		if symbol.Scope == GlobalScope || symbol.Scope == BuiltinScope || symbol.Value != nil {
 			return symbol, ok
 		}
 
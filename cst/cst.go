@@ -0,0 +1,162 @@
+// Package cst builds lossless concrete syntax trees. Unlike the ast, a
+// concrete syntax tree keeps every token including whitespace and comments,
+// so printing it reproduces the source byte for byte.
+package cst
+
+import (
+	"compiler/ast"
+	"compiler/parser"
+	"compiler/scanner"
+	"compiler/token"
+	"errors"
+	"sort"
+	"strings"
+)
+
+type Token struct {
+	token.Token
+	// Text is the exact source text of the token. It differs from the
+	// literal for strings, whose literal lacks the quotes.
+	Text string
+}
+
+// IsTrivia reports whether the token is whitespace or a comment.
+func (tok *Token) IsTrivia() bool {
+	return tok.Type == token.WHITESPACE || tok.Type == token.COMMENT
+}
+
+// Node is either a leaf holding a single token or an inner node holding
+// the nodes of the ast node it was parsed into. Trivia in front of the
+// first token of an ast node belongs to the enclosing node.
+type Node struct {
+	AST      ast.Node
+	Token    *Token
+	Children []*Node
+}
+
+// Parse parses the input into a concrete syntax tree whose root maps to the
+// *ast.Program of the input.
+func Parse(input string) (*Node, error) {
+	s := scanner.NewHandcodedScanner(input)
+	s.EmitTrivia()
+
+	p := parser.New(s)
+	program := p.ParseProgram()
+	if len(p.Errors) != 0 {
+		return nil, errors.New(strings.Join(p.Errors, "\n"))
+	}
+
+	return build(input, program, p.Tokens(), p.Spans()), nil
+}
+
+// String returns the source text of the node.
+func (n *Node) String() string {
+	var out strings.Builder
+	n.write(&out)
+	return out.String()
+}
+
+func (n *Node) write(out *strings.Builder) {
+	if n.Token != nil {
+		out.WriteString(n.Token.Text)
+	}
+	for _, child := range n.Children {
+		child.write(out)
+	}
+}
+
+// Tokens returns the tokens of the node in source order.
+func (n *Node) Tokens() []*Token {
+	if n.Token != nil {
+		return []*Token{n.Token}
+	}
+
+	var tokens []*Token
+	for _, child := range n.Children {
+		tokens = append(tokens, child.Tokens()...)
+	}
+	return tokens
+}
+
+// Find returns the node the given ast node was parsed from or nil if it is
+// not part of the tree.
+func (n *Node) Find(node ast.Node) *Node {
+	if n.AST == node {
+		return n
+	}
+
+	for _, child := range n.Children {
+		if found := child.Find(node); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+type builder struct {
+	tokens []*Token
+	spans  []parser.Span
+	next   int
+}
+
+// build nests the spans recorded by the parser. The tokens cover the input
+// without gaps, so the text of a token reaches up to the next one.
+func build(input string, program *ast.Program, tokens []token.Token, spans []parser.Span) *Node {
+	b := &builder{}
+	for i, tok := range tokens {
+		if tok.Type == token.EOF {
+			break
+		}
+
+		end := len(input)
+		if i+1 < len(tokens) && tokens[i+1].Position.Offset < end {
+			end = tokens[i+1].Position.Offset
+		}
+		b.tokens = append(b.tokens, &Token{Token: tok, Text: input[tok.Position.Offset:end]})
+	}
+
+	// enclosing nodes come first: spans with the same range are ordered
+	// from the last recorded one, which is the outermost.
+	order := make([]int, len(spans))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := spans[order[i]], spans[order[j]]
+		if a.Start != b.Start {
+			return a.Start < b.Start
+		}
+		if a.End != b.End {
+			return a.End > b.End
+		}
+		return order[i] > order[j]
+	})
+	for _, i := range order {
+		b.spans = append(b.spans, spans[i])
+	}
+
+	return b.node(program, 0, len(b.tokens))
+}
+
+func (b *builder) node(astNode ast.Node, start int, end int) *Node {
+	n := &Node{AST: astNode}
+
+	for i := start; i < end; {
+		for b.next < len(b.spans) && b.spans[b.next].Start < i {
+			b.next++
+		}
+
+		if b.next < len(b.spans) && b.spans[b.next].Start == i && b.spans[b.next].End <= end {
+			span := b.spans[b.next]
+			b.next++
+			n.Children = append(n.Children, b.node(span.Node, span.Start, span.End))
+			i = span.End
+			continue
+		}
+
+		n.Children = append(n.Children, &Node{Token: b.tokens[i]})
+		i++
+	}
+
+	return n
+}
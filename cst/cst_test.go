@@ -0,0 +1,95 @@
+package cst
+
+import (
+	"compiler/ast"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	inputs := []string{
+		``,
+		"   \n\t",
+		`let x = 5;`,
+		"let   add = fn(a,b)  {\n\treturn a +b // sum\n};\r\n\nadd( 1 , -2 )  ",
+		"// leading comment\nif (1 < 2 && true) { \"yes\" } else { \"no\" }\n// trailing comment",
+		`let m = {"a": [1, 2][0], "b": !false}; m [ "a" ]`,
+		`"Hello ${ name }, ${"nested ${1+2}"}!"`,
+		"match (x) {\n  0 => 1,\n  [a, ...rest] if a > 0 => rest,\n  {name} => name,\n  _ => -1\n}",
+		`let [a, ...rest] = xs ;let {name, "age": age} = person`,
+		`a?.b?.[0] ?? null; xs |> map(x => x * 2)`,
+		"infixr 5 <+> = fn(a, b) { a + b };\n1 <+>2<+> 3",
+		"let x : int=1; fn(a :[ int ], b) : fn( int ):{string:int} { a }",
+	}
+
+	for _, input := range inputs {
+		tree, err := Parse(input)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %s", input, err)
+		}
+
+		if tree.String() != input {
+			t.Errorf("wrong output.\nwant=%q\ngot= %q", input, tree.String())
+		}
+	}
+}
+
+func TestMappingToAst(t *testing.T) {
+	input := "let x = 1 +  2 * 3; // note\nx"
+
+	tree, err := Parse(input)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	program, ok := tree.AST.(*ast.Program)
+	if !ok {
+		t.Fatalf("Expected root to map to *ast.Program. Got %T", tree.AST)
+	}
+
+	let := program.Statements[0].(*ast.LetStatement)
+	sum := let.Value.(*ast.InfixExpression)
+
+	tests := []struct {
+		node     ast.Node
+		expected string
+	}{
+		{let, "let x = 1 +  2 * 3;"},
+		{let.Name, "x"},
+		{sum, "1 +  2 * 3"},
+		{sum.Right, "2 * 3"},
+		{program.Statements[1], "x"},
+	}
+
+	for _, tt := range tests {
+		node := tree.Find(tt.node)
+		if node == nil {
+			t.Fatalf("Expected node for %s", tt.node.String())
+		}
+		if node.String() != tt.expected {
+			t.Errorf("Expected '%s'. Got '%s'", tt.expected, node.String())
+		}
+	}
+
+	var trivia []string
+	for _, tok := range tree.Tokens() {
+		if tok.IsTrivia() {
+			trivia = append(trivia, tok.Text)
+		}
+	}
+	expected := []string{" ", " ", " ", " ", "  ", " ", " ", " ", "// note", "\n"}
+	if len(trivia) != len(expected) {
+		t.Fatalf("Expected %d trivia. Got %d: %q", len(expected), len(trivia), trivia)
+	}
+	for i := range expected {
+		if trivia[i] != expected[i] {
+			t.Errorf("Expected trivia '%s'. Got '%s'", expected[i], trivia[i])
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	_, err := Parse(`let x 5`)
+	if err == nil {
+		t.Errorf("Expected error for invalid input")
+	}
+}
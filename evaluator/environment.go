@@ -5,6 +5,11 @@ import "compiler/object"
 type Environment struct {
 	currentEnvironment  map[string]object.Object
 	extendedEnvironment *Environment
+	constants           map[string]bool
+
+	// renameCount numbers the names quote renames during a macro
+	// expansion, so they are unique in the whole expanded program
+	renameCount *int
 }
 
 func NewEnvironment() *Environment {
@@ -30,3 +35,30 @@ func (env *Environment) get(key string) object.Object {
 func (env *Environment) put(key string, value object.Object) {
 	env.currentEnvironment[key] = value
 }
+
+func (env *Environment) putConstant(key string, value object.Object) {
+	if env.constants == nil {
+		env.constants = make(map[string]bool)
+	}
+
+	env.currentEnvironment[key] = value
+	env.constants[key] = true
+}
+
+// renames returns the rename counter of the innermost macro expansion env
+// is part of. Quotes evaluated outside of an expansion get a counter of
+// their own.
+func (env *Environment) renames() *int {
+	for e := env; e != nil; e = e.extendedEnvironment {
+		if e.renameCount != nil {
+			return e.renameCount
+		}
+	}
+	return new(int)
+}
+
+// isConstant reports whether key is bound by a const statement of this
+// environment. Constants of extended environments may be shadowed.
+func (env *Environment) isConstant(key string) bool {
+	return env.constants[key]
+}
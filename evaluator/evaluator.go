@@ -4,6 +4,7 @@ import (
 	"compiler/ast"
 	"compiler/object"
 	"compiler/token"
+	"strings"
 )
 
 type Builtin func(*ast.CallExpression, *Environment) object.Object
@@ -43,6 +44,10 @@ func evaluate(node ast.Node, env *Environment) object.Object {
 	case *ast.ExpressionStatement:
 		return evaluate(v.Expression, env)
 	case *ast.LetStatement:
+		if env.isConstant(v.Name.Value) {
+			return object.NewError("cannot assign to constant %s", v.Name.Value)
+		}
+
 		value := evaluate(v.Value, env)
 		if isError(value) {
 			return value
@@ -50,6 +55,40 @@ func evaluate(node ast.Node, env *Environment) object.Object {
 
 		env.put(v.Name.Value, value)
 		return NULL
+	case *ast.ConstStatement:
+		if env.isConstant(v.Name.Value) {
+			return object.NewError("cannot assign to constant %s", v.Name.Value)
+		}
+
+		value := evaluate(v.Value, env)
+		if isError(value) {
+			return value
+		}
+
+		env.putConstant(v.Name.Value, value)
+		return NULL
+	case *ast.InfixDeclaration:
+		value := evaluate(v.Value, env)
+		if isError(value) {
+			return value
+		}
+
+		env.put(v.Operator.Literal, value)
+		return NULL
+	case *ast.DestructuringLetStatement:
+		value := evaluate(v.Value, env)
+		if isError(value) {
+			return value
+		}
+
+		matched := matchPattern(v.Pattern, value, env)
+		if isError(matched) {
+			return matched
+		}
+		if matched != TRUE {
+			return object.NewError("cannot destructure %s: value does not fit the pattern", value.String())
+		}
+		return NULL
 	case *ast.ReturnStatement:
 		value := evaluate(v.ReturnValue, env)
 		if isError(value) {
@@ -69,6 +108,9 @@ func evaluate(node ast.Node, env *Environment) object.Object {
 	case *ast.PrefixExpression:
 		return evaluatePrefixExpression(v, env)
 	case *ast.InfixExpression:
+		if env.get(string(v.Operator)) != nil {
+			return evaluate(v.Call(), env)
+		}
 		return evaluateInfixExpression(v, env)
 	case *ast.IntegerLiteral:
 		return &object.Integer{Value: v.Value}
@@ -76,6 +118,19 @@ func evaluate(node ast.Node, env *Environment) object.Object {
 		return newBool(v.Value)
 	case *ast.StringLiteral:
 		return &object.String{Value: v.Value}
+	case *ast.InterpolatedString:
+		var out strings.Builder
+		for i, text := range v.Texts {
+			out.WriteString(text.Value)
+			if i < len(v.Expressions) {
+				value := evaluate(v.Expressions[i], env)
+				if isError(value) {
+					return value
+				}
+				out.WriteString(value.String())
+			}
+		}
+		return &object.String{Value: out.String()}
 	case *ast.Identifier:
 		builtin := getBuiltinByName(v.Value)
 		if builtin != nil {
@@ -92,52 +147,14 @@ func evaluate(node ast.Node, env *Environment) object.Object {
 		for _, param := range v.Parameters {
 			params = append(params, param.Value)
 		}
-		return &object.Function{Parameters: params, Body: v.Body}
-	case *ast.CallExpression:
-		left := evaluate(v.Left, env)
-		if isError(left) {
-			return left
-		}
 
-		builtin, ok := left.(*object.Builtin)
-		if ok {
-			args := make([]object.Object, len(v.Arguments))
-			for i, arg := range v.Arguments {
-				currentArg := evaluate(arg, env)
-				if isError(currentArg) {
-					return currentArg
-				}
-				args[i] = currentArg
-			}
-			return wrapNativeValue(builtin.Fn(args...))
-		}
-
-		function, ok := left.(*object.Function)
-		if !ok {
-			return object.NewError("not a function. Got %s", left.Type())
-		}
-
-		if numArg, numParam := len(v.Arguments), len(function.Parameters); numArg != numParam {
-			return object.NewError("wrong number of arguments: expected %d. Got %d", numParam, numArg)
-		}
-
-		newEnv := FromEnvironment(env)
-
-		for i, param := range function.Parameters {
-			currentParam := evaluate(v.Arguments[i], env)
-			if isError(currentParam) {
-				return currentParam
-			}
-
-			newEnv.put(param, currentParam)
-		}
-
-		result := evaluateBlockStatement(function.Body, newEnv)
-
-		returnStmt, ok := result.(*object.Return)
-		if ok {
-			return returnStmt.ReturnValue
+		function := &object.Function{Parameters: params, Defaults: v.Defaults, Body: v.Body}
+		if v.Rest != nil {
+			function.Rest = v.Rest.Value
 		}
+		return function
+	case *ast.CallExpression:
+		result, _ := evaluateChain(v, env)
 		return result
 	case *ast.IfExpression:
 		evaluatedCondition := evaluate(v.Condition, env)
@@ -168,8 +185,8 @@ func evaluate(node ast.Node, env *Environment) object.Object {
 		}
 		return &object.Array{Elements: elements}
 	case *ast.MapLiteral:
-		entries := make(map[string]object.Object, len(v.Entries))
-		for key, value := range v.Entries {
+		mapObj := &object.Map{}
+		for _, key := range v.OrderedKeys() {
 			keyObject := evaluate(key, env)
 			if isError(keyObject) {
 				return keyObject
@@ -179,41 +196,359 @@ func evaluate(node ast.Node, env *Environment) object.Object {
 				return object.NewError("not a valid hash key: %s", keyObject.Type())
 			}
 
-			valueObject := evaluate(value, env)
+			valueObject := evaluate(v.Entries[key], env)
 			if isError(valueObject) {
 				return valueObject
 			}
 
-			entries[hashableKey.Hash()] = valueObject
+			mapObj.Set(hashableKey, valueObject)
 		}
-		return &object.Map{Entries: entries}
+		return mapObj
 	case *ast.IndexExpression:
-		left := evaluate(v.Left, env)
-		if isError(left) {
-			return left
+		result, _ := evaluateChain(v, env)
+		return result
+	case *ast.PropertyExpression:
+		result, _ := evaluateChain(v, env)
+		return result
+	case *ast.NullLiteral:
+		return NULL
+	case *ast.MatchExpression:
+		return evaluateMatchExpression(v, env)
+	case *ast.SpreadExpression:
+		return object.NewError("spread is only allowed in call arguments")
+	case *ast.PipeExpression:
+		return evaluate(v.Call(), env)
+	case *ast.LambdaLiteral:
+		return evaluate(v.Function(), env)
+	case *ast.MacroLiteral:
+		return object.NewError("macros can only be defined by top-level let statements")
+	default:
+		return object.NewError("Node of type %T unknown", v)
+	}
+}
+
+// evaluateArguments evaluates the arguments of a call and expands spread
+// arrays into separate arguments.
+func evaluateArguments(arguments []ast.Expression, env *Environment) ([]object.Object, *object.Error) {
+	args := make([]object.Object, 0, len(arguments))
+	for _, arg := range arguments {
+		spread, isSpread := arg.(*ast.SpreadExpression)
+		if isSpread {
+			arg = spread.Value
+		}
+
+		value := evaluate(arg, env)
+		if errObj, ok := value.(*object.Error); ok {
+			return nil, errObj
+		}
+
+		if !isSpread {
+			args = append(args, value)
+			continue
+		}
+
+		arr, ok := value.(*object.Array)
+		if !ok {
+			return nil, object.NewError("type missmatch: cannot spread %s", value.Type())
+		}
+		args = append(args, arr.Elements...)
+	}
+
+	return args, nil
+}
+
+// bindArguments creates the environment of a call. Default values of omitted
+// parameters are evaluated in it, so they can refer to earlier parameters.
+func bindArguments(function *object.Function, args []object.Object, env *Environment) (*Environment, *object.Error) {
+	numParams := len(function.Parameters)
+
+	required := numParams
+	for i := range function.Defaults {
+		if function.Defaults[i] != nil {
+			required = i
+			break
+		}
+	}
+
+	hasDefaults := required != numParams
+	isVariadic := function.Rest != ""
+
+	switch {
+	case len(args) < required && (hasDefaults || isVariadic):
+		return nil, object.NewError("wrong number of arguments: expected at least %d. Got %d", required, len(args))
+	case len(args) > numParams && !isVariadic && hasDefaults:
+		return nil, object.NewError("wrong number of arguments: expected at most %d. Got %d", numParams, len(args))
+	case len(args) < required || len(args) > numParams && !isVariadic:
+		return nil, object.NewError("wrong number of arguments: expected %d. Got %d", numParams, len(args))
+	}
+
+	newEnv := FromEnvironment(env)
+
+	for i, param := range function.Parameters {
+		if i < len(args) {
+			newEnv.put(param, args[i])
+			continue
+		}
+
+		value := evaluate(function.Defaults[i], newEnv)
+		if errObj, ok := value.(*object.Error); ok {
+			return nil, errObj
+		}
+		newEnv.put(param, value)
+	}
+
+	if function.Rest != "" {
+		rest := make([]object.Object, 0)
+		if len(args) > numParams {
+			rest = append(rest, args[numParams:]...)
+		}
+		newEnv.put(function.Rest, &object.Array{Elements: rest})
+	}
+
+	return newEnv, nil
+}
+
+func evaluateMatchExpression(match *ast.MatchExpression, env *Environment) object.Object {
+	subject := evaluate(match.Subject, env)
+	if isError(subject) {
+		return subject
+	}
+
+	for _, arm := range match.Arms {
+		armEnv := FromEnvironment(env)
+
+		matched := matchPattern(arm.Pattern, subject, armEnv)
+		if isError(matched) {
+			return matched
+		}
+		if matched != TRUE {
+			continue
+		}
+
+		if arm.Guard != nil {
+			guard := evaluate(arm.Guard, armEnv)
+			if isError(guard) {
+				return guard
+			}
+
+			booleanGuard, ok := guard.(*object.Boolean)
+			if !ok {
+				return object.NewError("non-boolean guard in match arm")
+			}
+			if !booleanGuard.Value {
+				continue
+			}
+		}
+
+		return evaluate(arm.Body, armEnv)
+	}
+
+	return object.NewError("non-exhaustive match: no pattern matched %s", subject.String())
+}
+
+// matchPattern reports whether value matches the pattern and puts the
+// bindings of the pattern into env.
+func matchPattern(pattern ast.Pattern, value object.Object, env *Environment) object.Object {
+	switch pattern := pattern.(type) {
+	case *ast.WildcardPattern:
+		return TRUE
+	case *ast.BindingPattern:
+		if env.isConstant(pattern.Name.Value) {
+			return object.NewError("cannot assign to constant %s", pattern.Name.Value)
+		}
+
+		env.put(pattern.Name.Value, value)
+		return TRUE
+	case *ast.LiteralPattern:
+		literal := evaluate(pattern.Value, env)
+		if isError(literal) {
+			return literal
+		}
+		if literal == NULL {
+			return newBool(value == NULL)
+		}
+
+		hashableLiteral, ok := literal.(object.Hashable)
+		if !ok {
+			return FALSE
+		}
+		hashableValue, ok := value.(object.Hashable)
+		if !ok {
+			return FALSE
+		}
+		return newBool(hashableValue.Hash() == hashableLiteral.Hash())
+	case *ast.ArrayPattern:
+		arr, ok := value.(*object.Array)
+		if !ok {
+			return FALSE
+		}
+
+		if len(arr.Elements) < len(pattern.Elements) || pattern.Rest == nil && len(arr.Elements) != len(pattern.Elements) {
+			return FALSE
+		}
+
+		for i, element := range pattern.Elements {
+			matched := matchPattern(element, arr.Elements[i], env)
+			if matched != TRUE {
+				return matched
+			}
+		}
+
+		if pattern.Rest != nil && pattern.Rest.Value != "_" {
+			if env.isConstant(pattern.Rest.Value) {
+				return object.NewError("cannot assign to constant %s", pattern.Rest.Value)
+			}
+
+			rest := make([]object.Object, len(arr.Elements)-len(pattern.Elements))
+			copy(rest, arr.Elements[len(pattern.Elements):])
+			env.put(pattern.Rest.Value, &object.Array{Elements: rest})
+		}
+		return TRUE
+	case *ast.MapPattern:
+		mapObj, ok := value.(*object.Map)
+		if !ok {
+			return FALSE
+		}
+
+		for _, entry := range pattern.Entries {
+			key := evaluate(entry.Key, env)
+			if isError(key) {
+				return key
+			}
+
+			hashableKey, ok := key.(object.Hashable)
+			if !ok {
+				return object.NewError("not a valid hash key: %s", key.Type())
+			}
+
+			entryValue, ok := mapObj.Get(hashableKey)
+			if !ok {
+				return FALSE
+			}
+
+			matched := matchPattern(entry.Value, entryValue, env)
+			if matched != TRUE {
+				return matched
+			}
+		}
+		return TRUE
+	default:
+		return object.NewError("unknown pattern %T", pattern)
+	}
+}
+
+// evaluateChain evaluates a chain of index, property and call expressions.
+// It reports whether an optional link like a?.b found a null left side, in
+// which case the rest of the chain is skipped and the result is null.
+func evaluateChain(node ast.Expression, env *Environment) (object.Object, bool) {
+	switch v := node.(type) {
+	case *ast.IndexExpression:
+		left, skipped := evaluateChain(v.Left, env)
+		if skipped || isError(left) {
+			return left, skipped
+		}
+		if v.Optional && left.Type() == object.NULL {
+			return NULL, true
 		}
 
 		index := evaluate(v.Index, env)
 		if isError(index) {
-			return index
+			return index, false
 		}
 
-		switch true {
-		case left.Type() == object.ARRAY && index.Type() == object.INT:
-			arr := left.(*object.Array)
-			indexInt := index.(*object.Integer)
-			return evaluateArrayIndexExpression(arr, indexInt)
-		case left.Type() == object.MAP:
-			mapObj := left.(*object.Map)
-			return evaluateMapIndexExpression(mapObj, index)
-		default:
-			return object.NewError("type missmatch: cannot index %s", left.Type())
+		return evaluateIndexExpression(left, index), false
+	case *ast.PropertyExpression:
+		left, skipped := evaluateChain(v.Left, env)
+		if skipped || isError(left) {
+			return left, skipped
 		}
+		if v.Optional && left.Type() == object.NULL {
+			return NULL, true
+		}
+
+		return evaluatePropertyExpression(left, v.Property.Value, v.Optional), false
+	case *ast.CallExpression:
+		if isCallTo(v, "quote") {
+			if len(v.Arguments) != 1 {
+				return object.NewError("wrong number of arguments to quote: expected 1. Got %d", len(v.Arguments)), false
+			}
+			return quote(v.Arguments[0], env), false
+		}
+
+		left, skipped := evaluateChain(v.Left, env)
+		if skipped || isError(left) {
+			return left, skipped
+		}
+
+		args, errObj := evaluateArguments(v.Arguments, env)
+		if errObj != nil {
+			return errObj, false
+		}
+
+		return applyFunction(left, args, env), false
 	default:
-		return object.NewError("Node of type %T unknown", v)
+		return evaluate(node, env), false
 	}
 }
 
+func applyFunction(left object.Object, args []object.Object, env *Environment) object.Object {
+	builtin, ok := left.(*object.Builtin)
+	if ok {
+		return wrapNativeValue(builtin.Fn(args...))
+	}
+
+	function, ok := left.(*object.Function)
+	if !ok {
+		return object.NewError("not a function. Got %s", left.Type())
+	}
+
+	newEnv, errObj := bindArguments(function, args, env)
+	if errObj != nil {
+		return errObj
+	}
+
+	result := evaluateBlockStatement(function.Body, newEnv)
+
+	returnStmt, ok := result.(*object.Return)
+	if ok {
+		return returnStmt.ReturnValue
+	}
+	return result
+}
+
+func evaluateIndexExpression(left object.Object, index object.Object) object.Object {
+	switch true {
+	case left.Type() == object.ARRAY && index.Type() == object.INT:
+		arr := left.(*object.Array)
+		indexInt := index.(*object.Integer)
+		return evaluateArrayIndexExpression(arr, indexInt)
+	case left.Type() == object.MAP:
+		mapObj := left.(*object.Map)
+		return evaluateMapIndexExpression(mapObj, index)
+	default:
+		return object.NewError("type missmatch: cannot index %s", left.Type())
+	}
+}
+
+// evaluatePropertyExpression reads a property of a map. A missing key is an
+// error unless the access is optional, in which case it results in null.
+func evaluatePropertyExpression(left object.Object, property string, optional bool) object.Object {
+	mapObj, ok := left.(*object.Map)
+	if !ok {
+		return object.NewError("type missmatch: cannot access property %s of %s", property, left.Type())
+	}
+
+	name := &object.String{Value: property}
+	value, ok := mapObj.Get(name)
+	if !ok {
+		if optional {
+			return NULL
+		}
+		return object.NewError("map has no key %q", property)
+	}
+	return value
+}
+
 func evaluateArrayIndexExpression(left *object.Array, index *object.Integer) object.Object {
 	if 0 > index.Value || index.Value >= int64(len(left.Elements)) {
 		return object.NewError("index %d out of bounds for array of length %d", index.Value, len(left.Elements))
@@ -227,9 +562,7 @@ func evaluateMapIndexExpression(left *object.Map, index object.Object) object.Ob
 		return object.NewError("not a valid hash key: %s", index.Type())
 	}
 
-	key := hashableIndex.Hash()
-
-	value, ok := left.Entries[key]
+	value, ok := left.Get(hashableIndex)
 	if !ok {
 		return NULL
 	}
@@ -286,6 +619,13 @@ func evaluateInfixExpression(infixExpr *ast.InfixExpression, env *Environment) o
 		return left
 	}
 
+	if infixExpr.Operator == token.COALESCE {
+		if left.Type() != object.NULL {
+			return left
+		}
+		return evaluate(infixExpr.Right, env)
+	}
+
 	right := evaluate(infixExpr.Right, env)
 	if isError(right) {
 		return right
@@ -307,11 +647,26 @@ func evaluateInfixExpression(infixExpr *ast.InfixExpression, env *Environment) o
 		rightStr := right.(*object.String)
 
 		return evaluateStringInfixExpression(infixExpr.Operator, leftStr, rightStr)
+	case left.Type() == object.NULL || right.Type() == object.NULL:
+		return evaluateNullInfixExpression(infixExpr.Operator, left, right)
 	default:
 		return object.NewError("Operation not supported %s %s %s", left.Type(), infixExpr.Operator, right.Type())
 	}
 }
 
+// evaluateNullInfixExpression compares null with any value. Null is only
+// equal to itself.
+func evaluateNullInfixExpression(operator token.TokenType, left object.Object, right object.Object) object.Object {
+	switch operator {
+	case token.EQUALS:
+		return newBool(left.Type() == right.Type())
+	case token.NOT_EQUALS:
+		return newBool(left.Type() != right.Type())
+	default:
+		return object.NewError("Operation not supported %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
 func evaluateIntegerInfixExpression(operator token.TokenType, left *object.Integer, right *object.Integer) object.Object {
 	switch operator {
 	case token.PLUS:
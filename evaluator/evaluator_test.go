@@ -199,10 +199,152 @@ func TestStringEvaluation(t *testing.T) {
 		    hashmap["a"]`,
 			"b",
 		},
+		{
+			`let name = "you"; "Hello ${name}, you have ${len([1, 2])} items"`,
+			"Hello you, you have 2 items",
+		},
+		{
+			`"${1}${true}${[1, "a"]}"`,
+			"1true[1, a]",
+		},
+		{
+			`let f = fn(x) { "<${x}>" }; "${f(f(1))}"`,
+			"<<1>>",
+		},
+	}
+
+	runEvaluatorTests(t, tests)
+
+}
+
+func TestMapBuiltins(t *testing.T) {
+	tests := []evaluatorTest{
+		{`let m = {"b": 1, "a": 2}; "${keys(m)}"`, "[b, a]"},
+		{`"${values({"b": 1, "a": 2})}"`, "[1, 2]"},
+		{`"${entries({"b": 1, 2: true})}"`, "[[b, 1], [2, true]]"},
+		{`keys({1: "x", true: "y"})[0] + 1`, 2},
+		{`has({"a": 1}, "a")`, true},
+		{`has({1: 1}, "1")`, false},
+		{`let m = {"a": 1}; let n = set(m, "b", 2); "${keys(m)} ${keys(n)}"`, "[a] [a, b]"},
+		{`let m = set({"a": 1, "b": 2}, "a", 3); "${entries(m)}"`, "[[a, 3], [b, 2]]"},
+		{`"${keys(delete({"a": 1, "b": 2, "c": 3}, "b"))}"`, "[a, c]"},
+		{`delete({"a": 1}, "x")["a"]`, 1},
+		{`isEmpty(delete({"a": 1}, "a"))`, true},
+		{`"${entries(merge({"a": 1, "b": 2}, {"c": 3, "a": 4}))}"`, "[[a, 4], [b, 2], [c, 3]]"},
+	}
+
+	runEvaluatorTests(t, tests)
+}
+
+func TestConstStatement(t *testing.T) {
+	tests := []evaluatorTest{
+		{`const x = 10; x`, 10},
+		{`const x = "a"; const y = x + "b"; y`, "ab"},
+		{`const x = 1; let f = fn() { let x = 2; x }; f() + x`, 3},
+		{`const x = 1; match (2) { x => x }`, 2},
+	}
+
+	runEvaluatorTests(t, tests)
+}
+
+func TestDestructuringLetStatement(t *testing.T) {
+	tests := []evaluatorTest{
+		{`let [a, b] = [1, 2]; a + b`, 3},
+		{`let [a, b, ...rest] = [1, 2, 3, 4]; len(rest)`, 2},
+		{`let [_, [x, y]] = [0, [1, 2]]; x * y`, 2},
+		{`let {name, age} = {"name": "someone", "age": 42}; name`, "someone"},
+		{`let f = fn(pair) { let [a, b] = pair; a - b }; f([5, 2])`, 3},
+	}
+
+	runEvaluatorTests(t, tests)
+}
+
+func TestDefaultRestAndSpread(t *testing.T) {
+	tests := []evaluatorTest{
+		{`let f = fn(a, b = 10) { a + b }; f(1)`, 11},
+		{`let f = fn(a, b = a * 2, c = a + b) { c }; f(1)`, 3},
+		{`let f = fn(a, b = a * 2, c = a + b) { c }; f(1, 5)`, 6},
+		{`let f = fn(a, ...rest) { len(rest) }; f(1, 2, 3)`, 2},
+		{`let f = fn(...rest) { len(rest) }; f()`, 0},
+		{`let add = fn(a, b, c) { a + b + c }; add(1, ...[2, 3])`, 6},
+		{`len(...[[1, 2]])`, 2},
+	}
+
+	runEvaluatorTests(t, tests)
+}
+
+func TestPipesAndLambdas(t *testing.T) {
+	tests := []evaluatorTest{
+		{`[1, 2, 3] |> len`, 3},
+		{`let sub = fn(a, b) { a - b }; 10 |> sub(3)`, 7},
+		{`let double = x => x * 2; 1 |> double |> double`, 4},
+		{`let apply = fn(x, f) { f(x) }; 5 |> apply(x => x + 1)`, 6},
+		{`let f = fn(...rest) { len(rest) }; 1 |> f(...[2, 3])`, 3},
+	}
+
+	runEvaluatorTests(t, tests)
+}
+
+func TestDeclaredOperators(t *testing.T) {
+	tests := []evaluatorTest{
+		{`infixl 6 <+> = fn(a, b) { a * 10 + b }; 1 <+> 2 <+> 3`, 123},
+		{`infixr 6 <+> = fn(a, b) { a * 10 + b }; 1 <+> 2 <+> 3`, 33},
+		{`infixl 7 ** = fn(a, b) { if (b == 0) { 1 } else { a * (a ** (b - 1)) } }; 1 + 2 ** 3`, 9},
+		{`infixl 5 <> = fn(a, b) { a + b }; "a" <> "b" <> "c"`, "abc"},
+	}
+
+	runEvaluatorTests(t, tests)
+}
+
+func TestPropertyExpression(t *testing.T) {
+	tests := []evaluatorTest{
+		{`let person = {"name": "someone", "age": 42}; person.age`, 42},
+		{`let a = {"b": {"c": "d"}}; a.b.c`, "d"},
+		{`let person = {"greet": fn(x) { "hello " + x }}; person.greet("you")`, "hello you"},
+	}
+
+	runEvaluatorTests(t, tests)
+}
+
+func TestOptionalChainingAndCoalescing(t *testing.T) {
+	tests := []evaluatorTest{
+		{`null`, NULL},
+		{`null == null`, true},
+		{`1 == null`, false},
+		{`null != "a"`, true},
+		{`let a = null; a?.b.c.d`, NULL},
+		{`let a = null; a?.[0]`, NULL},
+		{`let a = null; a?.f(1)`, NULL},
+		{`let a = {"b": {"c": 1}}; a?.b.c`, 1},
+		{`let a = {"b": 1}; a?.c`, NULL},
+		{`let xs = [1, 2]; xs?.[1]`, 2},
+		{`null ?? 1`, 1},
+		{`false ?? 1`, false},
+		{`null ?? null ?? 3`, 3},
+		{`let a = {"b": 1}; a?.c ?? "default"`, "default"},
+		{`1 ?? undefinedName`, 1},
 	}
 
 	runEvaluatorTests(t, tests)
+}
+
+func TestMatchExpression(t *testing.T) {
+	tests := []evaluatorTest{
+		{`match (2) { 1 => "one", 2 => "two", _ => "many" }`, "two"},
+		{`match (-1) { -1 => true, _ => false }`, true},
+		{`match ("1") { 1 => "int", "1" => "string" }`, "string"},
+		{`match (3) { n if n > 5 => 0, n => n * 2 }`, 6},
+		{`match ([1, 2, 3]) { [] => 0, [a] => a, [a, b, ...rest] => a + b + len(rest) }`, 4},
+		{`match ([1, [2]]) { [_, [b]] => b }`, 2},
+		{`match ({"name": "x", "age": 3}) { {"age": 4} => 0, {name, "age": age} => age }`, 3},
+		{`match (1) { {} => 0, [] => 1, _ => 2 }`, 2},
+		{`match (null) { 0 => "zero", null => "null", _ => "other" }`, "null"},
+		{`match ({}["a"]) { null => 1, _ => 2 }`, 1},
+		{`match (0) { null => 1, _ => 2 }`, 2},
+		{`let x = 1; match (2) { x => x }; x`, 1},
+	}
 
+	runEvaluatorTests(t, tests)
 }
 
 func runEvaluatorTests(t *testing.T, tests []evaluatorTest) {
@@ -246,6 +388,10 @@ func runEvaluatorTests(t *testing.T, tests []evaluatorTest) {
 			if intResult.Value != int64(expected) {
 				t.Fatalf("Expected %d. Got %d", tt.expected, intResult.Value)
 			}
+		case *object.Null:
+			if output != NULL {
+				t.Fatalf("Expected NULL. Got %s", output.String())
+			}
 		}
 	}
 }
@@ -300,11 +446,79 @@ func TestErrorHandling(t *testing.T) {
 			`push(1, 2, 3)`,
 			"wrong number of arguments: expected 2. Got 3",
 		},
+		{
+			`keys([1])`,
+			"type missmatch: first argument of keys must be MAP. Got ARRAY",
+		},
+		{
+			`has({}, [1])`,
+			"type missmatch: cannot use ARRAY as key for hashmap",
+		},
+		{
+			`merge({}, 1)`,
+			"type missmatch: second argument of merge must be MAP. Got INT",
+		},
+		{
+			`set({}, 1)`,
+			"wrong number of arguments: expected 3. Got 2",
+		},
 		{
 			`let f = fn(a,b,c) { return a + b + c }
 		    f(1,2)`,
 			"wrong number of arguments: expected 3. Got 2",
 		},
+		{
+			`match (3) { 1 => 1, 2 => 2 }`,
+			"non-exhaustive match: no pattern matched 3",
+		},
+		{
+			`fn(a, b = 1) { a }()`,
+			"wrong number of arguments: expected at least 1. Got 0",
+		},
+		{
+			`fn(a, b = 1) { a }(1, 2, 3)`,
+			"wrong number of arguments: expected at most 2. Got 3",
+		},
+		{
+			`let person = {"name": "someone"}; person.age`,
+			`map has no key "age"`,
+		},
+		{
+			`let a = {"b": null}; a?.b.c`,
+			"type missmatch: cannot access property c of NULL",
+		},
+		{
+			`null - 1`,
+			"Operation not supported NULL - INT",
+		},
+		{
+			`"a${1 + true}"`,
+			"Operation not supported INT + BOOLEAN",
+		},
+		{
+			`const x = 1; let x = 2;`,
+			"cannot assign to constant x",
+		},
+		{
+			`const x = 1; const x = 2;`,
+			"cannot assign to constant x",
+		},
+		{
+			`const x = 1; let [a, ...x] = [1, 2];`,
+			"cannot assign to constant x",
+		},
+		{
+			`let x = 1; x.y`,
+			"type missmatch: cannot access property y of INT",
+		},
+		{
+			`fn(a) { a }(...1)`,
+			"type missmatch: cannot spread INT",
+		},
+		{
+			`let [a, b] = 1`,
+			"cannot destructure 1: value does not fit the pattern",
+		},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,108 @@
+package evaluator
+
+import (
+	"compiler/ast"
+	"compiler/object"
+	"fmt"
+)
+
+// DefineMacros moves the top-level macro definitions of the program, like
+// let unless = macro(condition, body) { ... };, into env.
+func DefineMacros(program *ast.Program, env *Environment) {
+	statements := make([]ast.Statement, 0, len(program.Statements))
+
+	for _, stmt := range program.Statements {
+		let, ok := stmt.(*ast.LetStatement)
+		if !ok {
+			statements = append(statements, stmt)
+			continue
+		}
+
+		macro, ok := let.Value.(*ast.MacroLiteral)
+		if !ok {
+			statements = append(statements, stmt)
+			continue
+		}
+
+		env.put(let.Name.Value, &object.Macro{Parameters: macro.Parameters, Body: macro.Body})
+	}
+
+	program.Statements = statements
+}
+
+// ExpandMacros replaces every call of a macro defined in env by the quoted
+// expression the macro returns. It runs after parsing and before the
+// program is evaluated or compiled.
+func ExpandMacros(program *ast.Program, env *Environment) (*ast.Program, error) {
+	expanded, err := expandMacros(program, env, new(int))
+	return expanded.(*ast.Program), err
+}
+
+func expandMacros(node ast.Node, env *Environment, renameCount *int) (ast.Node, error) {
+	var err error
+	expanded := ast.Rewrite(node, func(node ast.Node) ast.Node {
+		call, ok := node.(*ast.CallExpression)
+		if !ok || err != nil {
+			return node
+		}
+
+		ident, ok := call.Left.(*ast.Identifier)
+		if !ok {
+			return node
+		}
+
+		macro, ok := env.get(ident.Value).(*object.Macro)
+		if !ok {
+			return node
+		}
+
+		var expr ast.Expression
+		expr, err = expandMacro(ident.Value, macro, call.Arguments, env, renameCount)
+		if err != nil {
+			return node
+		}
+		return expr
+	})
+
+	return expanded, err
+}
+
+func expandMacro(name string, macro *object.Macro, args []ast.Expression, env *Environment, renameCount *int) (ast.Expression, error) {
+	if len(args) != len(macro.Parameters) {
+		return nil, fmt.Errorf("wrong number of arguments to macro %s: expected %d. Got %d", name, len(macro.Parameters), len(args))
+	}
+
+	macroEnv := FromEnvironment(env)
+	macroEnv.renameCount = renameCount
+	for i, param := range macro.Parameters {
+		macroEnv.put(param.Value, &object.Quote{Node: args[i]})
+	}
+
+	result := evaluateBlockStatement(macro.Body, macroEnv)
+	if returnValue, ok := result.(*object.Return); ok {
+		result = returnValue.ReturnValue
+	}
+	if result == nil {
+		result = NULL
+	}
+	if isError(result) {
+		return nil, fmt.Errorf("macro %s: %s", name, result.String())
+	}
+
+	quoted, ok := result.(*object.Quote)
+	if !ok {
+		return nil, fmt.Errorf("macro %s must return a quoted expression. Got %s", name, result.Type())
+	}
+
+	expr, ok := quoted.Node.(ast.Expression)
+	if !ok {
+		return nil, fmt.Errorf("macro %s must return a quoted expression. Got %T", name, quoted.Node)
+	}
+
+	// the expansion may call further macros
+	expanded, err := expandMacros(expr, env, renameCount)
+	if err != nil {
+		return nil, err
+	}
+	return expanded.(ast.Expression), nil
+}
@@ -0,0 +1,244 @@
+package evaluator
+
+import (
+	"compiler/ast"
+	"compiler/object"
+	"compiler/parser"
+	"compiler/scanner"
+	"testing"
+)
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`quote(5)`, `5`},
+		{`quote(5 + 8)`, `(5 + 8)`},
+		{`quote(foobar)`, `foobar`},
+		{`quote(foobar + barfoo)`, `(foobar + barfoo)`},
+		{`quote(unquote(4))`, `4`},
+		{`quote(8 + unquote(4 + 4))`, `(8 + 8)`},
+		{`quote(unquote(true == false))`, `false`},
+		{`quote(unquote("a"))`, `a`},
+		{`quote(unquote(null))`, `null`},
+		{`let q = quote(4 + 4); quote(unquote(4 + 4) + unquote(q))`, `(8 + (4 + 4))`},
+	}
+
+	for _, tt := range tests {
+		evaluated := New().Evaluate(parseProgram(t, tt.input))
+
+		quote, ok := evaluated.(*object.Quote)
+		if !ok {
+			t.Fatalf("Expected *object.Quote. Got %T (%+v)", evaluated, evaluated)
+		}
+
+		if quote.Node.String() != tt.expected {
+			t.Errorf("Expected '%s'. Got '%s'", tt.expected, quote.Node.String())
+		}
+	}
+}
+
+func TestDefineMacros(t *testing.T) {
+	input := `
+	let number = 1;
+	let function = fn(x, y) { x + y };
+	let mymacro = macro(x, y) { x + y; };
+	`
+
+	env := NewEnvironment()
+	program := parseProgram(t, input)
+
+	DefineMacros(program, env)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("Expected 2 statements. Got %d", len(program.Statements))
+	}
+
+	if env.get("number") != nil || env.get("function") != nil {
+		t.Fatalf("Expected only macros to be defined")
+	}
+
+	macro, ok := env.get("mymacro").(*object.Macro)
+	if !ok {
+		t.Fatalf("Expected *object.Macro. Got %T", env.get("mymacro"))
+	}
+
+	if len(macro.Parameters) != 2 || macro.Parameters[0].Value != "x" || macro.Parameters[1].Value != "y" {
+		t.Fatalf("Expected parameters x, y. Got %v", macro.Parameters)
+	}
+
+	if macro.Body.String() != "{(x + y)}" {
+		t.Fatalf("Expected body '{(x + y)}'. Got '%s'", macro.Body.String())
+	}
+}
+
+func TestExpandMacros(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`let infixExpression = macro() { quote(1 + 2); }; infixExpression();`,
+			`(1 + 2)`,
+		},
+		{
+			`let reverse = macro(a, b) { quote(unquote(b) - unquote(a)); }; reverse(2 + 2, 10 - 5);`,
+			`(10 - 5) - (2 + 2)`,
+		},
+		{
+			`
+			let unless = macro(condition, consequence, alternative) {
+				quote(if (!(unquote(condition))) {
+					unquote(consequence);
+				} else {
+					unquote(alternative);
+				});
+			};
+			unless(10 > 5, puts("not greater"), puts("greater"));
+			`,
+			`if (!(10 > 5)) { puts("not greater") } else { puts("greater") }`,
+		},
+		{
+			`let twice = macro(x) { quote(unquote(x) + unquote(x)) }; let inc = macro(x) { quote(unquote(x) + 1) }; twice(inc(1))`,
+			`((1 + 1)) + ((1 + 1))`,
+		},
+		{
+			`let first = macro(x) { quote(second(unquote(x))) }; let second = macro(x) { quote(unquote(x) * 2) }; first(3)`,
+			`3 * 2`,
+		},
+	}
+
+	for _, tt := range tests {
+		env := NewEnvironment()
+		program := parseProgram(t, tt.input)
+
+		DefineMacros(program, env)
+		expanded, err := ExpandMacros(program, env)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %s", tt.input, err)
+		}
+
+		expected := parseProgram(t, tt.expected)
+		if expanded.String() != expected.String() {
+			t.Errorf("Expected '%s'. Got '%s'", expected.String(), expanded.String())
+		}
+	}
+}
+
+func TestMacroExpansionIsHygienic(t *testing.T) {
+	tests := []evaluatorTest{
+		{
+			`
+			let x = 10;
+			let double = macro(a) { quote(if (true) { let x = unquote(a); x * 2 } else { 0 }) };
+			double(x + 1) + x
+			`,
+			32,
+		},
+		{
+			`
+			let x = 1;
+			let adder = macro(a) { quote(fn(x) { x + unquote(a) }) };
+			adder(x)(10)
+			`,
+			11,
+		},
+		{
+			`
+			let twice = macro(a) { quote(if (true) { let tmp = unquote(a); tmp + tmp } else { 0 }) };
+			twice(twice(2))
+			`,
+			8,
+		},
+		{
+			`
+			let mk = macro(v) { quote(fn(x) { {"x": x}.x + unquote(v) }) };
+			let x = 5;
+			mk(x)(1)
+			`,
+			6,
+		},
+		{
+			`
+			let x = 10;
+			let m = macro() { quote(if (true) { let y = x; let x = 1; x + y } else { 0 }) };
+			m()
+			`,
+			11,
+		},
+		{
+			`
+			let x = 3;
+			let m = macro() { quote(fn(x) { x }(1) + x) };
+			m()
+			`,
+			4,
+		},
+	}
+
+	for _, tt := range tests {
+		env := NewEnvironment()
+		program := parseProgram(t, tt.input)
+
+		DefineMacros(program, env)
+		expanded, err := ExpandMacros(program, env)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %s", tt.input, err)
+		}
+
+		evaluated := New().Evaluate(expanded)
+		integer, ok := evaluated.(*object.Integer)
+		if !ok {
+			t.Fatalf("Expected IntegerObject. Got %T (%+v)", evaluated, evaluated)
+		}
+
+		if integer.Value != int64(tt.expected.(int)) {
+			t.Errorf("Expected %d. Got %d", tt.expected, integer.Value)
+		}
+	}
+}
+
+func TestMacroExpansionErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		error string
+	}{
+		{
+			`let m = macro(a, b) { quote(1) }; m(1)`,
+			"wrong number of arguments to macro m: expected 2. Got 1",
+		},
+		{
+			`let m = macro(a) { 1 }; m(1)`,
+			"macro m must return a quoted expression. Got INT",
+		},
+		{
+			`let m = macro(a) { quote(unquote(fn() {})) }; m(1)`,
+			"macro m: cannot unquote FUNCTION",
+		},
+		{
+			`let m = macro(a) { quote(unquote(b)) }; m(1)`,
+			"macro m: undefined: b",
+		},
+	}
+
+	for _, tt := range tests {
+		env := NewEnvironment()
+		program := parseProgram(t, tt.input)
+
+		DefineMacros(program, env)
+		_, err := ExpandMacros(program, env)
+		if err == nil || err.Error() != tt.error {
+			t.Errorf("Expected error '%s'. Got %v", tt.error, err)
+		}
+	}
+}
+
+func parseProgram(t *testing.T, input string) *ast.Program {
+	p := parser.New(scanner.NewHandcodedScanner(input))
+
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	return program
+}
@@ -0,0 +1,227 @@
+package evaluator
+
+import (
+	"compiler/ast"
+	"compiler/object"
+	"compiler/token"
+	"fmt"
+	"strconv"
+)
+
+// quote turns node into an AST value. Every unquote(x) call inside it is
+// replaced by the syntax of the value x evaluates to. Names bound inside
+// node are renamed, so the quoted code can neither capture nor clobber
+// names of the code spliced into it by unquote.
+func quote(node ast.Node, env *Environment) object.Object {
+	node = ast.Clone(node)
+
+	spliced := make(map[ast.Node]bool)
+	var errObj object.Object
+	node = ast.Rewrite(node, func(node ast.Node) ast.Node {
+		call, ok := node.(*ast.CallExpression)
+		if !ok || !isCallTo(call, "unquote") || errObj != nil {
+			return node
+		}
+
+		if len(call.Arguments) != 1 {
+			errObj = object.NewError("wrong number of arguments to unquote: expected 1. Got %d", len(call.Arguments))
+			return node
+		}
+
+		value := evaluate(call.Arguments[0], env)
+		if isError(value) {
+			errObj = value
+			return node
+		}
+
+		expr, err := objectToExpression(value)
+		if err != nil {
+			errObj = err
+			return node
+		}
+
+		spliced[expr] = true
+		return expr
+	})
+	if errObj != nil {
+		return errObj
+	}
+
+	renameBindings(node, spliced, env.renames())
+	return &object.Quote{Node: node}
+}
+
+func isCallTo(call *ast.CallExpression, name string) bool {
+	ident, ok := call.Left.(*ast.Identifier)
+	return ok && ident.Value == name
+}
+
+// objectToExpression converts the result of an unquote back into syntax.
+func objectToExpression(value object.Object) (ast.Expression, *object.Error) {
+	switch value := value.(type) {
+	case *object.Integer:
+		literal := strconv.FormatInt(value.Value, 10)
+		return &ast.IntegerLiteral{Token: token.Token{Type: token.INT, Literal: literal}, Value: value.Value}, nil
+	case *object.Boolean:
+		tok := token.Token{Type: token.FALSE, Literal: "false"}
+		if value.Value {
+			tok = token.Token{Type: token.TRUE, Literal: "true"}
+		}
+		return &ast.BooleanLiteral{Token: tok, Value: value.Value}, nil
+	case *object.String:
+		return &ast.StringLiteral{Token: token.Token{Type: token.STRING, Literal: value.Value}, Value: value.Value}, nil
+	case *object.Null:
+		return &ast.NullLiteral{Token: token.Token{Type: token.NULL, Literal: "null"}}, nil
+	case *object.Quote:
+		expr, ok := ast.Clone(value.Node).(ast.Expression)
+		if !ok {
+			return nil, object.NewError("cannot unquote %T", value.Node)
+		}
+		return expr, nil
+	default:
+		return nil, object.NewError("cannot unquote %s", value.Type())
+	}
+}
+
+// renameBindings gives every name bound by a let, const, function parameter
+// or pattern in node a fresh name and renames the references resolving to
+// it. Code spliced in by unquote is left alone. count numbers the fresh
+// names.
+func renameBindings(node ast.Node, spliced map[ast.Node]bool, count *int) {
+	r := &renamer{spliced: spliced, count: count}
+	r.openScope()
+	ast.Walk(r, node)
+}
+
+// renamer renames the bindings of quoted code in place. Like in the
+// compiler, functions and match arms open a scope, blocks do not.
+type renamer struct {
+	spliced map[ast.Node]bool
+	count   *int
+	scope   *renameScope
+}
+
+type renameScope struct {
+	names map[string]string
+	outer *renameScope
+}
+
+func (r *renamer) openScope() {
+	r.scope = &renameScope{names: make(map[string]string), outer: r.scope}
+}
+
+func (r *renamer) closeScope() {
+	r.scope = r.scope.outer
+}
+
+// bind renames ident to a fresh name visible in the current scope.
+func (r *renamer) bind(ident *ast.Identifier) {
+	if ident == nil || ident.Value == "_" {
+		return
+	}
+
+	*r.count++
+	name := fmt.Sprintf("%s$%d", ident.Value, *r.count)
+	r.scope.names[ident.Value] = name
+	ident.Value = name
+}
+
+// lookup returns the fresh name of a bound name, or name itself if it is
+// not bound inside the quoted code.
+func (r *renamer) lookup(name string) string {
+	for scope := r.scope; scope != nil; scope = scope.outer {
+		if renamed, ok := scope.names[name]; ok {
+			return renamed
+		}
+	}
+	return name
+}
+
+func (r *renamer) Visit(node ast.Node) ast.Visitor {
+	if node == nil || r.spliced[node] {
+		return nil
+	}
+
+	switch node := node.(type) {
+	case *ast.Identifier:
+		node.Value = r.lookup(node.Value)
+	case *ast.LetStatement:
+		r.bind(node.Name)
+		ast.Walk(r, node.Value)
+		return nil
+	case *ast.ConstStatement:
+		r.bind(node.Name)
+		ast.Walk(r, node.Value)
+		return nil
+	case *ast.DestructuringLetStatement:
+		ast.Walk(r, node.Value)
+		r.pattern(node.Pattern)
+		return nil
+	case *ast.FunctionLiteral:
+		if node.Name != "" {
+			node.Name = r.lookup(node.Name)
+		}
+		r.openScope()
+		// default values only see the parameters in front of them
+		for i, param := range node.Parameters {
+			if def := node.Default(i); def != nil {
+				ast.Walk(r, def)
+			}
+			r.bind(param)
+		}
+		r.bind(node.Rest)
+		ast.Walk(r, node.Body)
+		r.closeScope()
+		return nil
+	case *ast.LambdaLiteral:
+		if node.Name != "" {
+			node.Name = r.lookup(node.Name)
+		}
+		r.openScope()
+		r.bind(node.Parameter)
+		ast.Walk(r, node.Body)
+		r.closeScope()
+		return nil
+	case *ast.MacroLiteral:
+		r.openScope()
+		for _, param := range node.Parameters {
+			r.bind(param)
+		}
+		ast.Walk(r, node.Body)
+		r.closeScope()
+		return nil
+	case *ast.MatchArm:
+		r.openScope()
+		r.pattern(node.Pattern)
+		if node.Guard != nil {
+			ast.Walk(r, node.Guard)
+		}
+		ast.Walk(r, node.Body)
+		r.closeScope()
+		return nil
+	case *ast.PropertyExpression:
+		// the property is a key, not a reference
+		ast.Walk(r, node.Left)
+		return nil
+	}
+	return r
+}
+
+func (r *renamer) pattern(pattern ast.Pattern) {
+	switch pattern := pattern.(type) {
+	case *ast.BindingPattern:
+		r.bind(pattern.Name)
+	case *ast.LiteralPattern:
+		ast.Walk(r, pattern.Value)
+	case *ast.ArrayPattern:
+		for _, e := range pattern.Elements {
+			r.pattern(e)
+		}
+		r.bind(pattern.Rest)
+	case *ast.MapPattern:
+		for _, entry := range pattern.Entries {
+			ast.Walk(r, entry.Key)
+			r.pattern(entry.Value)
+		}
+	}
+}
@@ -0,0 +1,605 @@
+package format
+
+import (
+	"compiler/ast"
+	"compiler/parser"
+	"compiler/scanner"
+	"compiler/token"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const MaxLineWidth = 80
+const TabWidth = 4
+
+var precedences = map[token.TokenType]int{
+	token.COALESCE:      parser.COALESCE,
+	token.EQUALS:        parser.EQUALS,
+	token.NOT_EQUALS:    parser.EQUALS,
+	token.GREATER_EQUAL: parser.EQUALS,
+	token.LESS_EQUAL:    parser.EQUALS,
+	token.AND:           parser.AND,
+	token.OR:            parser.AND,
+	token.GT:            parser.LESSGREATER,
+	token.LT:            parser.LESSGREATER,
+	token.PLUS:          parser.SUM,
+	token.MINUS:         parser.SUM,
+	token.ASTERIK:       parser.PRODUCT,
+	token.SLASH:         parser.PRODUCT,
+}
+
+type printer struct {
+	comments    []*ast.Comment
+	nextComment int
+
+	// operators holds the infix declarations of the program by operator
+	operators map[token.TokenType]*ast.InfixDeclaration
+}
+
+// Source parses the input and returns it in canonical style.
+func Source(input string) (string, error) {
+	p := parser.New(scanner.NewHandcodedScanner(input))
+
+	program := p.ParseProgram()
+	if len(p.Errors) != 0 {
+		return "", errors.New(strings.Join(p.Errors, "\n"))
+	}
+
+	return Program(program), nil
+}
+
+// Program pretty-prints a parsed program including its comments. The
+// output ends with a newline unless the program is empty.
+func Program(program *ast.Program) string {
+	p := &printer{comments: program.Comments, operators: make(map[token.TokenType]*ast.InfixDeclaration)}
+	ast.Inspect(program, func(node ast.Node) bool {
+		if decl, ok := node.(*ast.InfixDeclaration); ok {
+			p.operators[decl.Operator.Type] = decl
+		}
+		return true
+	})
+
+	out := p.statements(program.Statements, 0, math.MaxInt)
+	if out == "" {
+		return ""
+	}
+	return out + "\n"
+}
+
+// statements renders every statement on its own line. Comments located
+// before end are emitted in between.
+func (p *printer) statements(statements []ast.Statement, indent int, end int) string {
+	lines := make([]string, 0)
+	lastLine := 0
+
+	// an if expression only needs a terminating semicolon when the next
+	// statement could otherwise be parsed as its continuation
+	pendingIf, pendingIfEnd := -1, 0
+
+	for _, stmt := range statements {
+		position := startOf(stmt)
+
+		lines = p.flushComments(lines, position.Offset, indent, &lastLine)
+		if lastLine > 0 && position.Line > lastLine+1 {
+			lines = append(lines, "")
+		}
+
+		text := p.statement(stmt, indent)
+		if pendingIf != -1 && strings.IndexAny(text, "([-") == 0 {
+			line := lines[pendingIf]
+			lines[pendingIf] = line[:pendingIfEnd] + ";" + line[pendingIfEnd:]
+		}
+
+		pendingIf = -1
+		if isIfStatement(stmt) {
+			pendingIf = len(lines)
+			pendingIfEnd = len(tabs(indent)) + len(text)
+		}
+
+		lines = append(lines, tabs(indent)+text)
+		lastLine = endLine(stmt)
+	}
+	lines = p.flushComments(lines, end, indent, &lastLine)
+
+	return strings.Join(lines, "\n")
+}
+
+func (p *printer) flushComments(lines []string, before int, indent int, lastLine *int) []string {
+	for p.nextComment < len(p.comments) {
+		comment := p.comments[p.nextComment]
+		position := comment.Token.Position
+		if position.Offset >= before {
+			break
+		}
+		p.nextComment++
+
+		text := strings.TrimRight(comment.Token.Literal, " \t\r")
+		if comment.Trailing && len(lines) > 0 {
+			lines[len(lines)-1] += " " + text
+			continue
+		}
+
+		if *lastLine > 0 && position.Line > *lastLine+1 {
+			lines = append(lines, "")
+		}
+		lines = append(lines, tabs(indent)+text)
+		*lastLine = position.Line
+	}
+
+	return lines
+}
+
+func (p *printer) statement(stmt ast.Statement, indent int) string {
+	col := indent * TabWidth
+
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		prefix := "let " + stmt.Name.Value + annotation(stmt.Type) + " = "
+		return prefix + p.expression(stmt.Value, indent, col+len(prefix)) + ";"
+	case *ast.ConstStatement:
+		prefix := "const " + stmt.Name.Value + annotation(stmt.Type) + " = "
+		return prefix + p.expression(stmt.Value, indent, col+len(prefix)) + ";"
+	case *ast.InfixDeclaration:
+		prefix := fmt.Sprintf("%s %d %s = ", stmt.Token.Literal, stmt.Precedence, stmt.Operator.Literal)
+		return prefix + p.expression(stmt.Value, indent, col+len(prefix)) + ";"
+	case *ast.DestructuringLetStatement:
+		prefix := "let " + p.pattern(stmt.Pattern) + " = "
+		return prefix + p.expression(stmt.Value, indent, col+len(prefix)) + ";"
+	case *ast.ReturnStatement:
+		if stmt.ReturnValue == nil {
+			return "return;"
+		}
+		return "return " + p.expression(stmt.ReturnValue, indent, col+len("return ")) + ";"
+	case *ast.ExpressionStatement:
+		text := p.expression(stmt.Expression, indent, col)
+		if isIfStatement(stmt) {
+			return text
+		}
+		return text + ";"
+	case *ast.BlockStatement:
+		return p.block(stmt, indent)
+	default:
+		return stmt.String()
+	}
+}
+
+func (p *printer) expression(expr ast.Expression, indent int, col int) string {
+	switch expr := expr.(type) {
+	case *ast.Identifier:
+		return expr.Value
+	case *ast.IntegerLiteral:
+		return strconv.FormatInt(expr.Value, 10)
+	case *ast.BooleanLiteral:
+		return strconv.FormatBool(expr.Value)
+	case *ast.StringLiteral:
+		return `"` + escape(expr.Value) + `"`
+	case *ast.InterpolatedString:
+		out := `"`
+		for i, text := range expr.Texts {
+			out += escape(text.Value)
+			if i < len(expr.Expressions) {
+				out += "${" + p.expression(expr.Expressions[i], indent, 0) + "}"
+			}
+		}
+		return out + `"`
+	case *ast.NullLiteral:
+		return "null"
+	case *ast.PrefixExpression:
+		operator := string(expr.Operator)
+		return operator + p.operand(expr.Right, parser.PREFIX, indent, col+len(operator))
+	case *ast.InfixExpression:
+		leftPrecedence, rightPrecedence := p.precedenceOf(expr), p.precedenceOf(expr)+1
+		if decl, ok := p.operators[expr.Operator]; ok && decl.RightAssociative() {
+			leftPrecedence, rightPrecedence = rightPrecedence, leftPrecedence
+		}
+
+		left := p.operand(expr.Left, leftPrecedence, indent, col)
+		operator := " " + string(expr.Operator) + " "
+		right := p.operand(expr.Right, rightPrecedence, indent, advance(col, left+operator))
+
+		return left + operator + right
+	case *ast.IfExpression:
+		prefix := "if ("
+		condition := p.expression(expr.Condition, indent, col+len(prefix))
+		out := prefix + condition + ") " + p.block(expr.Consequence, indent)
+		if expr.Alternative != nil {
+			out += " else " + p.block(expr.Alternative, indent)
+		}
+		return out
+	case *ast.FunctionLiteral:
+		params := make([]string, 0, len(expr.Parameters)+1)
+		for i, param := range expr.Parameters {
+			text := param.Value + annotation(expr.ParameterType(i))
+			if def := expr.Default(i); def != nil {
+				text += " = " + p.expression(def, indent, 0)
+			}
+			params = append(params, text)
+		}
+		if expr.Rest != nil {
+			params = append(params, "..."+expr.Rest.Value+annotation(expr.RestType))
+		}
+		return "fn(" + strings.Join(params, ", ") + ")" + annotation(expr.ReturnType) + " " + p.block(expr.Body, indent)
+	case *ast.MacroLiteral:
+		params := make([]string, len(expr.Parameters))
+		for i, param := range expr.Parameters {
+			params[i] = param.Value
+		}
+		return "macro(" + strings.Join(params, ", ") + ") " + p.block(expr.Body, indent)
+	case *ast.LambdaLiteral:
+		prefix := expr.Parameter.Value + " => "
+		return prefix + p.expression(expr.Body, indent, col+len(prefix))
+	case *ast.PipeExpression:
+		left := p.operand(expr.Left, parser.PIPE, indent, col)
+		right := p.operand(expr.Right, parser.PIPE+1, indent, advance(col, left+" |> "))
+		return left + " |> " + right
+	case *ast.SpreadExpression:
+		return "..." + p.expression(expr.Value, indent, col+len("..."))
+	case *ast.CallExpression:
+		left := p.postfixOperand(expr.Left, indent, col)
+		return left + p.list("(", expr.Arguments, ")", expr.Rparen.Position, indent, advance(col, left))
+	case *ast.IndexExpression:
+		left := p.postfixOperand(expr.Left, indent, col)
+		if expr.Optional {
+			left += "?."
+		}
+		return left + "[" + p.expression(expr.Index, indent, advance(col, left+"[")) + "]"
+	case *ast.PropertyExpression:
+		if expr.Optional {
+			return p.postfixOperand(expr.Left, indent, col) + "?." + expr.Property.Value
+		}
+		return p.postfixOperand(expr.Left, indent, col) + "." + expr.Property.Value
+	case *ast.ArrayLiteral:
+		return p.list("[", expr.Elements, "]", expr.Rbracket.Position, indent, col)
+	case *ast.MapLiteral:
+		return p.mapLiteral(expr, indent, col)
+	case *ast.MatchExpression:
+		return p.match(expr, indent, col)
+	default:
+		return expr.String()
+	}
+}
+
+// match puts every arm on its own line, each followed by a comma.
+func (p *printer) match(match *ast.MatchExpression, indent int, col int) string {
+	prefix := "match ("
+	out := prefix + p.expression(match.Subject, indent, col+len(prefix)) + ") {"
+	if len(match.Arms) == 0 {
+		return out + "}"
+	}
+
+	for _, arm := range match.Arms {
+		armCol := (indent + 1) * TabWidth
+
+		text := p.pattern(arm.Pattern)
+		if arm.Guard != nil {
+			text += " if " + p.expression(arm.Guard, indent+1, advance(armCol, text+" if "))
+		}
+		text += " => "
+		text += p.expression(arm.Body, indent+1, advance(armCol, text))
+
+		out += "\n" + tabs(indent+1) + text + ","
+	}
+
+	return out + "\n" + tabs(indent) + "}"
+}
+
+func (p *printer) pattern(pattern ast.Pattern) string {
+	switch pattern := pattern.(type) {
+	case *ast.LiteralPattern:
+		return p.expression(pattern.Value, 0, 0)
+	case *ast.ArrayPattern:
+		items := make([]string, 0, len(pattern.Elements)+1)
+		for _, e := range pattern.Elements {
+			items = append(items, p.pattern(e))
+		}
+		if pattern.Rest != nil {
+			items = append(items, "..."+pattern.Rest.Value)
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case *ast.MapPattern:
+		items := make([]string, len(pattern.Entries))
+		for i, entry := range pattern.Entries {
+			key, isString := entry.Key.(*ast.StringLiteral)
+			binding, isBinding := entry.Value.(*ast.BindingPattern)
+			if isString && isBinding && key.Value == binding.Name.Value {
+				items[i] = binding.Name.Value
+				continue
+			}
+			items[i] = p.expression(entry.Key, 0, 0) + ": " + p.pattern(entry.Value)
+		}
+		return "{" + strings.Join(items, ", ") + "}"
+	default:
+		return pattern.String()
+	}
+}
+
+// operand renders an operand and wraps it in parentheses if its own
+// precedence is lower than the given one.
+func (p *printer) operand(expr ast.Expression, precedence int, indent int, col int) string {
+	if p.precedenceOf(expr) < precedence {
+		return "(" + p.expression(expr, indent, col+1) + ")"
+	}
+	return p.expression(expr, indent, col)
+}
+
+func (p *printer) postfixOperand(expr ast.Expression, indent int, col int) string {
+	switch expr.(type) {
+	case *ast.InfixExpression, *ast.PrefixExpression, *ast.PipeExpression, *ast.LambdaLiteral:
+		return "(" + p.expression(expr, indent, col+1) + ")"
+	default:
+		return p.expression(expr, indent, col)
+	}
+}
+
+// list lays out the elements of a list ending at the position of close.
+func (p *printer) list(open string, elements []ast.Expression, close string, end token.Position, indent int, col int) string {
+	starts := make([]token.Position, len(elements))
+	for i, e := range elements {
+		starts[i] = expressionStart(e)
+	}
+
+	return p.commentedLayout(open, starts, func(i int) (string, int) {
+		return p.expression(elements[i], indent+1, (indent+1)*TabWidth), endLine(elements[i])
+	}, close, end, indent, col)
+}
+
+func (p *printer) mapLiteral(mapExpr *ast.MapLiteral, indent int, col int) string {
+	keys := mapExpr.OrderedKeys()
+	starts := make([]token.Position, len(keys))
+	for i, key := range keys {
+		starts[i] = expressionStart(key)
+	}
+
+	return p.commentedLayout("{", starts, func(i int) (string, int) {
+		itemCol := (indent + 1) * TabWidth
+		keyText := p.expression(keys[i], indent+1, itemCol)
+		value := mapExpr.Entries[keys[i]]
+		return keyText + ": " + p.expression(value, indent+1, advance(itemCol, keyText+": ")), endLine(value)
+	}, "}", mapExpr.Rbrace.Position, indent, col)
+}
+
+// commentedLayout renders the items starting at starts with render, which
+// also returns the last line of the item, and lays them out like layout.
+// Comments located between the items are kept in front of the item they
+// precede and comments before end at the end of the list, which forces the
+// list onto multiple lines.
+func (p *printer) commentedLayout(open string, starts []token.Position, render func(i int) (string, int), close string, end token.Position, indent int, col int) string {
+	first := p.nextComment
+	lines := []string{open}
+	lastLine := 0
+
+	items := make([]string, len(starts))
+	for i, start := range starts {
+		lines = p.flushComments(lines, start.Offset, indent+1, &lastLine)
+		items[i], lastLine = render(i)
+		lines = append(lines, tabs(indent+1)+items[i]+",")
+	}
+	lines = p.flushComments(lines, end.Offset, indent+1, &lastLine)
+
+	if p.nextComment == first {
+		return layout(open, items, close, indent, col)
+	}
+	return strings.Join(append(lines, tabs(indent)+close), "\n")
+}
+
+// layout keeps a list on a single line if it fits, otherwise every item
+// gets its own line followed by a comma.
+func layout(open string, items []string, close string, indent int, col int) string {
+	flat := open + strings.Join(items, ", ") + close
+	if !strings.Contains(flat, "\n") && col+len(flat) <= MaxLineWidth {
+		return flat
+	}
+
+	var out strings.Builder
+	out.WriteString(open + "\n")
+	for _, item := range items {
+		out.WriteString(tabs(indent+1) + item + ",\n")
+	}
+	out.WriteString(tabs(indent) + close)
+
+	return out.String()
+}
+
+func (p *printer) block(block *ast.BlockStatement, indent int) string {
+	body := p.statements(block.Statements, indent+1, block.Rbrace.Position.Offset)
+	if body == "" {
+		return "{}"
+	}
+	return "{\n" + body + "\n" + tabs(indent) + "}"
+}
+
+func (p *printer) precedenceOf(expr ast.Expression) int {
+	switch expr := expr.(type) {
+	case *ast.InfixExpression:
+		if precedence, ok := precedences[expr.Operator]; ok {
+			return precedence
+		}
+		if decl, ok := p.operators[expr.Operator]; ok {
+			precedence, _ := parser.DeclaredPrecedence(decl.Precedence)
+			return precedence
+		}
+		return parser.LOWEST
+	case *ast.PrefixExpression:
+		return parser.PREFIX
+	case *ast.PipeExpression:
+		return parser.PIPE
+	case *ast.LambdaLiteral:
+		return parser.LAMBDA
+	default:
+		return math.MaxInt - 1
+	}
+}
+
+// annotation returns the ": type" suffix of an annotated name or nothing.
+func annotation(typ ast.Type) string {
+	if typ == nil {
+		return ""
+	}
+	return ": " + typ.String()
+}
+
+func isIfStatement(stmt ast.Statement) bool {
+	exprStmt, ok := stmt.(*ast.ExpressionStatement)
+	if !ok {
+		return false
+	}
+	_, ok = exprStmt.Expression.(*ast.IfExpression)
+	return ok
+}
+
+func startOf(stmt ast.Statement) token.Position {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		return stmt.Token.Position
+	case *ast.ConstStatement:
+		return stmt.Token.Position
+	case *ast.InfixDeclaration:
+		return stmt.Token.Position
+	case *ast.DestructuringLetStatement:
+		return stmt.Token.Position
+	case *ast.ReturnStatement:
+		return stmt.Token.Position
+	case *ast.ExpressionStatement:
+		return stmt.Token.Position
+	case *ast.BlockStatement:
+		return stmt.Token.Position
+	default:
+		return token.Position{}
+	}
+}
+
+// expressionStart returns the position of the first token of an expression.
+func expressionStart(expr ast.Expression) token.Position {
+	switch expr := expr.(type) {
+	case *ast.InfixExpression:
+		return expressionStart(expr.Left)
+	case *ast.PipeExpression:
+		return expressionStart(expr.Left)
+	case *ast.CallExpression:
+		return expressionStart(expr.Left)
+	case *ast.IndexExpression:
+		return expressionStart(expr.Left)
+	case *ast.PropertyExpression:
+		return expressionStart(expr.Left)
+	case *ast.LambdaLiteral:
+		return expr.Parameter.Token.Position
+	case *ast.PrefixExpression:
+		return expr.Token.Position
+	case *ast.SpreadExpression:
+		return expr.Token.Position
+	case *ast.IfExpression:
+		return expr.Token.Position
+	case *ast.FunctionLiteral:
+		return expr.Token.Position
+	case *ast.MacroLiteral:
+		return expr.Token.Position
+	case *ast.ArrayLiteral:
+		return expr.Token.Position
+	case *ast.MapLiteral:
+		return expr.Token.Position
+	case *ast.MatchExpression:
+		return expr.Token.Position
+	case *ast.Identifier:
+		return expr.Token.Position
+	case *ast.IntegerLiteral:
+		return expr.Token.Position
+	case *ast.BooleanLiteral:
+		return expr.Token.Position
+	case *ast.StringLiteral:
+		return expr.Token.Position
+	case *ast.InterpolatedString:
+		return expr.Token.Position
+	case *ast.NullLiteral:
+		return expr.Token.Position
+	default:
+		return token.Position{}
+	}
+}
+
+// endLine approximates the last source line of a node by the line of its
+// last recorded token.
+func endLine(node ast.Node) int {
+	switch node := node.(type) {
+	case *ast.LetStatement:
+		return endLine(node.Value)
+	case *ast.ConstStatement:
+		return endLine(node.Value)
+	case *ast.InfixDeclaration:
+		return endLine(node.Value)
+	case *ast.DestructuringLetStatement:
+		return endLine(node.Value)
+	case *ast.ReturnStatement:
+		if node.ReturnValue == nil {
+			return node.Token.Position.Line
+		}
+		return endLine(node.ReturnValue)
+	case *ast.ExpressionStatement:
+		return endLine(node.Expression)
+	case *ast.BlockStatement:
+		return node.Rbrace.Position.Line
+	case *ast.PrefixExpression:
+		return endLine(node.Right)
+	case *ast.InfixExpression:
+		return endLine(node.Right)
+	case *ast.IfExpression:
+		if node.Alternative != nil {
+			return endLine(node.Alternative)
+		}
+		return endLine(node.Consequence)
+	case *ast.FunctionLiteral:
+		return endLine(node.Body)
+	case *ast.MacroLiteral:
+		return endLine(node.Body)
+	case *ast.LambdaLiteral:
+		return endLine(node.Body)
+	case *ast.PipeExpression:
+		return endLine(node.Right)
+	case *ast.CallExpression:
+		return node.Rparen.Position.Line
+	case *ast.IndexExpression:
+		return endLine(node.Index)
+	case *ast.PropertyExpression:
+		return node.Property.Token.Position.Line
+	case *ast.ArrayLiteral:
+		return node.Rbracket.Position.Line
+	case *ast.MapLiteral:
+		return node.Rbrace.Position.Line
+	case *ast.MatchExpression:
+		return node.Rbrace.Position.Line
+	case *ast.Identifier:
+		return node.Token.Position.Line
+	case *ast.IntegerLiteral:
+		return node.Token.Position.Line
+	case *ast.BooleanLiteral:
+		return node.Token.Position.Line
+	case *ast.StringLiteral:
+		return node.Token.Position.Line
+	case *ast.InterpolatedString:
+		return node.Texts[len(node.Texts)-1].Token.Position.Line
+	case *ast.NullLiteral:
+		return node.Token.Position.Line
+	default:
+		return 0
+	}
+}
+
+// escape escapes the ${ in the text of a string, which would otherwise
+// start an interpolation.
+func escape(text string) string {
+	return strings.ReplaceAll(text, "${", `\${`)
+}
+
+func advance(col int, text string) int {
+	if i := strings.LastIndex(text, "\n"); i != -1 {
+		line := text[i+1:]
+		return len(line) + strings.Count(line, "\t")*(TabWidth-1)
+	}
+	return col + len(text)
+}
+
+func tabs(indent int) string {
+	return strings.Repeat("\t", indent)
+}
@@ -0,0 +1,178 @@
+package format
+
+import (
+	"compiler/parser"
+	"compiler/scanner"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"let x=5",
+			"let x = 5;\n",
+		},
+		{
+			"1+2*3; (1+2)*3; 1-(2-3); (1-2)-3",
+			"1 + 2 * 3;\n(1 + 2) * 3;\n1 - (2 - 3);\n1 - 2 - 3;\n",
+		},
+		{
+			"-(1+2); !true == false; (-a)(1); f(x)[0]",
+			"-(1 + 2);\n!true == false;\n(-a)(1);\nf(x)[0];\n",
+		},
+		{
+			"let add = fn(a,b){return a+b}",
+			"let add = fn(a, b) {\n\treturn a + b;\n};\n",
+		},
+		{
+			"if (x > 1) { x } else { 0 }",
+			"if (x > 1) {\n\tx;\n} else {\n\t0;\n}\n",
+		},
+		{
+			"if (x) { 1 }; -2",
+			"if (x) {\n\t1;\n};\n-2;\n",
+		},
+		{
+			"if (x) { 1 }; [1, 2]; if (y) {}",
+			"if (x) {\n\t1;\n};\n[1, 2];\nif (y) {}\n",
+		},
+		{
+			`{"a": 1, "b": [1,2]}`,
+			"{\"a\": 1, \"b\": [1, 2]};\n",
+		},
+		{
+			"let x = 1;\n\n\n\nlet y = 2;\nlet z = 3;",
+			"let x = 1;\n\nlet y = 2;\nlet z = 3;\n",
+		},
+		{
+			"// leading\nlet x = 1; // trailing\n\n// own line\nlet f = fn() {\n  // inside\n  x\n  // end of block\n}\n// end of program",
+			"// leading\nlet x = 1; // trailing\n\n// own line\nlet f = fn() {\n\t// inside\n\tx;\n\t// end of block\n};\n// end of program\n",
+		},
+		{
+			"let m = { // pairs\n  // first\n  \"a\": 1, // one\n\n  // second\n  \"b\": 2\n  // last\n};\nm",
+			"let m = { // pairs\n\t// first\n\t\"a\": 1, // one\n\n\t// second\n\t\"b\": 2,\n\t// last\n};\nm;\n",
+		},
+		{
+			"[1, // one\n 2, 3]; f(1, // arg\n 2); g(\n  // first\n  a,\n  ...rest // spread\n)",
+			"[\n\t1, // one\n\t2,\n\t3,\n];\nf(\n\t1, // arg\n\t2,\n);\ng(\n\t// first\n\ta,\n\t...rest, // spread\n);\n",
+		},
+		{
+			`let result = someFunction(firstArgument, secondArgument, thirdArgument, fourthArgument);`,
+			"let result = someFunction(\n\tfirstArgument,\n\tsecondArgument,\n\tthirdArgument,\n\tfourthArgument,\n);\n",
+		},
+		{
+			`map(xs, fn(x) { x * 2 })`,
+			"map(\n\txs,\n\tfn(x) {\n\t\tx * 2;\n\t},\n);\n",
+		},
+		{
+			`let person = {"name": "someone with a long name", "age": 42, "hobbies": ["reading"]}`,
+			"let person = {\n\t\"name\": \"someone with a long name\",\n\t\"age\": 42,\n\t\"hobbies\": [\"reading\"],\n};\n",
+		},
+		{
+			"person . greet(x).name; (-a).b",
+			"person.greet(x).name;\n(-a).b;\n",
+		},
+		{
+			"let m = macro(a,b){quote(unquote(b)-unquote(a))}",
+			"let m = macro(a, b) {\n\tquote(unquote(b) - unquote(a));\n};\n",
+		},
+		{
+			`"a ${ x+1 } b ${f( y )}"`,
+			"\"a ${x + 1} b ${f(y)}\";\n",
+		},
+		{
+			`"\${a}" + "\${a} ${ b }"`,
+			"\"\\${a}\" + \"\\${a} ${b}\";\n",
+		},
+		{
+			"const  limit=10",
+			"const limit = 10;\n",
+		},
+		{
+			"a ?. b?.[ 0 ]??(null ?? 1)",
+			"a?.b?.[0] ?? (null ?? 1);\n",
+		},
+		{
+			"xs|>map( x=>x*2 )|>f(1+2 |> g)",
+			"xs |> map(x => x * 2) |> f(1 + 2 |> g);\n",
+		},
+		{
+			"(x => x)(1); a |> (b |> c); (x => x) ?? f",
+			"(x => x)(1);\na |> (b |> c);\n(x => x) ?? f;\n",
+		},
+		{
+			"infixr 6 <+> = fn(a,b){ a+b }; (a<+>b)<+>c; a<+>(b<+>c); (a+b)<+>c",
+			"infixr 6 <+> = fn(a, b) {\n\ta + b;\n};\n(a <+> b) <+> c;\na <+> b <+> c;\n(a + b) <+> c;\n",
+		},
+		{
+			`let f = fn(a,b=1+2,...rest){ g(a, ...rest) }`,
+			"let f = fn(a, b = 1 + 2, ...rest) {\n\tg(a, ...rest);\n};\n",
+		},
+		{
+			`let [a,b,...rest]=xs; let {"name":name,"age":years}=person`,
+			"let [a, b, ...rest] = xs;\nlet {name, \"age\": years} = person;\n",
+		},
+		{
+			`match (x) { 0 => "zero", [a, ...rest] if a > 0 => a, {"name": name, "age": 1} => name, _ => "other" }`,
+			"match (x) {\n\t0 => \"zero\",\n\t[a, ...rest] if a > 0 => a,\n\t{name, \"age\": 1} => name,\n\t_ => \"other\",\n};\n",
+		},
+		{
+			"let x:int=1; const f : fn( int ,[string] ):{ string:bool } = fn(a:int,b : [string]=[]):null { }",
+			"let x: int = 1;\nconst f: fn(int, [string]): {string: bool} = fn(a: int, b: [string] = []): null {};\n",
+		},
+		{
+			"fn(... rest : [ int ]){rest}",
+			"fn(...rest: [int]) {\n\trest;\n};\n",
+		},
+	}
+
+	for _, tt := range tests {
+		formatted, err := Source(tt.input)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %s", tt.input, err)
+		}
+
+		if formatted != tt.expected {
+			t.Errorf("wrong output for %q.\nwant=%q\ngot= %q", tt.input, tt.expected, formatted)
+		}
+	}
+}
+
+func TestFormatIsIdempotentAndRoundTrips(t *testing.T) {
+	inputs := []string{
+		`let fib = fn(n) { if (n < 2) { return n } fib(n-1) + fib(n-2) }; fib(10)`,
+		`let xs = [1, 2, 3]; let m = {"a": xs[0], "b": -xs[1] * (2 + 3)}; m["a"]`,
+		`let f = fn(a, b) { fn(c) { a + b + c } }; f(1, 2)(3) // call it`,
+		`if (true && false || 1 == 2) { 1 } else { if (x <= 3) { "nested" } }`,
+		`let long = [aVeryLongIdentifierName, anotherVeryLongIdentifierName, yetAnotherOne]`,
+		`isEmpty(push([], fn() { return 10 }))`,
+		`let f = fn(x) { match (x) { [] => 0, [_, ...rest] => 1 + f(rest), {} => match (x) { {a} => a } } }`,
+		"let m = {\n\t// first\n\t\"a\": 1, // one\n\t\"b\": {\"c\": 2 // nested\n\t}\n}",
+		"f([1, // one\n\t2], // list\n\t// last\n)",
+	}
+
+	for _, input := range inputs {
+		first, err := Source(input)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %s", input, err)
+		}
+
+		second, err := Source(first)
+		if err != nil {
+			t.Fatalf("unexpected error when reformatting %q: %s", first, err)
+		}
+
+		if first != second {
+			t.Errorf("formatting is not idempotent.\nfirst= %q\nsecond=%q", first, second)
+		}
+
+		original := parser.New(scanner.NewHandcodedScanner(input)).ParseProgram()
+		reparsed := parser.New(scanner.NewHandcodedScanner(first)).ParseProgram()
+		if original.String() != reparsed.String() {
+			t.Errorf("formatting changed the program.\nwant=%s\ngot= %s", original.String(), reparsed.String())
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package lint
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Config enables and disables rules by their ID. Rules not mentioned are
+// enabled. A configuration file is a JSON object like
+//
+//	{"rules": {"unused-binding": false}}
+type Config struct {
+	Rules map[string]bool `json:"rules"`
+}
+
+// Enabled reports whether the rule runs under config.
+func (config *Config) Enabled(rule *Rule) bool {
+	enabled, ok := config.Rules[rule.ID]
+	return !ok || enabled
+}
+
+// ParseConfig decodes a configuration file. Unknown rule IDs are rejected.
+func ParseConfig(data []byte) (*Config, error) {
+	config := &Config{}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, err
+	}
+
+	for id := range config.Rules {
+		if ruleByID(id) == nil {
+			return nil, fmt.Errorf("unknown rule %s", id)
+		}
+	}
+	return config, nil
+}
+
+// LoadConfig reads and decodes the configuration file at path.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := ParseConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return config, nil
+}
+
+func ruleByID(id string) *Rule {
+	for _, rule := range Rules {
+		if rule.ID == id {
+			return rule
+		}
+	}
+	return nil
+}
@@ -0,0 +1,407 @@
+// Package lint reports suspicious constructs in programs that are valid but
+// most likely mistakes, like bindings that are never used.
+//
+// Every warning is identified by the ID of the rule that produced it. Rules
+// can be disabled by a Config, and single lines can be excluded with a
+// comment like
+//
+//	// lint:ignore unused-binding, shadowed-builtin
+//
+// which applies to the line it trails or, on a line of its own, to the next
+// line. Without rule IDs the comment suppresses every rule.
+package lint
+
+import (
+	"compiler/ast"
+	"compiler/compiler"
+	"compiler/object"
+	"compiler/token"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type Rule struct {
+	ID          string
+	Description string
+}
+
+var (
+	UnusedBinding   = &Rule{ID: "unused-binding", Description: "let and const bindings that are never used"}
+	ShadowedBuiltin = &Rule{ID: "shadowed-builtin", Description: "bindings hiding a builtin function"}
+	UnreachableCode = &Rule{ID: "unreachable-code", Description: "statements following a return statement"}
+	SelfComparison  = &Rule{ID: "self-comparison", Description: "comparisons of an expression with itself"}
+)
+
+// Rules lists every rule in the order they are documented.
+var Rules = []*Rule{
+	UnusedBinding,
+	ShadowedBuiltin,
+	UnreachableCode,
+	SelfComparison,
+}
+
+// Diagnostic is a warning of a rule at a position of the source.
+type Diagnostic struct {
+	Position token.Position
+	Rule     *Rule
+	Message  string
+}
+
+func (d *Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s (%s)", d.Position, d.Message, d.Rule.ID)
+}
+
+const ignoreDirective = "lint:ignore"
+
+// binding is a name whose uses are counted.
+type binding struct {
+	name *ast.Identifier
+	used bool
+}
+
+type scope struct {
+	table *compiler.SymbolTable
+	// bindings are checked for uses when the scope ends.
+	bindings []*binding
+}
+
+type linter struct {
+	config *Config
+	scope  *scope
+	outer  []*scope
+
+	declared    map[*compiler.Symbol]*binding
+	diagnostics []*Diagnostic
+}
+
+// Lint runs the rules enabled by config over program and returns the
+// diagnostics that are not suppressed, ordered by position. A nil config
+// enables every rule.
+func Lint(program *ast.Program, config *Config) []*Diagnostic {
+	if config == nil {
+		config = &Config{}
+	}
+
+	table := compiler.NewSymbolTable()
+	for i, builtin := range object.Builtins {
+		table.DefineBuiltin(i, builtin.Name)
+	}
+
+	l := &linter{
+		config:   config,
+		scope:    &scope{table: table},
+		declared: make(map[*compiler.Symbol]*binding),
+	}
+	l.statements(program.Statements)
+	l.checkUnused()
+
+	ignored := suppressions(program.Comments)
+	var diagnostics []*Diagnostic
+	for _, d := range l.diagnostics {
+		rules, ok := ignored[d.Position.Line]
+		if ok && (len(rules) == 0 || rules[d.Rule.ID]) {
+			continue
+		}
+		diagnostics = append(diagnostics, d)
+	}
+
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		return diagnostics[i].Position.Offset < diagnostics[j].Position.Offset
+	})
+	return diagnostics
+}
+
+// suppressions maps lines to the IDs of the rules ignored on them. An empty
+// set ignores every rule.
+func suppressions(comments []*ast.Comment) map[int]map[string]bool {
+	ignored := make(map[int]map[string]bool)
+	for _, comment := range comments {
+		text := strings.TrimSpace(strings.TrimPrefix(comment.Token.Literal, "//"))
+		if !strings.HasPrefix(text, ignoreDirective) {
+			continue
+		}
+
+		line := comment.Token.Position.Line
+		if !comment.Trailing {
+			line++
+		}
+
+		rules := make(map[string]bool)
+		for _, id := range strings.FieldsFunc(text[len(ignoreDirective):], isSeparator) {
+			rules[id] = true
+		}
+		ignored[line] = rules
+	}
+	return ignored
+}
+
+func isSeparator(r rune) bool {
+	return r == ',' || r == ' ' || r == '\t'
+}
+
+func (l *linter) report(rule *Rule, pos token.Position, format string, a ...interface{}) {
+	if !l.config.Enabled(rule) {
+		return
+	}
+	l.diagnostics = append(l.diagnostics, &Diagnostic{Position: pos, Rule: rule, Message: fmt.Sprintf(format, a...)})
+}
+
+func (l *linter) enterScope() {
+	l.outer = append(l.outer, l.scope)
+	l.scope = &scope{table: compiler.FromSymbolTable(l.scope.table)}
+}
+
+func (l *linter) leaveScope() {
+	l.checkUnused()
+	l.scope = l.outer[len(l.outer)-1]
+	l.outer = l.outer[:len(l.outer)-1]
+}
+
+func (l *linter) checkUnused() {
+	for _, b := range l.scope.bindings {
+		if !b.used && !strings.HasPrefix(b.name.Value, "_") {
+			l.report(UnusedBinding, b.name.Token.Position, "%s is declared but never used", b.name.Value)
+		}
+	}
+}
+
+// define binds name in the current scope. Only the uses of tracked
+// bindings are checked.
+func (l *linter) define(name *ast.Identifier, tracked bool) {
+	table := l.scope.table
+	if symbol, ok := table.RetrieveSymbol(name.Value); ok && symbol.Scope == compiler.BuiltinScope {
+		l.report(ShadowedBuiltin, name.Token.Position, "%s shadows the builtin function %s", name.Value, name.Value)
+	}
+
+	symbol := table.Define(name.Value)
+	if tracked {
+		b := &binding{name: name}
+		l.scope.bindings = append(l.scope.bindings, b)
+		l.declared[symbol] = b
+	}
+}
+
+// use marks the binding name resolves to as used.
+func (l *linter) use(name *ast.Identifier) {
+	table := l.scope.table
+	symbol, ok := table.RetrieveSymbol(name.Value)
+	if !ok {
+		return
+	}
+
+	// free symbols refer to the symbol of the enclosing function they
+	// were captured from
+	for symbol.Scope == compiler.FreeScope {
+		symbol = table.FreeSymbols[symbol.Index]
+		table = table.UnwrapSymbolTable()
+	}
+
+	if b, ok := l.declared[symbol]; ok {
+		b.used = true
+	}
+}
+
+func (l *linter) statements(statements []ast.Statement) {
+	reachable, reported := true, false
+	for _, stmt := range statements {
+		// the rest of the block is covered by a single warning
+		if !reachable && !reported {
+			l.report(UnreachableCode, statementPosition(stmt), "unreachable code")
+			reported = true
+		}
+
+		l.statement(stmt)
+		if _, ok := stmt.(*ast.ReturnStatement); ok {
+			reachable = false
+		}
+	}
+}
+
+func (l *linter) statement(stmt ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		l.expression(stmt.Value)
+		l.define(stmt.Name, true)
+	case *ast.ConstStatement:
+		l.expression(stmt.Value)
+		l.define(stmt.Name, true)
+	case *ast.InfixDeclaration:
+		l.expression(stmt.Value)
+		l.scope.table.Define(stmt.Operator.Literal)
+	case *ast.DestructuringLetStatement:
+		l.expression(stmt.Value)
+		l.pattern(stmt.Pattern, true)
+	case *ast.ReturnStatement:
+		if stmt.ReturnValue != nil {
+			l.expression(stmt.ReturnValue)
+		}
+	case *ast.ExpressionStatement:
+		if stmt.Expression != nil {
+			l.expression(stmt.Expression)
+		}
+	case *ast.BlockStatement:
+		l.statements(stmt.Statements)
+	}
+}
+
+func (l *linter) expression(expr ast.Expression) {
+	switch expr := expr.(type) {
+	case *ast.Identifier:
+		l.use(expr)
+	case *ast.InterpolatedString:
+		for _, e := range expr.Expressions {
+			l.expression(e)
+		}
+	case *ast.PrefixExpression:
+		l.expression(expr.Right)
+	case *ast.InfixExpression:
+		l.expression(expr.Left)
+		l.expression(expr.Right)
+		if isComparison(expr.Operator) && isPure(expr.Left) && expr.Left.String() == expr.Right.String() {
+			l.report(SelfComparison, expr.Token.Position, "comparison of %s with itself", expr.Left)
+		}
+	case *ast.IfExpression:
+		l.expression(expr.Condition)
+		l.statement(expr.Consequence)
+		if expr.Alternative != nil {
+			l.statement(expr.Alternative)
+		}
+	case *ast.FunctionLiteral:
+		l.function(expr)
+	case *ast.MacroLiteral:
+		l.enterScope()
+		for _, param := range expr.Parameters {
+			l.define(param, false)
+		}
+		l.statement(expr.Body)
+		l.leaveScope()
+	case *ast.LambdaLiteral:
+		l.function(expr.Function())
+	case *ast.PipeExpression:
+		l.expression(expr.Left)
+		l.expression(expr.Right)
+	case *ast.CallExpression:
+		l.expression(expr.Left)
+		for _, arg := range expr.Arguments {
+			l.expression(arg)
+		}
+	case *ast.SpreadExpression:
+		l.expression(expr.Value)
+	case *ast.ArrayLiteral:
+		for _, e := range expr.Elements {
+			l.expression(e)
+		}
+	case *ast.IndexExpression:
+		l.expression(expr.Left)
+		l.expression(expr.Index)
+	case *ast.PropertyExpression:
+		l.expression(expr.Left)
+	case *ast.MapLiteral:
+		for _, key := range expr.OrderedKeys() {
+			l.expression(key)
+			l.expression(expr.Entries[key])
+		}
+	case *ast.MatchExpression:
+		l.expression(expr.Subject)
+		for _, arm := range expr.Arms {
+			// bindings are only visible inside their arm
+			l.enterScope()
+			l.pattern(arm.Pattern, false)
+			if arm.Guard != nil {
+				l.expression(arm.Guard)
+			}
+			l.expression(arm.Body)
+			l.leaveScope()
+		}
+	}
+}
+
+func (l *linter) function(fn *ast.FunctionLiteral) {
+	l.enterScope()
+
+	if fn.Name != "" {
+		l.scope.table.DefineFunctionName(fn.Name)
+	}
+
+	// default values only see the parameters in front of them
+	for i, param := range fn.Parameters {
+		if def := fn.Default(i); def != nil {
+			l.expression(def)
+		}
+		l.define(param, false)
+	}
+	if fn.Rest != nil {
+		l.define(fn.Rest, false)
+	}
+
+	l.statement(fn.Body)
+	l.leaveScope()
+}
+
+func (l *linter) pattern(pattern ast.Pattern, tracked bool) {
+	switch pattern := pattern.(type) {
+	case *ast.LiteralPattern:
+		l.expression(pattern.Value)
+	case *ast.BindingPattern:
+		l.define(pattern.Name, tracked)
+	case *ast.ArrayPattern:
+		for _, e := range pattern.Elements {
+			l.pattern(e, tracked)
+		}
+		if pattern.Rest != nil {
+			l.define(pattern.Rest, tracked)
+		}
+	case *ast.MapPattern:
+		for _, entry := range pattern.Entries {
+			l.expression(entry.Key)
+			l.pattern(entry.Value, tracked)
+		}
+	}
+}
+
+func isComparison(operator token.TokenType) bool {
+	switch operator {
+	case token.EQUALS, token.NOT_EQUALS, token.LT, token.GT, token.LESS_EQUAL, token.GREATER_EQUAL:
+		return true
+	default:
+		return false
+	}
+}
+
+// isPure reports whether evaluating expr twice yields the same value.
+func isPure(expr ast.Expression) bool {
+	switch expr := expr.(type) {
+	case *ast.Identifier, *ast.IntegerLiteral, *ast.StringLiteral, *ast.BooleanLiteral, *ast.NullLiteral:
+		return true
+	case *ast.PropertyExpression:
+		return isPure(expr.Left)
+	case *ast.IndexExpression:
+		return isPure(expr.Left) && isPure(expr.Index)
+	case *ast.PrefixExpression:
+		return isPure(expr.Right)
+	default:
+		return false
+	}
+}
+
+func statementPosition(stmt ast.Statement) token.Position {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		return stmt.Token.Position
+	case *ast.ConstStatement:
+		return stmt.Token.Position
+	case *ast.InfixDeclaration:
+		return stmt.Token.Position
+	case *ast.DestructuringLetStatement:
+		return stmt.Token.Position
+	case *ast.ReturnStatement:
+		return stmt.Token.Position
+	case *ast.ExpressionStatement:
+		return stmt.Token.Position
+	case *ast.BlockStatement:
+		return stmt.Token.Position
+	default:
+		return token.Position{}
+	}
+}
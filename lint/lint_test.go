@@ -0,0 +1,100 @@
+package lint
+
+import (
+	"compiler/parser"
+	"compiler/scanner"
+	"strings"
+	"testing"
+)
+
+func lint(t *testing.T, input string, config *Config) []string {
+	t.Helper()
+
+	p := parser.New(scanner.NewHandcodedScanner(input))
+	program := p.ParseProgram()
+	if len(p.Errors) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors)
+	}
+
+	var diagnostics []string
+	for _, d := range Lint(program, config) {
+		diagnostics = append(diagnostics, d.String())
+	}
+	return diagnostics
+}
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{`let x = 1; x + 1`, nil},
+		{`let x = 1;`, []string{`1:5: x is declared but never used (unused-binding)`}},
+		{`let _x = 1; const limit = 10; limit`, nil},
+		{`let x = 1; let x = 2; x`, []string{`1:5: x is declared but never used (unused-binding)`}},
+		{`let x = 1; let x = x + 1; x`, nil},
+		{`let [a, ...rest] = [1, 2]; a`, []string{`1:12: rest is declared but never used (unused-binding)`}},
+		{`let f = fn(a, b) { let c = a; b }; f(1, 2)`, []string{`1:24: c is declared but never used (unused-binding)`}},
+		{`let f = fn(n) { if (n > 0) { f(n - 1) } };`, []string{`1:5: f is declared but never used (unused-binding)`}},
+		{`let x = 1; let f = fn() { fn() { x } }; f()`, nil},
+		{`let f = fn(x) { match (x) { [y] => y, _ => 0 } }; f`, nil},
+		{`let len = fn(x) { 0 }; len(1)`, []string{`1:5: len shadows the builtin function len (shadowed-builtin)`}},
+		{`let f = fn(push, ...len) { push(len) }; f`, []string{
+			`1:12: push shadows the builtin function push (shadowed-builtin)`,
+			`1:21: len shadows the builtin function len (shadowed-builtin)`,
+		}},
+		{`let f = fn() { return 1; let x = 2; x }; f`, []string{`1:26: unreachable code (unreachable-code)`}},
+		{`let f = fn() { if (true) { return 1; 2 } 3 }; f`, []string{`1:38: unreachable code (unreachable-code)`}},
+		{`let x = 1; x == x`, []string{`1:14: comparison of x with itself (self-comparison)`}},
+		{`let m = {}; m.a[0] < m.a[0]`, []string{`1:20: comparison of m.a[0] with itself (self-comparison)`}},
+		{`let f = fn() { 1 }; f() == f()`, nil},
+	}
+
+	for _, tt := range tests {
+		actual := lint(t, tt.input, nil)
+		if strings.Join(actual, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("wrong diagnostics for %q.\nwant=%q\ngot= %q", tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func TestSuppressionComments(t *testing.T) {
+	input := `
+let a = 1; // lint:ignore unused-binding
+// lint:ignore
+let len = 2;
+// lint:ignore self-comparison
+let b = 3;
+let c = 4; // lint:ignore shadowed-builtin, self-comparison
+`
+	expected := []string{
+		`6:5: b is declared but never used (unused-binding)`,
+		`7:5: c is declared but never used (unused-binding)`,
+	}
+
+	actual := lint(t, input, nil)
+	if strings.Join(actual, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong diagnostics.\nwant=%q\ngot= %q", expected, actual)
+	}
+}
+
+func TestConfig(t *testing.T) {
+	config, err := ParseConfig([]byte(`{"rules": {"unused-binding": false, "self-comparison": true}}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	actual := lint(t, `let len = 1; len == len`, config)
+	expected := []string{
+		`1:5: len shadows the builtin function len (shadowed-builtin)`,
+		`1:18: comparison of len with itself (self-comparison)`,
+	}
+	if strings.Join(actual, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong diagnostics.\nwant=%q\ngot= %q", expected, actual)
+	}
+
+	_, err = ParseConfig([]byte(`{"rules": {"unused": false}}`))
+	if err == nil || err.Error() != "unknown rule unused" {
+		t.Errorf("Expected 'unknown rule unused'. Got '%v'", err)
+	}
+}
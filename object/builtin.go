@@ -46,10 +46,151 @@ var Builtins = []*Builtin{
 			case *String:
 				return len(arg.Value) == 0
 			case *Map:
-				return len(arg.Entries) == 0
+				return arg.Len() == 0
 			default:
 				return NewError("type missmatch: isEmpty(%s) not supported", arg.Type())
 			}
 		},
 	},
+	{
+		Name: "keys",
+		Fn: func(args ...Object) interface{} {
+			mapArg, err := mapArgument("keys", args, 1)
+			if err != nil {
+				return err
+			}
+
+			keys := make([]Object, mapArg.Len())
+			for i, pair := range mapArg.Pairs() {
+				keys[i] = pair.Key
+			}
+			return &Array{Elements: keys}
+		},
+	},
+	{
+		Name: "values",
+		Fn: func(args ...Object) interface{} {
+			mapArg, err := mapArgument("values", args, 1)
+			if err != nil {
+				return err
+			}
+
+			values := make([]Object, mapArg.Len())
+			for i, pair := range mapArg.Pairs() {
+				values[i] = pair.Value
+			}
+			return &Array{Elements: values}
+		},
+	},
+	{
+		Name: "entries",
+		Fn: func(args ...Object) interface{} {
+			mapArg, err := mapArgument("entries", args, 1)
+			if err != nil {
+				return err
+			}
+
+			entries := make([]Object, mapArg.Len())
+			for i, pair := range mapArg.Pairs() {
+				entries[i] = &Array{Elements: []Object{pair.Key, pair.Value}}
+			}
+			return &Array{Elements: entries}
+		},
+	},
+	{
+		Name: "has",
+		Fn: func(args ...Object) interface{} {
+			mapArg, err := mapArgument("has", args, 2)
+			if err != nil {
+				return err
+			}
+
+			key, err := keyArgument(args[1])
+			if err != nil {
+				return err
+			}
+
+			_, ok := mapArg.Get(key)
+			return ok
+		},
+	},
+	{
+		Name: "set",
+		Fn: func(args ...Object) interface{} {
+			mapArg, err := mapArgument("set", args, 3)
+			if err != nil {
+				return err
+			}
+
+			key, err := keyArgument(args[1])
+			if err != nil {
+				return err
+			}
+
+			result := mapArg.Copy()
+			result.Set(key, args[2])
+			return result
+		},
+	},
+	{
+		Name: "delete",
+		Fn: func(args ...Object) interface{} {
+			mapArg, err := mapArgument("delete", args, 2)
+			if err != nil {
+				return err
+			}
+
+			key, err := keyArgument(args[1])
+			if err != nil {
+				return err
+			}
+
+			result := mapArg.Copy()
+			result.Delete(key)
+			return result
+		},
+	},
+	{
+		Name: "merge",
+		Fn: func(args ...Object) interface{} {
+			mapArg, err := mapArgument("merge", args, 2)
+			if err != nil {
+				return err
+			}
+
+			other, ok := args[1].(*Map)
+			if !ok {
+				return NewError("type missmatch: second argument of merge must be %s. Got %s", MAP, args[1].Type())
+			}
+
+			// keys of both maps keep the position they have in the first
+			result := mapArg.Copy()
+			for _, pair := range other.Pairs() {
+				result.Set(pair.Key, pair.Value)
+			}
+			return result
+		},
+	},
+}
+
+// mapArgument checks that a builtin got numArgs arguments, the first of
+// which is a map, and returns that map.
+func mapArgument(name string, args []Object, numArgs int) (*Map, *Error) {
+	if len(args) != numArgs {
+		return nil, NewError("wrong number of arguments: expected %d. Got %d", numArgs, len(args))
+	}
+
+	mapArg, ok := args[0].(*Map)
+	if !ok {
+		return nil, NewError("type missmatch: first argument of %s must be %s. Got %s", name, MAP, args[0].Type())
+	}
+	return mapArg, nil
+}
+
+func keyArgument(arg Object) (Hashable, *Error) {
+	key, ok := arg.(Hashable)
+	if !ok {
+		return nil, NewError("type missmatch: cannot use %s as key for hashmap", arg.Type())
+	}
+	return key, nil
 }
@@ -21,6 +21,8 @@ const (
 	BUILTIN           = "BUILTIN"
 	COMPILED_FUNCTION = "COMPILED_FUNCTION"
 	CLOSURE           = "CLOSURE"
+	QUOTE             = "QUOTE"
+	MACRO             = "MACRO"
 )
 
 type ObjectType string
@@ -47,6 +49,8 @@ func (intObj *Integer) Hash() string {
 
 type Function struct {
 	Parameters []string
+	Defaults   []ast.Expression
+	Rest       string
 	Body       *ast.BlockStatement
 }
 
@@ -79,16 +83,28 @@ func (arr *Array) String() string {
 	var out bytes.Buffer
 
 	out.WriteString("[")
-	for _, e := range arr.Elements {
+	for i, e := range arr.Elements {
+		if i != 0 {
+			out.WriteString(", ")
+		}
 		out.WriteString(e.String())
 	}
-	out.WriteString(")")
+	out.WriteString("]")
 
 	return out.String()
 }
 
+// Map holds key/value pairs in the order their keys were first set. The
+// zero value is an empty map.
 type Map struct {
-	Entries map[string]Object
+	pairs []MapPair
+	// index holds the position of every pair in pairs by the Hash of its key.
+	index map[string]int
+}
+
+type MapPair struct {
+	Key   Hashable
+	Value Object
 }
 
 func (mapObj *Map) Type() ObjectType { return MAP }
@@ -96,6 +112,65 @@ func (mapObj *Map) String() string {
 	return "map"
 }
 
+// Len returns the number of pairs of the map.
+func (mapObj *Map) Len() int {
+	return len(mapObj.pairs)
+}
+
+// Pairs returns the pairs of the map in order. The slice must not be
+// modified.
+func (mapObj *Map) Pairs() []MapPair {
+	return mapObj.pairs
+}
+
+// Get returns the value of key, or false if the map has no such key.
+func (mapObj *Map) Get(key Hashable) (Object, bool) {
+	i, ok := mapObj.index[key.Hash()]
+	if !ok {
+		return nil, false
+	}
+	return mapObj.pairs[i].Value, true
+}
+
+// Set sets the value of key. A new key is added after the existing ones,
+// an existing key keeps its position and original key object.
+func (mapObj *Map) Set(key Hashable, value Object) {
+	if i, ok := mapObj.index[key.Hash()]; ok {
+		mapObj.pairs[i].Value = value
+		return
+	}
+
+	if mapObj.index == nil {
+		mapObj.index = make(map[string]int)
+	}
+	mapObj.index[key.Hash()] = len(mapObj.pairs)
+	mapObj.pairs = append(mapObj.pairs, MapPair{Key: key, Value: value})
+}
+
+// Delete removes key from the map. The remaining pairs keep their order.
+func (mapObj *Map) Delete(key Hashable) {
+	i, ok := mapObj.index[key.Hash()]
+	if !ok {
+		return
+	}
+
+	mapObj.pairs = append(mapObj.pairs[:i:i], mapObj.pairs[i+1:]...)
+	delete(mapObj.index, key.Hash())
+	for j := i; j < len(mapObj.pairs); j++ {
+		mapObj.index[mapObj.pairs[j].Key.Hash()] = j
+	}
+}
+
+// Copy returns a map with the same pairs that can be changed
+// independently.
+func (mapObj *Map) Copy() *Map {
+	copied := &Map{}
+	for _, pair := range mapObj.pairs {
+		copied.Set(pair.Key, pair.Value)
+	}
+	return copied
+}
+
 type String struct {
 	Value string
 }
@@ -143,11 +218,20 @@ func (builtin *Builtin) String() string {
 	return ""
 }
 
+// CompiledFunction takes NumParams positional parameters of which the last
+// NumDefaults are optional. A variadic function collects further arguments
+// into an array stored in the local after the positional parameters.
+// Name is empty for anonymous functions, Lines maps the instructions to
+// the source they were compiled from.
 type CompiledFunction struct {
 	Instructions code.Instructions
+	Name         string
+	Lines        code.LineTable
 
-	NumParams int
-	NumLocals int
+	NumParams   int
+	NumDefaults int
+	Variadic    bool
+	NumLocals   int
 }
 
 func (compiledFn *CompiledFunction) Type() ObjectType {
@@ -172,3 +256,29 @@ func (c *Closure) Type() ObjectType {
 func (c *Closure) String() string {
 	return fmt.Sprintf("Closure[%p]", c)
 }
+
+// Quote is an unevaluated piece of syntax as produced by quote(...) and
+// passed to and returned from macros.
+type Quote struct {
+	Node ast.Node
+}
+
+func (q *Quote) Type() ObjectType {
+	return QUOTE
+}
+func (q *Quote) String() string {
+	return "QUOTE(" + q.Node.String() + ")"
+}
+
+type Macro struct {
+	Parameters []*ast.Identifier
+	Body       *ast.BlockStatement
+}
+
+func (m *Macro) Type() ObjectType {
+	return MACRO
+}
+func (m *Macro) String() string {
+	literal := &ast.MacroLiteral{Parameters: m.Parameters, Body: m.Body}
+	return literal.String()
+}
@@ -0,0 +1,237 @@
+package parser
+
+import (
+	"compiler/ast"
+	"compiler/scanner"
+	"compiler/token"
+	"fmt"
+	"strings"
+)
+
+// Edit replaces the source text from Start up to End by Text. Offsets are
+// byte offsets into the source before the edit.
+type Edit struct {
+	Start int
+	End   int
+	Text  string
+}
+
+// Document is a parsed source text that can be edited. An edit only
+// rescans and reparses the top-level statements around it and reuses the
+// statements behind it, yet the program always equals a full parse of the
+// current source.
+type Document struct {
+	source  string
+	program *ast.Program
+	// regions holds the source range of every top-level statement. A
+	// region reaches up to the start of the next statement.
+	regions []region
+
+	Errors []string
+}
+
+type region struct {
+	start token.Position
+	end   int
+}
+
+// window is the result of parsing a part of the source.
+type window struct {
+	statements []ast.Statement
+	regions    []region
+	comments   []*ast.Comment
+	errors     []string
+	// end is the offset parsing stopped at.
+	end int
+}
+
+func NewDocument(source string) *Document {
+	d := &Document{source: source}
+	d.parseAll()
+	return d
+}
+
+func (d *Document) Source() string {
+	return d.source
+}
+
+func (d *Document) Program() *ast.Program {
+	return d.program
+}
+
+// Apply edits the source and updates the program. Statements in front of
+// the edit are kept and statements behind it are reused once the reparsed
+// statements line up with them again. Documents with errors and edits
+// touching infix declarations, which change how the rest of the source
+// parses, are parsed completely.
+func (d *Document) Apply(edit Edit) error {
+	if edit.Start < 0 || edit.Start > edit.End || edit.End > len(d.source) {
+		return fmt.Errorf("invalid edit range %d-%d for source of length %d", edit.Start, edit.End, len(d.source))
+	}
+
+	old := d.source
+	d.source = old[:edit.Start] + edit.Text + old[edit.End:]
+	if len(d.Errors) != 0 || len(d.regions) == 0 {
+		d.parseAll()
+		return nil
+	}
+
+	// the statement in front of the edited one is reparsed as well, since
+	// the edit may continue it
+	first := 0
+	for first < len(d.regions) && d.regions[first].end <= edit.Start {
+		first++
+	}
+	first--
+
+	start := token.Position{Offset: 0, Line: 1, Column: 1}
+	if first <= 0 {
+		first = 0
+	} else {
+		start = d.regions[first].start
+	}
+
+	delta := len(edit.Text) - (edit.End - edit.Start)
+	editEnd := edit.Start + len(edit.Text)
+
+	starts := make(map[int]int, len(d.regions))
+	for i, r := range d.regions {
+		starts[r.start.Offset] = i
+	}
+	reused := len(d.regions)
+	synced := func(offset int) bool {
+		if offset < editEnd {
+			return false
+		}
+		i, ok := starts[offset-delta]
+		if ok {
+			reused = i
+		}
+		return ok
+	}
+
+	w := d.parseWindow(start, declarations(d.program.Statements[:first]), synced)
+	replaced := d.program.Statements[first:reused]
+	if len(w.errors) != 0 || len(declarations(replaced)) != 0 || len(declarations(w.statements)) != 0 {
+		d.parseAll()
+		return nil
+	}
+
+	oldEnd, newEnd := positionAt(old, edit.End), positionAt(d.source, editEnd)
+	move := func(pos token.Position) token.Position {
+		if pos.Line == oldEnd.Line {
+			pos.Column += newEnd.Column - oldEnd.Column
+		}
+		pos.Line += newEnd.Line - oldEnd.Line
+		pos.Offset += delta
+		return pos
+	}
+
+	statements := append([]ast.Statement{}, d.program.Statements[:first]...)
+	statements = append(statements, w.statements...)
+	regions := append([]region{}, d.regions[:first]...)
+	regions = append(regions, w.regions...)
+	for i := reused; i < len(d.regions); i++ {
+		ast.Relocate(d.program.Statements[i], move)
+		statements = append(statements, d.program.Statements[i])
+		regions = append(regions, region{start: move(d.regions[i].start), end: d.regions[i].end + delta})
+	}
+
+	var comments []*ast.Comment
+	for _, comment := range d.program.Comments {
+		if comment.Token.Position.Offset < start.Offset {
+			comments = append(comments, comment)
+		}
+	}
+	comments = append(comments, w.comments...)
+	for _, comment := range d.program.Comments {
+		if comment.Token.Position.Offset >= w.end-delta && reused < len(d.regions) {
+			ast.Relocate(comment, move)
+			comments = append(comments, comment)
+		}
+	}
+
+	d.program = &ast.Program{Statements: statements, Comments: comments}
+	d.regions = regions
+	return nil
+}
+
+func (d *Document) parseAll() {
+	start := token.Position{Offset: 0, Line: 1, Column: 1}
+	w := d.parseWindow(start, nil, func(int) bool { return false })
+
+	d.program = &ast.Program{Statements: w.statements, Comments: w.comments}
+	d.regions = w.regions
+	d.Errors = w.errors
+}
+
+// parseWindow parses the statements from start on until it reaches the
+// end of the source or a statement starting at an offset synced accepts.
+func (d *Document) parseWindow(start token.Position, operators []*ast.InfixDeclaration, synced func(offset int) bool) *window {
+	s := &offsetScanner{scanner: scanner.NewHandcodedScanner(d.source[start.Offset:]), start: start}
+	p := New(s)
+	for _, decl := range operators {
+		p.Declare(decl)
+	}
+
+	w := &window{}
+	for !p.currentTokenIs(token.EOF) && !synced(p.currentToken.Position.Offset) {
+		begin := p.currentToken.Position
+		statement := p.parseStatement()
+		p.nextToken()
+
+		if statement != nil {
+			w.statements = append(w.statements, statement)
+			w.regions = append(w.regions, region{start: begin, end: p.currentToken.Position.Offset})
+		}
+	}
+	w.end = p.currentToken.Position.Offset
+
+	// the parser has already read the comments behind the current token
+	for _, comment := range p.comments {
+		if comment.Token.Position.Offset < w.end || p.currentTokenIs(token.EOF) {
+			w.comments = append(w.comments, comment)
+		}
+	}
+	w.errors = p.Errors
+
+	return w
+}
+
+// declarations returns the infix declarations of the statements, which
+// affect how the statements following them are parsed.
+func declarations(statements []ast.Statement) []*ast.InfixDeclaration {
+	var decls []*ast.InfixDeclaration
+	for _, statement := range statements {
+		ast.Inspect(statement, func(node ast.Node) bool {
+			if decl, ok := node.(*ast.InfixDeclaration); ok {
+				decls = append(decls, decl)
+			}
+			return true
+		})
+	}
+	return decls
+}
+
+func positionAt(source string, offset int) token.Position {
+	line := strings.Count(source[:offset], "\n") + 1
+	column := offset - strings.LastIndex(source[:offset], "\n")
+	return token.Position{Offset: offset, Line: line, Column: column}
+}
+
+// offsetScanner scans the source from start on and reports positions
+// relative to the beginning of the source.
+type offsetScanner struct {
+	scanner scanner.Scanner
+	start   token.Position
+}
+
+func (s *offsetScanner) NextToken() token.Token {
+	tok := s.scanner.NextToken()
+	if tok.Position.Line == 1 {
+		tok.Position.Column += s.start.Column - 1
+	}
+	tok.Position.Line += s.start.Line - 1
+	tok.Position.Offset += s.start.Offset
+	return tok
+}
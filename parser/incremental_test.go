@@ -0,0 +1,149 @@
+package parser
+
+import (
+	"compiler/ast"
+	"compiler/scanner"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+const document = `// helpers
+let add = fn(a, b) { a + b }; // sum
+let double = x => x * 2;
+
+let xs = [1, 2, 3] |> map(double);
+if (len(xs) > 2) {
+	"many ${len(xs)}"
+} else {
+	"few"
+}
+// classify
+let classify = fn(x) {
+	match (x) {
+		0 => "zero",
+		[a, ...rest] if a > 0 => rest,
+		_ => "other",
+	}
+};
+classify(add(1, 2))
+`
+
+func expectFullReparse(t *testing.T, doc *Document) {
+	t.Helper()
+
+	p := New(scanner.NewHandcodedScanner(doc.Source()))
+	program := p.ParseProgram()
+
+	expected, err := ast.EncodeJSON(program)
+	if err != nil {
+		t.Fatalf("encoding failed: %s", err)
+	}
+	actual, err := ast.EncodeJSON(doc.Program())
+	if err != nil {
+		t.Fatalf("encoding failed: %s", err)
+	}
+
+	if string(actual) != string(expected) {
+		t.Fatalf("program differs from full reparse of %q.\nwant=%s\ngot= %s", doc.Source(), expected, actual)
+	}
+	if strings.Join(doc.Errors, "\n") != strings.Join(p.Errors, "\n") {
+		t.Fatalf("errors differ from full reparse of %q.\nwant=%v\ngot= %v", doc.Source(), p.Errors, doc.Errors)
+	}
+}
+
+func TestIncrementalEdits(t *testing.T) {
+	tests := []Edit{
+		{Start: 12, End: 12, Text: "\n"},
+		{Start: 18, End: 21, Text: "sum"},
+		{Start: 0, End: 11, Text: ""},
+		{Start: 0, End: 0, Text: "let zero = 0;\n"},
+		{Start: 45, End: 46, Text: "+ 1\n-"},
+		{Start: 60, End: 60, Text: "// note\n"},
+		{Start: 100, End: 105, Text: ""},
+		{Start: 110, End: 110, Text: "\"unclosed"},
+		{Start: 110, End: 119, Text: ""},
+		{Start: 0, End: 0, Text: "infixl 6 <+> = add;\n"},
+		{Start: 0, End: 20, Text: ""},
+	}
+
+	doc := NewDocument(document)
+	expectFullReparse(t, doc)
+
+	for _, edit := range tests {
+		if err := doc.Apply(edit); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		expectFullReparse(t, doc)
+	}
+
+	end := len(doc.Source())
+	if err := doc.Apply(Edit{Start: end, End: end, Text: "\nadd(1, 2) * 3"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expectFullReparse(t, doc)
+}
+
+func TestRandomIncrementalEdits(t *testing.T) {
+	random := rand.New(rand.NewSource(42))
+
+	// edits mostly keep the document valid, so statements get reused
+	randomEdit := func(source string) Edit {
+		at := random.Intn(len(source))
+		switch {
+		case source[at] == '\n':
+			statements := []string{"\nlet y = 2;", "\n// comment", "\n", "\nxs[0]", "\n}"}
+			return Edit{Start: at, End: at, Text: statements[random.Intn(len(statements))]}
+		case source[at] == ' ':
+			whitespace := []string{"", "  ", "\n\t", " // c\n"}
+			return Edit{Start: at, End: at + 1, Text: whitespace[random.Intn(len(whitespace))]}
+		case '0' <= source[at] && source[at] <= '9':
+			return Edit{Start: at, End: at + 1, Text: []string{"42", "7", "-1"}[random.Intn(3)]}
+		default:
+			return Edit{Start: at, End: at, Text: []string{"", "a", "(", "\""}[random.Intn(4)]}
+		}
+	}
+
+	doc := NewDocument(document)
+	for i := 0; i < 1000; i++ {
+		if err := doc.Apply(randomEdit(doc.Source())); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		expectFullReparse(t, doc)
+
+		if len(doc.Errors) != 0 && random.Intn(4) == 0 {
+			doc = NewDocument(document)
+		}
+	}
+}
+
+func TestIncrementalEditsReuseStatements(t *testing.T) {
+	doc := NewDocument(document)
+	before := doc.Program().Statements
+
+	if err := doc.Apply(Edit{Start: 18, End: 19, Text: "first"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expectFullReparse(t, doc)
+
+	after := doc.Program().Statements
+	expectProgramLength(t, after, len(before))
+	if after[0] == before[0] {
+		t.Errorf("Expected edited statement to be reparsed")
+	}
+	for i := 2; i < len(after); i++ {
+		if after[i] != before[i] {
+			t.Errorf("Expected statement %d to be reused", i)
+		}
+	}
+}
+
+func TestInvalidEdits(t *testing.T) {
+	doc := NewDocument(`let x = 1;`)
+
+	for _, edit := range []Edit{{Start: -1, End: 0}, {Start: 3, End: 2}, {Start: 0, End: 11}} {
+		if err := doc.Apply(edit); err == nil {
+			t.Errorf("Expected error for edit %+v", edit)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package parser
+
+import (
+	"compiler/ast"
+	"compiler/token"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// declaredPrecedences maps the precedence level of an infix declaration to
+// the precedence the operator is parsed with. Levels follow the builtin
+// operators, e.g. level 6 binds like + and level 7 like *.
+var declaredPrecedences = []int{
+	1: PIPE,
+	2: COALESCE,
+	3: EQUALS,
+	4: AND,
+	5: LESSGREATER,
+	6: SUM,
+	7: PRODUCT,
+}
+
+// DeclaredPrecedence returns the parser precedence of an operator declared
+// with the given level.
+func DeclaredPrecedence(level int) (int, bool) {
+	if level < 1 || level >= len(declaredPrecedences) {
+		return 0, false
+	}
+	return declaredPrecedences[level], true
+}
+
+// operatorCharacters are the characters declared operators are made of.
+const operatorCharacters = "+-*/<>=!&|?^%~@"
+
+func (p *Parser) parseInfixDeclaration() ast.Statement {
+	decl := &ast.InfixDeclaration{Token: p.currentToken}
+
+	if !p.expectPeek(token.INT) {
+		return nil
+	}
+
+	level, err := strconv.Atoi(p.currentToken.Literal)
+	if _, ok := DeclaredPrecedence(level); err != nil || !ok {
+		msg := fmt.Sprintf("Expected precedence between 1 and %d. Got %s", len(declaredPrecedences)-1, p.currentToken.Literal)
+		p.Errors = append(p.Errors, msg)
+		return nil
+	}
+	decl.Precedence = level
+	p.nextToken()
+
+	if !p.parseOperatorSymbol(decl) {
+		return nil
+	}
+	p.register(decl)
+
+	if !p.expectPeek(token.ASSIGN) {
+		return nil
+	}
+	p.nextToken()
+
+	decl.Value = p.parseExpression(LOWEST)
+
+	if fl, ok := decl.Value.(*ast.FunctionLiteral); ok {
+		fl.Name = decl.Operator.Literal
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return decl
+}
+
+// parseOperatorSymbol joins the current token and the tokens directly
+// following it into the symbol of the declared operator.
+func (p *Parser) parseOperatorSymbol(decl *ast.InfixDeclaration) bool {
+	first := p.currentToken
+	if !isOperatorToken(first) {
+		msg := fmt.Sprintf("Expected operator symbol. Got '%s'", first.Literal)
+		p.Errors = append(p.Errors, msg)
+		return false
+	}
+
+	symbol := first.Literal
+	for isOperatorToken(p.peekToken) && adjacent(p.currentToken, p.peekToken) {
+		p.nextToken()
+		symbol += p.currentToken.Literal
+	}
+
+	builtin := symbol == first.Literal && first.Type != token.ILLEGAL && !p.operators[symbol]
+	if builtin {
+		msg := fmt.Sprintf("cannot redeclare builtin operator %s", symbol)
+		p.Errors = append(p.Errors, msg)
+		return false
+	}
+
+	decl.Operator = token.Token{Type: token.TokenType(symbol), Literal: symbol, Position: first.Position}
+	return true
+}
+
+// Declare makes the operator of an infix declaration known to the parser,
+// e.g. to keep operators declared by earlier input of a REPL.
+func (p *Parser) Declare(decl *ast.InfixDeclaration) {
+	p.register(decl)
+	p.peekToken = p.glue(p.peekToken)
+	p.tokens[p.peekIndex] = p.peekToken
+}
+
+func (p *Parser) register(decl *ast.InfixDeclaration) {
+	operator := decl.Operator.Type
+	precedence, _ := DeclaredPrecedence(decl.Precedence)
+
+	p.operators[decl.Operator.Literal] = true
+	p.precedences[operator] = precedence
+	p.infixParseFunctions[operator] = p.parseInfixExpression
+	p.rightAssociative[operator] = decl.RightAssociative()
+}
+
+// glue joins tok with the tokens directly following it if together they
+// spell a declared operator. The longest declared operator wins, tokens
+// read beyond it are scanned again.
+func (p *Parser) glue(tok token.Token) token.Token {
+	if len(p.operators) == 0 || !isOperatorToken(tok) {
+		return tok
+	}
+
+	read := []token.Token{tok}
+	symbol := tok.Literal
+	longest, longestSymbol := 0, ""
+	if p.operators[symbol] {
+		longest, longestSymbol = 1, symbol
+	}
+
+	for p.isOperatorPrefix(symbol) {
+		next := p.scan()
+		read = append(read, next)
+		if !isOperatorToken(next) || !adjacent(read[len(read)-2], next) {
+			break
+		}
+
+		symbol += next.Literal
+		if p.operators[symbol] {
+			longest, longestSymbol = len(read), symbol
+		}
+	}
+
+	if longest == 0 {
+		p.pending = append(read[1:], p.pending...)
+		return tok
+	}
+
+	p.pending = append(read[longest:], p.pending...)
+	return token.Token{Type: token.TokenType(longestSymbol), Literal: longestSymbol, Position: tok.Position}
+}
+
+func (p *Parser) isOperatorPrefix(symbol string) bool {
+	for operator := range p.operators {
+		if len(operator) > len(symbol) && strings.HasPrefix(operator, symbol) {
+			return true
+		}
+	}
+	return false
+}
+
+func isOperatorToken(tok token.Token) bool {
+	switch tok.Type {
+	case token.COMMENT, token.STRING, token.STRING_HEAD, token.STRING_MIDDLE, token.STRING_TAIL:
+		return false
+	}
+
+	if tok.Literal == "" {
+		return false
+	}
+	for _, ch := range tok.Literal {
+		if !strings.ContainsRune(operatorCharacters, ch) {
+			return false
+		}
+	}
+	return true
+}
+
+func adjacent(tok token.Token, next token.Token) bool {
+	return next.Position.Offset == tok.Position.Offset+len(tok.Literal)
+}
@@ -11,6 +11,9 @@ import (
 const (
 	_ int = iota
 	LOWEST
+	LAMBDA
+	PIPE
+	COALESCE
 	EQUALS
 	AND
 	LESSGREATER
@@ -33,6 +36,21 @@ type Parser struct {
 	precedences          map[token.TokenType]int
 	prefixParseFunctions map[token.TokenType]PrefixParseFn
 	infixParseFunctions  map[token.TokenType]InfixParseFn
+	rightAssociative     map[token.TokenType]bool
+
+	// operators holds the symbols of the declared infix operators and
+	// pending the tokens read ahead while looking for them.
+	operators map[string]bool
+	pending   []token.Token
+
+	// tokens holds every token read so far including trivia. currentIndex
+	// and peekIndex locate the current and the peek token in it.
+	tokens       []token.Token
+	currentIndex int
+	peekIndex    int
+	spans        []Span
+
+	comments []*ast.Comment
 
 	Errors []string
 }
@@ -55,6 +73,11 @@ func New(l scanner.Scanner) *Parser {
 	p.precedences[token.SLASH] = PRODUCT
 	p.precedences[token.LPAREN] = CALL
 	p.precedences[token.LBRACKET] = INDEX
+	p.precedences[token.DOT] = INDEX
+	p.precedences[token.QUESTION_DOT] = INDEX
+	p.precedences[token.COALESCE] = COALESCE
+	p.precedences[token.PIPE] = PIPE
+	p.precedences[token.ARROW] = LAMBDA
 
 	p.prefixParseFunctions = make(map[token.TokenType]PrefixParseFn)
 	p.prefixParseFunctions[token.MINUS] = p.parsePrefixExpression
@@ -62,13 +85,17 @@ func New(l scanner.Scanner) *Parser {
 	p.prefixParseFunctions[token.IDENT] = p.parseIdentifier
 	p.prefixParseFunctions[token.INT] = p.parseInteger
 	p.prefixParseFunctions[token.STRING] = p.parseString
+	p.prefixParseFunctions[token.STRING_HEAD] = p.parseInterpolatedString
 	p.prefixParseFunctions[token.TRUE] = p.parseBoolean
 	p.prefixParseFunctions[token.FALSE] = p.parseBoolean
+	p.prefixParseFunctions[token.NULL] = p.parseNull
 	p.prefixParseFunctions[token.IF] = p.parseIfExpression
 	p.prefixParseFunctions[token.FUNCTION] = p.parseFunctionLiteral
 	p.prefixParseFunctions[token.LPAREN] = p.parseParen
 	p.prefixParseFunctions[token.LBRACKET] = p.parseArray
 	p.prefixParseFunctions[token.LBRACE] = p.parseMap
+	p.prefixParseFunctions[token.MATCH] = p.parseMatchExpression
+	p.prefixParseFunctions[token.MACRO] = p.parseMacroLiteral
 
 	p.infixParseFunctions = make(map[token.TokenType]InfixParseFn)
 	p.infixParseFunctions[token.EQUALS] = p.parseInfixExpression
@@ -85,7 +112,16 @@ func New(l scanner.Scanner) *Parser {
 	p.infixParseFunctions[token.OR] = p.parseInfixExpression
 	p.infixParseFunctions[token.LBRACKET] = p.parseIndexExpression
 	p.infixParseFunctions[token.LPAREN] = p.parseCallExpression
+	p.infixParseFunctions[token.DOT] = p.parsePropertyExpression
+	p.infixParseFunctions[token.QUESTION_DOT] = p.parseOptionalExpression
+	p.infixParseFunctions[token.COALESCE] = p.parseInfixExpression
+	p.infixParseFunctions[token.PIPE] = p.parsePipeExpression
+	p.infixParseFunctions[token.ARROW] = p.parseLambdaLiteral
 
+	p.rightAssociative = make(map[token.TokenType]bool)
+	p.operators = make(map[string]bool)
+
+	p.peekIndex = -1
 	p.nextToken()
 	p.nextToken()
 
@@ -94,7 +130,32 @@ func New(l scanner.Scanner) *Parser {
 
 func (p *Parser) nextToken() {
 	p.currentToken = p.peekToken
-	p.peekToken = p.scanner.NextToken()
+	p.currentIndex = p.peekIndex
+	p.peekToken = p.scan()
+
+	for p.peekTokenIs(token.COMMENT) || p.peekTokenIs(token.WHITESPACE) {
+		if p.peekTokenIs(token.COMMENT) {
+			comment := &ast.Comment{Token: p.peekToken}
+			comment.Trailing = p.currentToken.Position.IsValid() && p.currentToken.Position.Line == p.peekToken.Position.Line
+			p.comments = append(p.comments, comment)
+		}
+
+		p.tokens = append(p.tokens, p.peekToken)
+		p.peekToken = p.scan()
+	}
+
+	p.peekToken = p.glue(p.peekToken)
+	p.tokens = append(p.tokens, p.peekToken)
+	p.peekIndex = len(p.tokens) - 1
+}
+
+func (p *Parser) scan() token.Token {
+	if len(p.pending) != 0 {
+		tok := p.pending[0]
+		p.pending = p.pending[1:]
+		return tok
+	}
+	return p.scanner.NextToken()
 }
 
 func (p *Parser) ParseProgram() *ast.Program {
@@ -109,7 +170,34 @@ func (p *Parser) ParseProgram() *ast.Program {
 		p.nextToken()
 	}
 
-	return &ast.Program{Statements: statements}
+	return &ast.Program{Statements: statements, Comments: p.comments}
+}
+
+// Span records that Node was parsed from Tokens()[Start:End].
+type Span struct {
+	Node  ast.Node
+	Start int
+	End   int
+}
+
+// Tokens returns every token read so far in source order, including
+// comments and the whitespace of scanners that emit trivia.
+func (p *Parser) Tokens() []token.Token {
+	return p.tokens
+}
+
+// Spans returns the spans of the statements, expressions, blocks, patterns
+// and type annotations parsed so far. A span is recorded once its node is complete, so
+// nodes come after the nodes they contain.
+func (p *Parser) Spans() []Span {
+	return p.spans
+}
+
+// record adds the span from the token at start up to the current token.
+func (p *Parser) record(node ast.Node, start int) {
+	if node != nil {
+		p.spans = append(p.spans, Span{Node: node, Start: start, End: p.currentIndex + 1})
+	}
 }
 
 func (p *Parser) parseExpressionStatement() ast.Statement {
@@ -132,7 +220,9 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 		return nil
 	}
 
+	start := p.currentIndex
 	leftExpr := prefix()
+	p.record(leftExpr, start)
 
 	for !p.peekTokenIs(token.SEMICOLON) && precedence < p.peekPrecedence() {
 		infix, ok := p.infixParseFunctions[p.peekToken.Type]
@@ -142,6 +232,7 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 		p.nextToken()
 
 		leftExpr = infix(leftExpr)
+		p.record(leftExpr, start)
 	}
 	return leftExpr
 }
@@ -159,6 +250,14 @@ func (p *Parser) parseIdentifier() ast.Expression {
 	return &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
 }
 
+// identifier returns the current token as an identifier that is not parsed
+// as an expression, like the name of a let statement.
+func (p *Parser) identifier() *ast.Identifier {
+	ident := &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+	p.record(ident, p.currentIndex)
+	return ident
+}
+
 func (p *Parser) parseInteger() ast.Expression {
 	value, err := strconv.ParseInt(p.currentToken.Literal, 0, 64)
 	if err != nil {
@@ -172,6 +271,39 @@ func (p *Parser) parseString() ast.Expression {
 	return &ast.StringLiteral{Token: p.currentToken, Value: p.currentToken.Literal}
 }
 
+// parseInterpolatedString parses the tokens of "a${b}c${d}e", which are
+// STRING_HEAD, b, STRING_MIDDLE, d and STRING_TAIL.
+func (p *Parser) parseInterpolatedString() ast.Expression {
+	interpolated := &ast.InterpolatedString{Token: p.currentToken}
+	interpolated.Texts = append(interpolated.Texts, &ast.StringLiteral{Token: p.currentToken, Value: p.currentToken.Literal})
+
+	for {
+		p.nextToken()
+
+		expr := p.parseExpression(LOWEST)
+		if expr == nil {
+			return nil
+		}
+		interpolated.Expressions = append(interpolated.Expressions, expr)
+
+		if !p.peekTokenIs(token.STRING_MIDDLE) && !p.peekTokenIs(token.STRING_TAIL) {
+			msg := fmt.Sprintf("Expected } closing the interpolation. Got '%s'", p.peekToken)
+			p.Errors = append(p.Errors, msg)
+			return nil
+		}
+		p.nextToken()
+		interpolated.Texts = append(interpolated.Texts, &ast.StringLiteral{Token: p.currentToken, Value: p.currentToken.Literal})
+
+		if p.currentTokenIs(token.STRING_TAIL) {
+			return interpolated
+		}
+	}
+}
+
+func (p *Parser) parseNull() ast.Expression {
+	return &ast.NullLiteral{Token: p.currentToken}
+}
+
 func (p *Parser) parseBoolean() ast.Expression {
 	value, err := strconv.ParseBool(p.currentToken.Literal)
 	if err != nil {
@@ -182,9 +314,12 @@ func (p *Parser) parseBoolean() ast.Expression {
 }
 
 func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
-	infixExpr := &ast.InfixExpression{Left: left, Operator: p.currentToken.Type}
+	infixExpr := &ast.InfixExpression{Token: p.currentToken, Left: left, Operator: p.currentToken.Type}
 
 	precedence := p.currentPrecedence()
+	if p.rightAssociative[p.currentToken.Type] {
+		precedence--
+	}
 	p.nextToken()
 
 	infixExpr.Right = p.parseExpression(precedence)
@@ -207,14 +342,24 @@ func (p *Parser) peekPrecedence() int {
 }
 
 func (p *Parser) parseStatement() ast.Statement {
+	start := p.currentIndex
+
+	var statement ast.Statement
 	switch p.currentToken.Type {
 	case token.LET:
-		return p.parseLetStatement()
+		statement = p.parseLetStatement()
+	case token.CONST:
+		statement = p.parseConstStatement()
 	case token.RETURN:
-		return p.parseReturnStatement()
+		statement = p.parseReturnStatement()
+	case token.INFIXL, token.INFIXR:
+		statement = p.parseInfixDeclaration()
 	default:
-		return p.parseExpressionStatement()
+		statement = p.parseExpressionStatement()
 	}
+
+	p.record(statement, start)
+	return statement
 }
 
 func (p *Parser) parseIfExpression() ast.Expression {
@@ -252,12 +397,19 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 		return nil
 	}
 
-	function.Parameters = p.parseParameters()
+	if !p.parseParameters(function) {
+		return nil
+	}
 
 	if !p.expectPeek(token.RPAREN) {
 		return nil
 	}
 
+	var ok bool
+	if function.ReturnType, ok = p.parseAnnotation(); !ok {
+		return nil
+	}
+
 	if !p.expectPeek(token.LBRACE) {
 		return nil
 	}
@@ -266,6 +418,33 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 	return function
 }
 
+func (p *Parser) parseMacroLiteral() ast.Expression {
+	macro := &ast.MacroLiteral{Token: p.currentToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	for !p.peekTokenIs(token.RPAREN) {
+		if len(macro.Parameters) != 0 && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		macro.Parameters = append(macro.Parameters, p.identifier())
+	}
+	p.nextToken()
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	macro.Body = p.parseBlockStatement()
+
+	return macro
+}
+
 func (p *Parser) parseParen() ast.Expression {
 	p.nextToken()
 
@@ -285,7 +464,12 @@ func (p *Parser) parseCallExpression(left ast.Expression) ast.Expression {
 
 	arguments := make([]ast.Expression, 0)
 	for p.currentToken.Type != token.RPAREN {
-		argument := p.parseExpression(LOWEST)
+		if p.currentTokenIs(token.EOF) {
+			p.Errors = append(p.Errors, "Expected ) to close argument list. Got EOF")
+			return nil
+		}
+
+		argument := p.parseArgument()
 		if argument != nil {
 			arguments = append(arguments, argument)
 		}
@@ -296,10 +480,26 @@ func (p *Parser) parseCallExpression(left ast.Expression) ast.Expression {
 		p.nextToken()
 	}
 	call.Arguments = arguments
+	call.Rparen = p.currentToken
 
 	return call
 }
 
+func (p *Parser) parseArgument() ast.Expression {
+	if !p.currentTokenIs(token.ELLIPSIS) {
+		return p.parseExpression(LOWEST)
+	}
+
+	spread := &ast.SpreadExpression{Token: p.currentToken}
+	p.nextToken()
+
+	spread.Value = p.parseExpression(LOWEST)
+	if spread.Value == nil {
+		return nil
+	}
+	return spread
+}
+
 func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	indExpr := &ast.IndexExpression{Token: p.currentToken, Left: left}
 
@@ -314,26 +514,152 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	return indExpr
 }
 
-func (p *Parser) parseParameters() []*ast.Identifier {
+func (p *Parser) parsePropertyExpression(left ast.Expression) ast.Expression {
+	prop := &ast.PropertyExpression{Token: p.currentToken, Left: left}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	prop.Property = p.identifier()
+
+	return prop
+}
+
+func (p *Parser) parsePipeExpression(left ast.Expression) ast.Expression {
+	pipe := &ast.PipeExpression{Token: p.currentToken, Left: left}
+	p.nextToken()
+
+	pipe.Right = p.parseExpression(PIPE)
+	if pipe.Right == nil {
+		return nil
+	}
+
+	return pipe
+}
+
+// parseLambdaLiteral parses x => body. The body extends as far to the
+// right as possible.
+func (p *Parser) parseLambdaLiteral(left ast.Expression) ast.Expression {
+	if left == nil {
+		return nil
+	}
+
+	param, ok := left.(*ast.Identifier)
+	if !ok {
+		msg := fmt.Sprintf("Expected lambda parameter to be an identifier. Got '%s'", left.TokenLiteral())
+		p.Errors = append(p.Errors, msg)
+		return nil
+	}
+
+	lambda := &ast.LambdaLiteral{Token: p.currentToken, Parameter: param}
+	p.nextToken()
+
+	lambda.Body = p.parseExpression(LOWEST)
+	if lambda.Body == nil {
+		return nil
+	}
+
+	return lambda
+}
+
+// parseOptionalExpression parses left?.name and left?.[index].
+func (p *Parser) parseOptionalExpression(left ast.Expression) ast.Expression {
+	if !p.peekTokenIs(token.LBRACKET) {
+		prop, ok := p.parsePropertyExpression(left).(*ast.PropertyExpression)
+		if !ok {
+			return nil
+		}
+
+		prop.Optional = true
+		return prop
+	}
+	p.nextToken()
+
+	index, ok := p.parseIndexExpression(left).(*ast.IndexExpression)
+	if !ok {
+		return nil
+	}
+
+	index.Optional = true
+	return index
+}
+
+func (p *Parser) parseParameters(function *ast.FunctionLiteral) bool {
 	params := make([]*ast.Identifier, 0)
-	for p.peekToken.Type != token.RPAREN {
+	defaults := make([]ast.Expression, 0)
+	hasDefaults := false
+	types := make([]ast.Type, 0)
+	hasTypes := false
+
+	for p.peekToken.Type != token.RPAREN && p.peekToken.Type != token.EOF {
 		p.nextToken()
-		param := p.parseIdentifier()
-		if param != nil {
-			params = append(params, param.(*ast.Identifier))
+
+		if p.currentTokenIs(token.ELLIPSIS) {
+			if !p.expectPeek(token.IDENT) {
+				return false
+			}
+			function.Rest = p.identifier()
+
+			typ, ok := p.parseAnnotation()
+			if !ok {
+				return false
+			}
+			function.RestType = typ
+
+			if !p.peekTokenIs(token.RPAREN) {
+				p.Errors = append(p.Errors, fmt.Sprintf("Rest parameter %s must be the last parameter", function.Rest.Value))
+				return false
+			}
+			break
 		}
 
+		if !p.currentTokenIs(token.IDENT) {
+			p.Errors = append(p.Errors, fmt.Sprintf("Expected parameter name. Got %s", p.currentToken.Type))
+			return false
+		}
+		param := p.identifier()
+
+		typ, ok := p.parseAnnotation()
+		if !ok {
+			return false
+		}
+		hasTypes = hasTypes || typ != nil
+
+		var def ast.Expression
+		if p.peekTokenIs(token.ASSIGN) {
+			p.nextToken()
+			p.nextToken()
+			def = p.parseExpression(LOWEST)
+			hasDefaults = true
+		} else if hasDefaults {
+			p.Errors = append(p.Errors, fmt.Sprintf("Parameter %s without default value follows parameter with default value", param.Value))
+			return false
+		}
+
+		params = append(params, param)
+		defaults = append(defaults, def)
+		types = append(types, typ)
+
 		if p.peekTokenIs(token.COMMA) {
 			p.nextToken()
 		}
 	}
 
-	return params
+	function.Parameters = params
+	if hasDefaults {
+		function.Defaults = defaults
+	}
+	if hasTypes {
+		function.Types = types
+	}
+	return true
 }
 
 func (p *Parser) parseArray() ast.Expression {
+	arr := &ast.ArrayLiteral{Token: p.currentToken}
+
 	elems := make([]ast.Expression, 0)
-	for p.peekToken.Type != token.RBRACKET {
+	for p.peekToken.Type != token.RBRACKET && p.peekToken.Type != token.EOF {
 		p.nextToken()
 		e := p.parseExpression(LOWEST)
 		if e != nil {
@@ -345,16 +671,21 @@ func (p *Parser) parseArray() ast.Expression {
 		}
 	}
 
-	p.nextToken()
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
 
-	return &ast.ArrayLiteral{Elements: elems}
+	arr.Elements = elems
+	arr.Rbracket = p.currentToken
+	return arr
 }
 
 func (p *Parser) parseMap() ast.Expression {
 	mapExpr := &ast.MapLiteral{Token: p.currentToken}
 
 	entries := make(map[ast.Expression]ast.Expression)
-	for p.peekToken.Type != token.RBRACE {
+	keys := make([]ast.Expression, 0)
+	for p.peekToken.Type != token.RBRACE && p.peekToken.Type != token.EOF {
 		p.nextToken()
 		key := p.parseExpression(LOWEST)
 
@@ -365,23 +696,205 @@ func (p *Parser) parseMap() ast.Expression {
 
 		value := p.parseExpression(LOWEST)
 		entries[key] = value
+		keys = append(keys, key)
 
 		if p.peekTokenIs(token.COMMA) {
 			p.nextToken()
 		}
 	}
-	p.nextToken()
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
 
 	mapExpr.Entries = entries
+	mapExpr.Keys = keys
+	mapExpr.Rbrace = p.currentToken
 	return mapExpr
 }
 
+func (p *Parser) parseMatchExpression() ast.Expression {
+	match := &ast.MatchExpression{Token: p.currentToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	p.nextToken()
+
+	match.Subject = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	arms := make([]*ast.MatchArm, 0)
+	for !p.peekTokenIs(token.RBRACE) && !p.peekTokenIs(token.EOF) {
+		p.nextToken()
+
+		arm := &ast.MatchArm{Token: p.currentToken}
+		arm.Pattern = p.parsePattern()
+		if arm.Pattern == nil {
+			return nil
+		}
+
+		if p.peekTokenIs(token.IF) {
+			p.nextToken()
+			p.nextToken()
+			arm.Guard = p.parseExpression(LAMBDA)
+		}
+
+		if !p.expectPeek(token.ARROW) {
+			return nil
+		}
+		p.nextToken()
+
+		arm.Body = p.parseExpression(LOWEST)
+		arms = append(arms, arm)
+
+		if p.peekTokenIs(token.COMMA) {
+			p.nextToken()
+		}
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+
+	match.Arms = arms
+	match.Rbrace = p.currentToken
+	return match
+}
+
+func (p *Parser) parsePattern() ast.Pattern {
+	start := p.currentIndex
+
+	var pattern ast.Pattern
+	switch p.currentToken.Type {
+	case token.IDENT:
+		if p.currentToken.Literal == "_" {
+			pattern = &ast.WildcardPattern{Token: p.currentToken}
+			break
+		}
+		ident := p.identifier()
+		pattern = &ast.BindingPattern{Token: p.currentToken, Name: ident}
+	case token.INT, token.STRING, token.TRUE, token.FALSE, token.NULL:
+		pattern = &ast.LiteralPattern{Token: p.currentToken, Value: p.prefixParseFunctions[p.currentToken.Type]()}
+	case token.MINUS:
+		tok := p.currentToken
+		if !p.expectPeek(token.INT) {
+			return nil
+		}
+		value := &ast.PrefixExpression{Token: tok, Operator: tok.Type, Right: p.parseInteger()}
+		pattern = &ast.LiteralPattern{Token: tok, Value: value}
+	case token.LBRACKET:
+		pattern = p.parseArrayPattern()
+	case token.LBRACE:
+		pattern = p.parseMapPattern()
+	default:
+		msg := fmt.Sprintf("Unexpected token '%s' in pattern", p.currentToken.Literal)
+		p.Errors = append(p.Errors, msg)
+		return nil
+	}
+
+	p.record(pattern, start)
+	return pattern
+}
+
+func (p *Parser) parseArrayPattern() ast.Pattern {
+	arr := &ast.ArrayPattern{Token: p.currentToken}
+
+	elements := make([]ast.Pattern, 0)
+	for !p.peekTokenIs(token.RBRACKET) && !p.peekTokenIs(token.EOF) {
+		p.nextToken()
+
+		if p.currentTokenIs(token.ELLIPSIS) {
+			if !p.expectPeek(token.IDENT) {
+				return nil
+			}
+			arr.Rest = p.identifier()
+			break
+		}
+
+		element := p.parsePattern()
+		if element == nil {
+			return nil
+		}
+		elements = append(elements, element)
+
+		if p.peekTokenIs(token.COMMA) {
+			p.nextToken()
+		}
+	}
+
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+
+	arr.Elements = elements
+	arr.Rbracket = p.currentToken
+	return arr
+}
+
+func (p *Parser) parseMapPattern() ast.Pattern {
+	mapPattern := &ast.MapPattern{Token: p.currentToken}
+
+	entries := make([]*ast.MapPatternEntry, 0)
+	for !p.peekTokenIs(token.RBRACE) && !p.peekTokenIs(token.EOF) {
+		p.nextToken()
+
+		entry := &ast.MapPatternEntry{}
+		switch p.currentToken.Type {
+		case token.IDENT:
+			// {name} is short for {"name": name}
+			entry.Key = &ast.StringLiteral{Token: p.currentToken, Value: p.currentToken.Literal}
+			entry.Value = p.parsePattern()
+		case token.STRING, token.INT, token.TRUE, token.FALSE:
+			entry.Key = p.prefixParseFunctions[p.currentToken.Type]()
+			if !p.expectPeek(token.COLON) {
+				return nil
+			}
+			p.nextToken()
+
+			entry.Value = p.parsePattern()
+			if entry.Value == nil {
+				return nil
+			}
+		default:
+			msg := fmt.Sprintf("Unexpected token '%s' as key of map pattern", p.currentToken.Literal)
+			p.Errors = append(p.Errors, msg)
+			return nil
+		}
+		entries = append(entries, entry)
+
+		if p.peekTokenIs(token.COMMA) {
+			p.nextToken()
+		}
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+
+	mapPattern.Entries = entries
+	mapPattern.Rbrace = p.currentToken
+	return mapPattern
+}
+
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
+	start := p.currentIndex
 	blockStatement := &ast.BlockStatement{Token: p.currentToken}
 	p.nextToken()
 
 	statements := make([]ast.Statement, 0)
 	for p.currentToken.Type != token.RBRACE {
+		if p.currentTokenIs(token.EOF) {
+			p.Errors = append(p.Errors, "Expected } to close block. Got EOF")
+			return nil
+		}
+
 		statement := p.parseStatement()
 		if statement != nil {
 			statements = append(statements, statement)
@@ -389,18 +902,70 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 		p.nextToken()
 	}
 	blockStatement.Statements = statements
+	blockStatement.Rbrace = p.currentToken
 
+	p.record(blockStatement, start)
 	return blockStatement
 }
 
-func (p *Parser) parseLetStatement() *ast.LetStatement {
+func (p *Parser) parseLetStatement() ast.Statement {
+	if p.peekTokenIs(token.LBRACKET) || p.peekTokenIs(token.LBRACE) {
+		return p.parseDestructuringLetStatement()
+	}
+
 	stmt := &ast.LetStatement{Token: p.currentToken}
 
 	if !p.expectPeek(token.IDENT) {
 		return nil
 	}
 
-	stmt.Name = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+	stmt.Name = p.identifier()
+
+	var ok bool
+	if stmt.Type, ok = p.parseAnnotation(); !ok {
+		return nil
+	}
+
+	if !p.expectPeek(token.ASSIGN) {
+		return nil
+	}
+	p.nextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+
+	nameFunction(stmt.Value, stmt.Name.Value)
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// nameFunction gives a function or lambda literal bound to name that name,
+// so it can call itself.
+func nameFunction(value ast.Expression, name string) {
+	switch value := value.(type) {
+	case *ast.FunctionLiteral:
+		value.Name = name
+	case *ast.LambdaLiteral:
+		value.Name = name
+	}
+}
+
+func (p *Parser) parseConstStatement() ast.Statement {
+	stmt := &ast.ConstStatement{Token: p.currentToken}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+
+	stmt.Name = p.identifier()
+
+	var ok bool
+	if stmt.Type, ok = p.parseAnnotation(); !ok {
+		return nil
+	}
 
 	if !p.expectPeek(token.ASSIGN) {
 		return nil
@@ -409,10 +974,31 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 
 	stmt.Value = p.parseExpression(LOWEST)
 
-	if fl, ok := stmt.Value.(*ast.FunctionLiteral); ok {
-		fl.Name = stmt.Name.Value
+	nameFunction(stmt.Value, stmt.Name.Value)
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
 	}
 
+	return stmt
+}
+
+func (p *Parser) parseDestructuringLetStatement() ast.Statement {
+	stmt := &ast.DestructuringLetStatement{Token: p.currentToken}
+	p.nextToken()
+
+	stmt.Pattern = p.parsePattern()
+	if stmt.Pattern == nil {
+		return nil
+	}
+
+	if !p.expectPeek(token.ASSIGN) {
+		return nil
+	}
+	p.nextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
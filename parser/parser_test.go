@@ -43,6 +43,59 @@ func TestLetStatement(t *testing.T) {
 	}
 }
 
+func TestConstStatement(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`const x = 5;`, `const x = 5;`},
+		{`const add = fn(a, b) { a + b }`, `const add = <add>fn(a, b){(a + b)};`},
+	}
+
+	for _, tt := range tests {
+		program := parseProgram(tt.input, t)
+		expectProgramLength(t, program.Statements, 1)
+
+		if _, ok := program.Statements[0].(*ast.ConstStatement); !ok {
+			t.Fatalf("Expected ConstStatement. Got %T", program.Statements[0])
+		}
+
+		if program.String() != tt.expected {
+			t.Errorf("Expected '%s'. Got '%s'", tt.expected, program.String())
+		}
+	}
+
+	p := New(scanner.NewHandcodedScanner(`const [a] = xs;`))
+	p.ParseProgram()
+	if len(p.Errors) == 0 {
+		t.Errorf("Expected error for const without a name")
+	}
+}
+
+func TestDestructuringLetStatement(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let [a, b, ...rest] = arr;`, `let [a, b, ...rest] = arr;`},
+		{`let {name, age} = person`, `let {name: name, age: age} = person;`},
+		{`let [_, {"x": x}] = points;`, `let [_, {x: x}] = points;`},
+	}
+
+	for _, tt := range tests {
+		program := parseProgram(tt.input, t)
+		expectProgramLength(t, program.Statements, 1)
+
+		if _, ok := program.Statements[0].(*ast.DestructuringLetStatement); !ok {
+			t.Fatalf("Expected DestructuringLetStatement. Got %T", program.Statements[0])
+		}
+
+		if program.String() != tt.expected {
+			t.Errorf("Expected '%s'. Got '%s'", tt.expected, program.String())
+		}
+	}
+}
+
 func TestReturnStatement(t *testing.T) {
 	input := `
     return 10;
@@ -414,6 +467,341 @@ func TestFunctionDefinition(t *testing.T) {
 	}
 }
 
+func TestPropertyExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`person.name`, `person.name`},
+		{`a.b.c`, `a.b.c`},
+		{`person.greet(x)`, `person.greet(x)`},
+		{`-a.b * 2`, `((-a.b) * 2)`},
+		{`xs[0].name`, `xs[0].name`},
+	}
+
+	for _, tt := range tests {
+		program := parseProgram(tt.input, t)
+		expectProgramLength(t, program.Statements, 1)
+
+		if program.String() != tt.expected {
+			t.Errorf("Expected '%s'. Got '%s'", tt.expected, program.String())
+		}
+	}
+
+	program := parseProgram(`person.greet(x)`, t)
+	call, ok := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.CallExpression)
+	if !ok {
+		t.Fatalf("Expected CallExpression. Got %T", program.Statements[0].(*ast.ExpressionStatement).Expression)
+	}
+
+	prop, ok := call.Left.(*ast.PropertyExpression)
+	if !ok {
+		t.Fatalf("Expected PropertyExpression as CallExpression.Left. Got %T", call.Left)
+	}
+
+	if prop.Property.Value != "greet" {
+		t.Fatalf("Expected property greet. Got %s", prop.Property.Value)
+	}
+
+	p := New(scanner.NewHandcodedScanner(`person.1`))
+	p.ParseProgram()
+	if len(p.Errors) == 0 {
+		t.Errorf("Expected error for property that is not an identifier")
+	}
+}
+
+func TestInterpolatedString(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"Hello ${name}!"`, `"Hello ${name}!"`},
+		{`"${a}${b + 1}"`, `"${a}${(b + 1)}"`},
+		{`"sum: ${add(1, 2) * 2} items: ${len(items)}"`, `"sum: ${(add(1, 2) * 2)} items: ${len(items)}"`},
+		{`"outer ${"inner ${x}"}"`, `"outer ${"inner ${x}"}"`},
+		{`"${ {"a": 1}["a"] }"`, `"${{ a: 1 }[a]}"`},
+	}
+
+	for _, tt := range tests {
+		program := parseProgram(tt.input, t)
+		expectProgramLength(t, program.Statements, 1)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		if _, ok := stmt.Expression.(*ast.InterpolatedString); !ok {
+			t.Fatalf("Expected InterpolatedString. Got %T", stmt.Expression)
+		}
+
+		if program.String() != tt.expected {
+			t.Errorf("Expected '%s'. Got '%s'", tt.expected, program.String())
+		}
+	}
+
+	for _, input := range []string{`"${}"`, `"${a b}"`, `"${a`} {
+		p := New(scanner.NewHandcodedScanner(input))
+		p.ParseProgram()
+		if len(p.Errors) == 0 {
+			t.Errorf("Expected error for %s", input)
+		}
+	}
+}
+
+func TestMacroLiteral(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`macro() { quote(1) }`, `macro(){quote(1)}`},
+		{`macro(x, y) { x + y; }`, `macro(x, y){(x + y)}`},
+	}
+
+	for _, tt := range tests {
+		program := parseProgram(tt.input, t)
+		expectProgramLength(t, program.Statements, 1)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		if _, ok := stmt.Expression.(*ast.MacroLiteral); !ok {
+			t.Fatalf("Expected MacroLiteral. Got %T", stmt.Expression)
+		}
+
+		if program.String() != tt.expected {
+			t.Errorf("Expected '%s'. Got '%s'", tt.expected, program.String())
+		}
+	}
+
+	p := New(scanner.NewHandcodedScanner(`macro(x = 1) { x }`))
+	p.ParseProgram()
+	if len(p.Errors) == 0 {
+		t.Errorf("Expected error for macro parameter with default value")
+	}
+}
+
+func TestOptionalChainingAndCoalescing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`null`, `null`},
+		{`person?.name`, `person?.name`},
+		{`xs?.[0]`, `xs?.[0]`},
+		{`a?.b.c?.[1](x)`, `a?.b.c?.[1](x)`},
+		{`a ?? b`, `(a ?? b)`},
+		{`a ?? b ?? c`, `((a ?? b) ?? c)`},
+		{`a == null ?? b`, `((a == null) ?? b)`},
+		{`a?.b ?? 1 + 2`, `(a?.b ?? (1 + 2))`},
+	}
+
+	for _, tt := range tests {
+		program := parseProgram(tt.input, t)
+		expectProgramLength(t, program.Statements, 1)
+
+		if program.String() != tt.expected {
+			t.Errorf("Expected '%s'. Got '%s'", tt.expected, program.String())
+		}
+	}
+
+	p := New(scanner.NewHandcodedScanner(`a?.1`))
+	p.ParseProgram()
+	if len(p.Errors) == 0 {
+		t.Errorf("Expected error for optional property that is not an identifier")
+	}
+}
+
+func TestPipesAndLambdas(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`xs |> f`, `(xs |> f)`},
+		{`xs |> f(1) |> g`, `((xs |> f(1)) |> g)`},
+		{`1 + 2 |> f`, `((1 + 2) |> f)`},
+		{`a ?? b |> f`, `((a ?? b) |> f)`},
+		{`x => x * 2`, `x => (x * 2)`},
+		{`x => y => x + y`, `x => y => (x + y)`},
+		{`xs |> map(x => x + 1)`, `(xs |> map(x => (x + 1)))`},
+		{`x => x |> f`, `x => (x |> f)`},
+		{`match (x) { n if n > 0 => n => n, _ => 0 }`, `match (x) { n if (n > 0) => n => n, _ => 0 }`},
+	}
+
+	for _, tt := range tests {
+		program := parseProgram(tt.input, t)
+		expectProgramLength(t, program.Statements, 1)
+
+		if program.String() != tt.expected {
+			t.Errorf("Expected '%s'. Got '%s'", tt.expected, program.String())
+		}
+	}
+
+	p := New(scanner.NewHandcodedScanner(`(a + b) => a`))
+	p.ParseProgram()
+	if len(p.Errors) == 0 {
+		t.Errorf("Expected error for lambda parameter that is not an identifier")
+	}
+
+	// lambdas bound by let and const are named like function literals
+	program := parseProgram(`let f = x => f(x); const g = x => x;`, t)
+	for i, name := range []string{"f", "g"} {
+		var value ast.Expression
+		switch stmt := program.Statements[i].(type) {
+		case *ast.LetStatement:
+			value = stmt.Value
+		case *ast.ConstStatement:
+			value = stmt.Value
+		}
+
+		lambda, ok := value.(*ast.LambdaLiteral)
+		if !ok {
+			t.Fatalf("Expected *ast.LambdaLiteral. Got %T", value)
+		}
+		if lambda.Name != name || lambda.Function().Name != name {
+			t.Errorf("Expected lambda named %s. Got %q", name, lambda.Name)
+		}
+	}
+}
+
+func TestInfixDeclarations(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`infixl 6 <+> = f; a <+> b <+> c`, `((a <+> b) <+> c)`},
+		{`infixr 6 <+> = f; a <+> b <+> c`, `(a <+> (b <+> c))`},
+		{`infixl 6 <+> = f; a <+> b * c`, `(a <+> (b * c))`},
+		{`infixl 7 <+> = f; a + b <+> c`, `(a + (b <+> c))`},
+		{`infixl 3 <+> = f; a<+>b == c`, `((a <+> b) == c)`},
+		{`infixl 7 % = f; a % b`, `(a % b)`},
+		{`infixl 6 <+ = f; infixl 7 <+> = g; a <+> b <+ c`, `((a <+> b) <+ c)`},
+		{`infixl 6 <- = f; a < -b`, `(a < (-b))`},
+		{`infixl 6 <- = f; a <- -b`, `(a <- (-b))`},
+	}
+
+	for _, tt := range tests {
+		p := New(scanner.NewHandcodedScanner(tt.input))
+		program := p.ParseProgram()
+		last := program.Statements[len(program.Statements)-1]
+
+		if len(p.Errors) != 0 {
+			t.Fatalf("Unexpected errors for '%s': %v", tt.input, p.Errors)
+		}
+		if last.String() != tt.expected {
+			t.Errorf("Expected '%s'. Got '%s'", tt.expected, last.String())
+		}
+	}
+
+	program := parseProgram(`infixr 5 ++ = fn(a, b) { a + b };`, t)
+	expected := `infixr 5 ++ = <++>fn(a, b){(a + b)};`
+	if program.String() != expected {
+		t.Errorf("Expected '%s'. Got '%s'", expected, program.String())
+	}
+}
+
+func TestInvalidInfixDeclarations(t *testing.T) {
+	tests := []string{
+		`infixl 8 <+> = f`,
+		`infixl 0 <+> = f`,
+		`infixl 6 + = f`,
+		`infixl 6 == = f`,
+		`infixl 6 plus = f`,
+		`infixr <+> = f`,
+		`infixl 6 <+> = f; a < + b`,
+	}
+
+	for _, input := range tests {
+		p := New(scanner.NewHandcodedScanner(input))
+		p.ParseProgram()
+
+		if len(p.Errors) == 0 {
+			t.Errorf("Expected errors for '%s'", input)
+		}
+	}
+}
+
+func TestFunctionParameters(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`fn(a, b = 1, ...rest) { a }`, `fn(a, b = 1, ...rest){a}`},
+		{`fn(...args) { args }`, `fn(...args){args}`},
+		{`fn(a: int, ...r: [int]) { r }`, `fn(a: int, ...r: [int]){r}`},
+		{`fn(a = 1 + 2, b = a) { b }`, `fn(a = (1 + 2), b = a){b}`},
+		{`f(1, ...xs, ...[2, 3])`, `f(1, ...xs, ...[2, 3])`},
+	}
+
+	for _, tt := range tests {
+		program := parseProgram(tt.input, t)
+		expectProgramLength(t, program.Statements, 1)
+
+		if program.String() != tt.expected {
+			t.Errorf("Expected '%s'. Got '%s'", tt.expected, program.String())
+		}
+	}
+
+	errors := []string{
+		`fn(a = 1, b) {}`,
+		`fn(...rest, a) {}`,
+		`fn(1) {}`,
+	}
+
+	for _, input := range errors {
+		p := New(scanner.NewHandcodedScanner(input))
+		p.ParseProgram()
+
+		if len(p.Errors) == 0 {
+			t.Errorf("Expected errors for '%s'", input)
+		}
+	}
+}
+
+func TestTypeAnnotations(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let x: int = 1;`, `let x: int = 1;`},
+		{`const names: [string] = [];`, `const names: [string] = [];`},
+		{`let m: {string: [int]} = {};`, `let m: {string: [int]} = { };`},
+		{`fn(a: string, b, c: bool = true): bool { c }`, `fn(a: string, b, c: bool = true): bool{c}`},
+		{`fn(): null { }`, `fn(): null{}`},
+		{`let f: fn(int, fn(int): int): [int] = g;`, `let f: fn(int, fn(int): int): [int] = g;`},
+		{`let f: fn() = g;`, `let f: fn() = g;`},
+	}
+
+	for _, tt := range tests {
+		program := parseProgram(tt.input, t)
+		expectProgramLength(t, program.Statements, 1)
+
+		if program.String() != tt.expected {
+			t.Errorf("Expected '%s'. Got '%s'", tt.expected, program.String())
+		}
+	}
+
+	program := parseProgram(`let add = fn(a: int, b): int { a + b };`, t)
+	function := program.Statements[0].(*ast.LetStatement).Value.(*ast.FunctionLiteral)
+	if len(function.Types) != 2 || function.ParameterType(0).String() != "int" || function.ParameterType(1) != nil {
+		t.Errorf("Expected parameter types [int <nil>]. Got %v", function.Types)
+	}
+	if function.ReturnType == nil || function.ReturnType.String() != "int" {
+		t.Errorf("Expected return type int. Got %v", function.ReturnType)
+	}
+
+	errors := []string{
+		`let x: = 1`,
+		`let x: [int = 1`,
+		`let m: {string} = {}`,
+		`fn(a: 1) {}`,
+		`fn(a): {}`,
+	}
+
+	for _, input := range errors {
+		p := New(scanner.NewHandcodedScanner(input))
+		p.ParseProgram()
+
+		if len(p.Errors) == 0 {
+			t.Errorf("Expected errors for '%s'", input)
+		}
+	}
+}
+
 func TestFunctionCall(t *testing.T) {
 	input := `
 	func(2 + 2, 4)
@@ -572,6 +960,107 @@ func TestHashMap(t *testing.T) {
 	}
 }
 
+func TestMatchExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`match (x) { 1 => "one", -1 => "minus one", _ => "other" }`,
+			`match (x) { 1 => one, (-1) => minus one, _ => other }`,
+		},
+		{
+			`match (x) { n if n > 0 => n }`,
+			`match (x) { n if (n > 0) => n }`,
+		},
+		{
+			`match (xs) { [] => 0, [first, ...rest] => first, [_, [a, b]] => a + b }`,
+			`match (xs) { [] => 0, [first, ...rest] => first, [_, [a, b]] => (a + b) }`,
+		},
+		{
+			`match (m) { {name, "age": 42} => name, {1: true} => 1 }`,
+			`match (m) { {name: name, age: 42} => name, {1: true} => 1 }`,
+		},
+	}
+
+	for _, tt := range tests {
+		program := parseProgram(tt.input, t)
+		expectProgramLength(t, program.Statements, 1)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		if _, ok := stmt.Expression.(*ast.MatchExpression); !ok {
+			t.Fatalf("Expected MatchExpression. Got %T", stmt.Expression)
+		}
+
+		if program.String() != tt.expected {
+			t.Errorf("Expected '%s'. Got '%s'", tt.expected, program.String())
+		}
+	}
+}
+
+func TestInvalidPatterns(t *testing.T) {
+	tests := []string{
+		`match (x) { fn => 1 }`,
+		`match (x) { [...rest, a] => 1 }`,
+		`match (x) { {[a]: 1} => 1 }`,
+		`match (x) { 1 }`,
+	}
+
+	for _, input := range tests {
+		p := New(scanner.NewHandcodedScanner(input))
+		p.ParseProgram()
+
+		if len(p.Errors) == 0 {
+			t.Errorf("Expected errors for '%s'", input)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `
+    // leading
+    let x = 5; // trailing
+    x // last
+    `
+
+	program := parseProgram(input, t)
+	expectProgramLength(t, program.Statements, 2)
+
+	tests := []struct {
+		expectedLiteral  string
+		expectedTrailing bool
+	}{
+		{"// leading", false},
+		{"// trailing", true},
+		{"// last", true},
+	}
+
+	if len(program.Comments) != len(tests) {
+		t.Fatalf("Expected %d comments. Got %d", len(tests), len(program.Comments))
+	}
+
+	for i, tt := range tests {
+		comment := program.Comments[i]
+		if comment.Token.Literal != tt.expectedLiteral {
+			t.Errorf("Expected comment %d to be '%s'. Got '%s'", i, tt.expectedLiteral, comment.Token.Literal)
+		}
+
+		if comment.Trailing != tt.expectedTrailing {
+			t.Errorf("Expected comment %d to have Trailing=%t", i, tt.expectedTrailing)
+		}
+	}
+}
+
+func TestUnterminatedBlock(t *testing.T) {
+	l := scanner.NewHandcodedScanner("fn(x) { x")
+	p := New(l)
+	p.ParseProgram()
+
+	if len(p.Errors) == 0 {
+		t.Fatalf("Expected error for unterminated block")
+	}
+}
+
 func parseProgram(input string, t *testing.T) *ast.Program {
 	l := scanner.NewHandcodedScanner(input)
 	p := New(l)
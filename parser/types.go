@@ -0,0 +1,90 @@
+package parser
+
+import (
+	"compiler/ast"
+	"compiler/token"
+	"fmt"
+)
+
+// parseAnnotation parses the optional ": type" following a name or the
+// parameters of a function. ok is false if the annotation is invalid.
+func (p *Parser) parseAnnotation() (typ ast.Type, ok bool) {
+	if !p.peekTokenIs(token.COLON) {
+		return nil, true
+	}
+	p.nextToken()
+	p.nextToken()
+
+	typ = p.parseType()
+	return typ, typ != nil
+}
+
+// parseType parses a type annotation starting at the current token, e.g.
+// int, null, [string], {string: int} or fn(int, bool): string.
+func (p *Parser) parseType() ast.Type {
+	start := p.currentIndex
+
+	var typ ast.Type
+	switch p.currentToken.Type {
+	case token.IDENT, token.NULL:
+		typ = &ast.NamedType{Token: p.currentToken, Name: p.currentToken.Literal}
+	case token.LBRACKET:
+		arr := &ast.ArrayType{Token: p.currentToken}
+		p.nextToken()
+
+		arr.Element = p.parseType()
+		if arr.Element == nil || !p.expectPeek(token.RBRACKET) {
+			return nil
+		}
+		typ = arr
+	case token.LBRACE:
+		mapType := &ast.MapType{Token: p.currentToken}
+		p.nextToken()
+
+		mapType.Key = p.parseType()
+		if mapType.Key == nil || !p.expectPeek(token.COLON) {
+			return nil
+		}
+		p.nextToken()
+
+		mapType.Value = p.parseType()
+		if mapType.Value == nil || !p.expectPeek(token.RBRACE) {
+			return nil
+		}
+		typ = mapType
+	case token.FUNCTION:
+		fn := &ast.FunctionType{Token: p.currentToken, Parameters: make([]ast.Type, 0)}
+		if !p.expectPeek(token.LPAREN) {
+			return nil
+		}
+
+		for !p.peekTokenIs(token.RPAREN) && !p.peekTokenIs(token.EOF) {
+			p.nextToken()
+
+			param := p.parseType()
+			if param == nil {
+				return nil
+			}
+			fn.Parameters = append(fn.Parameters, param)
+
+			if p.peekTokenIs(token.COMMA) {
+				p.nextToken()
+			}
+		}
+		if !p.expectPeek(token.RPAREN) {
+			return nil
+		}
+
+		var ok bool
+		if fn.Return, ok = p.parseAnnotation(); !ok {
+			return nil
+		}
+		typ = fn
+	default:
+		p.Errors = append(p.Errors, fmt.Sprintf("Expected type. Got %s", p.currentToken.Type))
+		return nil
+	}
+
+	p.record(typ, start)
+	return typ
+}
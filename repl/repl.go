@@ -2,16 +2,23 @@ package repl
 
 import (
 	"bufio"
+	"compiler/ast"
 	"compiler/evaluator"
 	"compiler/parser"
 	scannergenerator "compiler/scanner"
 	"compiler/token"
+	"compiler/types"
 	"fmt"
 	"io"
+	"strings"
 )
 
 const PROMPT = ">> "
 
+// TYPE_COMMAND prints the inferred type of the expression following it
+// instead of evaluating it.
+const TYPE_COMMAND = ":type "
+
 func Start(in io.Reader, out io.Writer) {
 	scanner := bufio.NewScanner(in)
 
@@ -19,6 +26,9 @@ func Start(in io.Reader, out io.Writer) {
 	dfa := generator.GenerateScanner(token.TokenClassifications)
 
 	e := evaluator.New()
+	macroEnv := evaluator.NewEnvironment()
+	inferrer := types.NewInferrer()
+	var operators []*ast.InfixDeclaration
 	for {
 		fmt.Fprint(out, PROMPT)
 		scanned := scanner.Scan()
@@ -27,15 +37,44 @@ func Start(in io.Reader, out io.Writer) {
 		}
 
 		line := scanner.Text()
+		typeOnly := strings.HasPrefix(line, TYPE_COMMAND)
+		line = strings.TrimPrefix(line, TYPE_COMMAND)
+
 		s := scannergenerator.NewTableDrivenScanner(line, dfa)
 		// l := lexer.New(line)
 		p := parser.New(s)
+		for _, decl := range operators {
+			p.Declare(decl)
+		}
 
 		program := p.ParseProgram()
 		if len(p.Errors) != 0 {
 			printParserErrors(out, p.Errors)
 		}
-		evaluationResult := e.Evaluate(program)
+
+		if typeOnly {
+			printType(out, inferrer, program)
+			continue
+		}
+
+		ast.Inspect(program, func(node ast.Node) bool {
+			if decl, ok := node.(*ast.InfixDeclaration); ok {
+				operators = append(operators, decl)
+			}
+			return true
+		})
+
+		evaluator.DefineMacros(program, macroEnv)
+		expanded, err := evaluator.ExpandMacros(program, macroEnv)
+		if err != nil {
+			io.WriteString(out, err.Error()+"\n")
+			continue
+		}
+
+		// keep the types of the bindings for later :type commands
+		inferrer.Infer(expanded)
+
+		evaluationResult := e.Evaluate(expanded)
 
 		if evaluationResult != nil {
 			io.WriteString(out, evaluationResult.String())
@@ -49,3 +88,25 @@ func printParserErrors(out io.Writer, errors []string) {
 		io.WriteString(out, "\t"+msg+"\n")
 	}
 }
+
+// printType prints the type of the last expression of the program or the
+// signatures of its declarations.
+func printType(out io.Writer, inferrer *types.Inferrer, program *ast.Program) {
+	info, errors := inferrer.Infer(program)
+	if len(errors) != 0 {
+		for _, err := range errors {
+			io.WriteString(out, "\t"+err.Error()+"\n")
+		}
+		return
+	}
+
+	if n := len(program.Statements); n != 0 {
+		if stmt, ok := program.Statements[n-1].(*ast.ExpressionStatement); ok {
+			io.WriteString(out, info.TypeOf(stmt.Expression).String()+"\n")
+			return
+		}
+	}
+	for _, binding := range info.Bindings {
+		io.WriteString(out, binding.String()+"\n")
+	}
+}
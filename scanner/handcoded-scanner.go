@@ -1,21 +1,44 @@
 package scanner
 
-import "compiler/token"
+import (
+	"compiler/token"
+	"strings"
+)
 
 type HandcodedScanner struct {
 	input        string
 	position     int
 	readPosition int
 	ch           byte
+
+	line   int
+	column int
+
+	// interpolations holds the number of unclosed braces of every ${...}
+	// of a string that is currently being scanned.
+	interpolations []int
+
+	trivia bool
 }
 
 func NewHandcodedScanner(input string) *HandcodedScanner {
-	l := &HandcodedScanner{input: input}
+	l := &HandcodedScanner{input: input, line: 1}
 	l.readChar()
 	return l
 }
 
+// EmitTrivia makes the scanner return whitespace as WHITESPACE tokens
+// instead of skipping it, so the tokens cover the input without gaps.
+func (s *HandcodedScanner) EmitTrivia() {
+	s.trivia = true
+}
+
 func (s *HandcodedScanner) readChar() {
+	if s.ch == '\n' {
+		s.line++
+		s.column = 0
+	}
+
 	if s.readPosition >= len(s.input) {
 		s.ch = 0
 	} else {
@@ -23,16 +46,45 @@ func (s *HandcodedScanner) readChar() {
 	}
 	s.position = s.readPosition
 	s.readPosition += 1
+	s.column++
 }
 
 func (s *HandcodedScanner) NextToken() token.Token {
+	if !s.trivia {
+		s.skipWhitespace()
+	}
+
+	position := token.Position{Offset: s.position, Line: s.line, Column: s.column}
+
 	var tok token.Token
+	if isWhitespace(s.ch) {
+		tok = token.Token{Type: token.WHITESPACE, Literal: s.readWhitespace()}
+	} else {
+		tok = s.scanToken()
+	}
+	tok.Position = position
 
-	s.skipWhitespace()
+	return tok
+}
+
+func (s *HandcodedScanner) scanToken() token.Token {
+	var tok token.Token
 
 	switch s.ch {
 	case '=':
-		tok = s.readTwoCharToken(tok, '=', token.EQUALS, token.ASSIGN)
+		if s.peek() == '>' {
+			tok = s.readTwoCharToken(tok, '>', token.ARROW, token.ASSIGN)
+		} else {
+			tok = s.readTwoCharToken(tok, '=', token.EQUALS, token.ASSIGN)
+		}
+	case '.':
+		if s.peek() == '.' && s.peekAt(2) == '.' {
+			s.readChar()
+			s.readChar()
+			tok = token.Token{Type: token.ELLIPSIS, Literal: "..."}
+		} else {
+			tok = newToken(token.DOT, s.ch)
+		}
 	case '!':
 		tok = s.readTwoCharToken(tok, '=', token.NOT_EQUALS, token.BANG)
 	case ';':
@@ -44,8 +96,18 @@ func (s *HandcodedScanner) NextToken() token.Token {
 	case ')':
 		tok = newToken(token.RPAREN, s.ch)
 	case '{':
+		if len(s.interpolations) != 0 {
+			s.interpolations[len(s.interpolations)-1]++
+		}
 		tok = newToken(token.LBRACE, s.ch)
 	case '}':
+		if n := len(s.interpolations); n != 0 {
+			if s.interpolations[n-1] == 0 {
+				s.interpolations = s.interpolations[:n-1]
+				return s.readStringPart(token.STRING_MIDDLE, token.STRING_TAIL)
+			}
+			s.interpolations[n-1]--
+		}
 		tok = newToken(token.RBRACE, s.ch)
 	case '[':
 		tok = newToken(token.LBRACKET, s.ch)
@@ -56,6 +118,11 @@ func (s *HandcodedScanner) NextToken() token.Token {
 	case '-':
 		tok = newToken(token.MINUS, s.ch)
 	case '/':
+		if s.peek() == '/' {
+			tok.Literal = s.readComment()
+			tok.Type = token.COMMENT
+			return tok
+		}
 		tok = newToken(token.SLASH, s.ch)
 	case '*':
 		tok = newToken(token.ASTERIK, s.ch)
@@ -65,14 +132,22 @@ func (s *HandcodedScanner) NextToken() token.Token {
 		tok = s.readTwoCharToken(tok, '=', token.LESS_EQUAL, token.LT)
 	case '>':
 		tok = s.readTwoCharToken(tok, '=', token.GREATER_EQUAL, token.GT)
+	case '?':
+		if s.peek() == '.' {
+			tok = s.readTwoCharToken(tok, '.', token.QUESTION_DOT, token.ILLEGAL)
+		} else {
+			tok = s.readTwoCharToken(tok, '?', token.COALESCE, token.ILLEGAL)
+		}
 	case '&':
 		tok = s.readTwoCharToken(tok, '&', token.AND, token.ILLEGAL)
 	case '|':
-		tok = s.readTwoCharToken(tok, '|', token.OR, token.ILLEGAL)
+		if s.peek() == '>' {
+			tok = s.readTwoCharToken(tok, '>', token.PIPE, token.ILLEGAL)
+		} else {
+			tok = s.readTwoCharToken(tok, '|', token.OR, token.ILLEGAL)
+		}
 	case '"':
-		tok.Literal = s.readString()
-		tok.Type = token.STRING
-		return tok
+		return s.readStringPart(token.STRING_HEAD, token.STRING)
 	case 0:
 		tok.Literal = ""
 		tok.Type = token.EOF
@@ -94,16 +169,30 @@ func (s *HandcodedScanner) NextToken() token.Token {
 }
 
 func (s *HandcodedScanner) peek() byte {
-	if s.readPosition >= len(s.input) {
+	return s.peekAt(1)
+}
+
+func (s *HandcodedScanner) peekAt(distance int) byte {
+	position := s.position + distance
+	if position >= len(s.input) {
 		return 0
 	}
-	return s.input[s.readPosition]
+	return s.input[position]
 }
 
 func (s *HandcodedScanner) skipWhitespace() {
-	for s.ch == ' ' || s.ch == '\r' || s.ch == '\n' || s.ch == '\t' {
+	s.readWhitespace()
+}
+
+func (s *HandcodedScanner) readWhitespace() string {
+	position := s.position
+	for isWhitespace(s.ch) {
 		s.readChar()
 	}
+	if position == s.position {
+		return ""
+	}
+	return s.input[position:s.position]
 }
 
 func (s *HandcodedScanner) readIdentifier() string {
@@ -114,15 +203,33 @@ func (s *HandcodedScanner) readIdentifier() string {
 	return s.input[position:s.position]
 }
 
-func (s *HandcodedScanner) readString() string {
+// readStringPart reads the text following a quote or the closing brace of
+// an interpolation. The part is of type closed if it ends the string, or
+// of type open if it is followed by ${, which starts an interpolation.
+func (s *HandcodedScanner) readStringPart(open token.TokenType, closed token.TokenType) token.Token {
 	s.readChar()
-	position := s.position
-	for s.ch != '"' && s.ch != 0 {
+	text, end := scanStringPart(s.input, s.position)
+	for s.position < end {
 		s.readChar()
 	}
-	result := s.input[position:s.position]
+	tok := token.Token{Type: closed, Literal: text}
+
+	if s.ch == '$' {
+		s.readChar()
+		s.interpolations = append(s.interpolations, 0)
+		tok.Type = open
+	}
 	s.readChar()
-	return result
+
+	return tok
+}
+
+func (s *HandcodedScanner) readComment() string {
+	position := s.position
+	for s.ch != '\n' && s.ch != 0 {
+		s.readChar()
+	}
+	return s.input[position:s.position]
 }
 
 func (s *HandcodedScanner) readNumber() string {
@@ -146,6 +253,26 @@ func (s *HandcodedScanner) readTwoCharToken(tok token.Token, expectedNext byte,
 	return tok
 }
 
+// scanStringPart returns the text of a string from offset start up to the
+// closing quote, the end of the input or the ${ of an interpolation, and the
+// offset it stopped at. An escaped \${ stands for a literal ${.
+func scanStringPart(input string, start int) (string, int) {
+	var text strings.Builder
+	i := start
+	for i < len(input) && input[i] != '"' && !strings.HasPrefix(input[i:], "${") {
+		if strings.HasPrefix(input[i:], `\${`) {
+			i++
+		}
+		text.WriteByte(input[i])
+		i++
+	}
+	return text.String(), i
+}
+
+func isWhitespace(ch byte) bool {
+	return ch == ' ' || ch == '\r' || ch == '\n' || ch == '\t'
+}
+
 func isLetter(ch byte) bool {
 	return ('a' <= ch && ch <= 'z') || ('A' <= ch && ch <= 'Z') || ch == '_'
 }
@@ -24,6 +24,13 @@ func TestNextToken(t *testing.T) {
     []
     "test"
     :
+    match
+    =>
+    ...
+    a.b
+    a?.b ?? null
+    xs |> f || x
+    infixl infixr
     `
 
 	tests := []struct {
@@ -76,6 +83,70 @@ func TestNextToken(t *testing.T) {
 		{token.RBRACKET, "]"},
 		{token.STRING, "test"},
 		{token.COLON, ":"},
+		{token.MATCH, "match"},
+		{token.ARROW, "=>"},
+		{token.ELLIPSIS, "..."},
+		{token.IDENT, "a"},
+		{token.DOT, "."},
+		{token.IDENT, "b"},
+		{token.IDENT, "a"},
+		{token.QUESTION_DOT, "?."},
+		{token.IDENT, "b"},
+		{token.COALESCE, "??"},
+		{token.NULL, "null"},
+		{token.IDENT, "xs"},
+		{token.PIPE, "|>"},
+		{token.IDENT, "f"},
+		{token.OR, "||"},
+		{token.IDENT, "x"},
+		{token.INFIXL, "infixl"},
+		{token.INFIXR, "infixr"},
+		{token.EOF, ""},
+	}
+
+	l := NewHandcodedScanner(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - type wrong. expected=%q, got %q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got %q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestInterpolatedStrings(t *testing.T) {
+	input := `"a${b}c" "${ {"k": "}"}["k"] }${"x${y}"}" "$ {}" "\${a} ${b}\$"`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.STRING_HEAD, "a"},
+		{token.IDENT, "b"},
+		{token.STRING_TAIL, "c"},
+		{token.STRING_HEAD, ""},
+		{token.LBRACE, "{"},
+		{token.STRING, "k"},
+		{token.COLON, ":"},
+		{token.STRING, "}"},
+		{token.RBRACE, "}"},
+		{token.LBRACKET, "["},
+		{token.STRING, "k"},
+		{token.RBRACKET, "]"},
+		{token.STRING_MIDDLE, ""},
+		{token.STRING_HEAD, "x"},
+		{token.IDENT, "y"},
+		{token.STRING_TAIL, ""},
+		{token.STRING_TAIL, ""},
+		{token.STRING, "$ {}"},
+		{token.STRING_HEAD, "${a} "},
+		{token.IDENT, "b"},
+		{token.STRING_TAIL, "\\$"},
 		{token.EOF, ""},
 	}
 
@@ -93,3 +164,70 @@ func TestNextToken(t *testing.T) {
 		}
 	}
 }
+
+func TestCommentsAndPositions(t *testing.T) {
+	input := `let x = 5; // five
+  x / 2`
+
+	tests := []struct {
+		expectedType     token.TokenType
+		expectedLiteral  string
+		expectedPosition token.Position
+	}{
+		{token.LET, "let", token.Position{Offset: 0, Line: 1, Column: 1}},
+		{token.IDENT, "x", token.Position{Offset: 4, Line: 1, Column: 5}},
+		{token.ASSIGN, "=", token.Position{Offset: 6, Line: 1, Column: 7}},
+		{token.INT, "5", token.Position{Offset: 8, Line: 1, Column: 9}},
+		{token.SEMICOLON, ";", token.Position{Offset: 9, Line: 1, Column: 10}},
+		{token.COMMENT, "// five", token.Position{Offset: 11, Line: 1, Column: 12}},
+		{token.IDENT, "x", token.Position{Offset: 21, Line: 2, Column: 3}},
+		{token.SLASH, "/", token.Position{Offset: 23, Line: 2, Column: 5}},
+		{token.INT, "2", token.Position{Offset: 25, Line: 2, Column: 7}},
+		{token.EOF, "", token.Position{Offset: 26, Line: 2, Column: 8}},
+	}
+
+	l := NewHandcodedScanner(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - type wrong. expected=%q, got %q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got %q", i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if tok.Position != tt.expectedPosition {
+			t.Fatalf("tests[%d] - position wrong. expected=%+v, got %+v", i, tt.expectedPosition, tok.Position)
+		}
+	}
+}
+
+func TestTrivia(t *testing.T) {
+	input := " x = 5; // five\n\t"
+
+	expected := []token.Token{
+		{Type: token.WHITESPACE, Literal: " ", Position: token.Position{Offset: 0, Line: 1, Column: 1}},
+		{Type: token.IDENT, Literal: "x", Position: token.Position{Offset: 1, Line: 1, Column: 2}},
+		{Type: token.WHITESPACE, Literal: " ", Position: token.Position{Offset: 2, Line: 1, Column: 3}},
+		{Type: token.ASSIGN, Literal: "=", Position: token.Position{Offset: 3, Line: 1, Column: 4}},
+		{Type: token.WHITESPACE, Literal: " ", Position: token.Position{Offset: 4, Line: 1, Column: 5}},
+		{Type: token.INT, Literal: "5", Position: token.Position{Offset: 5, Line: 1, Column: 6}},
+		{Type: token.SEMICOLON, Literal: ";", Position: token.Position{Offset: 6, Line: 1, Column: 7}},
+		{Type: token.WHITESPACE, Literal: " ", Position: token.Position{Offset: 7, Line: 1, Column: 8}},
+		{Type: token.COMMENT, Literal: "// five", Position: token.Position{Offset: 8, Line: 1, Column: 9}},
+		{Type: token.WHITESPACE, Literal: "\n\t", Position: token.Position{Offset: 15, Line: 1, Column: 16}},
+		{Type: token.EOF, Literal: "", Position: token.Position{Offset: 17, Line: 2, Column: 2}},
+	}
+
+	s := NewHandcodedScanner(input)
+	s.EmitTrivia()
+	for i, expectedToken := range expected {
+		tok := s.NextToken()
+		if tok != expectedToken {
+			t.Fatalf("tests[%d] - expected: %v, got: %v", i, expectedToken, tok)
+		}
+	}
+}
@@ -99,7 +99,7 @@ func TestGeneratedScanner(t *testing.T) {
 		{token.ELSE, "else"},
 		{token.TRUE, "true"},
 		{token.FALSE, "false"},
-		{token.STRING, "\"test1T EST2\""},
+		{token.STRING, "test1T EST2"},
 		{token.EOF, ""},
 	}
 
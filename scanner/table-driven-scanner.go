@@ -11,22 +11,73 @@ type TableDrivenScanner struct {
 	readPosition int
 	ch           byte
 
+	line        int
+	lineStart   int
+	lineScanned int
+
 	dfa *Dfa
+
+	// interpolations holds the number of unclosed braces of every ${...}
+	// of a string that is currently being scanned.
+	interpolations []int
+
+	trivia bool
 }
 
 func NewTableDrivenScanner(input string, dfa *Dfa) *TableDrivenScanner {
-	s := &TableDrivenScanner{input: input, dfa: dfa}
+	s := &TableDrivenScanner{input: input, dfa: dfa, line: 1}
 	s.readChar()
 	return s
 }
 
+// EmitTrivia makes the scanner return whitespace as WHITESPACE tokens
+// instead of skipping it, so the tokens cover the input without gaps.
+func (s *TableDrivenScanner) EmitTrivia() {
+	s.trivia = true
+}
+
 func (s *TableDrivenScanner) NextToken() token.Token {
-	s.skipWhitespace()
+	if !s.trivia {
+		s.skipWhitespace()
+	}
+
+	position := s.positionAt(s.position)
+
+	var tok token.Token
+	if s.position < len(s.input) && isWhitespace(s.ch) {
+		tok = token.Token{Type: token.WHITESPACE, Literal: s.readWhitespace()}
+	} else {
+		tok = s.scanToken()
+	}
+	tok.Position = position
 
+	return tok
+}
+
+func (s *TableDrivenScanner) scanToken() token.Token {
 	if s.position >= len(s.input) {
 		return token.Token{Type: token.EOF, Literal: ""}
 	}
 
+	if s.ch == '/' && s.readPosition < len(s.input) && s.input[s.readPosition] == '/' {
+		return token.Token{Type: token.COMMENT, Literal: s.readComment()}
+	}
+
+	// strings and the braces around interpolations are scanned by hand, as
+	// the dfa cannot keep track of the nesting of interpolations
+	switch n := len(s.interpolations); {
+	case s.ch == '"':
+		return s.readStringPart(token.STRING_HEAD, token.STRING)
+	case s.ch == '{' && n != 0:
+		s.interpolations[n-1]++
+	case s.ch == '}' && n != 0:
+		if s.interpolations[n-1] == 0 {
+			s.interpolations = s.interpolations[:n-1]
+			return s.readStringPart(token.STRING_MIDDLE, token.STRING_TAIL)
+		}
+		s.interpolations[n-1]--
+	}
+
 	state := s.dfa.InitialState
 	lexeme := ""
 	stack := []int{}
@@ -61,6 +112,48 @@ func (s *TableDrivenScanner) NextToken() token.Token {
 	return token.Token{Type: token.ILLEGAL, Literal: lexeme}
 }
 
+// readStringPart reads the text following a quote or the closing brace of
+// an interpolation. The part is of type closed if it ends the string, or
+// of type open if it is followed by ${, which starts an interpolation.
+func (s *TableDrivenScanner) readStringPart(open token.TokenType, closed token.TokenType) token.Token {
+	s.readChar()
+	text, end := scanStringPart(s.input, s.position)
+	for s.position < end {
+		s.readChar()
+	}
+	tok := token.Token{Type: closed, Literal: text}
+
+	if s.ch == '$' {
+		s.readChar()
+		s.interpolations = append(s.interpolations, 0)
+		tok.Type = open
+	}
+	s.readChar()
+
+	return tok
+}
+
+func (s *TableDrivenScanner) readComment() string {
+	position := s.position
+	for s.position < len(s.input) && s.ch != '\n' {
+		s.readChar()
+	}
+	return s.input[position:s.position]
+}
+
+// positionAt converts an offset into a position. Tokens are requested in
+// source order, so lines only need to be counted once.
+func (s *TableDrivenScanner) positionAt(offset int) token.Position {
+	for s.lineScanned < offset && s.lineScanned < len(s.input) {
+		if s.input[s.lineScanned] == '\n' {
+			s.line++
+			s.lineStart = s.lineScanned + 1
+		}
+		s.lineScanned++
+	}
+	return token.Position{Offset: offset, Line: s.line, Column: offset - s.lineStart + 1}
+}
+
 func (s *TableDrivenScanner) isAcceptingState(state int) bool {
 	return slices.Contains(s.dfa.AcceptingStates, state)
 }
@@ -87,7 +180,16 @@ func (s *TableDrivenScanner) rollback() {
 }
 
 func (s *TableDrivenScanner) skipWhitespace() {
-	for s.ch == ' ' || s.ch == '\r' || s.ch == '\n' || s.ch == '\t' {
+	s.readWhitespace()
+}
+
+func (s *TableDrivenScanner) readWhitespace() string {
+	position := s.position
+	for s.position < len(s.input) && isWhitespace(s.ch) {
 		s.readChar()
 	}
+	if position == s.position {
+		return ""
+	}
+	return s.input[position:s.position]
 }
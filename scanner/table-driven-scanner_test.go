@@ -233,8 +233,104 @@ func testNextChar(t *testing.T, input string, dfa *Dfa, expectedToken token.Toke
 
 	scanner := NewTableDrivenScanner(input, dfa)
 	token := scanner.NextToken()
-	if token != expectedToken {
+	if token.Type != expectedToken.Type || token.Literal != expectedToken.Literal {
 		t.Logf("current input: %s", input)
 		t.Errorf("expected: %v, got: %v", expectedToken, token)
 	}
 }
+
+func TestPositions(t *testing.T) {
+	scannerGenerator := NewScannerGenerator()
+	dfa := scannerGenerator.GenerateScanner(token.TokenClassifications)
+
+	input := `let x = 5; // five
+  x`
+
+	expected := []token.Token{
+		{Type: token.LET, Literal: "let", Position: token.Position{Offset: 0, Line: 1, Column: 1}},
+		{Type: token.IDENT, Literal: "x", Position: token.Position{Offset: 4, Line: 1, Column: 5}},
+		{Type: token.ASSIGN, Literal: "=", Position: token.Position{Offset: 6, Line: 1, Column: 7}},
+		{Type: token.INT, Literal: "5", Position: token.Position{Offset: 8, Line: 1, Column: 9}},
+		{Type: token.SEMICOLON, Literal: ";", Position: token.Position{Offset: 9, Line: 1, Column: 10}},
+		{Type: token.COMMENT, Literal: "// five", Position: token.Position{Offset: 11, Line: 1, Column: 12}},
+		{Type: token.IDENT, Literal: "x", Position: token.Position{Offset: 21, Line: 2, Column: 3}},
+		{Type: token.EOF, Literal: "", Position: token.Position{Offset: 22, Line: 2, Column: 4}},
+	}
+
+	s := NewTableDrivenScanner(input, dfa)
+	for i, expectedToken := range expected {
+		tok := s.NextToken()
+		if tok != expectedToken {
+			t.Fatalf("tests[%d] - expected: %v, got: %v", i, expectedToken, tok)
+		}
+	}
+}
+
+func TestTableDrivenTrivia(t *testing.T) {
+	scannerGenerator := NewScannerGenerator()
+	dfa := scannerGenerator.GenerateScanner(token.TokenClassifications)
+
+	input := " x = 5; // five\n\t"
+
+	expected := []token.Token{
+		{Type: token.WHITESPACE, Literal: " ", Position: token.Position{Offset: 0, Line: 1, Column: 1}},
+		{Type: token.IDENT, Literal: "x", Position: token.Position{Offset: 1, Line: 1, Column: 2}},
+		{Type: token.WHITESPACE, Literal: " ", Position: token.Position{Offset: 2, Line: 1, Column: 3}},
+		{Type: token.ASSIGN, Literal: "=", Position: token.Position{Offset: 3, Line: 1, Column: 4}},
+		{Type: token.WHITESPACE, Literal: " ", Position: token.Position{Offset: 4, Line: 1, Column: 5}},
+		{Type: token.INT, Literal: "5", Position: token.Position{Offset: 5, Line: 1, Column: 6}},
+		{Type: token.SEMICOLON, Literal: ";", Position: token.Position{Offset: 6, Line: 1, Column: 7}},
+		{Type: token.WHITESPACE, Literal: " ", Position: token.Position{Offset: 7, Line: 1, Column: 8}},
+		{Type: token.COMMENT, Literal: "// five", Position: token.Position{Offset: 8, Line: 1, Column: 9}},
+		{Type: token.WHITESPACE, Literal: "\n\t", Position: token.Position{Offset: 15, Line: 1, Column: 16}},
+		{Type: token.EOF, Literal: "", Position: token.Position{Offset: 17, Line: 2, Column: 2}},
+	}
+
+	s := NewTableDrivenScanner(input, dfa)
+	s.EmitTrivia()
+	for i, expectedToken := range expected {
+		tok := s.NextToken()
+		if tok != expectedToken {
+			t.Fatalf("tests[%d] - expected: %v, got: %v", i, expectedToken, tok)
+		}
+	}
+}
+
+func TestTableDrivenInterpolatedStrings(t *testing.T) {
+	scannerGenerator := NewScannerGenerator()
+	dfa := scannerGenerator.GenerateScanner(token.TokenClassifications)
+
+	input := `"x${a}y" "${ {"k": "}"}["k"] }${"x${y}"}" "\${a} ${b}"`
+
+	expected := []token.Token{
+		{Type: token.STRING_HEAD, Literal: "x", Position: token.Position{Offset: 0, Line: 1, Column: 1}},
+		{Type: token.IDENT, Literal: "a", Position: token.Position{Offset: 4, Line: 1, Column: 5}},
+		{Type: token.STRING_TAIL, Literal: "y", Position: token.Position{Offset: 5, Line: 1, Column: 6}},
+		{Type: token.STRING_HEAD, Literal: "", Position: token.Position{Offset: 9, Line: 1, Column: 10}},
+		{Type: token.LBRACE, Literal: "{", Position: token.Position{Offset: 13, Line: 1, Column: 14}},
+		{Type: token.STRING, Literal: "k", Position: token.Position{Offset: 14, Line: 1, Column: 15}},
+		{Type: token.COLON, Literal: ":", Position: token.Position{Offset: 17, Line: 1, Column: 18}},
+		{Type: token.STRING, Literal: "}", Position: token.Position{Offset: 19, Line: 1, Column: 20}},
+		{Type: token.RBRACE, Literal: "}", Position: token.Position{Offset: 22, Line: 1, Column: 23}},
+		{Type: token.LBRACKET, Literal: "[", Position: token.Position{Offset: 23, Line: 1, Column: 24}},
+		{Type: token.STRING, Literal: "k", Position: token.Position{Offset: 24, Line: 1, Column: 25}},
+		{Type: token.RBRACKET, Literal: "]", Position: token.Position{Offset: 27, Line: 1, Column: 28}},
+		{Type: token.STRING_MIDDLE, Literal: "", Position: token.Position{Offset: 29, Line: 1, Column: 30}},
+		{Type: token.STRING_HEAD, Literal: "x", Position: token.Position{Offset: 32, Line: 1, Column: 33}},
+		{Type: token.IDENT, Literal: "y", Position: token.Position{Offset: 36, Line: 1, Column: 37}},
+		{Type: token.STRING_TAIL, Literal: "", Position: token.Position{Offset: 37, Line: 1, Column: 38}},
+		{Type: token.STRING_TAIL, Literal: "", Position: token.Position{Offset: 39, Line: 1, Column: 40}},
+		{Type: token.STRING_HEAD, Literal: "${a} ", Position: token.Position{Offset: 42, Line: 1, Column: 43}},
+		{Type: token.IDENT, Literal: "b", Position: token.Position{Offset: 51, Line: 1, Column: 52}},
+		{Type: token.STRING_TAIL, Literal: "", Position: token.Position{Offset: 52, Line: 1, Column: 53}},
+		{Type: token.EOF, Literal: "", Position: token.Position{Offset: 54, Line: 1, Column: 55}},
+	}
+
+	s := NewTableDrivenScanner(input, dfa)
+	for i, expectedToken := range expected {
+		tok := s.NextToken()
+		if tok != expectedToken {
+			t.Fatalf("tests[%d] - expected: %v, got: %v", i, expectedToken, tok)
+		}
+	}
+}
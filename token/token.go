@@ -1,10 +1,32 @@
 package token
 
+import "fmt"
+
 type TokenType string
 
 type Token struct {
-	Type    TokenType
-	Literal string
+	Type     TokenType
+	Literal  string
+	Position Position
+}
+
+// Position describes where a token starts in the source. Offset is zero
+// based, Line and Column start at 1. The zero value marks an unknown position.
+type Position struct {
+	Offset int
+	Line   int
+	Column int
+}
+
+func (pos Position) IsValid() bool {
+	return pos.Line > 0
+}
+
+func (pos Position) String() string {
+	if !pos.IsValid() {
+		return "-"
+	}
+	return fmt.Sprintf("%d:%d", pos.Line, pos.Column)
 }
 
 const (
@@ -13,6 +35,17 @@ const (
 	IDENT   = "IDENT"
 	INT     = "INT"
 	STRING  = "STRING"
+	COMMENT = "COMMENT"
+
+	// WHITESPACE is only returned by scanners that emit trivia.
+	WHITESPACE = "WHITESPACE"
+
+	// A string with interpolations like "a${b}c${d}e" is scanned as
+	// STRING_HEAD "a", the tokens of b, STRING_MIDDLE "c", the tokens of d
+	// and STRING_TAIL "e".
+	STRING_HEAD   = "STRING_HEAD"
+	STRING_MIDDLE = "STRING_MIDDLE"
+	STRING_TAIL   = "STRING_TAIL"
 
 	ASSIGN = "="
 	BANG   = "!"
@@ -27,6 +60,12 @@ const (
 	COMMA     = ","
 	SEMICOLON = ";"
 	COLON     = ":"
+	ARROW     = "=>"
+	ELLIPSIS  = "..."
+	DOT       = "."
+
+	QUESTION_DOT = "?."
+	COALESCE     = "??"
 
 	LPAREN   = "("
 	RPAREN   = ")"
@@ -37,6 +76,7 @@ const (
 
 	FUNCTION = "FUNCTION"
 	LET      = "LET"
+	CONST    = "CONST"
 
 	EQUALS        = "=="
 	NOT_EQUALS    = "!="
@@ -44,14 +84,22 @@ const (
 	GREATER_EQUAL = ">="
 	AND           = "&&"
 	OR            = "||"
+	PIPE          = "|>"
 
 	IF   = "if"
 	ELSE = "else"
 
 	RETURN = "return"
 
+	MATCH = "match"
+	MACRO = "macro"
+
+	INFIXL = "infixl"
+	INFIXR = "infixr"
+
 	TRUE  = "true"
 	FALSE = "false"
+	NULL  = "null"
 )
 
 func LookupIdentifier(identifier string) TokenType {
@@ -64,11 +112,17 @@ func LookupIdentifier(identifier string) TokenType {
 var keywords = map[string]TokenType{
 	"fn":     FUNCTION,
 	"let":    LET,
+	"const":  CONST,
 	"if":     IF,
 	"else":   ELSE,
 	"return": RETURN,
 	"true":   TRUE,
 	"false":  FALSE,
+	"match":  MATCH,
+	"macro":  MACRO,
+	"infixl": INFIXL,
+	"infixr": INFIXR,
+	"null":   NULL,
 }
 
 type TokenClassification struct {
@@ -99,14 +153,27 @@ var TokenClassifications = []TokenClassification{
 	{"!=", NOT_EQUALS, 1},
 	{"&&", AND, 1},
 	{"\\|\\|", OR, 1},
+	{"\\|>", PIPE, 1},
+	{"=>", ARROW, 1},
+	{"...", ELLIPSIS, 1},
+	{".", DOT, 1},
+	{"?.", QUESTION_DOT, 1},
+	{"??", COALESCE, 1},
 	{"/", SLASH, 1},
 	{"let", LET, 2},
+	{"const", CONST, 2},
 	{"return", RETURN, 2},
 	{"fn", FUNCTION, 2},
 	{"if", IF, 2},
 	{"else", ELSE, 2},
 	{"true", TRUE, 2},
 	{"false", FALSE, 2},
+	{"match", MATCH, 2},
+	{"macro", MACRO, 2},
+	{"infixl", INFIXL, 2},
+	{"infixr", INFIXR, 2},
+	{"null", NULL, 2},
+	{"_", IDENT, 1},
 	{"[a-z]([a-z]|[A-Z])*", IDENT, 1},
 	{"[0-9]([0-9])*", INT, 1},
 	{`"([a-z]|[A-Z]|[0-9]| )*"`, STRING, 1},
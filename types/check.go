@@ -0,0 +1,634 @@
+package types
+
+import (
+	"compiler/ast"
+	"compiler/token"
+	"fmt"
+)
+
+// builtins holds the types of the builtin functions of object.Builtins.
+var builtins = map[string]Type{
+	"push":    &Function{Parameters: []Type{&Array{Element: Any}, Any}, Return: &Array{Element: Any}},
+	"len":     &Function{Parameters: []Type{Any}, Return: Int},
+	"isEmpty": &Function{Parameters: []Type{Any}, Return: Bool},
+	"keys":    &Function{Parameters: []Type{anyMap}, Return: &Array{Element: Any}},
+	"values":  &Function{Parameters: []Type{anyMap}, Return: &Array{Element: Any}},
+	"entries": &Function{Parameters: []Type{anyMap}, Return: &Array{Element: &Array{Element: Any}}},
+	"has":     &Function{Parameters: []Type{anyMap, Any}, Return: Bool},
+	"set":     &Function{Parameters: []Type{anyMap, Any, Any}, Return: anyMap},
+	"delete":  &Function{Parameters: []Type{anyMap, Any}, Return: anyMap},
+	"merge":   &Function{Parameters: []Type{anyMap, anyMap}, Return: anyMap},
+}
+
+var anyMap = &Map{Key: Any, Value: Any}
+
+type scope struct {
+	names map[string]Type
+	outer *scope
+}
+
+func (s *scope) define(name string, typ Type) {
+	s.names[name] = typ
+}
+
+func (s *scope) lookup(name string) (Type, bool) {
+	for ; s != nil; s = s.outer {
+		if typ, ok := s.names[name]; ok {
+			return typ, true
+		}
+	}
+	return nil, false
+}
+
+type checker struct {
+	scope *scope
+	// returns holds the return types of the enclosing functions.
+	returns []Type
+	errors  []*Error
+}
+
+// Check checks the program for type errors. Names the checker knows
+// nothing about, like undefined ones, are dynamically typed.
+func Check(program *ast.Program) []*Error {
+	universe := &scope{names: make(map[string]Type, len(builtins))}
+	for name, typ := range builtins {
+		universe.define(name, typ)
+	}
+
+	c := &checker{scope: &scope{names: make(map[string]Type), outer: universe}}
+	for _, stmt := range program.Statements {
+		c.statement(stmt)
+	}
+	return c.errors
+}
+
+func (c *checker) errorf(position token.Position, format string, a ...interface{}) {
+	c.errors = append(c.errors, &Error{Position: position, Message: fmt.Sprintf(format, a...)})
+}
+
+func (c *checker) openScope() {
+	c.scope = &scope{names: make(map[string]Type), outer: c.scope}
+}
+
+func (c *checker) closeScope() {
+	c.scope = c.scope.outer
+}
+
+// statement checks a statement and returns the type of the value it
+// leaves as the result of a block.
+func (c *checker) statement(stmt ast.Statement) Type {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		c.declare(stmt.Name, stmt.Type, stmt.Value)
+	case *ast.ConstStatement:
+		c.declare(stmt.Name, stmt.Type, stmt.Value)
+	case *ast.InfixDeclaration:
+		c.scope.define(stmt.Operator.Literal, c.expression(stmt.Value))
+	case *ast.DestructuringLetStatement:
+		c.bindPattern(stmt.Pattern, c.expression(stmt.Value))
+	case *ast.ReturnStatement:
+		var typ Type = Null
+		if stmt.ReturnValue != nil {
+			typ = c.expression(stmt.ReturnValue)
+		}
+		if len(c.returns) != 0 {
+			expected := c.returns[len(c.returns)-1]
+			if !AssignableTo(typ, expected) {
+				c.errorf(stmt.Token.Position, "cannot return %s from function returning %s", typ, expected)
+			}
+		}
+		// the block is left before it results in a value
+		return Any
+	case *ast.ExpressionStatement:
+		return c.expression(stmt.Expression)
+	case *ast.BlockStatement:
+		return c.block(stmt)
+	}
+	return Null
+}
+
+// declare checks the value of a let or const statement against its
+// annotation and binds the name to the annotated type or, without an
+// annotation, to the type of the value.
+func (c *checker) declare(name *ast.Identifier, annotation ast.Type, value ast.Expression) {
+	var declared Type
+	if annotation != nil {
+		declared = c.resolve(annotation)
+	}
+
+	var typ Type
+	if fn, ok := value.(*ast.FunctionLiteral); ok {
+		// the function can call itself by the declared name
+		signature := c.signature(fn)
+		if declared != nil {
+			c.scope.define(name.Value, declared)
+		} else {
+			c.scope.define(name.Value, signature)
+		}
+		c.functionBody(fn, signature)
+		typ = signature
+	} else {
+		typ = c.expression(value)
+	}
+
+	if declared != nil {
+		if !AssignableTo(typ, declared) {
+			c.errorf(position(value), "cannot use %s as %s in declaration of %s", typ, declared, name.Value)
+		}
+		typ = declared
+	}
+	c.scope.define(name.Value, typ)
+}
+
+// block checks the statements of a block and returns the type of its
+// value, which is the value of its last statement.
+func (c *checker) block(block *ast.BlockStatement) Type {
+	if block == nil {
+		return Null
+	}
+
+	var typ Type = Null
+	for _, stmt := range block.Statements {
+		typ = c.statement(stmt)
+	}
+	return typ
+}
+
+func (c *checker) expression(expr ast.Expression) Type {
+	switch expr := expr.(type) {
+	case *ast.Identifier:
+		if typ, ok := c.scope.lookup(expr.Value); ok {
+			return typ
+		}
+		return Any
+	case *ast.IntegerLiteral:
+		return Int
+	case *ast.BooleanLiteral:
+		return Bool
+	case *ast.StringLiteral:
+		return String
+	case *ast.NullLiteral:
+		return Null
+	case *ast.InterpolatedString:
+		for _, e := range expr.Expressions {
+			c.expression(e)
+		}
+		return String
+	case *ast.PrefixExpression:
+		return c.prefix(expr)
+	case *ast.InfixExpression:
+		return c.infix(expr)
+	case *ast.IfExpression:
+		c.expression(expr.Condition)
+		return join(c.block(expr.Consequence), c.block(expr.Alternative))
+	case *ast.FunctionLiteral:
+		signature := c.signature(expr)
+		c.functionBody(expr, signature)
+		return signature
+	case *ast.MacroLiteral:
+		// macro bodies are quoted code
+		return Any
+	case *ast.LambdaLiteral:
+		c.openScope()
+		c.scope.define(expr.Parameter.Value, Any)
+		c.returns = append(c.returns, Any)
+		c.expression(expr.Body)
+		c.returns = c.returns[:len(c.returns)-1]
+		c.closeScope()
+		return &Function{Parameters: []Type{Any}, Return: Any}
+	case *ast.PipeExpression:
+		return c.call(expr.Call())
+	case *ast.CallExpression:
+		return c.call(expr)
+	case *ast.SpreadExpression:
+		typ := c.expression(expr.Value)
+		if arr, ok := typ.(*Array); ok {
+			return arr.Element
+		}
+		if typ != Any {
+			c.errorf(expr.Token.Position, "cannot spread %s", typ)
+		}
+		return Any
+	case *ast.ArrayLiteral:
+		var element Type = Any
+		for i, e := range expr.Elements {
+			if typ := c.expression(e); i == 0 {
+				element = typ
+			} else {
+				element = join(element, typ)
+			}
+		}
+		return &Array{Element: element}
+	case *ast.MapLiteral:
+		var key, value Type = Any, Any
+		for i, k := range expr.OrderedKeys() {
+			keyType, valueType := c.expression(k), c.expression(expr.Entries[k])
+			if !hashable(keyType) {
+				c.errorf(position(k), "cannot use %s as map key", keyType)
+			}
+			if i == 0 {
+				key, value = keyType, valueType
+			} else {
+				key, value = join(key, keyType), join(value, valueType)
+			}
+		}
+		return &Map{Key: key, Value: value, literal: true}
+	case *ast.IndexExpression:
+		return c.index(expr)
+	case *ast.PropertyExpression:
+		return c.property(expr)
+	case *ast.MatchExpression:
+		return c.match(expr)
+	default:
+		return Any
+	}
+}
+
+func (c *checker) prefix(expr *ast.PrefixExpression) Type {
+	right := c.expression(expr.Right)
+
+	switch expr.Operator {
+	case token.MINUS:
+		if AssignableTo(right, Int) {
+			return Int
+		}
+	case token.BANG:
+		if AssignableTo(right, Bool) {
+			return Bool
+		}
+	default:
+		return Any
+	}
+
+	c.errorf(expr.Token.Position, "operator %s not defined for %s", expr.Operator, right)
+	return Any
+}
+
+func (c *checker) infix(expr *ast.InfixExpression) Type {
+	if _, ok := c.scope.lookup(string(expr.Operator)); ok {
+		return c.call(expr.Call())
+	}
+
+	left, right := c.expression(expr.Left), c.expression(expr.Right)
+
+	switch expr.Operator {
+	case token.COALESCE:
+		if left == Null {
+			return right
+		}
+		return join(left, right)
+	case token.PLUS:
+		for _, typ := range []Type{Int, String} {
+			if AssignableTo(left, typ) && AssignableTo(right, typ) {
+				if left == Any && right == Any {
+					return Any
+				}
+				return typ
+			}
+		}
+	case token.MINUS, token.ASTERIK, token.SLASH:
+		if AssignableTo(left, Int) && AssignableTo(right, Int) {
+			return Int
+		}
+	case token.LT, token.GT, token.LESS_EQUAL, token.GREATER_EQUAL:
+		if AssignableTo(left, Int) && AssignableTo(right, Int) {
+			return Bool
+		}
+	case token.EQUALS, token.NOT_EQUALS:
+		if comparable(left, right) {
+			return Bool
+		}
+	case token.AND, token.OR:
+		if AssignableTo(left, Bool) && AssignableTo(right, Bool) {
+			return Bool
+		}
+	default:
+		return Any
+	}
+
+	c.errorf(expr.Token.Position, "operator %s not defined for %s and %s", expr.Operator, left, right)
+	return Any
+}
+
+// comparable reports whether values of the types can be compared for
+// equality. Null can be compared with every value.
+func comparable(left Type, right Type) bool {
+	if left == Any || right == Any || left == Null || right == Null {
+		return true
+	}
+	return Identical(left, right) && (left == Int || left == String || left == Bool)
+}
+
+// hashable reports whether values of the type can be used as map keys.
+func hashable(typ Type) bool {
+	return typ == Any || typ == Int || typ == String || typ == Bool
+}
+
+func (c *checker) call(call *ast.CallExpression) Type {
+	callee := c.expression(call.Left)
+
+	args := make([]Type, len(call.Arguments))
+	spread := false
+	for i, arg := range call.Arguments {
+		if _, ok := arg.(*ast.SpreadExpression); ok {
+			spread = true
+		}
+		args[i] = c.expression(arg)
+	}
+
+	fn, ok := callee.(*Function)
+	if !ok {
+		if callee != Any {
+			c.errorf(position(call.Left), "cannot call %s", callee)
+		}
+		return Any
+	}
+
+	// the number of spread arguments is only known at runtime
+	if !spread && (len(args) < len(fn.Parameters)-fn.Optional || len(args) > len(fn.Parameters) && fn.Rest == nil) {
+		c.errorf(call.Token.Position, "%s", wrongNumberOfArguments(fn, len(args)))
+	}
+
+	for i, arg := range call.Arguments {
+		if _, ok := arg.(*ast.SpreadExpression); ok {
+			break
+		}
+
+		param := fn.Rest
+		if i < len(fn.Parameters) {
+			param = fn.Parameters[i]
+		}
+		if param == nil {
+			break
+		}
+		if !AssignableTo(args[i], param) {
+			c.errorf(position(arg), "cannot use %s as %s in argument %d", args[i], param, i+1)
+		}
+	}
+
+	return fn.Return
+}
+
+// wrongNumberOfArguments describes a call of fn with numArgs arguments like
+// the vm does.
+func wrongNumberOfArguments(fn *Function, numArgs int) string {
+	required := len(fn.Parameters) - fn.Optional
+
+	switch {
+	case numArgs < required && (fn.Optional > 0 || fn.Rest != nil):
+		return fmt.Sprintf("wrong number of arguments: expected at least %d, got %d", required, numArgs)
+	case numArgs > len(fn.Parameters) && fn.Optional > 0:
+		return fmt.Sprintf("wrong number of arguments: expected at most %d, got %d", len(fn.Parameters), numArgs)
+	default:
+		return fmt.Sprintf("wrong number of arguments: expected %d, got %d", len(fn.Parameters), numArgs)
+	}
+}
+
+func (c *checker) index(expr *ast.IndexExpression) Type {
+	left, index := c.expression(expr.Left), c.expression(expr.Index)
+
+	switch left := left.(type) {
+	case *Array:
+		if !AssignableTo(index, Int) {
+			c.errorf(position(expr.Index), "cannot use %s as array index", index)
+		}
+		return left.Element
+	case *Map:
+		// unannotated code is dynamically typed, looking up a missing
+		// key just results in null
+		if !left.literal && !AssignableTo(index, left.Key) {
+			c.errorf(position(expr.Index), "cannot use %s as key of %s", index, left)
+		}
+		return left.Value
+	}
+
+	if left == Any || expr.Optional && left == Null {
+		return Any
+	}
+	c.errorf(expr.Token.Position, "cannot index %s", left)
+	return Any
+}
+
+func (c *checker) property(expr *ast.PropertyExpression) Type {
+	left := c.expression(expr.Left)
+
+	if m, ok := left.(*Map); ok {
+		if !m.literal && !AssignableTo(String, m.Key) {
+			c.errorf(expr.Property.Token.Position, "cannot use string as key of %s", m)
+		}
+		return m.Value
+	}
+
+	if left == Any || expr.Optional && left == Null {
+		return Any
+	}
+	c.errorf(expr.Property.Token.Position, "cannot access property %s of %s", expr.Property.Value, left)
+	return Any
+}
+
+// match joins the types of the arms. Unless the last arm matches every
+// value, the expression may also result in null.
+func (c *checker) match(match *ast.MatchExpression) Type {
+	subject := c.expression(match.Subject)
+
+	var typ Type
+	for i, arm := range match.Arms {
+		c.openScope()
+		c.bindPattern(arm.Pattern, subject)
+		if arm.Guard != nil {
+			c.expression(arm.Guard)
+		}
+		body := c.expression(arm.Body)
+		c.closeScope()
+
+		if i == 0 {
+			typ = body
+		} else {
+			typ = join(typ, body)
+		}
+	}
+
+	if len(match.Arms) == 0 {
+		return Null
+	}
+	last := match.Arms[len(match.Arms)-1]
+	switch last.Pattern.(type) {
+	case *ast.WildcardPattern, *ast.BindingPattern:
+		if last.Guard == nil {
+			return typ
+		}
+	}
+	return join(typ, Null)
+}
+
+// bindPattern binds the names of a pattern matched against a value of the
+// given type.
+func (c *checker) bindPattern(pattern ast.Pattern, typ Type) {
+	switch pattern := pattern.(type) {
+	case *ast.BindingPattern:
+		c.scope.define(pattern.Name.Value, typ)
+	case *ast.ArrayPattern:
+		var element Type = Any
+		if arr, ok := typ.(*Array); ok {
+			element = arr.Element
+		}
+		for _, e := range pattern.Elements {
+			c.bindPattern(e, element)
+		}
+		if pattern.Rest != nil {
+			c.scope.define(pattern.Rest.Value, &Array{Element: element})
+		}
+	case *ast.MapPattern:
+		var value Type = Any
+		if m, ok := typ.(*Map); ok {
+			value = m.Value
+		}
+		for _, entry := range pattern.Entries {
+			c.bindPattern(entry.Value, value)
+		}
+	}
+}
+
+// signature returns the type of a function literal from its annotations.
+func (c *checker) signature(fn *ast.FunctionLiteral) *Function {
+	signature := &Function{
+		Parameters: make([]Type, len(fn.Parameters)),
+		Return:     c.resolve(fn.ReturnType),
+	}
+	if fn.Rest != nil {
+		signature.Rest = c.restElement(fn)
+	}
+	for i := range fn.Parameters {
+		signature.Parameters[i] = c.resolve(fn.ParameterType(i))
+		if fn.Default(i) != nil {
+			signature.Optional++
+		}
+	}
+	return signature
+}
+
+// restElement returns the element type of the rest parameter of fn, any
+// unless annotated.
+func (c *checker) restElement(fn *ast.FunctionLiteral) Type {
+	if fn.RestType == nil {
+		return Any
+	}
+
+	typ := c.resolve(fn.RestType)
+	arr, ok := typ.(*Array)
+	if !ok {
+		c.errorf(fn.Rest.Token.Position, "cannot use %s as type of rest parameter %s", typ, fn.Rest.Value)
+		return Any
+	}
+	return arr.Element
+}
+
+func (c *checker) functionBody(fn *ast.FunctionLiteral, signature *Function) {
+	c.openScope()
+	defer c.closeScope()
+
+	for i, param := range fn.Parameters {
+		// defaults are evaluated when called and see the parameters
+		// in front of them
+		if def := fn.Default(i); def != nil {
+			if typ := c.expression(def); !AssignableTo(typ, signature.Parameters[i]) {
+				c.errorf(position(def), "cannot use %s as %s in default value of %s", typ, signature.Parameters[i], param.Value)
+			}
+		}
+		c.scope.define(param.Value, signature.Parameters[i])
+	}
+	if fn.Rest != nil {
+		c.scope.define(fn.Rest.Value, &Array{Element: signature.Rest})
+	}
+
+	c.returns = append(c.returns, signature.Return)
+	result := c.block(fn.Body)
+	c.returns = c.returns[:len(c.returns)-1]
+
+	if !AssignableTo(result, signature.Return) {
+		pos := fn.Body.Token.Position
+		if n := len(fn.Body.Statements); n != 0 {
+			if stmt, ok := fn.Body.Statements[n-1].(*ast.ExpressionStatement); ok {
+				pos = position(stmt.Expression)
+			}
+		}
+		c.errorf(pos, "cannot return %s from function returning %s", result, signature.Return)
+	}
+}
+
+// resolve returns the type an annotation refers to. Missing annotations
+// refer to any.
+func (c *checker) resolve(annotation ast.Type) Type {
+	switch annotation := annotation.(type) {
+	case *ast.NamedType:
+		if basic, ok := basics[annotation.Name]; ok {
+			return basic
+		}
+		c.errorf(annotation.Token.Position, "unknown type %s", annotation.Name)
+		return Any
+	case *ast.ArrayType:
+		return &Array{Element: c.resolve(annotation.Element)}
+	case *ast.MapType:
+		key := c.resolve(annotation.Key)
+		if !hashable(key) {
+			c.errorf(annotation.Token.Position, "cannot use %s as map key", key)
+		}
+		return &Map{Key: key, Value: c.resolve(annotation.Value)}
+	case *ast.FunctionType:
+		fn := &Function{Parameters: make([]Type, len(annotation.Parameters)), Return: c.resolve(annotation.Return)}
+		for i, param := range annotation.Parameters {
+			fn.Parameters[i] = c.resolve(param)
+		}
+		return fn
+	default:
+		return Any
+	}
+}
+
+// position returns the position of the first token of an expression.
+func position(expr ast.Expression) token.Position {
+	switch expr := expr.(type) {
+	case *ast.Identifier:
+		return expr.Token.Position
+	case *ast.IntegerLiteral:
+		return expr.Token.Position
+	case *ast.BooleanLiteral:
+		return expr.Token.Position
+	case *ast.StringLiteral:
+		return expr.Token.Position
+	case *ast.InterpolatedString:
+		return expr.Token.Position
+	case *ast.NullLiteral:
+		return expr.Token.Position
+	case *ast.PrefixExpression:
+		return expr.Token.Position
+	case *ast.InfixExpression:
+		return position(expr.Left)
+	case *ast.IfExpression:
+		return expr.Token.Position
+	case *ast.FunctionLiteral:
+		return expr.Token.Position
+	case *ast.MacroLiteral:
+		return expr.Token.Position
+	case *ast.LambdaLiteral:
+		return expr.Parameter.Token.Position
+	case *ast.PipeExpression:
+		return position(expr.Left)
+	case *ast.CallExpression:
+		return position(expr.Left)
+	case *ast.SpreadExpression:
+		return expr.Token.Position
+	case *ast.ArrayLiteral:
+		return expr.Token.Position
+	case *ast.IndexExpression:
+		return position(expr.Left)
+	case *ast.PropertyExpression:
+		return position(expr.Left)
+	case *ast.MapLiteral:
+		return expr.Token.Position
+	case *ast.MatchExpression:
+		return expr.Token.Position
+	default:
+		return token.Position{}
+	}
+}
@@ -0,0 +1,157 @@
+package types
+
+import (
+	"compiler/parser"
+	"compiler/scanner"
+	"strings"
+	"testing"
+)
+
+func check(t *testing.T, input string) []*Error {
+	t.Helper()
+
+	p := parser.New(scanner.NewHandcodedScanner(input))
+	program := p.ParseProgram()
+	if len(p.Errors) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors)
+	}
+
+	return Check(program)
+}
+
+func TestWellTypedPrograms(t *testing.T) {
+	inputs := []string{
+		`let x: int = 1; x + 2`,
+		`let greet = fn(name: string): string { "Hello " + name }; greet("you")`,
+		`let f = fn(a, b) { a + b }; f(1, "untyped")`,
+		`let x = input(); let y: int = x; y * 2`,
+		`let xs: [int] = [1, 2, 3]; xs[0] - 1`,
+		`let xs: [int] = []; let m: {string: int} = {}; m["a"] + len(xs)`,
+		`let person = {"name": "someone"}; person.name + "!"`,
+		`let fib = fn(n: int): int { if (n < 2) { return n } fib(n - 1) + fib(n - 2) }; fib(10)`,
+		`let apply = fn(f: fn(int): int, x: int): int { f(x) }; apply(fn(x: int): int { x + 1 }, 1)`,
+		`let apply = fn(f: fn(int): int, x: int): int { f(x) }; apply(x => x * 2, 1)`,
+		`let f = fn(a: int, b: int = a, ...rest): int { a + b }; f(1); f(1, 2, 3, 4)`,
+		`let x: any = "dynamic"; let y: int = x;`,
+		`let s: string = match (1) { 0 => "zero", _ => "other" };`,
+		`let xs: [int] = [1, "mixed"]; let x: int = match (1) { 0 => 1 };`,
+		`let x: int = null ?? 1; let y = [1] ?? null;`,
+		`1 == null; "a" != "b"; true && !false`,
+		`infixl 6 <+> = fn(a: string, b: string): string { a + b }; "a" <+> "b"`,
+		`let [a, ...rest] = [1, 2]; let y: int = a; let zs: [int] = rest;`,
+		`let m = {1: "a"}; m["k"]; m.name; [{true: 1}][0][2]`,
+		`let sum = fn(...xs: [int]): int { len(xs) + xs[0] }; sum(1, 2); sum(...[3])`,
+		`let f: fn(int): any = fn(x: any): int { 1 };`,
+		`let n: int = len("abc"); let xs: [int] = push([1], 2);`,
+		`let m: {string: int} = {"a": 1}; let ks: [any] = keys(set(m, "b", 2)); let h: bool = has(m, "a");`,
+	}
+
+	for _, input := range inputs {
+		if errors := check(t, input); len(errors) != 0 {
+			t.Errorf("unexpected errors for %q: %v", input, errors)
+		}
+	}
+}
+
+func TestTypeErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let x: int = "one";`, `1:14: cannot use string as int in declaration of x`},
+		{`let x = 1;` + "\n" + `x + "a"`, `2:3: operator + not defined for int and string`},
+		{`-"a"`, `1:1: operator - not defined for string`},
+		{`!1`, `1:1: operator ! not defined for int`},
+		{`[1] == [1]`, `1:5: operator == not defined for [int] and [int]`},
+		{`1 < "a"`, `1:3: operator < not defined for int and string`},
+		{`let f = fn(a: int) { a }; f("a")`, `1:29: cannot use string as int in argument 1`},
+		{`let f = fn(a: int) { a }; f()`, `1:28: wrong number of arguments: expected 1, got 0`},
+		{`let f = fn(a, b = 1) { a }; f(1, 2, 3)`, `1:30: wrong number of arguments: expected at most 2, got 3`},
+		{`let f = fn(a, b, ...c) { a }; f(1)`, `1:32: wrong number of arguments: expected at least 2, got 1`},
+		{`let f = fn(...c: [int]) { c }; f(1, "a")`, `1:37: cannot use string as int in argument 2`},
+		{`fn(...c: int) { c }`, `1:7: cannot use int as type of rest parameter c`},
+		{`let f = fn(): int { "a" };`, `1:21: cannot return string from function returning int`},
+		{`let f = fn(): int { return true; };`, `1:21: cannot return bool from function returning int`},
+		{`let f = fn(): string { };`, `1:22: cannot return null from function returning string`},
+		{`let f = fn(a: int = "a") { a };`, `1:21: cannot use string as int in default value of a`},
+		{`let x = 1; x(2)`, `1:12: cannot call int`},
+		{`let xs = [1]; xs["a"]`, `1:18: cannot use string as array index`},
+		{`let m: {string: int} = {}; m[1]`, `1:30: cannot use int as key of {string: int}`},
+		{`let m: {int: string} = {1: "a"}; m.name`, `1:36: cannot use string as key of {int: string}`},
+		{`let x = 1; x[0]`, `1:13: cannot index int`},
+		{`let x = "a"; x.length`, `1:16: cannot access property length of string`},
+		{`let x: integer = 1;`, `1:8: unknown type integer`},
+		{`let m: {[int]: int} = {};`, `1:8: cannot use [int] as map key`},
+		{`{[1]: 2}`, `1:2: cannot use [int] as map key`},
+		{`let f: fn(int): int = fn(a: string): int { 1 };`, `1:23: cannot use fn(string): int as fn(int): int in declaration of f`},
+		{`let f: fn(int, int): int = fn(a: int): int { a };`, `1:28: cannot use fn(int): int as fn(int, int): int in declaration of f`},
+		{`let inc = fn(x: int): int { x + 1 }; "a" |> inc`, `1:38: cannot use string as int in argument 1`},
+		{`infixl 6 <+> = fn(a: int, b: int): int { a + b }; 1 <+> "b"`, `1:57: cannot use string as int in argument 2`},
+		{`let f = fn(x: int) { x }; f(...1)`, `1:29: cannot spread int`},
+		{`keys([1])`, `1:6: cannot use [int] as {any: any} in argument 1`},
+	}
+
+	for _, tt := range tests {
+		errors := check(t, tt.input)
+		if len(errors) != 1 {
+			t.Errorf("Expected 1 error for %q. Got %d: %v", tt.input, len(errors), errors)
+			continue
+		}
+
+		if errors[0].Error() != tt.expected {
+			t.Errorf("Expected '%s'. Got '%s'", tt.expected, errors[0].Error())
+		}
+	}
+}
+
+func TestNestedErrors(t *testing.T) {
+	input := `
+let add = fn(a: int, b: int): int { a + b };
+let twice = fn(f: fn(int): int, x: int): int {
+	let y: string = f(x);
+	f(f(x))
+};
+twice(fn(x) { add(x, "1") }, true)
+`
+	expected := []string{
+		`4:18: cannot use int as string in declaration of y`,
+		`7:22: cannot use string as int in argument 2`,
+		`7:30: cannot use bool as int in argument 2`,
+	}
+
+	errors := check(t, input)
+	var messages []string
+	for _, err := range errors {
+		messages = append(messages, err.Error())
+	}
+
+	if strings.Join(messages, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong errors.\nwant=%q\ngot= %q", expected, messages)
+	}
+}
+
+func TestAssignableTo(t *testing.T) {
+	tests := []struct {
+		from     Type
+		to       Type
+		expected bool
+	}{
+		{Int, Int, true},
+		{Int, Any, true},
+		{Any, String, true},
+		{Null, Int, false},
+		{&Array{Element: Any}, &Array{Element: Int}, true},
+		{&Array{Element: String}, &Array{Element: Int}, false},
+		{&Map{Key: String, Value: Int}, &Map{Key: String, Value: Any}, true},
+		{&Function{Parameters: []Type{Any}, Return: Int}, &Function{Parameters: []Type{Int}, Return: Any}, true},
+		{&Function{Parameters: []Type{Int, Int}, Optional: 1, Return: Int}, &Function{Parameters: []Type{Int}, Return: Int}, true},
+		{&Function{Parameters: []Type{Int}, Return: Int}, &Function{Parameters: []Type{Int}, Rest: Any, Return: Int}, false},
+		{&Function{Rest: Any, Return: Int}, &Function{Parameters: []Type{Int, Int}, Return: Int}, true},
+	}
+
+	for _, tt := range tests {
+		if actual := AssignableTo(tt.from, tt.to); actual != tt.expected {
+			t.Errorf("Expected AssignableTo(%s, %s) to be %t. Got %t", tt.from, tt.to, tt.expected, actual)
+		}
+	}
+}
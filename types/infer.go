@@ -0,0 +1,722 @@
+package types
+
+import (
+	"compiler/ast"
+	"compiler/object"
+	"compiler/token"
+	"fmt"
+)
+
+// Info holds the types inferred for a program.
+type Info struct {
+	// types holds the type of every expression and bound name. The types
+	// may refer to variables unified later on, so TypeOf resolves them.
+	types map[ast.Expression]Type
+	// Bindings holds the types of the top-level declarations in order.
+	Bindings []*Binding
+}
+
+// Binding is a name declared by a let, const or infix declaration.
+type Binding struct {
+	Name     string
+	Position token.Position
+	Type     Type
+}
+
+func (binding *Binding) String() string {
+	return binding.Name + ": " + binding.Type.String()
+}
+
+// TypeOf returns the inferred type of an expression or nil if the
+// expression is not part of the program.
+func (info *Info) TypeOf(expr ast.Expression) Type {
+	t, ok := info.types[expr]
+	if !ok {
+		return nil
+	}
+	return normalize(t)
+}
+
+// At returns the identifier at the given offset of the source and its
+// type, e.g. to show the type of a name the cursor hovers over.
+func (info *Info) At(offset int) (*ast.Identifier, Type) {
+	for expr, t := range info.types {
+		ident, ok := expr.(*ast.Identifier)
+		if !ok {
+			continue
+		}
+
+		start := ident.Token.Position.Offset
+		if start <= offset && offset < start+len(ident.Value) {
+			return ident, normalize(t)
+		}
+	}
+	return nil, nil
+}
+
+// Inferrer infers principal types for programs without annotations in the
+// style of Hindley-Milner. Unlike Check, it treats nothing as dynamically
+// typed: every expression must have a single type, so e.g. arrays cannot
+// mix strings and integers. Names bound by let statements are polymorphic.
+//
+// The inferrer keeps the bindings of the programs it has inferred, so a
+// program can use the names of the programs inferred before it.
+type Inferrer struct {
+	scope   *scope
+	level   int
+	next    int
+	returns []Type
+	errors  []*Error
+	info    *Info
+}
+
+func NewInferrer() *Inferrer {
+	in := &Inferrer{scope: &scope{names: make(map[string]Type)}}
+	for _, builtin := range object.Builtins {
+		in.scope.define(builtin.Name, in.builtin(builtin.Name))
+	}
+	in.scope = &scope{names: make(map[string]Type), outer: in.scope}
+	return in
+}
+
+// Infer infers the types of a program in a new inferrer.
+func Infer(program *ast.Program) (*Info, []*Error) {
+	return NewInferrer().Infer(program)
+}
+
+// Infer infers the types of the program and returns them together with the
+// type errors in order of discovery.
+func (in *Inferrer) Infer(program *ast.Program) (*Info, []*Error) {
+	in.info = &Info{types: make(map[ast.Expression]Type)}
+	in.errors = nil
+
+	for _, stmt := range program.Statements {
+		switch stmt := stmt.(type) {
+		case *ast.LetStatement:
+			in.statement(stmt)
+			in.bind(stmt.Name.Value, stmt.Name.Token.Position)
+		case *ast.ConstStatement:
+			in.statement(stmt)
+			in.bind(stmt.Name.Value, stmt.Name.Token.Position)
+		case *ast.InfixDeclaration:
+			in.statement(stmt)
+			in.bind(stmt.Operator.Literal, stmt.Operator.Position)
+		default:
+			in.statement(stmt)
+		}
+	}
+
+	return in.info, in.errors
+}
+
+func (in *Inferrer) bind(name string, position token.Position) {
+	t, _ := in.scope.lookup(name)
+	in.info.Bindings = append(in.info.Bindings, &Binding{Name: name, Position: position, Type: t})
+}
+
+// builtin returns the type of a builtin function. Builtins without a
+// known signature can be called in any way.
+func (in *Inferrer) builtin(name string) Type {
+	in.level++
+
+	a := in.fresh()
+	var t Type
+	switch name {
+	case "push":
+		t = &Function{Parameters: []Type{&Array{Element: a}, a}, Return: &Array{Element: a}}
+	case "len":
+		// len also takes strings, so its argument cannot be restricted
+		t = &Function{Parameters: []Type{a}, Return: Int}
+	case "isEmpty":
+		t = &Function{Parameters: []Type{a}, Return: Bool}
+	case "keys", "values", "entries", "has", "set", "delete", "merge":
+		t = in.mapBuiltin(name, a)
+	default:
+		t = a
+	}
+
+	in.level--
+	return in.generalize(t)
+}
+
+// mapBuiltin returns the type of a builtin taking a map with keys of type
+// key. Pairs have no type of their own, so the elements of entries are
+// left unconstrained.
+func (in *Inferrer) mapBuiltin(name string, key Type) Type {
+	value := in.fresh()
+	m := &Map{Key: key, Value: value}
+
+	switch name {
+	case "keys":
+		return &Function{Parameters: []Type{m}, Return: &Array{Element: key}}
+	case "values":
+		return &Function{Parameters: []Type{m}, Return: &Array{Element: value}}
+	case "entries":
+		return &Function{Parameters: []Type{m}, Return: &Array{Element: &Array{Element: in.fresh()}}}
+	case "has":
+		return &Function{Parameters: []Type{m, key}, Return: Bool}
+	case "set":
+		return &Function{Parameters: []Type{m, key, value}, Return: m}
+	case "delete":
+		return &Function{Parameters: []Type{m, key}, Return: m}
+	default:
+		return &Function{Parameters: []Type{m, m}, Return: m}
+	}
+}
+
+func (in *Inferrer) fresh() *Variable {
+	in.next++
+	return &Variable{ID: in.next, Level: in.level}
+}
+
+func (in *Inferrer) errorf(position token.Position, format string, a ...interface{}) {
+	in.errors = append(in.errors, &Error{Position: position, Message: fmt.Sprintf(format, a...)})
+}
+
+func (in *Inferrer) openScope() {
+	in.scope = &scope{names: make(map[string]Type), outer: in.scope}
+}
+
+func (in *Inferrer) closeScope() {
+	in.scope = in.scope.outer
+}
+
+// generalize turns the variables of t introduced inside the current let
+// into the variables of a scheme.
+func (in *Inferrer) generalize(t Type) Type {
+	var variables []*Variable
+	seen := make(map[*Variable]bool)
+	substitute(t, func(v *Variable) Type {
+		if v.Level > in.level && !seen[v] {
+			seen[v] = true
+			variables = append(variables, v)
+		}
+		return nil
+	})
+
+	if len(variables) == 0 {
+		return t
+	}
+	return &Scheme{Variables: variables, Type: t}
+}
+
+func (in *Inferrer) instantiate(scheme *Scheme) Type {
+	fresh := make(map[*Variable]Type, len(scheme.Variables))
+	for _, v := range scheme.Variables {
+		fresh[v] = in.fresh()
+	}
+	return substitute(scheme.Type, func(v *Variable) Type {
+		return fresh[v]
+	})
+}
+
+// unify makes a and b the same type by binding their variables. It
+// reports whether that is possible.
+func unify(a Type, b Type) bool {
+	a, b = prune(a), prune(b)
+
+	if v, ok := a.(*Variable); ok {
+		if a == b {
+			return true
+		}
+		if occurs(v, b) {
+			return false
+		}
+		v.Instance = b
+		return true
+	}
+	if _, ok := b.(*Variable); ok {
+		return unify(b, a)
+	}
+
+	switch a := a.(type) {
+	case *Array:
+		b, ok := b.(*Array)
+		return ok && unify(a.Element, b.Element)
+	case *Map:
+		b, ok := b.(*Map)
+		return ok && unify(a.Key, b.Key) && unify(a.Value, b.Value)
+	case *Function:
+		b, ok := b.(*Function)
+		if !ok || len(a.Parameters) != len(b.Parameters) || a.Optional != b.Optional || (a.Rest == nil) != (b.Rest == nil) {
+			return false
+		}
+		for i := range a.Parameters {
+			if !unify(a.Parameters[i], b.Parameters[i]) {
+				return false
+			}
+		}
+		if a.Rest != nil && !unify(a.Rest, b.Rest) {
+			return false
+		}
+		return unify(a.Return, b.Return)
+	default:
+		return a == b
+	}
+}
+
+// occurs reports whether v occurs in t, which would make t infinite. The
+// variables of t are lowered to the level of v on the way, since t becomes
+// reachable wherever v is.
+func occurs(v *Variable, t Type) bool {
+	found := false
+	substitute(t, func(u *Variable) Type {
+		if u == v {
+			found = true
+		}
+		if u.Level > v.Level {
+			u.Level = v.Level
+		}
+		return nil
+	})
+	return found
+}
+
+// unify unifies the types and reports a mismatch at the position.
+func (in *Inferrer) unify(position token.Position, expected Type, actual Type, context string) {
+	if !unify(expected, actual) {
+		in.mismatch(position, expected, actual, context)
+	}
+}
+
+func (in *Inferrer) mismatch(position token.Position, expected Type, actual Type, context string) {
+	both := normalize(&Function{Parameters: []Type{expected, actual}, Return: Null}).(*Function)
+	if context == "" {
+		in.errorf(position, "cannot unify %s with %s", both.Parameters[0], both.Parameters[1])
+		return
+	}
+	in.errorf(position, "cannot use %s as %s in %s", both.Parameters[1], both.Parameters[0], context)
+}
+
+func (in *Inferrer) statement(stmt ast.Statement) Type {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		in.declare(stmt.Name, stmt.Type, stmt.Value)
+	case *ast.ConstStatement:
+		in.declare(stmt.Name, stmt.Type, stmt.Value)
+	case *ast.InfixDeclaration:
+		in.level++
+		t := in.expression(stmt.Value)
+		in.level--
+		in.scope.define(stmt.Operator.Literal, in.generalize(t))
+	case *ast.DestructuringLetStatement:
+		in.bindPattern(stmt.Pattern, in.expression(stmt.Value))
+	case *ast.ReturnStatement:
+		var t Type = Null
+		if stmt.ReturnValue != nil {
+			t = in.expression(stmt.ReturnValue)
+		}
+		if len(in.returns) != 0 {
+			in.unify(stmt.Token.Position, in.returns[len(in.returns)-1], t, "return statement")
+		}
+		// the block is left before it results in a value
+		return in.fresh()
+	case *ast.ExpressionStatement:
+		return in.expression(stmt.Expression)
+	case *ast.BlockStatement:
+		return in.block(stmt)
+	}
+	return Null
+}
+
+// declare infers the type of the value of a let or const statement and
+// binds the name to its generalization. Functions can call themselves, but
+// only monomorphically.
+func (in *Inferrer) declare(name *ast.Identifier, annotation ast.Type, value ast.Expression) {
+	in.level++
+
+	var t Type
+	if _, ok := value.(*ast.FunctionLiteral); ok {
+		self := in.fresh()
+		in.scope.define(name.Value, self)
+		t = in.expression(value)
+		in.unify(position(value), self, t, "")
+	} else {
+		t = in.expression(value)
+	}
+
+	if annotation != nil {
+		in.unify(position(value), in.resolve(annotation), t, "declaration of "+name.Value)
+	}
+
+	in.level--
+	t = in.generalize(t)
+	in.scope.define(name.Value, t)
+	in.info.types[name] = t
+}
+
+func (in *Inferrer) block(block *ast.BlockStatement) Type {
+	if block == nil {
+		return Null
+	}
+
+	var t Type = Null
+	for _, stmt := range block.Statements {
+		t = in.statement(stmt)
+	}
+	return t
+}
+
+func (in *Inferrer) expression(expr ast.Expression) Type {
+	t := in.infer(expr)
+	if expr != nil {
+		in.info.types[expr] = t
+	}
+	return t
+}
+
+func (in *Inferrer) infer(expr ast.Expression) Type {
+	switch expr := expr.(type) {
+	case *ast.Identifier:
+		t, ok := in.scope.lookup(expr.Value)
+		if !ok {
+			return in.fresh()
+		}
+		if scheme, ok := t.(*Scheme); ok {
+			return in.instantiate(scheme)
+		}
+		return t
+	case *ast.IntegerLiteral:
+		return Int
+	case *ast.BooleanLiteral:
+		return Bool
+	case *ast.StringLiteral:
+		return String
+	case *ast.NullLiteral:
+		return Null
+	case *ast.InterpolatedString:
+		for _, e := range expr.Expressions {
+			in.expression(e)
+		}
+		return String
+	case *ast.PrefixExpression:
+		right := in.expression(expr.Right)
+		switch expr.Operator {
+		case token.MINUS:
+			in.operand(expr, Int, right)
+			return Int
+		case token.BANG:
+			in.operand(expr, Bool, right)
+			return Bool
+		}
+		return in.fresh()
+	case *ast.InfixExpression:
+		return in.infix(expr)
+	case *ast.IfExpression:
+		in.unify(position(expr.Condition), Bool, in.expression(expr.Condition), "condition")
+		consequence := in.block(expr.Consequence)
+		if expr.Alternative == nil {
+			// like a missing else block, the consequence results in null
+			in.unify(expr.Consequence.Token.Position, Null, consequence, "if without else")
+			return Null
+		}
+		in.unify(expr.Alternative.Token.Position, consequence, in.block(expr.Alternative), "else block")
+		return consequence
+	case *ast.FunctionLiteral:
+		return in.function(expr)
+	case *ast.MacroLiteral:
+		return in.fresh()
+	case *ast.LambdaLiteral:
+		param, result := in.fresh(), in.fresh()
+		in.openScope()
+		in.scope.define(expr.Parameter.Value, param)
+		in.info.types[expr.Parameter] = param
+		in.returns = append(in.returns, result)
+		in.unify(position(expr.Body), result, in.expression(expr.Body), "")
+		in.returns = in.returns[:len(in.returns)-1]
+		in.closeScope()
+		return &Function{Parameters: []Type{param}, Return: result}
+	case *ast.PipeExpression:
+		return in.call(expr.Call())
+	case *ast.CallExpression:
+		return in.call(expr)
+	case *ast.SpreadExpression:
+		element := in.fresh()
+		in.unify(position(expr.Value), &Array{Element: element}, in.expression(expr.Value), "spread")
+		return element
+	case *ast.ArrayLiteral:
+		element := Type(in.fresh())
+		for _, e := range expr.Elements {
+			in.unify(position(e), element, in.expression(e), "array element")
+		}
+		return &Array{Element: element}
+	case *ast.MapLiteral:
+		key, value := Type(in.fresh()), Type(in.fresh())
+		for _, k := range expr.OrderedKeys() {
+			in.unify(position(k), key, in.expression(k), "map key")
+			in.unify(position(expr.Entries[k]), value, in.expression(expr.Entries[k]), "map value")
+		}
+		return &Map{Key: key, Value: value}
+	case *ast.IndexExpression:
+		return in.index(expr)
+	case *ast.PropertyExpression:
+		value := in.fresh()
+		left := in.expression(expr.Left)
+		if !unify(&Map{Key: String, Value: value}, left) {
+			in.errorf(expr.Property.Token.Position, "cannot access property %s of %s", expr.Property.Value, normalize(left))
+		}
+		return value
+	case *ast.MatchExpression:
+		return in.match(expr)
+	default:
+		return in.fresh()
+	}
+}
+
+// operand unifies the operand of a prefix expression with the type the
+// operator expects.
+func (in *Inferrer) operand(expr *ast.PrefixExpression, expected Type, actual Type) {
+	if !unify(expected, actual) {
+		in.errorf(expr.Token.Position, "operator %s not defined for %s", expr.Operator, normalize(actual))
+	}
+}
+
+// infix infers the type of an infix expression. As there are no type
+// classes, + on operands of unknown type is taken to add integers.
+func (in *Inferrer) infix(expr *ast.InfixExpression) Type {
+	if _, ok := in.scope.lookup(string(expr.Operator)); ok {
+		return in.call(expr.Call())
+	}
+
+	left, right := in.expression(expr.Left), in.expression(expr.Right)
+
+	var operands, result Type
+	switch expr.Operator {
+	case token.COALESCE:
+		if prune(left) == Null {
+			return right
+		}
+		operands, result = left, left
+	case token.PLUS:
+		operands, result = Int, Int
+		if prune(left) == String || prune(right) == String {
+			operands, result = String, String
+		}
+	case token.MINUS, token.ASTERIK, token.SLASH:
+		operands, result = Int, Int
+	case token.LT, token.GT, token.LESS_EQUAL, token.GREATER_EQUAL:
+		operands, result = Int, Bool
+	case token.EQUALS, token.NOT_EQUALS:
+		// null can be compared with every value
+		if prune(left) == Null || prune(right) == Null {
+			return Bool
+		}
+		operands, result = left, Bool
+	case token.AND, token.OR:
+		operands, result = Bool, Bool
+	default:
+		return in.fresh()
+	}
+
+	if !unify(operands, left) || !unify(operands, right) {
+		both := normalize(&Function{Parameters: []Type{left, right}, Return: Null}).(*Function)
+		in.errorf(expr.Token.Position, "operator %s not defined for %s and %s", expr.Operator, both.Parameters[0], both.Parameters[1])
+	}
+	return result
+}
+
+func (in *Inferrer) function(fn *ast.FunctionLiteral) Type {
+	in.openScope()
+	defer in.closeScope()
+
+	t := &Function{Parameters: make([]Type, len(fn.Parameters)), Return: in.fresh()}
+	for i, param := range fn.Parameters {
+		t.Parameters[i] = in.fresh()
+		if annotation := fn.ParameterType(i); annotation != nil {
+			t.Parameters[i] = in.resolve(annotation)
+		}
+		// defaults are evaluated when called and see the parameters in
+		// front of them
+		if def := fn.Default(i); def != nil {
+			in.unify(position(def), t.Parameters[i], in.expression(def), "default value of "+param.Value)
+			t.Optional++
+		}
+		in.scope.define(param.Value, t.Parameters[i])
+		in.info.types[param] = t.Parameters[i]
+	}
+	if fn.Rest != nil {
+		t.Rest = in.fresh()
+		if fn.RestType != nil {
+			in.unify(fn.Rest.Token.Position, &Array{Element: t.Rest}, in.resolve(fn.RestType), "type of rest parameter "+fn.Rest.Value)
+		}
+		in.scope.define(fn.Rest.Value, &Array{Element: t.Rest})
+		in.info.types[fn.Rest] = &Array{Element: t.Rest}
+	}
+	if fn.ReturnType != nil {
+		t.Return = in.resolve(fn.ReturnType)
+	}
+
+	in.returns = append(in.returns, t.Return)
+	result := in.block(fn.Body)
+	in.returns = in.returns[:len(in.returns)-1]
+
+	pos := fn.Body.Token.Position
+	if n := len(fn.Body.Statements); n != 0 {
+		if stmt, ok := fn.Body.Statements[n-1].(*ast.ExpressionStatement); ok {
+			pos = position(stmt.Expression)
+		}
+	}
+	in.unify(pos, t.Return, result, "result of function")
+
+	return t
+}
+
+func (in *Inferrer) call(call *ast.CallExpression) Type {
+	callee := in.expression(call.Left)
+
+	args := make([]Type, len(call.Arguments))
+	spread := -1
+	for i, arg := range call.Arguments {
+		if _, ok := arg.(*ast.SpreadExpression); ok && spread == -1 {
+			spread = i
+		}
+		args[i] = in.expression(arg)
+	}
+
+	switch fn := prune(callee).(type) {
+	case *Variable:
+		if spread != -1 {
+			return in.fresh()
+		}
+		result := in.fresh()
+		in.unify(position(call.Left), callee, &Function{Parameters: args, Return: result}, "")
+		return result
+	case *Function:
+		if spread == -1 && (len(args) < len(fn.Parameters)-fn.Optional || len(args) > len(fn.Parameters) && fn.Rest == nil) {
+			in.errorf(call.Token.Position, "%s", wrongNumberOfArguments(fn, len(args)))
+		}
+
+		for i, arg := range call.Arguments {
+			var param Type
+			switch {
+			case i < len(fn.Parameters):
+				param = fn.Parameters[i]
+			case fn.Rest != nil:
+				param = fn.Rest
+			default:
+				continue
+			}
+
+			// the elements of spread arrays can end up in any of the
+			// remaining parameters
+			if spread != -1 && i >= spread {
+				for _, rest := range append(fn.Parameters[min(i, len(fn.Parameters)):], fn.Rest) {
+					if rest != nil {
+						in.unify(position(arg), rest, args[i], fmt.Sprintf("argument %d", i+1))
+					}
+				}
+				continue
+			}
+			in.unify(position(arg), param, args[i], fmt.Sprintf("argument %d", i+1))
+		}
+		return fn.Return
+	default:
+		in.errorf(position(call.Left), "cannot call %s", normalize(callee))
+		return in.fresh()
+	}
+}
+
+// index infers the type of an index expression. Values of unknown type
+// indexed by an integer are taken to be arrays, otherwise maps.
+func (in *Inferrer) index(expr *ast.IndexExpression) Type {
+	left, index := in.expression(expr.Left), in.expression(expr.Index)
+
+	element := in.fresh()
+	var container Type = &Map{Key: index, Value: element}
+	switch prune(left).(type) {
+	case *Array:
+		container = &Array{Element: element}
+	case *Variable:
+		if prune(index) == Int {
+			container = &Array{Element: element}
+		}
+	}
+
+	if !unify(container, left) {
+		in.errorf(expr.Token.Position, "cannot index %s", normalize(left))
+		return element
+	}
+	if _, ok := container.(*Array); ok {
+		in.unify(position(expr.Index), Int, index, "array index")
+	}
+	return element
+}
+
+func (in *Inferrer) match(match *ast.MatchExpression) Type {
+	subject := in.expression(match.Subject)
+
+	result := in.fresh()
+	for _, arm := range match.Arms {
+		in.openScope()
+		in.bindPattern(arm.Pattern, subject)
+		if arm.Guard != nil {
+			in.unify(position(arm.Guard), Bool, in.expression(arm.Guard), "guard")
+		}
+		in.unify(position(arm.Body), result, in.expression(arm.Body), "match arm")
+		in.closeScope()
+	}
+	return result
+}
+
+// bindPattern unifies the type of the matched value with the shape of the
+// pattern and binds its names.
+func (in *Inferrer) bindPattern(pattern ast.Pattern, t Type) {
+	switch pattern := pattern.(type) {
+	case *ast.LiteralPattern:
+		// null can be matched against every value
+		if literal := in.expression(pattern.Value); literal != Null {
+			in.unify(position(pattern.Value), t, literal, "pattern")
+		}
+	case *ast.BindingPattern:
+		in.scope.define(pattern.Name.Value, t)
+		in.info.types[pattern.Name] = t
+	case *ast.ArrayPattern:
+		element := in.fresh()
+		in.unify(pattern.Token.Position, &Array{Element: element}, t, "pattern")
+		for _, e := range pattern.Elements {
+			in.bindPattern(e, element)
+		}
+		if pattern.Rest != nil {
+			in.scope.define(pattern.Rest.Value, &Array{Element: element})
+			in.info.types[pattern.Rest] = &Array{Element: element}
+		}
+	case *ast.MapPattern:
+		key, value := in.fresh(), in.fresh()
+		in.unify(pattern.Token.Position, &Map{Key: key, Value: value}, t, "pattern")
+		for _, entry := range pattern.Entries {
+			in.unify(position(entry.Key), key, in.expression(entry.Key), "pattern key")
+			in.bindPattern(entry.Value, value)
+		}
+	}
+}
+
+// resolve returns the type an annotation refers to. The type any stands
+// for a fresh variable.
+func (in *Inferrer) resolve(annotation ast.Type) Type {
+	switch annotation := annotation.(type) {
+	case *ast.NamedType:
+		if annotation.Name == Any.Name {
+			return in.fresh()
+		}
+		if basic, ok := basics[annotation.Name]; ok {
+			return basic
+		}
+		in.errorf(annotation.Token.Position, "unknown type %s", annotation.Name)
+		return in.fresh()
+	case *ast.ArrayType:
+		return &Array{Element: in.resolve(annotation.Element)}
+	case *ast.MapType:
+		return &Map{Key: in.resolve(annotation.Key), Value: in.resolve(annotation.Value)}
+	case *ast.FunctionType:
+		fn := &Function{Parameters: make([]Type, len(annotation.Parameters)), Return: in.fresh()}
+		for i, param := range annotation.Parameters {
+			fn.Parameters[i] = in.resolve(param)
+		}
+		if annotation.Return != nil {
+			fn.Return = in.resolve(annotation.Return)
+		}
+		return fn
+	default:
+		return in.fresh()
+	}
+}
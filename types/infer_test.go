@@ -0,0 +1,170 @@
+package types
+
+import (
+	"compiler/ast"
+	"compiler/parser"
+	"compiler/scanner"
+	"strings"
+	"testing"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	p := parser.New(scanner.NewHandcodedScanner(input))
+	program := p.ParseProgram()
+	if len(p.Errors) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors)
+	}
+	return program
+}
+
+func TestInferredSignatures(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{`let id = fn(x) { x };`, []string{"id: fn(a): a"}},
+		{`let add = fn(a, b) { a + b };`, []string{"add: fn(int, int): int"}},
+		{`let greet = fn(name) { "Hello " + name };`, []string{"greet: fn(string): string"}},
+		{`let compose = fn(f, g) { fn(x) { f(g(x)) } };`, []string{"compose: fn(fn(a): b, fn(c): a): fn(c): b"}},
+		{
+			`let fold = fn(xs, acc, f) { match (xs) { [] => acc, [x, ...rest] => fold(rest, f(acc, x), f) } };`,
+			[]string{"fold: fn([a], b, fn(b, a): b): b"},
+		},
+		{
+			`let id = fn(x) { x }; let a = id(1); let b = id("s"); let c = id(id);`,
+			[]string{"id: fn(a): a", "a: int", "b: string", "c: fn(a): a"},
+		},
+		{`let xs = push([1], 2); let n = len(xs); let e = isEmpty("");`, []string{"xs: [int]", "n: int", "e: bool"}},
+		{`let n = len([1]) + len(["a"]); let xs = push(push([], "a"), "b"); let ys = push([true], false);`, []string{"n: int", "xs: [string]", "ys: [bool]"}},
+		{`let k = keys({"a": 1}); let v = values({1: true});`, []string{"k: [string]", "v: [bool]"}},
+		{`let m = {"a": [1]}; let v = m["a"]; let w = m.a[0];`, []string{"m: {string: [int]}", "v: [int]", "w: int"}},
+		{
+			`let m = set({"a": 1}, "b", 2); let k = keys(m); let v = values(merge(m, m)); let h = has(delete(m, "a"), "b");`,
+			[]string{"m: {string: int}", "k: [string]", "v: [int]", "h: bool"},
+		},
+		{`let counter = fn(start) { fn(step) { start + step } };`, []string{"counter: fn(int): fn(int): int"}},
+		{`let double = x => x * 2; let y = 3 |> double;`, []string{"double: fn(int): int", "y: int"}},
+		{`let f = fn(a, b = 1, ...rest) { push(rest, a + b) };`, []string{"f: fn(int, int, ...int): [int]"}},
+		{`let f = fn(...rest: [string]) { rest };`, []string{"f: fn(...string): [string]"}},
+		{`let f = fn(x: string, y: any): [any] { [y] };`, []string{"f: fn(string, a): [a]"}},
+		{`infixl 6 <+> = fn(a, b) { [a, b] }; let p = 1 <+> 2;`, []string{"<+>: fn(a, a): [a]", "p: [int]"}},
+		{`let first = fn(pair) { match (pair) { [a, _] => a } };`, []string{"first: fn([a]): a"}},
+		{`let orZero = fn(x) { match (x) { null => 0, n => n + 1 } };`, []string{"orZero: fn(int): int"}},
+		{`let get = fn(m, k) { m[k] }; let at = fn(xs) { xs[0] };`, []string{"get: fn({a: b}, a): b", "at: fn([a]): a"}},
+		{`let fib = fn(n) { if (n < 2) { return n } fib(n - 1) + fib(n - 2) };`, []string{"fib: fn(int): int"}},
+		{`let {name} = {"name": "x"}; const limit = 10;`, []string{"limit: int"}},
+	}
+
+	for _, tt := range tests {
+		info, errors := Infer(parse(t, tt.input))
+		if len(errors) != 0 {
+			t.Errorf("unexpected errors for %q: %v", tt.input, errors)
+			continue
+		}
+
+		var actual []string
+		for _, binding := range info.Bindings {
+			actual = append(actual, binding.String())
+		}
+		if strings.Join(actual, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("wrong signatures for %q.\nwant=%q\ngot= %q", tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func TestUnificationErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`[1, "a"]`, `1:5: cannot use string as int in array element`},
+		{`let f = fn(x) { x + 1 }; f("a")`, `1:28: cannot use string as int in argument 1`},
+		{`fn(x) { x(x) }`, `1:9: cannot unify a with fn(a): b`},
+		{`if (1) { 2 } else { 3 }`, `1:5: cannot use int as bool in condition`},
+		{`if (true) { 1 } else { "a" }`, `1:22: cannot use string as int in else block`},
+		{`if (true) { 1 }`, `1:11: cannot use int as null in if without else`},
+		{`let x = 1; x.name`, `1:14: cannot access property name of int`},
+		{`let x = 1; x[0]`, `1:13: cannot index int`},
+		{`let x = 1; x()`, `1:12: cannot call int`},
+		{`let f = fn(x) { x }; f(1, 2)`, `1:23: wrong number of arguments: expected 1, got 2`},
+		{`let id = fn(x) { x }; id(1) + id("a")`, `1:29: operator + not defined for int and string`},
+		{`fn(f) { [f(1), f("a")] }`, `1:18: cannot use string as int in argument 1`},
+		{`let f = fn(): int { "a" };`, `1:21: cannot use string as int in result of function`},
+		{`let f = fn(x) { if (x) { return 1 } "a" };`, `1:37: cannot use string as int in result of function`},
+		{`let x: string = 1;`, `1:17: cannot use int as string in declaration of x`},
+		{`match ([1]) { [a] => a, {b} => b }`, `1:25: cannot use [int] as {a: b} in pattern`},
+		{`match (1) { "a" => 1, _ => 2 }`, `1:13: cannot use string as int in pattern`},
+		{`-true`, `1:1: operator - not defined for bool`},
+		{`let xs = [1]; xs["a"]`, `1:18: cannot use string as int in array index`},
+		{`set({"a": 1}, "b", "c")`, `1:20: cannot use string as int in argument 3`},
+		{`fn(...rest: int) { rest }`, `1:7: cannot use int as [a] in type of rest parameter rest`},
+	}
+
+	for _, tt := range tests {
+		_, errors := Infer(parse(t, tt.input))
+		if len(errors) != 1 {
+			t.Errorf("Expected 1 error for %q. Got %d: %v", tt.input, len(errors), errors)
+			continue
+		}
+
+		if errors[0].Error() != tt.expected {
+			t.Errorf("Expected '%s'. Got '%s'", tt.expected, errors[0].Error())
+		}
+	}
+}
+
+func TestInferrerKeepsBindings(t *testing.T) {
+	in := NewInferrer()
+
+	if _, errors := in.Infer(parse(t, `let pair = fn(a, b) { [a, b] };`)); len(errors) != 0 {
+		t.Fatalf("unexpected errors: %v", errors)
+	}
+
+	program := parse(t, `pair(true, false)`)
+	info, errors := in.Infer(program)
+	if len(errors) != 0 {
+		t.Fatalf("unexpected errors: %v", errors)
+	}
+
+	expr := program.Statements[0].(*ast.ExpressionStatement).Expression
+	if actual := info.TypeOf(expr).String(); actual != "[bool]" {
+		t.Errorf("Expected '[bool]'. Got '%s'", actual)
+	}
+}
+
+func TestTypeAt(t *testing.T) {
+	input := `let twice = fn(f, x) { f(f(x)) }; twice(fn(n) { n * 2 }, 1)`
+	info, errors := Infer(parse(t, input))
+	if len(errors) != 0 {
+		t.Fatalf("unexpected errors: %v", errors)
+	}
+
+	tests := []struct {
+		offset   int
+		name     string
+		expected string
+	}{
+		{4, "twice", "fn(fn(a): a, a): a"},
+		{15, "f", "fn(a): a"},
+		{27, "x", "a"},
+		{34, "twice", "fn(fn(int): int, int): int"},
+		{43, "n", "int"},
+	}
+
+	for _, tt := range tests {
+		ident, typ := info.At(tt.offset)
+		if ident == nil {
+			t.Errorf("Expected identifier at offset %d", tt.offset)
+			continue
+		}
+		if ident.Value != tt.name || typ.String() != tt.expected {
+			t.Errorf("Expected '%s: %s' at offset %d. Got '%s: %s'", tt.name, tt.expected, tt.offset, ident.Value, typ)
+		}
+	}
+
+	if ident, _ := info.At(30); ident != nil {
+		t.Errorf("Expected no identifier at offset 30. Got %s", ident.Value)
+	}
+}
@@ -0,0 +1,260 @@
+// Package types statically checks programs with optional type annotations.
+// Unannotated code is dynamically typed: its values have the type any,
+// which is compatible with every other type, so only code mixing values
+// of known, incompatible types is rejected before it runs.
+//
+// In strict mode, Infer instead derives principal types for unannotated
+// code with Hindley-Milner inference and rejects every program whose
+// types cannot be unified.
+package types
+
+import (
+	"bytes"
+	"compiler/token"
+	"fmt"
+)
+
+type Type interface {
+	String() string
+}
+
+// Basic is one of the predeclared types int, string, bool, null and any.
+type Basic struct {
+	Name string
+}
+
+func (basic *Basic) String() string {
+	return basic.Name
+}
+
+var (
+	Int    = &Basic{Name: "int"}
+	String = &Basic{Name: "string"}
+	Bool   = &Basic{Name: "bool"}
+	Null   = &Basic{Name: "null"}
+	// Any is the type of dynamically typed values.
+	Any = &Basic{Name: "any"}
+)
+
+var basics = map[string]*Basic{
+	Int.Name:    Int,
+	String.Name: String,
+	Bool.Name:   Bool,
+	Null.Name:   Null,
+	Any.Name:    Any,
+}
+
+type Array struct {
+	Element Type
+}
+
+func (arr *Array) String() string {
+	return "[" + arr.Element.String() + "]"
+}
+
+type Map struct {
+	Key   Type
+	Value Type
+
+	// literal marks the type of an unannotated map literal, whose key type
+	// is only known from the keys it was built with
+	literal bool
+}
+
+func (m *Map) String() string {
+	return "{" + m.Key.String() + ": " + m.Value.String() + "}"
+}
+
+// Function describes functions taking Parameters, the last Optional of
+// which have default values. Functions with a rest parameter take any
+// number of additional arguments of type Rest, which is nil otherwise.
+type Function struct {
+	Parameters []Type
+	Optional   int
+	Rest       Type
+	Return     Type
+}
+
+func (fn *Function) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("fn(")
+	for i, param := range fn.Parameters {
+		if i != 0 {
+			out.WriteString(", ")
+		}
+		out.WriteString(param.String())
+	}
+	if fn.Rest != nil {
+		if len(fn.Parameters) != 0 {
+			out.WriteString(", ")
+		}
+		out.WriteString("..." + fn.Rest.String())
+	}
+	out.WriteString("): ")
+	out.WriteString(fn.Return.String())
+
+	return out.String()
+}
+
+// Variable is a type variable of the inference. Once unified with another
+// type it stands for that Instance. Name is only set for display.
+type Variable struct {
+	ID       int
+	Instance Type
+	Name     string
+	// Level is the let nesting depth the variable was introduced at. It is
+	// lowered to the level of the variables it is unified with, so only
+	// variables not reachable from outer bindings are generalized.
+	Level int
+}
+
+func (v *Variable) String() string {
+	switch {
+	case v.Instance != nil:
+		return v.Instance.String()
+	case v.Name != "":
+		return v.Name
+	default:
+		return fmt.Sprintf("t%d", v.ID)
+	}
+}
+
+// Scheme is the polymorphic type of a let binding. Every use of the
+// binding instantiates Type with fresh variables for Variables.
+type Scheme struct {
+	Variables []*Variable
+	Type      Type
+}
+
+func (scheme *Scheme) String() string {
+	return normalize(scheme.Type).String()
+}
+
+// Error is a type error at a position of the source.
+type Error struct {
+	Position token.Position
+	Message  string
+}
+
+func (err *Error) Error() string {
+	return fmt.Sprintf("%s: %s", err.Position, err.Message)
+}
+
+// Identical reports whether a and b are the same type.
+func Identical(a Type, b Type) bool {
+	return a.String() == b.String()
+}
+
+// AssignableTo reports whether a value of type from can be used where a
+// value of type to is expected. Values of type any can be used everywhere
+// and every value can be used as any.
+func AssignableTo(from Type, to Type) bool {
+	if from == Any || to == Any {
+		return true
+	}
+
+	switch to := to.(type) {
+	case *Array:
+		from, ok := from.(*Array)
+		return ok && AssignableTo(from.Element, to.Element)
+	case *Map:
+		from, ok := from.(*Map)
+		return ok && AssignableTo(from.Key, to.Key) && AssignableTo(from.Value, to.Value)
+	case *Function:
+		// from must accept every number of arguments to accepts
+		from, ok := from.(*Function)
+		if !ok || len(from.Parameters)-from.Optional > len(to.Parameters)-to.Optional {
+			return false
+		}
+		if from.Rest == nil && (to.Rest != nil || len(from.Parameters) < len(to.Parameters)) {
+			return false
+		}
+		for i, param := range to.Parameters {
+			expected := from.Rest
+			if i < len(from.Parameters) {
+				expected = from.Parameters[i]
+			}
+			if !AssignableTo(param, expected) {
+				return false
+			}
+		}
+		if to.Rest != nil && !AssignableTo(to.Rest, from.Rest) {
+			return false
+		}
+		return AssignableTo(from.Return, to.Return)
+	default:
+		return from == to
+	}
+}
+
+// join returns the type of a value that is either of type a or b.
+func join(a Type, b Type) Type {
+	if Identical(a, b) {
+		return a
+	}
+	return Any
+}
+
+// prune returns the type a chain of unified variables stands for.
+func prune(t Type) Type {
+	for {
+		v, ok := t.(*Variable)
+		if !ok || v.Instance == nil {
+			return t
+		}
+		t = v.Instance
+	}
+}
+
+// substitute returns a copy of t whose unbound variables are replaced by
+// replace, which may return nil to keep a variable.
+func substitute(t Type, replace func(*Variable) Type) Type {
+	switch t := prune(t).(type) {
+	case *Variable:
+		if r := replace(t); r != nil {
+			return r
+		}
+		return t
+	case *Array:
+		return &Array{Element: substitute(t.Element, replace)}
+	case *Map:
+		return &Map{Key: substitute(t.Key, replace), Value: substitute(t.Value, replace)}
+	case *Function:
+		fn := &Function{Parameters: make([]Type, len(t.Parameters)), Optional: t.Optional}
+		for i, param := range t.Parameters {
+			fn.Parameters[i] = substitute(param, replace)
+		}
+		if t.Rest != nil {
+			fn.Rest = substitute(t.Rest, replace)
+		}
+		fn.Return = substitute(t.Return, replace)
+		return fn
+	case *Scheme:
+		return &Scheme{Variables: t.Variables, Type: substitute(t.Type, replace)}
+	default:
+		return t
+	}
+}
+
+// normalize resolves the variables of t and names the unbound ones a, b,
+// c and so on in order of appearance.
+func normalize(t Type) Type {
+	names := make(map[*Variable]*Variable)
+	return substitute(t, func(v *Variable) Type {
+		named, ok := names[v]
+		if !ok {
+			named = &Variable{ID: v.ID, Name: variableName(len(names)), Level: v.Level}
+			names[v] = named
+		}
+		return named
+	})
+}
+
+func variableName(i int) string {
+	name := string(rune('a' + i%26))
+	if i >= 26 {
+		name += fmt.Sprint(i / 26)
+	}
+	return name
+}
@@ -0,0 +1,68 @@
+package vm
+
+import (
+	"compiler/token"
+	"fmt"
+	"strings"
+)
+
+// RuntimeError is an error raised while running a program. Error returns
+// the message only, StackTrace the calls that were active when it failed.
+type RuntimeError struct {
+	Err error
+	// Trace holds the active calls, innermost first.
+	Trace []StackFrame
+}
+
+// StackFrame is a call of Function that is executing at Position.
+type StackFrame struct {
+	Function string
+	Position token.Position
+}
+
+func (err *RuntimeError) Error() string {
+	return err.Err.Error()
+}
+
+func (err *RuntimeError) Unwrap() error {
+	return err.Err
+}
+
+// StackTrace formats the trace with one line per call, innermost first.
+// Repeated calls from the same position, as made by a recursive function,
+// are printed once followed by the number of repetitions.
+func (err *RuntimeError) StackTrace() string {
+	var out strings.Builder
+	for i := 0; i < len(err.Trace); {
+		frame := err.Trace[i]
+		fmt.Fprintf(&out, "\tat %s (%s)\n", frame.Function, frame.Position)
+
+		repeated := 0
+		for i++; i < len(err.Trace) && err.Trace[i] == frame; i++ {
+			repeated++
+		}
+		if repeated != 0 {
+			fmt.Fprintf(&out, "\t... %d more frames\n", repeated)
+		}
+	}
+	return out.String()
+}
+
+func (vm *VM) stackTrace() []StackFrame {
+	var trace []StackFrame
+	for i := vm.frameIndex; i >= 0; i-- {
+		frame := vm.frames[i]
+		fn := frame.cl.Fn
+
+		name := fn.Name
+		switch {
+		case i == 0:
+			name = "<main>"
+		case name == "":
+			name = "<anonymous>"
+		}
+
+		trace = append(trace, StackFrame{Function: name, Position: fn.Lines.Lookup(frame.ip)})
+	}
+	return trace
+}
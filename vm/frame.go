@@ -10,6 +10,7 @@ type Frame struct {
 	ip int
 
 	basePointer int
+	numArgs     int
 }
 
 func NewFrame(cl *object.Closure, basePointer int) *Frame {
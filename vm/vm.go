@@ -5,10 +5,15 @@ import (
 	"compiler/compiler"
 	"compiler/object"
 	"fmt"
+	"strings"
 )
 
 const StackSize = 2048
+
+// GlobalsSize is the number of globals allocated up front. Programs
+// defining more grow the globals as needed.
 const GlobalsSize = 6048
+
 const FramesSize = 1024
 
 var TRUE = &object.Boolean{Value: true}
@@ -28,7 +33,7 @@ type VM struct {
 }
 
 func New(bytecode *compiler.Bytecode) *VM {
-	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions}
+	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions, Lines: bytecode.Lines}
 	mainClosure := &object.Closure{Fn: mainFn}
 	mainFrame := NewFrame(mainClosure, 0)
 
@@ -52,7 +57,17 @@ func (vm *VM) LastPopped() object.Object {
 	return vm.stack[vm.sp]
 }
 
+// Run executes the program. Errors are returned as a *RuntimeError with
+// the stack trace at the failing instruction.
 func (vm *VM) Run() error {
+	err := vm.run()
+	if err != nil {
+		return &RuntimeError{Err: err, Trace: vm.stackTrace()}
+	}
+	return nil
+}
+
+func (vm *VM) run() error {
 	for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
 		vm.currentFrame().ip++
 
@@ -60,10 +75,15 @@ func (vm *VM) Run() error {
 		op := code.Opcode(vm.currentFrame().Instructions()[ip])
 		ins := vm.currentFrame().Instructions()
 
+		wide := op == code.OpWide
+		if wide {
+			vm.currentFrame().ip++
+			op = code.Opcode(ins[vm.currentFrame().ip])
+		}
+
 		switch op {
 		case code.OpConstant:
-			constIndex := code.ReadUint16(ins[ip+1:])
-			vm.currentFrame().ip += 2
+			constIndex := vm.operand(ins, 2, wide)
 
 			err := vm.push(vm.constants[constIndex])
 			if err != nil {
@@ -100,6 +120,8 @@ func (vm *VM) Run() error {
 				return err
 			}
 		case code.OpJumpNotTrue:
+			jumpPosition := vm.operand(ins, 2, wide)
+
 			condition := vm.pop()
 			booleanCondition, ok := condition.(*object.Boolean)
 			if !ok {
@@ -107,24 +129,25 @@ func (vm *VM) Run() error {
 			}
 
 			if !booleanCondition.Value {
-				jumpPosition := code.ReadUint16(ins[ip+1:])
-				vm.currentFrame().ip = int(jumpPosition - 1)
-			} else {
-				vm.currentFrame().ip += 2
+				vm.currentFrame().ip = jumpPosition - 1
 			}
 		case code.OpJump:
-			jumpPosition := code.ReadUint16(ins[ip+1:])
-			vm.currentFrame().ip = int(jumpPosition - 1)
+			jumpPosition := vm.operand(ins, 2, wide)
+			vm.currentFrame().ip = jumpPosition - 1
 		case code.OpSetGlobal:
-			globalsIndex := code.ReadUint16(ins[ip+1:])
-			vm.currentFrame().ip += 2
+			globalsIndex := vm.operand(ins, 2, wide)
 
+			if globalsIndex >= len(vm.globals) {
+				vm.globals = append(vm.globals, make([]object.Object, globalsIndex+1-len(vm.globals))...)
+			}
 			vm.globals[globalsIndex] = vm.pop()
 		case code.OpGetGlobal:
-			globalsIndex := code.ReadUint16(ins[ip+1:])
-			vm.currentFrame().ip += 2
+			globalsIndex := vm.operand(ins, 2, wide)
 
-			obj := vm.globals[globalsIndex]
+			var obj object.Object
+			if globalsIndex < len(vm.globals) {
+				obj = vm.globals[globalsIndex]
+			}
 			if obj == nil {
 				panic("trying to get global that does not exist")
 			}
@@ -134,15 +157,13 @@ func (vm *VM) Run() error {
 				return err
 			}
 		case code.OpSetLocal:
-			localsIndex := code.ReadUint8(ins[ip+1:])
-			vm.currentFrame().ip += 1
+			localsIndex := vm.operand(ins, 1, wide)
 
-			vm.stack[vm.currentFrame().basePointer+int(localsIndex)] = vm.pop()
+			vm.stack[vm.currentFrame().basePointer+localsIndex] = vm.pop()
 		case code.OpGetLocal:
-			localsIndex := code.ReadUint8(ins[ip+1:])
-			vm.currentFrame().ip += 1
+			localsIndex := vm.operand(ins, 1, wide)
 
-			obj := vm.stack[vm.currentFrame().basePointer+int(localsIndex)]
+			obj := vm.stack[vm.currentFrame().basePointer+localsIndex]
 			if obj == nil {
 				panic("trying to get local that does not exist")
 			}
@@ -152,8 +173,7 @@ func (vm *VM) Run() error {
 				return err
 			}
 		case code.OpGetBuiltin:
-			builtinIndex := code.ReadUint8(ins[ip+1:])
-			vm.currentFrame().ip += 1
+			builtinIndex := vm.operand(ins, 1, wide)
 
 			builtin := object.Builtins[builtinIndex]
 
@@ -162,8 +182,7 @@ func (vm *VM) Run() error {
 				return err
 			}
 		case code.OpArray:
-			numElements := int(code.ReadUint16(ins[ip+1:]))
-			vm.currentFrame().ip += 2
+			numElements := vm.operand(ins, 2, wide)
 
 			vm.sp = vm.sp - numElements
 
@@ -177,12 +196,11 @@ func (vm *VM) Run() error {
 				return err
 			}
 		case code.OpMap:
-			numEntries := int(code.ReadUint16(ins[ip+1:]))
-			vm.currentFrame().ip += 2
+			numEntries := vm.operand(ins, 2, wide)
 
 			vm.sp = vm.sp - numEntries*2
 
-			entries := make(map[string]object.Object, numEntries)
+			mapObj := &object.Map{}
 			for i := 0; i < numEntries; i++ {
 				key := vm.stack[vm.sp+2*i]
 				value := vm.stack[vm.sp+2*i+1]
@@ -192,10 +210,10 @@ func (vm *VM) Run() error {
 					return fmt.Errorf("type missmatch: non-hashable object provided as hash key")
 				}
 
-				entries[hashableKey.Hash()] = value
+				mapObj.Set(hashableKey, value)
 			}
 
-			err := vm.push(&object.Map{Entries: entries})
+			err := vm.push(mapObj)
 			if err != nil {
 				return err
 			}
@@ -227,11 +245,11 @@ func (vm *VM) Run() error {
 
 				hashableIndex, ok := index.(object.Hashable)
 				if !ok {
-					return fmt.Errorf("type missmatch: cannot use %s as key for hashmap", hashableIndex.Type())
+					return fmt.Errorf("type missmatch: cannot use %s as key for hashmap", index.Type())
 				}
 
-				value := mapObj.Entries[hashableIndex.Hash()]
-				if value == nil {
+				value, ok := mapObj.Get(hashableIndex)
+				if !ok {
 					value = NULL
 				}
 				err := vm.push(value)
@@ -239,11 +257,76 @@ func (vm *VM) Run() error {
 					return err
 				}
 			}
+		case code.OpGetProperty:
+			constIndex := vm.operand(ins, 2, wide)
+
+			value, err := getProperty(vm.pop(), vm.constants[constIndex].(*object.String))
+			if err != nil {
+				return err
+			}
+
+			err = vm.push(value)
+			if err != nil {
+				return err
+			}
+		case code.OpGetOptionalProperty:
+			constIndex := vm.operand(ins, 2, wide)
+
+			value, err := getOptionalProperty(vm.pop(), vm.constants[constIndex].(*object.String))
+			if err != nil {
+				return err
+			}
+
+			err = vm.push(value)
+			if err != nil {
+				return err
+			}
+		case code.OpJumpIfNull:
+			jumpPosition := vm.operand(ins, 2, wide)
+			if vm.stack[vm.sp-1].Type() == object.NULL {
+				vm.currentFrame().ip = jumpPosition - 1
+			}
+		case code.OpJumpIfNotNull:
+			jumpPosition := vm.operand(ins, 2, wide)
+			if vm.stack[vm.sp-1].Type() != object.NULL {
+				vm.currentFrame().ip = jumpPosition - 1
+			} else {
+				vm.pop()
+			}
+		case code.OpBuildString:
+			numParts := vm.operand(ins, 2, wide)
+
+			var out strings.Builder
+			for _, part := range vm.stack[vm.sp-numParts : vm.sp] {
+				out.WriteString(part.String())
+			}
+			vm.sp -= numParts
+
+			err := vm.push(&object.String{Value: out.String()})
+			if err != nil {
+				return err
+			}
 		case code.OpCall:
-			err := vm.executeCall()
+			numArgs := vm.operand(ins, 1, wide)
+
+			err := vm.executeCall(numArgs)
 			if err != nil {
 				return err
 			}
+		case code.OpCallSpread:
+			numArrays := vm.operand(ins, 1, wide)
+
+			err := vm.executeSpreadCall(numArrays)
+			if err != nil {
+				return err
+			}
+		case code.OpJumpIfArgument:
+			paramIndex := vm.operand(ins, 1, wide)
+			jumpPosition := vm.operand(ins, 2, wide)
+
+			if paramIndex < vm.currentFrame().numArgs {
+				vm.currentFrame().ip = jumpPosition - 1
+			}
 		case code.OpReturnValue:
 			returnValue := vm.pop()
 
@@ -263,17 +346,15 @@ func (vm *VM) Run() error {
 				return err
 			}
 		case code.OpClosure:
-			constIndex := code.ReadUint16(ins[ip+1:])
-			numFree := code.ReadUint8(ins[ip+3:])
-			vm.currentFrame().ip += 3
+			constIndex := vm.operand(ins, 2, wide)
+			numFree := vm.operand(ins, 1, wide)
 
-			err := vm.pushClosure(int(constIndex), int(numFree))
+			err := vm.pushClosure(constIndex, numFree)
 			if err != nil {
 				return err
 			}
 		case code.OpGetFree:
-			freeIndex := code.ReadUint8(ins[ip+1:])
-			vm.currentFrame().ip += 1
+			freeIndex := vm.operand(ins, 1, wide)
 
 			currentClosure := vm.currentFrame().cl
 			err := vm.push(currentClosure.Free[freeIndex])
@@ -286,14 +367,85 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
+		case code.OpMatchLiteral:
+			literal := vm.pop()
+			value := vm.pop()
+
+			err := vm.push(booleanObjectFromBool(matchesLiteral(value, literal)))
+			if err != nil {
+				return err
+			}
+		case code.OpMatchArray:
+			numElements := vm.operand(ins, 2, wide)
+			hasRest := vm.operand(ins, 1, wide) == 1
+
+			arr, ok := vm.pop().(*object.Array)
+			matches := ok && (len(arr.Elements) == numElements || hasRest && len(arr.Elements) > numElements)
+
+			err := vm.push(booleanObjectFromBool(matches))
+			if err != nil {
+				return err
+			}
+		case code.OpMatchMap:
+			_, ok := vm.pop().(*object.Map)
+
+			err := vm.push(booleanObjectFromBool(ok))
+			if err != nil {
+				return err
+			}
+		case code.OpHasKey:
+			key := vm.pop()
+			mapObj := vm.pop().(*object.Map)
+
+			hashableKey, ok := key.(object.Hashable)
+			if !ok {
+				return fmt.Errorf("type missmatch: cannot use %s as key for hashmap", key.Type())
+			}
+
+			_, ok = mapObj.Get(hashableKey)
+			err := vm.push(booleanObjectFromBool(ok))
+			if err != nil {
+				return err
+			}
+		case code.OpSlice:
+			start := vm.operand(ins, 2, wide)
+
+			arr := vm.pop().(*object.Array)
+			elements := make([]object.Object, len(arr.Elements)-start)
+			copy(elements, arr.Elements[start:])
+
+			err := vm.push(&object.Array{Elements: elements})
+			if err != nil {
+				return err
+			}
+		case code.OpMatchFail:
+			value := vm.pop()
+			return fmt.Errorf("non-exhaustive match: no pattern matched %s", value.String())
+		case code.OpDestructureFail:
+			value := vm.pop()
+			return fmt.Errorf("cannot destructure %s: value does not fit the pattern", value.String())
 		case code.OpPop:
 			vm.pop()
+		case code.OpDup:
+			err := vm.push(vm.stack[vm.sp-1])
+			if err != nil {
+				return err
+			}
 		}
 	}
 
 	return nil
 }
 
+// operand reads the next operand of the current instruction, which is
+// width bytes wide unless the instruction is wide, and moves ip behind it.
+func (vm *VM) operand(ins code.Instructions, width int, wide bool) int {
+	frame := vm.currentFrame()
+	operand, read := code.ReadOperand(ins[frame.ip+1:], width, wide)
+	frame.ip += read
+	return operand
+}
+
 func (vm *VM) pushClosure(constIndex, numFree int) error {
 	constant := vm.constants[constIndex]
 	function, ok := constant.(*object.CompiledFunction)
@@ -311,25 +463,11 @@ func (vm *VM) pushClosure(constIndex, numFree int) error {
 	return vm.push(closure)
 }
 
-func (vm *VM) executeCall() error {
-	ip := vm.currentFrame().ip
-
-	numArgs := code.ReadUint8(vm.currentFrame().Instructions()[ip+1:])
-	vm.currentFrame().ip++
-
-	callee := vm.stack[vm.sp-1-int(numArgs)]
+func (vm *VM) executeCall(numArgs int) error {
+	callee := vm.stack[vm.sp-1-numArgs]
 	switch callee := callee.(type) {
 	case *object.Closure:
-		cl := callee
-
-		if int(numArgs) != cl.Fn.NumParams {
-			return fmt.Errorf("wrong number of arguments: expected %d, got %d", cl.Fn.NumParams, numArgs)
-		}
-
-		functionFrame := NewFrame(cl, vm.sp-int(numArgs))
-		vm.pushFrame(functionFrame)
-
-		vm.sp += cl.Fn.NumLocals + 1
+		return vm.callClosure(callee, numArgs)
 	case *object.Builtin:
 		builtin := callee
 
@@ -353,6 +491,75 @@ func (vm *VM) executeCall() error {
 	return nil
 }
 
+// callClosure sets up the frame of a closure whose arguments are on top of
+// the stack. Omitted optional parameters are left to the default value
+// prologue of the function, surplus arguments of a variadic function are
+// collected into an array.
+func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
+	fn := cl.Fn
+
+	required := fn.NumParams - fn.NumDefaults
+	if numArgs < required || !fn.Variadic && numArgs > fn.NumParams {
+		return wrongNumberOfArguments(fn, numArgs)
+	}
+
+	basePointer := vm.sp - numArgs
+	if basePointer+fn.NumLocals >= StackSize {
+		return fmt.Errorf("stack overflow")
+	}
+
+	if fn.Variadic {
+		rest := make([]object.Object, 0)
+		if numArgs > fn.NumParams {
+			rest = append(rest, vm.stack[basePointer+fn.NumParams:vm.sp]...)
+		}
+		vm.stack[basePointer+fn.NumParams] = &object.Array{Elements: rest}
+	}
+
+	functionFrame := NewFrame(cl, basePointer)
+	functionFrame.numArgs = min(numArgs, fn.NumParams)
+	vm.pushFrame(functionFrame)
+
+	vm.sp = basePointer + fn.NumLocals
+	return nil
+}
+
+func wrongNumberOfArguments(fn *object.CompiledFunction, numArgs int) error {
+	required := fn.NumParams - fn.NumDefaults
+
+	switch {
+	case numArgs < required && (fn.NumDefaults > 0 || fn.Variadic):
+		return fmt.Errorf("wrong number of arguments: expected at least %d, got %d", required, numArgs)
+	case numArgs > fn.NumParams && fn.NumDefaults > 0:
+		return fmt.Errorf("wrong number of arguments: expected at most %d, got %d", fn.NumParams, numArgs)
+	default:
+		return fmt.Errorf("wrong number of arguments: expected %d, got %d", fn.NumParams, numArgs)
+	}
+}
+
+// executeSpreadCall concatenates the argument arrays on top of the stack and
+// calls the function below them with the elements as arguments.
+func (vm *VM) executeSpreadCall(numArrays int) error {
+	args := make([]object.Object, 0)
+	for _, value := range vm.stack[vm.sp-numArrays : vm.sp] {
+		arr, ok := value.(*object.Array)
+		if !ok {
+			return fmt.Errorf("type missmatch: cannot spread %s", value.Type())
+		}
+		args = append(args, arr.Elements...)
+	}
+	vm.sp -= numArrays
+
+	for _, arg := range args {
+		err := vm.push(arg)
+		if err != nil {
+			return err
+		}
+	}
+
+	return vm.executeCall(len(args))
+}
+
 func wrapNativeValue(value interface{}) object.Object {
 	switch value := value.(type) {
 	case bool:
@@ -438,6 +645,8 @@ func (vm *VM) executeComparisonOperation(op code.Opcode) error {
 		leftValue := left.(*object.String).Value
 		rightValue := right.(*object.String).Value
 		return vm.executeStringComparison(op, leftValue, rightValue)
+	case rightType == object.NULL || leftType == object.NULL:
+		return vm.executeNullComparison(op, left, right)
 	default:
 		return fmt.Errorf("operator %d not known for type %s, %s", op, leftType, rightType)
 	}
@@ -486,6 +695,21 @@ func (vm *VM) executeStringComparison(op code.Opcode, left string, right string)
 	return nil
 }
 
+// executeNullComparison compares null with any value. Null is only equal to
+// itself.
+func (vm *VM) executeNullComparison(op code.Opcode, left object.Object, right object.Object) error {
+	switch op {
+	case code.OpEqual:
+		vm.push(booleanObjectFromBool(left.Type() == right.Type()))
+	case code.OpNotEqual:
+		vm.push(booleanObjectFromBool(left.Type() != right.Type()))
+	default:
+		return fmt.Errorf("operator %d not known for type NULL", op)
+	}
+
+	return nil
+}
+
 func (vm *VM) executePrefixOperation(op code.Opcode) error {
 	right := vm.pop()
 
@@ -511,6 +735,52 @@ func (vm *VM) executePrefixOperation(op code.Opcode) error {
 	return nil
 }
 
+func getProperty(left object.Object, name *object.String) (object.Object, error) {
+	mapObj, ok := left.(*object.Map)
+	if !ok {
+		return nil, fmt.Errorf("type missmatch: cannot access property %s of %s", name.Value, left.Type())
+	}
+
+	value, ok := mapObj.Get(name)
+	if !ok {
+		return nil, fmt.Errorf("map has no key %q", name.Value)
+	}
+	return value, nil
+}
+
+// getOptionalProperty is like getProperty but results in null if the map
+// has no such key.
+func getOptionalProperty(left object.Object, name *object.String) (object.Object, error) {
+	mapObj, ok := left.(*object.Map)
+	if !ok {
+		return nil, fmt.Errorf("type missmatch: cannot access property %s of %s", name.Value, left.Type())
+	}
+
+	value, ok := mapObj.Get(name)
+	if !ok {
+		return NULL, nil
+	}
+	return value, nil
+}
+
+func matchesLiteral(value object.Object, literal object.Object) bool {
+	if literal == NULL {
+		return value == NULL
+	}
+
+	hashableValue, ok := value.(object.Hashable)
+	if !ok {
+		return false
+	}
+
+	hashableLiteral, ok := literal.(object.Hashable)
+	if !ok {
+		return false
+	}
+
+	return hashableValue.Hash() == hashableLiteral.Hash()
+}
+
 func booleanObjectFromBool(value bool) *object.Boolean {
 	if value {
 		return TRUE
@@ -3,10 +3,13 @@ package vm
 import (
 	"compiler/ast"
 	"compiler/compiler"
+	"compiler/evaluator"
 	"compiler/object"
 	"compiler/parser"
 	"compiler/scanner"
+	"errors"
 	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -65,6 +68,12 @@ func TestStringExpressions(t *testing.T) {
 	tests := []vmTestCase{
 		{`"string"`, "string"},
 		{`"str" + "ing"`, "string"},
+		{`let name = "you"; "Hello ${name}!"`, "Hello you!"},
+		{`let items = [1, 2]; "${len(items)} items"`, "2 items"},
+		{`"${1}${true}${[1, "a"]}"`, "1true[1, a]"},
+		{`let f = fn(x) { "<${x}>" }; "${f(f(1))}"`, "<<1>>"},
+		{`let m = {"k": 5}; "${m["k"] * 2}"`, "10"},
+		{`let a = 1; "\${a} is ${a}"`, "${a} is 1"},
 	}
 
 	runVmTests(t, tests)
@@ -82,6 +91,21 @@ func TestIfElseExpression(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func TestFoldedExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{`1 + 2 * 3 - 8 / 2`, 3},
+		{`-(1 - 4) >= 3 == !false`, true},
+		{`"a" + "b" == "ab"`, true},
+		{`null == false`, false},
+		{`let f = fn() { 5; if (false) { 1 } }; f()`, NULL},
+		{`let f = fn() { if (true) { let a = 2; a * 3 } }; f()`, 6},
+		{`let f = fn() { if (1 < 2) { return 1; } 2 }; f()`, 1},
+		{`let x = if (false) { 1 } else { let y = 2; y + 1 }; x`, 3},
+	}
+
+	runVmTests(t, tests)
+}
+
 func TestLetStatements(t *testing.T) {
 	tests := []vmTestCase{
 		{`let x = 10; x`, 10},
@@ -92,6 +116,36 @@ func TestLetStatements(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func TestConstStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{`const x = 10; x`, 10},
+		{`const x = "a"; const y = x + "b"; y`, "ab"},
+		{`const limit = 3; let f = fn(n) { if (n > limit) { limit } else { n } }; f(5)`, 3},
+		{`const add = fn(a, b) { a + b }; add(1, 2)`, 3},
+		{`const fact = fn(n) { if (n == 0) { 1 } else { n * fact(n - 1) } }; fact(4)`, 24},
+		{`const x = 1; let f = fn() { const x = 2; x }; f() + x`, 3},
+		{`const nothing = null; nothing ?? 1`, 1},
+		{`let f = fn() { const xs = [1, 2]; fn() { xs } }; f()()`, []int{1, 2}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestDestructuringLetStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{`let [a, b] = [1, 2]; a + b`, 3},
+		{`let [a, b, ...rest] = [1, 2, 3, 4]; rest`, []int{3, 4}},
+		{`let [a, ...rest] = [1]; rest`, []int{}},
+		{`let [_, [x, y]] = [0, [1, 2]]; x * y`, 2},
+		{`let {name, age} = {"name": "someone", "age": 42}; name`, "someone"},
+		{`let {"pos": [x, y]} = {"pos": [3, 4]}; x + y`, 7},
+		{`let f = fn(pair) { let [a, b] = pair; a - b }; f([5, 2])`, 3},
+		{`let f = fn(pair) { let [a, b] = pair; fn() { a * b } }; f([5, 2])()`, 10},
+	}
+
+	runVmTests(t, tests)
+}
+
 func TestArrayExpressions(t *testing.T) {
 	tests := []vmTestCase{
 		{`[1, 2, 3]`, []int{1, 2, 3}},
@@ -121,6 +175,45 @@ func TestIndexExpressions(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func TestPropertyExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{`let person = {"name": "someone", "age": 42}; person.age`, 42},
+		{`let a = {"b": {"c": "d"}}; a.b.c`, "d"},
+		{`let person = {"greet": fn(x) { "hello " + x }}; person.greet("you")`, "hello you"},
+		{`let xs = [{"n": 1}, {"n": 2}]; xs[1].n`, 2},
+		{`let counter = {"inc": fn(n) { n + 1 }}; let x = counter.inc(1); -counter.inc(x)`, -3},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestOptionalChainingAndCoalescing(t *testing.T) {
+	tests := []vmTestCase{
+		{`null`, NULL},
+		{`null == null`, true},
+		{`null != null`, false},
+		{`1 == null`, false},
+		{`null != "a"`, true},
+		{`let a = null; a?.b`, NULL},
+		{`let a = null; a?.b.c.d`, NULL},
+		{`let a = null; a?.[0]`, NULL},
+		{`let a = null; a?.f(1)`, NULL},
+		{`let a = {"b": {"c": 1}}; a?.b.c`, 1},
+		{`let a = {"b": 1}; a?.c`, NULL},
+		{`let a = {"b": null}; a.b?.c`, NULL},
+		{`let xs = [1, 2]; xs?.[1]`, 2},
+		{`let a = {"f": fn(x) { x * 2 }}; a?.f(2)`, 4},
+		{`null ?? 1`, 1},
+		{`2 ?? 1`, 2},
+		{`false ?? 1`, false},
+		{`null ?? null ?? 3`, 3},
+		{`let a = {"b": 1}; a?.c ?? "default"`, "default"},
+		{`let calls = fn() { 1 / 0 }; 1 ?? calls()`, 1},
+	}
+
+	runVmTests(t, tests)
+}
+
 func TestFunctions(t *testing.T) {
 	tests := []vmTestCase{
 		{`fn() { return 10 }()`, 10},
@@ -144,6 +237,74 @@ func TestFunctions(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func TestDefaultAndRestParameters(t *testing.T) {
+	tests := []vmTestCase{
+		{`let f = fn(a, b = 10) { a + b }; f(1)`, 11},
+		{`let f = fn(a, b = 10) { a + b }; f(1, 2)`, 3},
+		{`let f = fn(a, b = a * 2, c = a + b) { [a, b, c] }; f(1)`, []int{1, 2, 3}},
+		{`let f = fn(a, b = a * 2, c = a + b) { [a, b, c] }; f(1, 5)`, []int{1, 5, 6}},
+		{`let f = fn(...rest) { rest }; f()`, []int{}},
+		{`let f = fn(a, ...rest) { rest }; f(1, 2, 3)`, []int{2, 3}},
+		{`let f = fn(a, b = 2, ...rest) { [a, b, len(rest)] }; f(1)`, []int{1, 2, 0}},
+		{`let f = fn(a, b = 2, ...rest) { [a, b, len(rest)] }; f(1, 5, 6, 7)`, []int{1, 5, 2}},
+		{`let x = 5; let f = fn(a = x) { fn() { a } }; f()()`, 5},
+		{
+			`
+			let max = fn(first, ...rest) {
+				let loop = fn(best, xs) {
+					if (len(xs) == 0) { return best; }
+					let [head, ...tail] = xs;
+					if (head > best) { loop(head, tail) } else { loop(best, tail) }
+				};
+				loop(first, rest)
+			};
+			max(3, 9, 2, 7)
+			`,
+			9,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestSpreadCalls(t *testing.T) {
+	tests := []vmTestCase{
+		{`let add = fn(a, b, c) { a + b + c }; add(...[1, 2, 3])`, 6},
+		{`let add = fn(a, b, c) { a + b + c }; add(1, ...[2], 3)`, 6},
+		{`let add = fn(a, b, c) { a + b + c }; let xs = [2, 3]; add(...[1], ...xs)`, 6},
+		{`let f = fn(...rest) { rest }; f(...[], 1, ...[2, 3])`, []int{1, 2, 3}},
+		{`len(...[[1, 2]])`, 2},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestPipesAndLambdas(t *testing.T) {
+	tests := []vmTestCase{
+		{`[1, 2, 3] |> len`, 3},
+		{`let sub = fn(a, b) { a - b }; 10 |> sub(3)`, 7},
+		{`let double = x => x * 2; 1 |> double |> double`, 4},
+		{`[1] |> push(2) |> push(3)`, []int{1, 2, 3}},
+		{`let add = x => y => x + y; add(1)(2)`, 3},
+		{`let apply = fn(x, f) { f(x) }; 5 |> apply(x => x + 1)`, 6},
+		{`let f = fn(...rest) { rest }; 1 |> f(...[2, 3])`, []int{1, 2, 3}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestDeclaredOperators(t *testing.T) {
+	tests := []vmTestCase{
+		{`infixl 6 <+> = fn(a, b) { a * 10 + b }; 1 <+> 2 <+> 3`, 123},
+		{`infixr 6 <+> = fn(a, b) { a * 10 + b }; 1 <+> 2 <+> 3`, 33},
+		{`infixl 7 ** = fn(a, b) { if (b == 0) { 1 } else { a * (a ** (b - 1)) } }; 1 + 2 ** 3`, 9},
+		{`infixl 5 <> = fn(a, b) { a + b }; "a" <> "b" <> "c"`, "abc"},
+		{`infixr 1 & = fn(a, b) { push(b, a) }; let f = fn() { 1 & 2 & [] }; f()`, []int{2, 1}},
+	}
+
+	runVmTests(t, tests)
+}
+
 func TestLocalVariables(t *testing.T) {
 	tests := []vmTestCase{
 		{
@@ -195,6 +356,25 @@ func TestBuiltins(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func TestMapBuiltins(t *testing.T) {
+	tests := []vmTestCase{
+		{`let m = {"b": 1, "a": 2}; "${keys(m)}"`, "[b, a]"},
+		{`"${values({"b": 1, "a": 2})}"`, "[1, 2]"},
+		{`"${entries({"b": 1, 2: true})}"`, "[[b, 1], [2, true]]"},
+		{`keys({1: "x", true: "y"})[0] + 1`, 2},
+		{`has({"a": 1}, "a")`, true},
+		{`has({1: 1}, "1")`, false},
+		{`let m = {"a": 1}; let n = set(m, "b", 2); "${keys(m)} ${keys(n)}"`, "[a] [a, b]"},
+		{`let m = set({"a": 1, "b": 2}, "a", 3); "${entries(m)}"`, "[[a, 3], [b, 2]]"},
+		{`"${keys(delete({"a": 1, "b": 2, "c": 3}, "b"))}"`, "[a, c]"},
+		{`delete({"a": 1}, "x")["a"]`, 1},
+		{`isEmpty(delete({"a": 1}, "a"))`, true},
+		{`"${entries(merge({"a": 1, "b": 2}, {"c": 3, "a": 4}))}"`, "[[a, 4], [b, 2], [c, 3]]"},
+	}
+
+	runVmTests(t, tests)
+}
+
 func TestClosures(t *testing.T) {
 	tests := []vmTestCase{
 		{
@@ -243,11 +423,137 @@ func TestRecursiveFunctions(t *testing.T) {
 			`,
 			expected: 0,
 		},
+		{
+			input: `
+			let g = fn() {
+				let fact = n => if (n < 2) { 1 } else { n * fact(n - 1) };
+				fact(5)
+			};
+			g();
+			`,
+			expected: 120,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestMatchExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{`match (2) { 1 => "one", 2 => "two", _ => "many" }`, "two"},
+		{`match (5) { 1 => "one", 2 => "two", _ => "many" }`, "many"},
+		{`match (-1) { -1 => true, _ => false }`, true},
+		{`match ("1") { 1 => "int", "1" => "string" }`, "string"},
+		{`match (true) { false => 0, true => 1 }`, 1},
+		{`match (3) { n if n > 5 => 0, n => n * 2 }`, 6},
+		{`match ([1, 2, 3]) { [] => 0, [a] => a, [a, b, ...rest] => a + b + len(rest) }`, 4},
+		{`match ([1, 2]) { [a, b, ...rest] => len(rest) }`, 0},
+		{`match ([1, 2]) { [a] => 0, [_, [b]] => b, [_, b] => b * 10 }`, 20},
+		{`match ([1, [2]]) { [_, [b]] => b }`, 2},
+		{`match ([1, 2, 3]) { [1, ...rest] => rest }`, []int{2, 3}},
+		{`match ({"name": "x", "age": 3}) { {"age": 4} => 0, {name, "age": age} => age }`, 3},
+		{`match ({"a": [1, 2]}) { {"a": [_, b]} => b }`, 2},
+		{`match (1) { {} => 0, [] => 1, _ => 2 }`, 2},
+		{`match (null) { 0 => "zero", null => "null", _ => "other" }`, "null"},
+		{`match ({}["a"]) { null => 1, _ => 2 }`, 1},
+		{`match (0) { null => 1, _ => 2 }`, 2},
+		{`match ([null]) { [null] => true }`, true},
+		{
+			`
+			let describe = fn(x) {
+				match (x) {
+					0 => "zero",
+					[] => "empty",
+					[_, ...rest] => describe(rest),
+					_ => "other",
+				}
+			};
+			describe([1, 2, 3]);
+			`,
+			"empty",
+		},
+		{
+			`
+			let offset = 10;
+			let add = fn(xs) { match (xs) { [x] => fn(y) { x + y + offset } } };
+			add([1])(2);
+			`,
+			13,
+		},
+		{`let x = 1; match (2) { x => x }; x`, 1},
+		{`match (1) { 1 => match (2) { 2 => 3 } }`, 3},
 	}
 
 	runVmTests(t, tests)
 }
 
+func TestExpandedMacros(t *testing.T) {
+	tests := []vmTestCase{
+		{`let unless = macro(c, a, b) { quote(if (!(unquote(c))) { unquote(a) } else { unquote(b) }) }; unless(1 > 2, 10, 20)`, 10},
+		{`let x = 10; let double = macro(a) { quote(if (true) { let x = unquote(a); x * 2 } else { 0 }) }; double(x + 1) + x`, 32},
+		{`let square = macro(a) { quote(fn(x) { x * x }(unquote(a))) }; let f = fn(x) { square(x + 1) }; f(2)`, 9},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		env := evaluator.NewEnvironment()
+		evaluator.DefineMacros(program, env)
+		expanded, err := evaluator.ExpandMacros(program, env)
+		if err != nil {
+			t.Fatalf("macro expansion error: %s", err)
+		}
+
+		comp := compiler.New()
+		err = comp.Compile(expanded)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+
+		testExpectedObject(t, tt.expected, vm.LastPopped())
+	}
+}
+
+func TestDecodedBytecode(t *testing.T) {
+	tests := []vmTestCase{
+		{`let fib = fn(n) { if (n < 2) { return n } fib(n - 1) + fib(n - 2) }; fib(10)`, 55},
+		{`let m = {"a": [1, 2], "b": "c"}; m.b + "${len(m.a)}"`, "c2"},
+		{`let f = fn(a, b = 2, ...rest) { a + b + len(rest) }; f(1, 2, 3, 4)`, 5},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		err := comp.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		encoded, err := compiler.EncodeBytecode(comp.Bytecode())
+		if err != nil {
+			t.Fatalf("encode error: %s", err)
+		}
+
+		decoded, err := compiler.DecodeBytecode(encoded)
+		if err != nil {
+			t.Fatalf("decode error: %s", err)
+		}
+
+		vm := New(decoded)
+		err = vm.Run()
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+
+		testExpectedObject(t, tt.expected, vm.LastPopped())
+	}
+}
+
 func TestErrorHandling(t *testing.T) {
 	tests := []vmTestCase{
 		{
@@ -282,11 +588,200 @@ func TestErrorHandling(t *testing.T) {
 			`,
 			expected: fmt.Errorf("wrong number of arguments: expected 1. Got 2"),
 		},
+		{
+			input: `
+			match (3) { 1 => 1, 2 => 2 }
+			`,
+			expected: fmt.Errorf("non-exhaustive match: no pattern matched 3"),
+		},
+		{
+			input: `
+			fn(a, b = 1) { a }()
+			`,
+			expected: fmt.Errorf("wrong number of arguments: expected at least 1, got 0"),
+		},
+		{
+			input: `
+			fn(a, b = 1) { a }(1, 2, 3)
+			`,
+			expected: fmt.Errorf("wrong number of arguments: expected at most 2, got 3"),
+		},
+		{
+			input: `
+			fn(a, ...rest) { a }()
+			`,
+			expected: fmt.Errorf("wrong number of arguments: expected at least 1, got 0"),
+		},
+		{
+			input: `
+			let person = {"name": "someone"};
+			person.age
+			`,
+			expected: fmt.Errorf(`map has no key "age"`),
+		},
+		{
+			input: `
+			let a = {"b": null};
+			a?.b.c
+			`,
+			expected: fmt.Errorf("type missmatch: cannot access property c of NULL"),
+		},
+		{
+			input: `
+			1?.a
+			`,
+			expected: fmt.Errorf("type missmatch: cannot access property a of INT"),
+		},
+		{
+			input: `
+			[1].length
+			`,
+			expected: fmt.Errorf("type missmatch: cannot access property length of ARRAY"),
+		},
+		{
+			input: `
+			fn(a) { a }(...1)
+			`,
+			expected: fmt.Errorf("type missmatch: cannot spread INT"),
+		},
+		{
+			input: `
+			let [a, b] = [1, 2, 3];
+			`,
+			expected: fmt.Errorf("cannot destructure [1, 2, 3]: value does not fit the pattern"),
+		},
+		{
+			input: `
+			let {name} = {"age": 1};
+			`,
+			expected: fmt.Errorf("cannot destructure map: value does not fit the pattern"),
+		},
+		{
+			input:    `keys([1])`,
+			expected: fmt.Errorf("type missmatch: first argument of keys must be MAP. Got ARRAY"),
+		},
+		{
+			input:    `has({}, [1])`,
+			expected: fmt.Errorf("type missmatch: cannot use ARRAY as key for hashmap"),
+		},
+		{
+			input:    `merge({}, 1)`,
+			expected: fmt.Errorf("type missmatch: second argument of merge must be MAP. Got INT"),
+		},
+		{
+			input:    `set({}, 1)`,
+			expected: fmt.Errorf("wrong number of arguments: expected 3. Got 2"),
+		},
 	}
 
 	testVmError(t, tests)
 }
 
+func TestWideOperands(t *testing.T) {
+	// more constants and globals than fit two bytes, with jumps past the
+	// first 65536 bytes of instructions
+	var globals strings.Builder
+	for i := 0; i < 70000; i++ {
+		fmt.Fprintf(&globals, "let %s = %d;\n", name("g", i), i)
+	}
+	fmt.Fprintf(&globals, "if (%s == 1) { %s } else { 0 }", name("g", 1), name("g", 69999))
+
+	// more parameters, arguments, locals and free variables than fit a byte
+	params := make([]string, 300)
+	args := make([]string, 300)
+	for i := range params {
+		params[i] = name("a", i)
+		args[i] = fmt.Sprint(i)
+	}
+	call := fmt.Sprintf("let f = fn(%s) { let x = %s + %s; x }; f(%s)",
+		strings.Join(params, ", "), params[0], params[299], strings.Join(args, ", "))
+
+	var closure strings.Builder
+	closure.WriteString("let outer = fn() {")
+	for i := 0; i < 300; i++ {
+		fmt.Fprintf(&closure, "let %s = %d; ", name("v", i), i)
+	}
+	closure.WriteString("fn() { 0")
+	for i := 0; i < 300; i++ {
+		fmt.Fprintf(&closure, " + %s", name("v", i))
+	}
+	closure.WriteString(" } }; outer()()")
+
+	tests := []vmTestCase{
+		{globals.String(), 69999},
+		{call, 299},
+		{closure.String(), 44850},
+	}
+
+	runVmTests(t, tests)
+}
+
+// name returns a distinct identifier for every i, identifiers cannot
+// contain digits.
+func name(prefix string, i int) string {
+	out := []byte(prefix)
+	for {
+		out = append(out, byte('a'+i%26))
+		i /= 26
+		if i == 0 {
+			return string(out)
+		}
+	}
+}
+
+func TestStackTrace(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`let inner = fn(x) { x + true };
+let outer = fn() { inner(1) };
+let y = 2;
+let call = f => f();
+call(outer)`,
+			"\tat inner (1:23)\n\tat outer (2:25)\n\tat call (4:18)\n\tat <main> (5:5)\n",
+		},
+		{
+			`let f = fn(n) { if (n == 0) { n + true } else { f(n - 1) } };
+f(3)`,
+			"\tat f (1:33)\n\tat f (1:50)\n\t... 2 more frames\n\tat <main> (2:2)\n",
+		},
+	}
+
+	for _, tt := range tests {
+		for _, options := range []compiler.Options{compiler.DefaultOptions, {}} {
+			comp := compiler.NewWithOptions(options)
+			err := comp.Compile(parse(tt.input))
+			if err != nil {
+				t.Fatalf("compiler error: %s", err)
+			}
+
+			// the line table survives the bytecode file
+			encoded, err := compiler.EncodeBytecode(comp.Bytecode())
+			if err != nil {
+				t.Fatalf("encode error: %s", err)
+			}
+			decoded, err := compiler.DecodeBytecode(encoded)
+			if err != nil {
+				t.Fatalf("decode error: %s", err)
+			}
+
+			for _, bytecode := range []*compiler.Bytecode{comp.Bytecode(), decoded} {
+				err = New(bytecode).Run()
+
+				var runtimeErr *RuntimeError
+				if !errors.As(err, &runtimeErr) {
+					t.Fatalf("expected a runtime error, got %v", err)
+				}
+				if runtimeErr.StackTrace() != tt.expected {
+					t.Errorf("wrong stack trace.\nwant=%q\ngot= %q", tt.expected, runtimeErr.StackTrace())
+				}
+			}
+		}
+	}
+}
+
 func testVmError(t *testing.T, tests []vmTestCase) {
 	t.Helper()
 
@@ -316,24 +811,27 @@ func testVmError(t *testing.T, tests []vmTestCase) {
 func runVmTests(t *testing.T, tests []vmTestCase) {
 	t.Helper()
 
-	for _, tt := range tests {
-		program := parse(tt.input)
+	// optimizations must not change the results
+	for _, options := range []compiler.Options{compiler.DefaultOptions, {}} {
+		for _, tt := range tests {
+			program := parse(tt.input)
 
-		comp := compiler.New()
-		err := comp.Compile(program)
-		if err != nil {
-			t.Fatalf("compiler error: %s", err)
-		}
+			comp := compiler.NewWithOptions(options)
+			err := comp.Compile(program)
+			if err != nil {
+				t.Fatalf("compiler error: %s", err)
+			}
 
-		vm := New(comp.Bytecode())
-		err = vm.Run()
-		if err != nil {
-			t.Fatalf("vm error: %s", err)
-		}
+			vm := New(comp.Bytecode())
+			err = vm.Run()
+			if err != nil {
+				t.Fatalf("vm error: %s", err)
+			}
 
-		stackElem := vm.LastPopped()
+			stackElem := vm.LastPopped()
 
-		testExpectedObject(t, tt.expected, stackElem)
+			testExpectedObject(t, tt.expected, stackElem)
+		}
 	}
 }
 
@@ -466,7 +964,12 @@ func testMapObject(expected map[string]int, actual object.Object) error {
 			actual, actual)
 	}
 
-	for key, value := range result.Entries {
+	if result.Len() != len(expected) {
+		return fmt.Errorf("wrong number of pairs. got=%d, want=%d", result.Len(), len(expected))
+	}
+
+	for _, pair := range result.Pairs() {
+		key, value := pair.Key.Hash(), pair.Value
 		expectedValue, ok := expected[key]
 		if !ok {
 			return fmt.Errorf("key does not exist. got=%s", key)